@@ -1,23 +1,65 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"zana-speech-backend/internal/config"
 	"zana-speech-backend/internal/server"
 )
 
+// shutdownTimeout is how long in-flight requests get to finish after SIGTERM.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// JSON logs; the standard log package is routed through the same handler
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
 	s, err := server.NewServer(cfg)
 	if err != nil {
 		log.Fatalf("failed to create server: %v", err)
 		os.Exit(1)
 	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			slog.Error("error closing server", "error", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	addr := ":" + cfg.Port
-	fmt.Printf("GITTER server listening on %s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, s.Router()))
+	srv := &http.Server{Addr: addr, Handler: s.Router()}
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("GITTER server listening", "addr", addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			_ = s.Close()
+			log.Fatalf("server error: %v", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("graceful shutdown failed", "error", err)
+	}
 }
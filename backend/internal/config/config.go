@@ -1,9 +1,12 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,13 +16,29 @@ type Config struct {
 	OpenAIAPIKey  string
 	AllowedOrigin string
 	Model         string
-	TTSModel      string
-	STTModel      string
-	ElevenAPIKey  string
-	ElevenVoiceID string
-	ElevenModel   string
+	// Chat models tried in order when Model is overloaded (429) or unavailable (404)
+	ModelFallbacks []string
+	TTSModel       string
+	STTModel       string
+	ElevenAPIKey   string
+	ElevenVoiceID  string
+	ElevenModel    string
+	// OpenAI voice used when TTS falls back to (or is forced to) OpenAI
+	OpenAITTSVoice string
+	// OpenAI endpoint overrides for proxies, a specific organization or Azure OpenAI.
+	// OpenAIAPIType is openai or azure; Azure maps model names to deployment names
+	// through OpenAIAzureDeployments and needs OpenAIBaseURL
+	OpenAIBaseURL          string
+	OpenAIOrgID            string
+	OpenAIAPIType          string
+	OpenAIAPIVersion       string
+	OpenAIAzureDeployments map[string]string
+	// Default Whisper prompt hinting domain vocabulary; a request's prompt field overrides it
+	STTPrompt string
 	// Database
 	DatabaseURL string
+	// Redis for shared session state across replicas; in-memory when empty
+	RedisURL string
 	// GitHub OAuth
 	GitHubClientID     string
 	GitHubClientSecret string
@@ -28,13 +47,75 @@ type Config struct {
 	GitHubScopes       []string
 	// Optional static GitHub token (Personal Access Token) for local testing
 	GitHubToken string
+	// GitHub App installation auth; GitHubAppPrivateKey holds the PEM itself (literal
+	// \n escapes allowed for one-line env vars) and GitHubAppPrivateKeyFile a path to it
+	GitHubAppID             string
+	GitHubAppInstallationID int64
+	GitHubAppPrivateKey     string
+	GitHubAppPrivateKeyFile string
+	// Shared secret GitHub signs webhook deliveries with; empty disables /api/github/webhook
+	GitHubWebhookSecret string
 	// Frontend URL for OAuth callback redirect
 	FrontendURL string
 	// GitHub MCP
 	GitHubMCPAddress string
 	GitHubMCPEnabled bool
+	// REST API base; set for GitHub Enterprise Server (e.g. https://ghe.example.com/api/v3)
+	GitHubAPIBaseURL string
+	// User-Agent sent on every GitHub API request
+	GitHubUserAgent string
+	// Maximum files fetched when paginating a PR diff
+	GitHubMaxDiffFiles int
+	// Maximum comments fetched when paginating a PR's comments
+	GitHubMaxComments int
+	// PR statuses are cached per head commit for GitHubStatusCacheTTL, at most
+	// GitHubStatusCacheSize of them; either <= 0 disables the cache
+	GitHubStatusCacheSize int
+	GitHubStatusCacheTTL  time.Duration
+	// How many PR comments a reply reads out before saying "and N more"; 0 only counts them
+	SpokenCommentLimit int
+	// Chat history trimming: count keeps the last messages, tokens keeps what fits
+	// HistoryTokenBudget estimated tokens (system prompt included)
+	HistoryTrim        string
+	HistoryTokenBudget int
+	// Request size limits: chat messages over MaxMessageLength characters and voice
+	// uploads over MaxAudioBytes are rejected with 413
+	MaxMessageLength int
+	MaxAudioBytes    int64
 	// Default repo owner when user provides bare repo name
 	DefaultRepoOwner string
+	// Repos intents may act on, as owner/repo or owner/*; empty allows every repo
+	RepoAllowlist []string
+	// In-memory session state idle longer than this is evicted by the janitor
+	SessionIdleTTL time.Duration
+	// Stored GitHub logins not updated for this long are purged; <= 0 keeps them
+	GitHubAuthMaxAge time.Duration
+	// Classified intents below this confidence are confirmed with the user first
+	IntentConfidenceThreshold float64
+	// Intent classifier backend: llm or rules
+	IntentClassifier string
+	// merge_pr and merge_approved ask the user to confirm before merging
+	RequireMergeConfirmation bool
+	// merge_pr checks status first and refuses PRs with failing checks or conflicts unless forced
+	MergePrecheck bool
+	// merge_pr deletes the PR's head branch after merging unless the request says otherwise
+	DeleteBranchOnMerge bool
+	// Session cookie; CookieDomain lets subdomains share it, CookieSecure is auto|true|false
+	SessionCookieName string
+	SessionTTL        time.Duration
+	CookieDomain      string
+	CookieSecure      string
+	// Per-session request rate limit; RateLimitRPS <= 0 disables it
+	RateLimitRPS   float64
+	RateLimitBurst int
+	// Request budgets: chat turns (classification plus GitHub calls), streamed
+	// completions, voice uploads (transcription and reply), single GitHub API calls
+	// and one intent classification
+	ChatTimeout     time.Duration
+	StreamTimeout   time.Duration
+	VoiceTimeout    time.Duration
+	GitHubTimeout   time.Duration
+	ClassifyTimeout time.Duration
 }
 
 func Load() Config {
@@ -45,11 +126,14 @@ func Load() Config {
 		AllowedOrigin:      getEnvDefault("ALLOWED_ORIGIN", "*"),
 		Model:              getEnvDefault("OPENAI_MODEL", "gpt-4o-mini"),
 		TTSModel:           getEnvDefault("OPENAI_TTS_MODEL", "tts-1"),
+		OpenAITTSVoice:     getEnvDefault("OPENAI_TTS_VOICE", "alloy"),
 		STTModel:           getEnvDefault("OPENAI_STT_MODEL", "whisper-1"),
+		STTPrompt:          getEnvDefault("OPENAI_STT_PROMPT", "GitHub, pull request, PR, repository, repo, merge, squash, rebase, review, approve, draft, branch, commit"),
 		ElevenAPIKey:       os.Getenv("ELEVEN_API_KEY"),
 		ElevenVoiceID:      os.Getenv("ELEVEN_VOICE_ID"),
 		ElevenModel:        getEnvDefault("ELEVEN_MODEL_ID", "eleven_multilingual_v2"),
 		DatabaseURL:        os.Getenv("DB_URL"),
+		RedisURL:           os.Getenv("REDIS_URL"),
 		GitHubClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 		GitHubClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
 		GitHubRedirectURL:  getEnvDefault("GITHUB_REDIRECT_URL", "http://localhost:8080/api/github/callback"),
@@ -59,14 +143,158 @@ func Load() Config {
 		FrontendURL:        getEnvDefault("FRONTEND_URL", "http://localhost:5173"),
 		GitHubMCPAddress:   os.Getenv("GITHUB_MCP_ADDRESS"),
 		GitHubMCPEnabled:   getEnvBoolDefault("GITHUB_MCP_ENABLED", false),
+		GitHubAPIBaseURL:   getEnvDefault("GITHUB_API_BASE_URL", "https://api.github.com"),
+		GitHubUserAgent:    getEnvDefault("GITHUB_USER_AGENT", "gitter"),
+		GitHubMaxDiffFiles: getEnvIntDefault("GITHUB_MAX_DIFF_FILES", 3000),
 		DefaultRepoOwner:   os.Getenv("DEFAULT_REPO_OWNER"),
+		RepoAllowlist:      getEnvListDefault("REPO_ALLOWLIST", nil),
+		SessionIdleTTL:     getEnvDurationDefault("SESSION_IDLE_TTL", 24*time.Hour),
+
+		GitHubMaxComments:         getEnvIntDefault("GITHUB_MAX_COMMENTS", 500),
+		GitHubStatusCacheSize:     getEnvIntDefault("GITHUB_STATUS_CACHE_SIZE", 256),
+		GitHubStatusCacheTTL:      getEnvDurationDefault("GITHUB_STATUS_CACHE_TTL", time.Minute),
+		SpokenCommentLimit:        getEnvIntDefault("SPOKEN_COMMENT_LIMIT", 3),
+		HistoryTrim:               strings.ToLower(getEnvDefault("HISTORY_TRIM", "count")),
+		HistoryTokenBudget:        getEnvIntDefault("HISTORY_TOKEN_BUDGET", 4000),
+		MaxMessageLength:          getEnvIntDefault("MAX_MESSAGE_LENGTH", 4000),
+		MaxAudioBytes:             int64(getEnvIntDefault("MAX_AUDIO_BYTES", 25<<20)),
+		GitHubAuthMaxAge:          getEnvDurationDefault("GITHUB_AUTH_MAX_AGE", 30*24*time.Hour),
+		IntentConfidenceThreshold: getEnvFloatDefault("INTENT_CONFIDENCE_THRESHOLD", 0.5),
+		IntentClassifier:          strings.ToLower(getEnvDefault("INTENT_CLASSIFIER", "llm")),
+		RequireMergeConfirmation:  getEnvBoolDefault("REQUIRE_MERGE_CONFIRMATION", true),
+		MergePrecheck:             getEnvBoolDefault("MERGE_PRECHECK", true),
+		DeleteBranchOnMerge:       getEnvBoolDefault("DELETE_BRANCH_ON_MERGE", false),
+		SessionCookieName:         getEnvDefault("SESSION_COOKIE_NAME", "zana_session"),
+		SessionTTL:                getEnvDurationDefault("SESSION_TTL", 24*time.Hour),
+		CookieDomain:              os.Getenv("COOKIE_DOMAIN"),
+		CookieSecure:              strings.ToLower(getEnvDefault("COOKIE_SECURE", "auto")),
+		RateLimitRPS:              getEnvFloatDefault("RATE_LIMIT_RPS", 2),
+		RateLimitBurst:            getEnvIntDefault("RATE_LIMIT_BURST", 10),
+		ChatTimeout:               getEnvDurationDefault("CHAT_TIMEOUT", 20*time.Second),
+		StreamTimeout:             getEnvDurationDefault("STREAM_TIMEOUT", 120*time.Second),
+		VoiceTimeout:              getEnvDurationDefault("VOICE_TIMEOUT", 180*time.Second),
+		GitHubTimeout:             getEnvDurationDefault("GITHUB_TIMEOUT", 20*time.Second),
+		ClassifyTimeout:           getEnvDurationDefault("CLASSIFY_TIMEOUT", 10*time.Second),
+		OpenAIBaseURL:             strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/"),
+		OpenAIOrgID:               os.Getenv("OPENAI_ORG_ID"),
+		OpenAIAPIType:             strings.ToLower(getEnvDefault("OPENAI_API_TYPE", "openai")),
+		OpenAIAPIVersion:          os.Getenv("OPENAI_API_VERSION"),
+		OpenAIAzureDeployments:    getEnvMap("OPENAI_AZURE_DEPLOYMENTS"),
+		ModelFallbacks:            getEnvListDefault("OPENAI_MODEL_FALLBACKS", nil),
+		GitHubAppID:               strings.TrimSpace(os.Getenv("GITHUB_APP_ID")),
+		GitHubAppInstallationID:   int64(getEnvIntDefault("GITHUB_APP_INSTALLATION_ID", 0)),
+		GitHubAppPrivateKey:       strings.ReplaceAll(os.Getenv("GITHUB_APP_PRIVATE_KEY"), `\n`, "\n"),
+		GitHubAppPrivateKeyFile:   os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"),
+		GitHubWebhookSecret:       os.Getenv("GITHUB_WEBHOOK_SECRET"),
 	}
 	if cfg.OpenAIAPIKey == "" {
-		log.Println("warning: OPENAI_API_KEY is not set; API calls will fail until provided")
+		slog.Warn("OPENAI_API_KEY is not set; API calls will fail until provided")
 	}
 	return cfg
 }
 
+// Validate checks settings that depend on each other and reports every problem at once.
+func (c Config) Validate() error {
+	var problems []string
+	if c.GitHubClientID != "" {
+		if c.GitHubClientSecret == "" {
+			problems = append(problems, "GITHUB_CLIENT_SECRET is required when GITHUB_CLIENT_ID is set")
+		}
+		if c.GitHubRedirectURL == "" {
+			problems = append(problems, "GITHUB_REDIRECT_URL is required when GITHUB_CLIENT_ID is set")
+		}
+	}
+	if c.GitHubAppID != "" {
+		if c.GitHubAppInstallationID <= 0 {
+			problems = append(problems, "GITHUB_APP_INSTALLATION_ID is required when GITHUB_APP_ID is set")
+		}
+		if c.GitHubAppPrivateKey == "" && c.GitHubAppPrivateKeyFile == "" {
+			problems = append(problems, "GITHUB_APP_PRIVATE_KEY or GITHUB_APP_PRIVATE_KEY_FILE is required when GITHUB_APP_ID is set")
+		}
+	}
+	if c.ElevenVoiceID != "" && c.ElevenAPIKey == "" {
+		problems = append(problems, "ELEVEN_API_KEY is required when ELEVEN_VOICE_ID is set")
+	}
+	if n, err := strconv.Atoi(c.Port); err != nil || n <= 0 || n > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be a number between 1 and 65535, got %q", c.Port))
+	}
+	switch c.CookieSecure {
+	case "auto", "true", "false":
+	default:
+		problems = append(problems, fmt.Sprintf("COOKIE_SECURE must be auto, true or false, got %q", c.CookieSecure))
+	}
+	if c.SessionTTL <= 0 {
+		problems = append(problems, "SESSION_TTL must be positive")
+	}
+	if c.IntentConfidenceThreshold < 0 || c.IntentConfidenceThreshold > 1 {
+		problems = append(problems, fmt.Sprintf("INTENT_CONFIDENCE_THRESHOLD must be between 0 and 1, got %g", c.IntentConfidenceThreshold))
+	}
+	if c.SpokenCommentLimit < 0 {
+		problems = append(problems, fmt.Sprintf("SPOKEN_COMMENT_LIMIT must not be negative, got %d", c.SpokenCommentLimit))
+	}
+	if c.MaxMessageLength <= 0 {
+		problems = append(problems, fmt.Sprintf("MAX_MESSAGE_LENGTH must be positive, got %d", c.MaxMessageLength))
+	}
+	if c.MaxAudioBytes <= 0 {
+		problems = append(problems, fmt.Sprintf("MAX_AUDIO_BYTES must be positive, got %d", c.MaxAudioBytes))
+	}
+	switch c.HistoryTrim {
+	case "count":
+	case "tokens":
+		if c.HistoryTokenBudget <= 0 {
+			problems = append(problems, fmt.Sprintf("HISTORY_TOKEN_BUDGET must be positive when HISTORY_TRIM is tokens, got %d", c.HistoryTokenBudget))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("HISTORY_TRIM must be count or tokens, got %q", c.HistoryTrim))
+	}
+	switch c.OpenAIAPIType {
+	case "openai":
+	case "azure":
+		if c.OpenAIBaseURL == "" {
+			problems = append(problems, "OPENAI_BASE_URL is required when OPENAI_API_TYPE is azure")
+		}
+		if _, ok := c.OpenAIAzureDeployments[c.Model]; !ok {
+			problems = append(problems, fmt.Sprintf("OPENAI_AZURE_DEPLOYMENTS must map OPENAI_MODEL %q to a deployment when OPENAI_API_TYPE is azure", c.Model))
+		}
+		for _, m := range c.ModelFallbacks {
+			if _, ok := c.OpenAIAzureDeployments[m]; !ok {
+				problems = append(problems, fmt.Sprintf("OPENAI_AZURE_DEPLOYMENTS must map fallback model %q to a deployment when OPENAI_API_TYPE is azure", m))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("OPENAI_API_TYPE must be openai or azure, got %q", c.OpenAIAPIType))
+	}
+	for _, entry := range c.RepoAllowlist {
+		owner, name, ok := strings.Cut(entry, "/")
+		if !ok || owner == "" || name == "" || owner == "*" || strings.Contains(name, "/") {
+			problems = append(problems, fmt.Sprintf("REPO_ALLOWLIST entries must be owner/repo or owner/*, got %q", entry))
+		}
+	}
+	switch c.IntentClassifier {
+	case "llm", "rules":
+	default:
+		problems = append(problems, fmt.Sprintf("INTENT_CLASSIFIER must be llm or rules, got %q", c.IntentClassifier))
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"CHAT_TIMEOUT", c.ChatTimeout},
+		{"STREAM_TIMEOUT", c.StreamTimeout},
+		{"VOICE_TIMEOUT", c.VoiceTimeout},
+		{"GITHUB_TIMEOUT", c.GitHubTimeout},
+		{"CLASSIFY_TIMEOUT", c.ClassifyTimeout},
+	} {
+		if t.d <= 0 {
+			problems = append(problems, t.name+" must be positive")
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
 func getEnvDefault(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -91,6 +319,54 @@ func getEnvListDefault(key string, def []string) []string {
 	return def
 }
 
+// getEnvMap parses "key=value,key2=value2"; entries without "=" are skipped with a warning.
+func getEnvMap(key string) map[string]string {
+	out := map[string]string{}
+	for _, p := range strings.Split(os.Getenv(key), ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(p, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			slog.Warn("ignoring entry; expected key=value", "key", key, "entry", p)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func getEnvIntDefault(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n
+		}
+		slog.Warn("not a number; using default", "key", key, "value", v, "default", def)
+	}
+	return def
+}
+
+func getEnvFloatDefault(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f
+		}
+		slog.Warn("not a number; using default", "key", key, "value", v, "default", def)
+	}
+	return def
+}
+
+func getEnvDurationDefault(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(strings.TrimSpace(v)); err == nil {
+			return d
+		}
+		slog.Warn("not a duration (e.g. 30s, 15m); using default", "key", key, "value", v, "default", def)
+	}
+	return def
+}
+
 func getEnvBoolDefault(key string, def bool) bool {
 	if v := os.Getenv(key); v != "" {
 		switch strings.ToLower(strings.TrimSpace(v)) {
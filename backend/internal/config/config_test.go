@@ -0,0 +1,147 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig is the smallest configuration Validate accepts.
+func validConfig() Config {
+	return Config{
+		Port:                      "8080",
+		Model:                     "gpt-4o-mini",
+		CookieSecure:              "auto",
+		SessionTTL:                24 * time.Hour,
+		IntentConfidenceThreshold: 0.5,
+		SpokenCommentLimit:        3,
+		MaxMessageLength:          4000,
+		MaxAudioBytes:             25 << 20,
+		HistoryTrim:               "count",
+		OpenAIAPIType:             "openai",
+		IntentClassifier:          "llm",
+		ChatTimeout:               20 * time.Second,
+		StreamTimeout:             120 * time.Second,
+		VoiceTimeout:              180 * time.Second,
+		GitHubTimeout:             20 * time.Second,
+		ClassifyTimeout:           10 * time.Second,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		// want is a fragment of the reported problem, "" when the config is valid
+		want string
+	}{
+		{name: "defaults", modify: func(c *Config) {}},
+		{name: "oauth without secret", modify: func(c *Config) { c.GitHubClientID = "id"; c.GitHubRedirectURL = "http://x/cb" }, want: "GITHUB_CLIENT_SECRET is required"},
+		{name: "oauth without redirect", modify: func(c *Config) { c.GitHubClientID = "id"; c.GitHubClientSecret = "s" }, want: "GITHUB_REDIRECT_URL is required"},
+		{name: "oauth complete", modify: func(c *Config) {
+			c.GitHubClientID, c.GitHubClientSecret, c.GitHubRedirectURL = "id", "s", "http://x/cb"
+		}},
+		{name: "app without installation", modify: func(c *Config) { c.GitHubAppID = "1"; c.GitHubAppPrivateKey = "key" }, want: "GITHUB_APP_INSTALLATION_ID is required"},
+		{name: "app without key", modify: func(c *Config) { c.GitHubAppID = "1"; c.GitHubAppInstallationID = 2 }, want: "GITHUB_APP_PRIVATE_KEY or GITHUB_APP_PRIVATE_KEY_FILE"},
+		{name: "app with key file", modify: func(c *Config) {
+			c.GitHubAppID, c.GitHubAppInstallationID, c.GitHubAppPrivateKeyFile = "1", 2, "app.pem"
+		}},
+		{name: "voice without key", modify: func(c *Config) { c.ElevenVoiceID = "v" }, want: "ELEVEN_API_KEY is required"},
+		{name: "port not a number", modify: func(c *Config) { c.Port = "http" }, want: `PORT must be a number between 1 and 65535, got "http"`},
+		{name: "port zero", modify: func(c *Config) { c.Port = "0" }, want: "PORT must be"},
+		{name: "port too large", modify: func(c *Config) { c.Port = "65536" }, want: "PORT must be"},
+		{name: "cookie secure", modify: func(c *Config) { c.CookieSecure = "yes" }, want: `COOKIE_SECURE must be auto, true or false, got "yes"`},
+		{name: "session ttl", modify: func(c *Config) { c.SessionTTL = 0 }, want: "SESSION_TTL must be positive"},
+		{name: "confidence below zero", modify: func(c *Config) { c.IntentConfidenceThreshold = -0.1 }, want: "INTENT_CONFIDENCE_THRESHOLD must be between 0 and 1, got -0.1"},
+		{name: "confidence above one", modify: func(c *Config) { c.IntentConfidenceThreshold = 1.5 }, want: "INTENT_CONFIDENCE_THRESHOLD"},
+		{name: "confidence bounds are inclusive", modify: func(c *Config) { c.IntentConfidenceThreshold = 1 }},
+		{name: "spoken comments", modify: func(c *Config) { c.SpokenCommentLimit = -1 }, want: "SPOKEN_COMMENT_LIMIT must not be negative"},
+		{name: "spoken comments off", modify: func(c *Config) { c.SpokenCommentLimit = 0 }},
+		{name: "message length", modify: func(c *Config) { c.MaxMessageLength = 0 }, want: "MAX_MESSAGE_LENGTH must be positive"},
+		{name: "audio bytes", modify: func(c *Config) { c.MaxAudioBytes = -1 }, want: "MAX_AUDIO_BYTES must be positive"},
+		{name: "history trim", modify: func(c *Config) { c.HistoryTrim = "words" }, want: `HISTORY_TRIM must be count or tokens, got "words"`},
+		{name: "token trim without budget", modify: func(c *Config) { c.HistoryTrim = "tokens" }, want: "HISTORY_TOKEN_BUDGET must be positive"},
+		{name: "token trim", modify: func(c *Config) { c.HistoryTrim = "tokens"; c.HistoryTokenBudget = 4000 }},
+		{name: "api type", modify: func(c *Config) { c.OpenAIAPIType = "anthropic" }, want: `OPENAI_API_TYPE must be openai or azure`},
+		{name: "azure without base url", modify: func(c *Config) {
+			c.OpenAIAPIType = "azure"
+			c.OpenAIAzureDeployments = map[string]string{"gpt-4o-mini": "mini"}
+		}, want: "OPENAI_BASE_URL is required"},
+		{name: "azure without model deployment", modify: func(c *Config) {
+			c.OpenAIAPIType, c.OpenAIBaseURL = "azure", "https://acme.openai.azure.com"
+		}, want: `must map OPENAI_MODEL "gpt-4o-mini"`},
+		{name: "azure without fallback deployment", modify: func(c *Config) {
+			c.OpenAIAPIType, c.OpenAIBaseURL = "azure", "https://acme.openai.azure.com"
+			c.OpenAIAzureDeployments = map[string]string{"gpt-4o-mini": "mini"}
+			c.ModelFallbacks = []string{"gpt-4o"}
+		}, want: `must map fallback model "gpt-4o"`},
+		{name: "azure complete", modify: func(c *Config) {
+			c.OpenAIAPIType, c.OpenAIBaseURL = "azure", "https://acme.openai.azure.com"
+			c.OpenAIAzureDeployments = map[string]string{"gpt-4o-mini": "mini", "gpt-4o": "big"}
+			c.ModelFallbacks = []string{"gpt-4o"}
+		}},
+		{name: "allowlist entries", modify: func(c *Config) { c.RepoAllowlist = []string{"acme/app", "acme/*"} }},
+		{name: "allowlist without repo", modify: func(c *Config) { c.RepoAllowlist = []string{"acme"} }, want: `REPO_ALLOWLIST entries must be owner/repo or owner/*, got "acme"`},
+		{name: "allowlist wildcard owner", modify: func(c *Config) { c.RepoAllowlist = []string{"*/app"} }, want: `got "*/app"`},
+		{name: "allowlist nested path", modify: func(c *Config) { c.RepoAllowlist = []string{"acme/app/sub"} }, want: `got "acme/app/sub"`},
+		{name: "allowlist empty owner", modify: func(c *Config) { c.RepoAllowlist = []string{"/app"} }, want: `got "/app"`},
+		{name: "classifier", modify: func(c *Config) { c.IntentClassifier = "regex" }, want: `INTENT_CLASSIFIER must be llm or rules, got "regex"`},
+		{name: "rules classifier", modify: func(c *Config) { c.IntentClassifier = "rules" }},
+		{name: "chat timeout", modify: func(c *Config) { c.ChatTimeout = 0 }, want: "CHAT_TIMEOUT must be positive"},
+		{name: "stream timeout", modify: func(c *Config) { c.StreamTimeout = -time.Second }, want: "STREAM_TIMEOUT must be positive"},
+		{name: "voice timeout", modify: func(c *Config) { c.VoiceTimeout = 0 }, want: "VOICE_TIMEOUT must be positive"},
+		{name: "github timeout", modify: func(c *Config) { c.GitHubTimeout = 0 }, want: "GITHUB_TIMEOUT must be positive"},
+		{name: "classify timeout", modify: func(c *Config) { c.ClassifyTimeout = 0 }, want: "CLASSIFY_TIMEOUT must be positive"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validConfig()
+			tc.modify(&c)
+			err := c.Validate()
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tc.want)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate() = %v, want %q", err, tc.want)
+			}
+			if n := strings.Count(err.Error(), "\n  - "); n != 1 {
+				t.Errorf("reported %d problems, want 1:\n%v", n, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	c := validConfig()
+	c.Port = "x"
+	c.SessionTTL = 0
+	c.IntentClassifier = ""
+	c.ChatTimeout = 0
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil")
+	}
+	want := "invalid configuration:\n" +
+		"  - PORT must be a number between 1 and 65535, got \"x\"\n" +
+		"  - SESSION_TTL must be positive\n" +
+		"  - INTENT_CLASSIFIER must be llm or rules, got \"\"\n" +
+		"  - CHAT_TIMEOUT must be positive"
+	if err.Error() != want {
+		t.Errorf("Validate() =\n%v\nwant\n%v", err, want)
+	}
+}
+
+func TestLoadDefaultsAreValid(t *testing.T) {
+	for _, k := range []string{"PORT", "COOKIE_SECURE", "SESSION_TTL", "HISTORY_TRIM", "OPENAI_API_TYPE", "INTENT_CLASSIFIER", "GITHUB_CLIENT_ID", "GITHUB_APP_ID", "ELEVEN_VOICE_ID", "REPO_ALLOWLIST"} {
+		t.Setenv(k, "")
+	}
+	if err := Load().Validate(); err != nil {
+		t.Errorf("Load().Validate() = %v", err)
+	}
+}
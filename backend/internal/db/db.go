@@ -1,12 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -38,7 +39,7 @@ func New(connectionString string) (*DB, error) {
 	if err := sqlDB.Ping(); err != nil {
 		// Try with SSL disabled if connection fails and SSL mode not specified
 		if connectionString != "" && !containsIgnoreCase(connectionString, "sslmode") {
-			log.Println("retrying database connection with SSL disabled")
+			slog.Info("retrying database connection with SSL disabled")
 			sqlDB.Close()
 			sslDisabledConnection := connectionString
 			if strings.Contains(connectionString, "?") {
@@ -69,20 +70,40 @@ func (db *DB) HealthCheck() error {
 	return db.Ping()
 }
 
+// HealthCheckContext is HealthCheck bounded by ctx, so callers can cap how long it waits
+func (db *DB) HealthCheckContext(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
 
+// migrationsFS holds the SQL migrations compiled into the binary.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// RunEmbeddedMigrations applies the migrations embedded in the binary.
+func (db *DB) RunEmbeddedMigrations() error {
+	return db.runMigrations(migrationsFS, "migrations")
+}
+
 // RunMigrations executes all SQL migration files in the migrations directory
 func (db *DB) RunMigrations(migrationsDir string) error {
-	migrations, err := readMigrations(migrationsDir)
+	return db.runMigrations(os.DirFS(migrationsDir), ".")
+}
+
+// runMigrations applies the not-yet-applied migrations found under dir in fsys, in order.
+func (db *DB) runMigrations(fsys fs.FS, dir string) error {
+	migrations, err := readMigrations(fsys, dir)
 	if err != nil {
 		return fmt.Errorf("failed to read migrations: %w", err)
 	}
 
 	if len(migrations) == 0 {
-		log.Println("no migrations found")
+		slog.Info("no migrations found")
 		return nil
 	}
 
@@ -99,11 +120,11 @@ func (db *DB) RunMigrations(migrationsDir string) error {
 		}
 
 		if applied {
-			log.Printf("migration %d already applied, skipping", migration.Number)
+			slog.Debug("migration already applied, skipping", "number", migration.Number)
 			continue
 		}
 
-		log.Printf("applying migration %d: %s", migration.Number, migration.Name)
+		slog.Info("applying migration", "number", migration.Number, "name", migration.Name)
 
 		// Execute migration in a transaction
 		tx, err := db.Begin()
@@ -130,24 +151,28 @@ func (db *DB) RunMigrations(migrationsDir string) error {
 			return fmt.Errorf("failed to commit migration: %w", err)
 		}
 
-		log.Printf("migration %d applied successfully", migration.Number)
+		slog.Info("migration applied", "number", migration.Number)
 	}
 
 	return nil
 }
 
-// Migration represents a single migration file
+// Migration is one numbered schema change. SQL applies it; DownSQL, when a
+// NNN_name.down.sql file exists, undoes it.
 type Migration struct {
-	Number int
-	Name   string
-	SQL    string
+	Number  int
+	Name    string
+	SQL     string
+	DownSQL string
 }
 
-// readMigrations reads all migration files from the migrations directory
-func readMigrations(migrationsDir string) ([]Migration, error) {
-	var migrations []Migration
+// readMigrations reads all migration files under dir in fsys. Files are either
+// NNN_name.up.sql / NNN_name.down.sql pairs or a plain NNN_name.sql, which is an
+// up migration (optionally paired with a .down.sql).
+func readMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	byNumber := make(map[int]*Migration)
 
-	err := filepath.WalkDir(migrationsDir, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -168,18 +193,31 @@ func readMigrations(migrationsDir string) ([]Migration, error) {
 			return nil
 		}
 
-		sqlBytes, err := os.ReadFile(path)
+		sqlBytes, err := fs.ReadFile(fsys, path)
 		if err != nil {
 			return fmt.Errorf("failed to read migration file %s: %w", filename, err)
 		}
 
 		name := strings.TrimSuffix(strings.Join(parts[1:], "_"), ".sql")
+		down := strings.HasSuffix(name, ".down")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".down"), ".up")
 
-		migrations = append(migrations, Migration{
-			Number: number,
-			Name:   name,
-			SQL:    string(sqlBytes),
-		})
+		m, ok := byNumber[number]
+		if !ok {
+			m = &Migration{Number: number, Name: name}
+			byNumber[number] = m
+		}
+		if down {
+			if m.DownSQL != "" {
+				return fmt.Errorf("duplicate down migration %d", number)
+			}
+			m.DownSQL = string(sqlBytes)
+			return nil
+		}
+		if m.SQL != "" {
+			return fmt.Errorf("duplicate up migration %d", number)
+		}
+		m.SQL = string(sqlBytes)
 
 		return nil
 	})
@@ -187,6 +225,14 @@ func readMigrations(migrationsDir string) ([]Migration, error) {
 		return nil, err
 	}
 
+	migrations := make([]Migration, 0, len(byNumber))
+	for _, m := range byNumber {
+		if m.SQL == "" {
+			return nil, fmt.Errorf("migration %d has a down file but no up file", m.Number)
+		}
+		migrations = append(migrations, *m)
+	}
+
 	// Sort migrations by number
 	sort.Slice(migrations, func(i, j int) bool {
 		return migrations[i].Number < migrations[j].Number
@@ -195,6 +241,86 @@ func readMigrations(migrationsDir string) ([]Migration, error) {
 	return migrations, nil
 }
 
+// Rollback undoes the last steps applied embedded migrations, newest first. Each
+// down migration runs in a transaction together with removing its schema_migrations row.
+func (db *DB) Rollback(steps int) error {
+	return db.rollback(migrationsFS, "migrations", steps)
+}
+
+func (db *DB) rollback(fsys fs.FS, dir string, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("rollback steps must be positive, got %d", steps)
+	}
+	migrations, err := readMigrations(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+	byNumber := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byNumber[m.Number] = m
+	}
+
+	if err := db.createMigrationTable(); err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+	applied, err := db.appliedMigrations(steps)
+	if err != nil {
+		return fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	if len(applied) < steps {
+		return fmt.Errorf("cannot roll back %d migrations: only %d applied", steps, len(applied))
+	}
+	// Check every step up front so a missing down file doesn't leave a partial rollback
+	for _, version := range applied {
+		m, ok := byNumber[version]
+		if !ok || strings.TrimSpace(m.DownSQL) == "" {
+			return fmt.Errorf("migration %d has no down migration", version)
+		}
+	}
+
+	for _, version := range applied {
+		m := byNumber[version]
+		slog.Info("rolling back migration", "number", m.Number, "name", m.Name)
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if _, err := tx.Exec(m.DownSQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to roll back migration %d: %w", m.Number, err)
+		}
+		if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.Number); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to unrecord migration: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit rollback: %w", err)
+		}
+
+		slog.Info("migration rolled back", "number", m.Number)
+	}
+	return nil
+}
+
+// appliedMigrations returns up to limit applied migration versions, newest first
+func (db *DB) appliedMigrations(limit int) ([]int, error) {
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
 // createMigrationTable creates the table that tracks which migrations have been applied
 func (db *DB) createMigrationTable() error {
 	createTableSQL := `
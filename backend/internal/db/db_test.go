@@ -0,0 +1,261 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestDB connects to the Postgres in TEST_DB_URL with a fresh schema as the
+// search path, dropped when the test ends. Tests needing it are skipped without one.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	admin, err := New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	db, err := New(url + sep + "search_path=" + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// tableExists reports whether table is in the test schema.
+func tableExists(t *testing.T, db *DB, table string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1", table).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func appliedVersions(t *testing.T, db *DB) []int {
+	t.Helper()
+	versions, err := db.appliedMigrations(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := readMigrations(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Number != i+1 {
+			t.Errorf("migration %d is numbered %d; numbers must run 1, 2, 3...", i, m.Number)
+		}
+		if strings.TrimSpace(m.SQL) == "" || m.Name == "" {
+			t.Errorf("migration %d = %+v, want a name and SQL", m.Number, m)
+		}
+	}
+	if migrations[0].Name != "initial_schema" || !strings.Contains(migrations[0].SQL, "CREATE TABLE IF NOT EXISTS github_auth") {
+		t.Errorf("first migration = %s %q", migrations[0].Name, migrations[0].SQL)
+	}
+}
+
+func TestRunEmbeddedMigrations(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.RunEmbeddedMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"schema_migrations", "github_auth", "messages"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("table %s missing after migrating", table)
+		}
+	}
+	migrations, _ := readMigrations(migrationsFS, "migrations")
+	if got := appliedVersions(t, db); len(got) != len(migrations) {
+		t.Errorf("applied %v, want all %d migrations", got, len(migrations))
+	}
+
+	// Running again on startup is a no-op
+	if err := db.RunEmbeddedMigrations(); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if got := appliedVersions(t, db); len(got) != len(migrations) {
+		t.Errorf("applied %v after a second run", got)
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr string
+	}{
+		{
+			name: "up/down pairs and plain files",
+			files: fstest.MapFS{
+				"m/002_add_col.up.sql":   {Data: []byte("ALTER 2")},
+				"m/002_add_col.down.sql": {Data: []byte("UNDO 2")},
+				"m/001_init.sql":         {Data: []byte("CREATE 1")},
+				"m/001_init.down.sql":    {Data: []byte("DROP 1")},
+				"m/003_legacy_only.sql":  {Data: []byte("CREATE 3")},
+				"m/README.md":            {Data: []byte("not a migration")},
+				"m/notes.sql":            {Data: []byte("no number")},
+			},
+			want: []Migration{
+				{Number: 1, Name: "init", SQL: "CREATE 1", DownSQL: "DROP 1"},
+				{Number: 2, Name: "add_col", SQL: "ALTER 2", DownSQL: "UNDO 2"},
+				{Number: 3, Name: "legacy_only", SQL: "CREATE 3"},
+			},
+		},
+		{
+			name:    "down without up",
+			files:   fstest.MapFS{"m/001_init.down.sql": {Data: []byte("DROP 1")}},
+			wantErr: "migration 1 has a down file but no up file",
+		},
+		{
+			name: "plain and up file for one number",
+			files: fstest.MapFS{
+				"m/001_init.sql":    {Data: []byte("CREATE 1")},
+				"m/001_init.up.sql": {Data: []byte("CREATE 1")},
+			},
+			wantErr: "duplicate up migration 1",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readMigrations(tc.files, "m")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("migrations = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsCanRollBack(t *testing.T) {
+	migrations, err := readMigrations(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if strings.TrimSpace(m.DownSQL) == "" {
+			t.Errorf("migration %d (%s) has no down migration", m.Number, m.Name)
+		}
+	}
+}
+
+func TestRollbackRejectsNonPositiveSteps(t *testing.T) {
+	for _, steps := range []int{0, -1} {
+		// Checked before the database is touched
+		if err := (&DB{}).Rollback(steps); err == nil || !strings.Contains(err.Error(), "must be positive") {
+			t.Errorf("Rollback(%d) = %v", steps, err)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db := newTestDB(t)
+	migrations := fstest.MapFS{
+		"m/001_widgets.sql":      {Data: []byte("CREATE TABLE widgets (id INT)")},
+		"m/001_widgets.down.sql": {Data: []byte("DROP TABLE widgets")},
+		"m/002_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INT)")},
+		"m/002_gadgets.down.sql": {Data: []byte("DROP TABLE gadgets")},
+		"m/003_sprockets.sql":    {Data: []byte("CREATE TABLE sprockets (id INT)")},
+	}
+
+	// Nothing applied yet: there is nothing to undo
+	if err := db.rollback(migrations, "m", 1); err == nil || !strings.Contains(err.Error(), "only 0 applied") {
+		t.Fatalf("rollback before migrating = %v", err)
+	}
+
+	if err := db.runMigrations(migrations, "m"); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"widgets", "gadgets", "sprockets"} {
+		if !tableExists(t, db, table) {
+			t.Fatalf("%s missing after migrating up", table)
+		}
+	}
+
+	// 003 has no down file, so nothing is undone
+	if err := db.rollback(migrations, "m", 1); err == nil || !strings.Contains(err.Error(), "migration 3 has no down migration") {
+		t.Fatalf("rollback of 003 = %v", err)
+	}
+	if !tableExists(t, db, "sprockets") || len(appliedVersions(t, db)) != 3 {
+		t.Fatal("failed rollback changed the schema")
+	}
+
+	// Undo 003 by hand, then roll back one step: only 002 goes
+	if _, err := db.Exec("DROP TABLE sprockets; DELETE FROM schema_migrations WHERE version = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.rollback(migrations, "m", 1); err != nil {
+		t.Fatalf("partial rollback: %v", err)
+	}
+	if tableExists(t, db, "gadgets") || !tableExists(t, db, "widgets") {
+		t.Error("partial rollback undid the wrong migrations")
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("applied = %v, want [1]", got)
+	}
+
+	// More steps than applied migrations is refused outright
+	if err := db.rollback(migrations, "m", 2); err == nil || !strings.Contains(err.Error(), "cannot roll back 2 migrations") {
+		t.Fatalf("over-long rollback = %v", err)
+	}
+	if !tableExists(t, db, "widgets") {
+		t.Error("refused rollback dropped widgets")
+	}
+
+	if err := db.rollback(migrations, "m", 1); err != nil {
+		t.Fatal(err)
+	}
+	if tableExists(t, db, "widgets") || len(appliedVersions(t, db)) != 0 {
+		t.Error("full rollback left migrations applied")
+	}
+
+	// Rolled-back migrations apply again
+	if err := db.runMigrations(migrations, "m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int{3, 2, 1}) {
+		t.Errorf("applied after re-migrating = %v", got)
+	}
+}
@@ -0,0 +1,52 @@
+// Package dbtest provides a migrated Postgres schema for tests of code that needs
+// a real database.
+package dbtest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"zana-speech-backend/internal/db"
+)
+
+// New connects to the Postgres in TEST_DB_URL with a fresh, fully migrated schema as
+// the search path, dropped when the test ends. Tests needing it are skipped without one.
+func New(t testing.TB) *db.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	admin, err := db.New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	database, err := db.New(url + sep + "search_path=" + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.RunEmbeddedMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
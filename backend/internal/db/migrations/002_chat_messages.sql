@@ -0,0 +1,13 @@
+-- Create messages table for persisting chat history per session
+-- Rows are trimmed per session to the configured history length by the application
+
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Create index on session_id for ordered history lookups and trimming
+CREATE INDEX IF NOT EXISTS idx_messages_session_id ON messages(session_id, id);
@@ -0,0 +1,7 @@
+-- Keep only each session's default account and restore the single-account key
+DELETE FROM github_auth WHERE NOT is_default;
+
+DROP INDEX IF EXISTS idx_github_auth_default;
+ALTER TABLE github_auth DROP CONSTRAINT IF EXISTS github_auth_pkey;
+ALTER TABLE github_auth ADD PRIMARY KEY (session_id);
+ALTER TABLE github_auth DROP COLUMN IF EXISTS is_default;
@@ -0,0 +1,13 @@
+-- Allow several GitHub accounts per session (e.g. work and personal)
+-- Rows are keyed by session and account login; one account per session is the default
+
+ALTER TABLE github_auth ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing sessions had exactly one account, which becomes their default
+UPDATE github_auth SET is_default = TRUE;
+
+ALTER TABLE github_auth DROP CONSTRAINT IF EXISTS github_auth_pkey;
+ALTER TABLE github_auth ADD PRIMARY KEY (session_id, github_owner);
+
+-- At most one default account per session
+CREATE UNIQUE INDEX IF NOT EXISTS idx_github_auth_default ON github_auth(session_id) WHERE is_default;
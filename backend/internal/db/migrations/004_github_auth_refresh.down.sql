@@ -0,0 +1,2 @@
+ALTER TABLE github_auth DROP COLUMN IF EXISTS token_expiry;
+ALTER TABLE github_auth DROP COLUMN IF EXISTS refresh_token;
@@ -0,0 +1,5 @@
+-- Keep OAuth refresh tokens so expiring GitHub tokens can be renewed without a new login
+-- token_expiry is NULL for tokens that never expire
+
+ALTER TABLE github_auth ADD COLUMN IF NOT EXISTS refresh_token TEXT NOT NULL DEFAULT '';
+ALTER TABLE github_auth ADD COLUMN IF NOT EXISTS token_expiry TIMESTAMP;
@@ -0,0 +1,136 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GitHub rejects app JWTs that live longer than ten minutes
+	appJWTLifetime = 9 * time.Minute
+	// Backdates iat to tolerate clock drift between us and GitHub
+	appJWTClockSkew = time.Minute
+	// Installation tokens are refreshed this long before GitHub expires them
+	appTokenRefreshMargin = 5 * time.Minute
+)
+
+// AppTokenSource mints installation access tokens for a GitHub App and caches each
+// one until shortly before it expires. It is safe for concurrent use.
+type AppTokenSource struct {
+	client         GitHubAPIClient
+	appID          string
+	installationID int64
+	key            *rsa.PrivateKey
+	now            func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewAppTokenSource builds a token source for one installation of the App appID.
+// privateKeyPEM is the key GitHub generated for the App (PKCS#1 or PKCS#8 PEM);
+// opts configure the REST client the same way as for NewGitHubAPIClient.
+func NewAppTokenSource(appID string, installationID int64, privateKeyPEM []byte, opts ...Option) (*AppTokenSource, error) {
+	if strings.TrimSpace(appID) == "" || installationID <= 0 {
+		return nil, errors.New("github app id and installation id are required")
+	}
+	key, err := parseRSAPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &AppTokenSource{
+		client:         NewGitHubAPIClient(opts...),
+		appID:          strings.TrimSpace(appID),
+		installationID: installationID,
+		key:            key,
+		now:            time.Now,
+	}, nil
+}
+
+// Token returns a cached installation token, minting a new one when none is cached
+// or the cached one expires within appTokenRefreshMargin.
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.now().Add(appTokenRefreshMargin).Before(s.expiresAt) {
+		return s.token, nil
+	}
+	jwt, err := s.appJWT()
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", s.installationID)
+	resp, err := s.client.do(ctx, jwt, http.MethodPost, path, "application/vnd.github+json", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", responseError(resp, "create installation token")
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token == "" {
+		return "", errors.New("create installation token: empty token in response")
+	}
+	s.token, s.expiresAt = body.Token, body.ExpiresAt
+	return s.token, nil
+}
+
+// appJWT signs the short-lived RS256 JWT that authenticates as the App itself.
+func (s *AppTokenSource) appJWT() (string, error) {
+	now := s.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": s.appID,
+	})
+	enc := base64.RawURLEncoding
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("sign github app jwt: %w", err)
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+// parseRSAPrivateKey decodes the first PEM block of data as a PKCS#1 or PKCS#8 RSA key.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("github app private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse github app private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github app private key is not an RSA key")
+	}
+	return key, nil
+}
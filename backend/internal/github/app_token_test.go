@@ -0,0 +1,225 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	appKeyOnce sync.Once
+	appKey     *rsa.PrivateKey
+)
+
+// testAppKey is an RSA key shared by the tests; generating one per test is slow.
+func testAppKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	appKeyOnce.Do(func() {
+		var err error
+		if appKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return appKey
+}
+
+// installationEndpoint fakes GitHub's access token endpoint for installation 42 of
+// App 123. It checks the App JWT and hands out ghs_1, ghs_2, ... expiring an hour
+// after now().
+type installationEndpoint struct {
+	t      *testing.T
+	key    *rsa.PublicKey
+	now    func() time.Time
+	status int
+
+	mu     sync.Mutex
+	minted int
+}
+
+func (e *installationEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/42/access_tokens" {
+		e.t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	e.checkJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if e.status != 0 {
+		w.WriteHeader(e.status)
+		_, _ = w.Write([]byte(`{"message":"A JSON web token could not be decoded"}`))
+		return
+	}
+	e.mu.Lock()
+	e.minted++
+	n := e.minted
+	e.mu.Unlock()
+	writeJSON(e.t, w, map[string]any{
+		"token":      "ghs_" + strconv.Itoa(n),
+		"expires_at": e.now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *installationEndpoint) checkJWT(jwt string) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		e.t.Errorf("Authorization is not a JWT: %q", jwt)
+		return
+	}
+	enc := base64.RawURLEncoding
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		e.t.Errorf("signature: %v", err)
+		return
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(e.key, crypto.SHA256, sum[:], sig); err != nil {
+		e.t.Errorf("JWT not signed with the App key: %v", err)
+	}
+	var header map[string]string
+	var claims struct {
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+		Iss string `json:"iss"`
+	}
+	h, _ := enc.DecodeString(parts[0])
+	c, _ := enc.DecodeString(parts[1])
+	if json.Unmarshal(h, &header) != nil || header["alg"] != "RS256" {
+		e.t.Errorf("JWT header = %s", h)
+	}
+	if json.Unmarshal(c, &claims) != nil || claims.Iss != "123" {
+		e.t.Errorf("JWT claims = %s", c)
+	}
+	now := e.now().Unix()
+	if claims.Iat > now || claims.Exp <= now || claims.Exp-claims.Iat > int64((10*time.Minute).Seconds()) {
+		e.t.Errorf("JWT iat %d exp %d around %d; GitHub allows at most ten minutes", claims.Iat, claims.Exp, now)
+	}
+}
+
+func (e *installationEndpoint) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.minted
+}
+
+// newTestAppTokenSource returns a token source for App 123, installation 42, talking
+// to endpoint and running on the clock now.
+func newTestAppTokenSource(t *testing.T, now *time.Time) (*AppTokenSource, *installationEndpoint) {
+	t.Helper()
+	key := testAppKey(t)
+	endpoint := &installationEndpoint{t: t, key: &key.PublicKey, now: func() time.Time { return *now }}
+	ts := httptest.NewServer(endpoint)
+	t.Cleanup(ts.Close)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	src, err := NewAppTokenSource("123", 42, keyPEM, WithBaseURL(ts.URL), WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.now = func() time.Time { return *now }
+	return src, endpoint
+}
+
+func TestAppTokenSourceCachesUntilNearExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	src, endpoint := newTestAppTokenSource(t, &now)
+	ctx := context.Background()
+
+	steps := []struct {
+		advance    time.Duration
+		wantToken  string
+		wantMinted int
+	}{
+		{wantToken: "ghs_1", wantMinted: 1},
+		// Cached while the token has more than the refresh margin left
+		{advance: 30 * time.Minute, wantToken: "ghs_1", wantMinted: 1},
+		{advance: 24 * time.Minute, wantToken: "ghs_1", wantMinted: 1},
+		// Six minutes left is inside the margin: mint a fresh one
+		{advance: 2 * time.Minute, wantToken: "ghs_2", wantMinted: 2},
+		{advance: time.Minute, wantToken: "ghs_2", wantMinted: 2},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		tok, err := src.Token(ctx)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if tok != step.wantToken || endpoint.count() != step.wantMinted {
+			t.Errorf("step %d: token %q after %d mints, want %q after %d", i, tok, endpoint.count(), step.wantToken, step.wantMinted)
+		}
+	}
+}
+
+func TestAppTokenSourceMintFailure(t *testing.T) {
+	now := time.Now()
+	src, endpoint := newTestAppTokenSource(t, &now)
+	endpoint.status = http.StatusUnauthorized
+
+	tok, err := src.Token(context.Background())
+	if err == nil || tok != "" {
+		t.Fatalf("Token = %q, %v; want an error", tok, err)
+	}
+	var unauthorized *UnauthorizedError
+	if !errors.As(err, &unauthorized) {
+		t.Errorf("err = %T %v, want *UnauthorizedError", err, err)
+	}
+
+	// A failure isn't cached: the next call tries again
+	endpoint.status = 0
+	if tok, err := src.Token(context.Background()); err != nil || tok != "ghs_1" {
+		t.Errorf("Token after recovery = %q, %v", tok, err)
+	}
+}
+
+func TestNewAppTokenSource(t *testing.T) {
+	key := testAppKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	tests := []struct {
+		name           string
+		appID          string
+		installationID int64
+		key            []byte
+		wantErr        string
+	}{
+		{name: "pkcs1 key", appID: "123", installationID: 42, key: pkcs1PEM},
+		{name: "pkcs8 key", appID: " 123 ", installationID: 42, key: pkcs8PEM},
+		{name: "missing app id", installationID: 42, key: pkcs1PEM, wantErr: "app id and installation id are required"},
+		{name: "missing installation", appID: "123", key: pkcs1PEM, wantErr: "app id and installation id are required"},
+		{name: "not pem", appID: "123", installationID: 42, key: []byte("ssh-rsa AAAA"), wantErr: "not PEM encoded"},
+		{name: "garbage in pem", appID: "123", installationID: 42, key: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("junk")}), wantErr: "parse github app private key"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := NewAppTokenSource(tc.appID, tc.installationID, tc.key)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.appID != "123" || !src.key.Equal(key) {
+				t.Errorf("source = app %q, key matches %v", src.appID, src.key.Equal(key))
+			}
+		})
+	}
+}
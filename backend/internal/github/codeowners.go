@@ -0,0 +1,117 @@
+package github
+
+import (
+	"path"
+	"strings"
+)
+
+// codeOwnersRule is a single CODEOWNERS line: a path pattern and its owners.
+type codeOwnersRule struct {
+	pattern string
+	owners  []string
+}
+
+// parseCodeOwners reads CODEOWNERS content, skipping blanks and comments.
+// Rules keep file order because the last matching rule wins.
+func parseCodeOwners(content string) []codeOwnersRule {
+	var rules []codeOwnersRule
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rules = append(rules, codeOwnersRule{pattern: fields[0], owners: fields[1:]})
+	}
+	return rules
+}
+
+// ownersForPath returns the owners of the last rule matching filePath.
+func ownersForPath(rules []codeOwnersRule, filePath string) []string {
+	var owners []string
+	for _, r := range rules {
+		if matchCodeOwnersPattern(r.pattern, filePath) {
+			owners = r.owners
+		}
+	}
+	return owners
+}
+
+// matchCodeOwnersPattern implements the gitignore-style subset CODEOWNERS uses:
+// "/" anchors to the repo root, a trailing "/" matches everything beneath a
+// directory, "*" matches within a segment, "**" spans segments, and a pattern
+// without a slash matches at any depth.
+func matchCodeOwnersPattern(pattern, filePath string) bool {
+	if pattern == "*" {
+		return true
+	}
+	anchored := strings.HasPrefix(pattern, "/")
+	p := strings.TrimPrefix(pattern, "/")
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	if p == "" {
+		return false
+	}
+	if !anchored && !strings.Contains(p, "/") {
+		// Match any path segment (file or directory) at any depth
+		p = "**/" + p
+	}
+	patSegs := strings.Split(p, "/")
+	fileSegs := strings.Split(filePath, "/")
+	// A matched directory owns everything beneath it, except for a trailing
+	// "/*" which only covers direct children.
+	if patSegs[len(patSegs)-1] == "*" {
+		return !dirOnly && matchSegments(patSegs, fileSegs)
+	}
+	for n := 1; n <= len(fileSegs); n++ {
+		if dirOnly && n == len(fileSegs) {
+			break
+		}
+		if matchSegments(patSegs, fileSegs[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pat, segs []string) bool {
+	if len(pat) == 0 {
+		return len(segs) == 0
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pat[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pat[0], segs[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pat[1:], segs[1:])
+}
+
+// SuggestReviewers maps changed file paths to CODEOWNERS owners, returning each
+// owner once in order of first appearance. Team owners (@org/team) are kept as-is.
+func SuggestReviewers(codeOwners string, paths []string) []string {
+	rules := parseCodeOwners(codeOwners)
+	seen := make(map[string]bool)
+	out := make([]string, 0)
+	for _, p := range paths {
+		for _, o := range ownersForPath(rules, p) {
+			key := strings.ToLower(o)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, o)
+		}
+	}
+	return out
+}
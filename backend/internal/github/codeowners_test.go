@@ -0,0 +1,109 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testCodeOwners = `# Default owners
+*                 @acme/core
+
+*.go              @gopher
+/docs/            @writer
+/api/**/*.proto   @schema @Gopher
+build/            @ci-team   # anywhere in the tree
+/web/*            @frontend
+`
+
+func TestMatchCodeOwnersPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*", "anything/at/all.txt", true},
+		{"*.go", "main.go", true},
+		{"*.go", "internal/server/server.go", true},
+		{"*.go", "main.gox", false},
+		{"/docs/", "docs/guide/intro.md", true},
+		{"/docs/", "src/docs/readme.md", false},
+		{"/docs/", "docs", false},
+		{"docs/", "src/docs/readme.md", true},
+		{"build/", "tools/build/run.sh", true},
+		{"build/", "build", false},
+		{"/api/**/*.proto", "api/v1/user.proto", true},
+		{"/api/**/*.proto", "api/user.proto", true},
+		{"/api/**/*.proto", "api/v1/user.go", false},
+		{"/web/*", "web/index.html", true},
+		{"/web/*", "web/app/main.js", false},
+		{"/Makefile", "Makefile", true},
+		{"/Makefile", "sub/Makefile", false},
+		{"/", "README.md", false},
+	}
+	for _, tc := range tests {
+		if got := matchCodeOwnersPattern(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("matchCodeOwnersPattern(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestSuggestReviewers(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{name: "last matching rule wins", paths: []string{"cmd/main.go"}, want: []string{"@gopher"}},
+		{name: "fallback rule", paths: []string{"README.md"}, want: []string{"@acme/core"}},
+		{name: "owners deduplicated case-insensitively in order", paths: []string{"api/v1/user.proto", "main.go", "docs/intro.md"}, want: []string{"@schema", "@Gopher", "@writer"}},
+		{name: "comment after owners is ignored", paths: []string{"tools/build/run.sh"}, want: []string{"@ci-team"}},
+		{name: "nothing changed", want: []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SuggestReviewers(testCodeOwners, tc.paths); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SuggestReviewers = %v, want %v", got, tc.want)
+			}
+		})
+	}
+	if got := SuggestReviewers("", []string{"main.go"}); len(got) != 0 {
+		t.Errorf("empty CODEOWNERS suggested %v", got)
+	}
+}
+
+func TestGetCodeOwnersLocations(t *testing.T) {
+	tests := []struct {
+		name    string
+		present map[string]string
+		want    string
+		wantErr error
+	}{
+		{name: ".github wins", present: map[string]string{".github/CODEOWNERS": "* @a", "CODEOWNERS": "* @b"}, want: "* @a"},
+		{name: "root", present: map[string]string{"CODEOWNERS": "* @b", "docs/CODEOWNERS": "* @c"}, want: "* @b"},
+		{name: "docs", present: map[string]string{"docs/CODEOWNERS": "* @c"}, want: "* @c"},
+		{name: "none", wantErr: ErrNoCodeOwners},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/contents/", func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept"); got != "application/vnd.github.raw" {
+					t.Errorf("Accept = %q", got)
+				}
+				content, ok := tc.present[r.URL.Path[len("/api/v3/repos/acme/app/contents/"):]]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write([]byte(content))
+			})
+			got, err := newTestClient(t, mux).GetCodeOwners(context.Background(), "tok", "acme/app")
+			if !errors.Is(err, tc.wantErr) || got != tc.want {
+				t.Errorf("GetCodeOwners = %q, %v; want %q, %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package github
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseHunks extracts hunk metadata from a unified diff patch by reading its
+// "@@ -a,b +c,d @@ section" headers. Malformed headers are skipped.
+func parseHunks(patch string) []DiffHunk {
+	if patch == "" {
+		return nil
+	}
+	var hunks []DiffHunk
+	for _, line := range strings.Split(patch, "\n") {
+		if !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+		if h, ok := parseHunkHeader(line); ok {
+			hunks = append(hunks, h)
+		}
+	}
+	return hunks
+}
+
+// parseHunkHeader parses a single "@@ -oldStart[,oldLines] +newStart[,newLines] @@ section" line.
+// An omitted line count defaults to 1, as in the unified diff format.
+func parseHunkHeader(line string) (DiffHunk, bool) {
+	rest := strings.TrimPrefix(line, "@@ ")
+	end := strings.Index(rest, " @@")
+	if end == -1 {
+		return DiffHunk{}, false
+	}
+	ranges := strings.Fields(rest[:end])
+	if len(ranges) != 2 || !strings.HasPrefix(ranges[0], "-") || !strings.HasPrefix(ranges[1], "+") {
+		return DiffHunk{}, false
+	}
+	oldStart, oldLines, ok := parseHunkRange(ranges[0][1:])
+	if !ok {
+		return DiffHunk{}, false
+	}
+	newStart, newLines, ok := parseHunkRange(ranges[1][1:])
+	if !ok {
+		return DiffHunk{}, false
+	}
+	return DiffHunk{
+		OldStart: oldStart,
+		OldLines: oldLines,
+		NewStart: newStart,
+		NewLines: newLines,
+		Section:  strings.TrimSpace(rest[end+len(" @@"):]),
+	}, true
+}
+
+func parseHunkRange(r string) (int, int, bool) {
+	start, count, hasCount := strings.Cut(r, ",")
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !hasCount {
+		return s, 1, true
+	}
+	c, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, false
+	}
+	return s, c, true
+}
@@ -0,0 +1,77 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   DiffHunk
+		wantOK bool
+	}{
+		{line: "@@ -10,7 +10,9 @@ func main() {", want: DiffHunk{OldStart: 10, OldLines: 7, NewStart: 10, NewLines: 9, Section: "func main() {"}, wantOK: true},
+		{line: "@@ -1,3 +1,4 @@", want: DiffHunk{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 4}, wantOK: true},
+		// An omitted count is one line
+		{line: "@@ -3 +3 @@", want: DiffHunk{OldStart: 3, OldLines: 1, NewStart: 3, NewLines: 1}, wantOK: true},
+		{line: "@@ -5 +5,2 @@ type T struct", want: DiffHunk{OldStart: 5, OldLines: 1, NewStart: 5, NewLines: 2, Section: "type T struct"}, wantOK: true},
+		// A new file starts from nothing
+		{line: "@@ -0,0 +1,12 @@", want: DiffHunk{NewStart: 1, NewLines: 12}, wantOK: true},
+		{line: "@@ -1,3 +1,4"},
+		{line: "@@ +1,4 -1,3 @@"},
+		{line: "@@ -1,3 @@"},
+		{line: "@@ -a,3 +1,4 @@"},
+		{line: "@@ -1,x +1,4 @@"},
+		{line: "@@ -1,3 +1,4 +1,5 @@"},
+		{line: "@@  @@"},
+	}
+	for _, tc := range tests {
+		got, ok := parseHunkHeader(tc.line)
+		if ok != tc.wantOK || got != tc.want {
+			t.Errorf("parseHunkHeader(%q) = %+v, %v; want %+v, %v", tc.line, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestParseHunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  []DiffHunk
+	}{
+		{name: "no patch"},
+		{
+			name:  "one hunk",
+			patch: "@@ -1,2 +1,3 @@\n line\n+added\n line",
+			want:  []DiffHunk{{OldStart: 1, OldLines: 2, NewStart: 1, NewLines: 3}},
+		},
+		{
+			name: "several hunks",
+			patch: "@@ -1,3 +1,3 @@ package main\n-old\n+new\n ctx\n" +
+				"@@ -20 +20,2 @@ func run() {\n ctx\n+added\n" +
+				"@@ -40,2 +41 @@\n-gone\n ctx",
+			want: []DiffHunk{
+				{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Section: "package main"},
+				{OldStart: 20, OldLines: 1, NewStart: 20, NewLines: 2, Section: "func run() {"},
+				{OldStart: 40, OldLines: 2, NewStart: 41, NewLines: 1},
+			},
+		},
+		{
+			name:  "malformed headers are skipped",
+			patch: "@@ -1,x +1 @@\n ctx\n@@ -5,1 +5,1 @@\n-a\n+b\n@@ broken",
+			want:  []DiffHunk{{OldStart: 5, OldLines: 1, NewStart: 5, NewLines: 1}},
+		},
+		{
+			// Content lines that happen to contain @@ aren't headers
+			name:  "@@ inside a line",
+			patch: "@@ -1 +1 @@\n-x := \"@@ -9 +9 @@\"\n+y := 1",
+			want:  []DiffHunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1}},
+		},
+	}
+	for _, tc := range tests {
+		if got := parseHunks(tc.patch); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: parseHunks = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitError is returned when GitHub refuses a request because the
+// token's rate limit is exhausted. ResetAt is when the quota refills.
+type RateLimitError struct {
+	ResetAt   time.Time
+	RequestID string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.ResetAt.IsZero() {
+		return "github rate limit exceeded"
+	}
+	return fmt.Sprintf("github rate limit exceeded; resets at %s", e.ResetAt.Format(time.RFC3339))
+}
+
+// rateLimitFromResponse returns a RateLimitError when resp signals an exhausted
+// quota (403/429 with X-RateLimit-Remaining: 0), otherwise nil.
+func rateLimitFromResponse(resp *http.Response) *RateLimitError {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	if strings.TrimSpace(resp.Header.Get("X-RateLimit-Remaining")) != "0" {
+		return nil
+	}
+	return &RateLimitError{
+		ResetAt:   parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset")),
+		RequestID: resp.Header.Get(RequestIDHeader),
+	}
+}
+
+// parseRateLimitReset converts the Unix-seconds X-RateLimit-Reset value to a time.
+// Returns the zero time when the header is missing or malformed.
+func parseRateLimitReset(v string) time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0)
+}
+
+// InvalidReviewersError is returned by RequestReviewers when GitHub rejects some of
+// the requested users, usually because they aren't collaborators on the repo.
+type InvalidReviewersError struct {
+	Reviewers []string
+}
+
+func (e *InvalidReviewersError) Error() string {
+	return fmt.Sprintf("invalid reviewers: %s", strings.Join(e.Reviewers, ", "))
+}
+
+// APIError describes a non-2xx GitHub response. Responses with a status callers
+// commonly act on are returned as UnauthorizedError, NotFoundError, ForbiddenError,
+// ConflictError or ValidationError, each of which unwraps to the underlying *APIError.
+type APIError struct {
+	Op         string // what was attempted, e.g. "merge"
+	StatusCode int
+	Message    string // GitHub's error message, or the raw body when it isn't JSON
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s failed (request id %s): %s", e.Op, e.RequestID, e.Message)
+	}
+	return fmt.Sprintf("%s failed: %s", e.Op, e.Message)
+}
+
+// UnauthorizedError is a 401: the token is invalid, expired or was revoked.
+type UnauthorizedError struct{ *APIError }
+
+func (e *UnauthorizedError) Unwrap() error { return e.APIError }
+
+// IsBadCredentials reports whether err means GitHub no longer accepts the token at
+// all: a 401, or a 403 whose message is GitHub's "Bad credentials". Scope and branch
+// rule 403s don't count; signing in again wouldn't fix those.
+func IsBadCredentials(err error) bool {
+	var unauthorized *UnauthorizedError
+	if errors.As(err, &unauthorized) {
+		return true
+	}
+	var forbidden *ForbiddenError
+	return errors.As(err, &forbidden) && strings.Contains(strings.ToLower(forbidden.Message), "bad credentials")
+}
+
+// NotFoundError is a 404: the repo, PR or resource doesn't exist, or the token
+// can't see it (GitHub hides private repos behind 404s).
+type NotFoundError struct {
+	*APIError
+	// Resource, when set, is the sentinel for what was missing (ErrCommentNotFound,
+	// ErrLabelNotFound or ErrBranchNotFound), so errors.Is matches it too
+	Resource error
+}
+
+func (e *NotFoundError) Unwrap() error { return e.APIError }
+
+func (e *NotFoundError) Is(target error) bool { return e.Resource != nil && target == e.Resource }
+
+// ForbiddenError is a 403 that isn't a rate limit, usually a missing token scope
+// or a branch protection rule.
+type ForbiddenError struct{ *APIError }
+
+func (e *ForbiddenError) Unwrap() error { return e.APIError }
+
+// ConflictError is a 409, or the 405 GitHub's merge endpoint returns when the PR
+// isn't mergeable (conflicts, or the head moved).
+type ConflictError struct{ *APIError }
+
+func (e *ConflictError) Unwrap() error { return e.APIError }
+
+// ValidationError is a 422: GitHub understood the request but rejected its contents.
+type ValidationError struct{ *APIError }
+
+func (e *ValidationError) Unwrap() error { return e.APIError }
+
+// newAPIError wraps base in the typed error matching its status code.
+func newAPIError(base *APIError) error {
+	switch base.StatusCode {
+	case http.StatusUnauthorized:
+		return &UnauthorizedError{base}
+	case http.StatusNotFound:
+		return &NotFoundError{APIError: base}
+	case http.StatusForbidden:
+		return &ForbiddenError{base}
+	case http.StatusConflict, http.StatusMethodNotAllowed:
+		return &ConflictError{base}
+	case http.StatusUnprocessableEntity:
+		return &ValidationError{base}
+	}
+	return base
+}
+
+// githubErrorMessage extracts the human-readable message from a GitHub error body,
+// appending the first detailed validation message when there is one. Bodies that
+// aren't GitHub's JSON error shape are returned trimmed.
+func githubErrorMessage(body []byte) string {
+	var parsed struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Message == "" {
+		return strings.TrimSpace(string(body))
+	}
+	msg := parsed.Message
+	for _, e := range parsed.Errors {
+		detail := e.Message
+		if detail == "" && e.Code != "" {
+			detail = strings.TrimSpace(e.Field + " " + e.Code)
+		}
+		if detail != "" {
+			return msg + ": " + detail
+		}
+	}
+	return msg
+}
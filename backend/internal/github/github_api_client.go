@@ -1,12 +1,16 @@
 package github
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,12 +21,30 @@ import (
 type MCPClient interface {
 	ListPRsForReview(ctx context.Context, token string) ([]PR, error)
 	ListUserPRs(ctx context.Context, token string) ([]PR, error)
-	GetPRComments(ctx context.Context, token, repo string, prNumber int) ([]Comment, error)
-	MergePR(ctx context.Context, token, repo string, prNumber int, method string) error
-	AddComment(ctx context.Context, token, repo string, prNumber int, body string) error
+	ListPRs(ctx context.Context, token string, kind IntentKind, filter PRFilter) ([]PR, error)
+	GetPRComments(ctx context.Context, token, repo string, prNumber int) ([]Comment, bool, error)
+	MergePR(ctx context.Context, token, repo string, prNumber int, method, commitTitle, commitMessage string) error
+	AddComment(ctx context.Context, token, repo string, prNumber int, body string) (int64, error)
+	DeleteComment(ctx context.Context, token, repo string, commentID int64) error
 	ReplyToReview(ctx context.Context, token, repo string, prNumber int, reviewID int, body string) error
 	GetPRStatus(ctx context.Context, token, repo string, prNumber int) (Status, error)
 	GetPRDiff(ctx context.Context, token, repo string, prNumber int) (Diff, error)
+	ClosePR(ctx context.Context, token, repo string, prNumber int) error
+	ReopenPR(ctx context.Context, token, repo string, prNumber int) error
+	GetPRDiffSince(ctx context.Context, token, repo string, prNumber int, sinceSHA string) (Diff, error)
+	GetCodeOwners(ctx context.Context, token, repo string) (string, error)
+	RequestReviewers(ctx context.Context, token, repo string, prNumber int, reviewers []string) error
+	AddLabels(ctx context.Context, token, repo string, prNumber int, labels []string) error
+	RemoveLabel(ctx context.Context, token, repo string, prNumber int, label string) error
+	GetPR(ctx context.Context, token, repo string, prNumber int) (PR, error)
+	MarkReady(ctx context.Context, token, repo string, prNumber int) error
+	GetAuthenticatedUser(ctx context.Context, token string) (User, error)
+	ListPRCommits(ctx context.Context, token, repo string, prNumber int) ([]Commit, error)
+	ListReviews(ctx context.Context, token, repo string, prNumber int) ([]Review, error)
+	SearchUserRepos(ctx context.Context, token, query string) ([]Repo, error)
+	GetRepo(ctx context.Context, token, repo string) (Repo, error)
+	DeleteBranch(ctx context.Context, token, repo, branch string) error
+	RerunFailedChecks(ctx context.Context, token, repo string, prNumber int) error
 }
 
 // GitHubAPIClient implements MCPClient using direct GitHub REST API calls.
@@ -30,27 +52,158 @@ type MCPClient interface {
 type GitHubAPIClient struct {
 	httpClient *http.Client
 	baseAPI    string
+	userAgent  string
+	// Upper bound on files fetched across pages by GetPRDiff
+	maxDiffFiles int
+	// Upper bound on comments returned by GetPRComments
+	maxComments int
+	// Recent GetPRStatus results by head commit; nil when caching is off
+	statuses *statusCache
 }
 
-func newGitHubAPIClient() GitHubAPIClient {
+// DefaultUserAgent is sent when no User-Agent is configured; GitHub rejects requests without one.
+const DefaultUserAgent = "gitter"
+
+// DefaultMaxDiffFiles matches the 3000-file limit of GitHub's list-files endpoint.
+const DefaultMaxDiffFiles = 3000
+
+// DefaultMaxComments bounds how many comments GetPRComments collects for one PR.
+const DefaultMaxComments = 500
+
+// DefaultAPIBaseURL is the public github.com REST endpoint.
+const DefaultAPIBaseURL = "https://api.github.com"
+
+// NormalizeAPIBaseURL trims trailing slashes and, for GitHub Enterprise Server
+// hosts given without a path, appends the "/api/v3" prefix GHES serves REST under.
+// An empty value, or github.com's web host, yields DefaultAPIBaseURL.
+func NormalizeAPIBaseURL(raw string) string {
+	base := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if base == "" {
+		return DefaultAPIBaseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		return base
+	}
+	switch host := strings.ToLower(u.Host); {
+	case host == "github.com" || host == "www.github.com":
+		return DefaultAPIBaseURL
+	case host != "api.github.com" && u.Path == "":
+		base += "/api/v3"
+	}
+	return base
+}
+
+// DefaultTimeout bounds a single GitHub API request when no timeout is configured.
+const DefaultTimeout = 20 * time.Second
+
+// Option configures a GitHubAPIClient built by NewGitHubAPIClient.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	httpClient   *http.Client
+	baseURL      string
+	userAgent    string
+	maxDiffFiles int
+	maxComments  int
+	timeout      time.Duration
+	statusSize   int
+	statusTTL    time.Duration
+}
+
+// WithHTTPClient sends requests through hc instead of a client built by the
+// constructor, e.g. to route through a proxy or a custom transport.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(o *clientOptions) { o.httpClient = hc }
+}
+
+// WithBaseURL points the client at another REST endpoint, such as a GitHub
+// Enterprise Server host. The value is passed through NormalizeAPIBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(o *clientOptions) { o.baseURL = baseURL }
+}
+
+// WithTimeout bounds each request. Combined with WithHTTPClient it applies to a
+// copy of that client, leaving the caller's client untouched.
+func WithTimeout(d time.Duration) Option {
+	return func(o *clientOptions) { o.timeout = d }
+}
+
+// WithUserAgent overrides DefaultUserAgent.
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) { o.userAgent = userAgent }
+}
+
+// WithMaxDiffFiles overrides DefaultMaxDiffFiles.
+func WithMaxDiffFiles(n int) Option {
+	return func(o *clientOptions) { o.maxDiffFiles = n }
+}
+
+// WithMaxComments overrides DefaultMaxComments.
+func WithMaxComments(n int) Option {
+	return func(o *clientOptions) { o.maxComments = n }
+}
+
+// WithStatusCache keeps up to size GetPRStatus results for ttl, keyed by the PR's
+// head commit. Merging, commenting and other writes to a PR drop its entries.
+// Caching is off unless both are positive.
+func WithStatusCache(size int, ttl time.Duration) Option {
+	return func(o *clientOptions) { o.statusSize, o.statusTTL = size, ttl }
+}
+
+// NewGitHubAPIClient builds a REST client for api.github.com unless options say otherwise.
+func NewGitHubAPIClient(opts ...Option) GitHubAPIClient {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if strings.TrimSpace(o.userAgent) == "" {
+		o.userAgent = DefaultUserAgent
+	}
+	if o.maxDiffFiles <= 0 {
+		o.maxDiffFiles = DefaultMaxDiffFiles
+	}
+	if o.maxComments <= 0 {
+		o.maxComments = DefaultMaxComments
+	}
+	hc := o.httpClient
+	switch {
+	case hc == nil:
+		timeout := o.timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		hc = &http.Client{Timeout: timeout}
+	case o.timeout > 0:
+		cp := *hc
+		cp.Timeout = o.timeout
+		hc = &cp
+	}
 	return GitHubAPIClient{
-		httpClient: &http.Client{Timeout: 20 * time.Second},
-		baseAPI:    "https://api.github.com",
+		httpClient:   hc,
+		baseAPI:      NormalizeAPIBaseURL(o.baseURL),
+		userAgent:    o.userAgent,
+		maxDiffFiles: o.maxDiffFiles,
+		maxComments:  o.maxComments,
+		statuses:     newStatusCache(o.statusSize, o.statusTTL),
 	}
 }
 
-// NewMCPClient retains the old constructor signature but returns the REST client.
-func NewMCPClient(address string, enabled bool) MCPClient { //nolint:revive,stylecheck
-	_ = address
-	_ = enabled
-	c := newGitHubAPIClient()
-	return c
+// NewMCPClient returns the REST client behind the MCPClient interface, for callers
+// that only need the interface. Options are those of NewGitHubAPIClient.
+func NewMCPClient(opts ...Option) MCPClient {
+	return NewGitHubAPIClient(opts...)
 }
 
 // ---- Helpers ----
 
 func (c GitHubAPIClient) do(ctx context.Context, token, method, path string, accept string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, method, c.baseAPI+path, body)
+	return c.doURL(ctx, token, method, c.baseAPI+path, accept, body)
+}
+
+// doURL is do for absolute URLs outside the REST base, such as the GraphQL endpoint.
+func (c GitHubAPIClient) doURL(ctx context.Context, token, method, rawURL string, accept string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
 	if err != nil {
 		return nil, err
 	}
@@ -61,20 +214,131 @@ func (c GitHubAPIClient) do(ctx context.Context, token, method, path string, acc
 		accept = "application/vnd.github+json"
 	}
 	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", c.userAgent)
 	return c.httpClient.Do(req)
 }
 
+// RequestIDHeader carries GitHub's per-request identifier, useful for support tickets.
+const RequestIDHeader = "X-GitHub-Request-Id"
+
+// responseError builds a typed error (see APIError) for a non-2xx response, including
+// the GitHub request id.
+// The caller remains responsible for closing resp.Body.
+func responseError(resp *http.Response, what string) error {
+	if rl := rateLimitFromResponse(resp); rl != nil {
+		slog.Warn("github rate limited", "op", what, "reset_at", rl.ResetAt.Format(time.RFC3339), "github_request_id", rl.RequestID)
+		return rl
+	}
+	b, _ := io.ReadAll(resp.Body)
+	reqID := resp.Header.Get(RequestIDHeader)
+	slog.Warn("github request failed", "op", what, "status", resp.StatusCode, "github_request_id", reqID)
+	return newAPIError(&APIError{Op: what, StatusCode: resp.StatusCode, Message: githubErrorMessage(b), RequestID: reqID})
+}
+
+// notFoundError reads a not-found response as a NotFoundError that errors.Is also
+// matches against resource.
+func notFoundError(resp *http.Response, what string, resource error) error {
+	b, _ := io.ReadAll(resp.Body)
+	return &NotFoundError{
+		APIError: &APIError{Op: what, StatusCode: resp.StatusCode, Message: githubErrorMessage(b), RequestID: resp.Header.Get(RequestIDHeader)},
+		Resource: resource,
+	}
+}
+
 func (c GitHubAPIClient) getJSON(ctx context.Context, token, path string, out any) error {
+	_, err := c.getJSONPage(ctx, token, path, out)
+	return err
+}
+
+// getJSONPage is getJSON for paginated endpoints: it also returns the path of the
+// next page from the Link header, or "" on the last page.
+func (c GitHubAPIClient) getJSONPage(ctx context.Context, token, path string, out any) (string, error) {
 	resp, err := c.do(ctx, token, http.MethodGet, path, "application/vnd.github+json", nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("github api %s failed: %s", path, strings.TrimSpace(string(b)))
+		return "", responseError(resp, "github api "+path)
 	}
-	return json.NewDecoder(resp.Body).Decode(out)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", err
+	}
+	return c.nextPagePath(resp.Header.Get("Link")), nil
+}
+
+// getPages follows Link headers from path, collecting up to max items. The bool
+// reports whether more items were left unfetched.
+func getPages[T any](ctx context.Context, c GitHubAPIClient, token, path string, max int) ([]T, bool, error) {
+	var items []T
+	for path != "" {
+		var page []T
+		next, err := c.getJSONPage(ctx, token, path, &page)
+		if err != nil {
+			return nil, false, err
+		}
+		items = append(items, page...)
+		if len(items) >= max {
+			truncated := next != "" || len(items) > max
+			return items[:max], truncated, nil
+		}
+		path = next
+	}
+	return items, false, nil
+}
+
+// nextPagePath extracts the rel="next" URL from a Link header and makes it
+// relative to baseAPI so it can be passed back to do.
+func (c GitHubAPIClient) nextPagePath(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segs := strings.Split(part, ";")
+		if len(segs) < 2 {
+			continue
+		}
+		isNext := false
+		for _, p := range segs[1:] {
+			if strings.TrimSpace(p) == `rel="next"` {
+				isNext = true
+				break
+			}
+		}
+		if !isNext {
+			continue
+		}
+		u := strings.Trim(strings.TrimSpace(segs[0]), "<>")
+		if strings.HasPrefix(u, c.baseAPI) {
+			return strings.TrimPrefix(u, c.baseAPI)
+		}
+		// Unexpected host; keep only path and query
+		if parsed, err := url.Parse(u); err == nil {
+			return parsed.RequestURI()
+		}
+	}
+	return ""
+}
+
+// parseRepo splits an "owner/name" reference, tolerating surrounding whitespace,
+// a leading "@", a github.com URL prefix and a trailing slash. Anything that
+// doesn't reduce to exactly two non-empty segments is rejected.
+func parseRepo(repo string) (owner, name string, err error) {
+	r := strings.TrimSpace(repo)
+	for _, prefix := range []string{"https://github.com/", "http://github.com/", "github.com/"} {
+		if len(r) >= len(prefix) && strings.EqualFold(r[:len(prefix)], prefix) {
+			r = r[len(prefix):]
+			break
+		}
+	}
+	r = strings.TrimPrefix(r, "@")
+	r = strings.TrimSuffix(r, "/")
+	parts := strings.Split(r, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid repo %q", repo)
+	}
+	owner, name = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if owner == "" || name == "" {
+		return "", "", fmt.Errorf("invalid repo %q", repo)
+	}
+	return owner, name, nil
 }
 
 func repoFromHTMLURL(u string) string {
@@ -91,18 +355,39 @@ func repoFromHTMLURL(u string) string {
 	return parts[0] + "/" + parts[1]
 }
 
+// repoFromAPIURL extracts owner/repo from a REST repository URL such as
+// https://api.github.com/repos/owner/repo, which also works for Enterprise hosts.
+func repoFromAPIURL(u string) string {
+	i := strings.LastIndex(u, "/repos/")
+	if i == -1 {
+		return ""
+	}
+	parts := strings.Split(u[i+len("/repos/"):], "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
+
 // ---- Implementations ----
 
 // Search Issues response (minimal fields used)
 type searchIssuesResponse struct {
 	Items []struct {
-		Number        int    `json:"number"`
-		Title         string `json:"title"`
-		HTMLURL       string `json:"html_url"`
-		RepositoryURL string `json:"repository_url"`
+		Number        int       `json:"number"`
+		Title         string    `json:"title"`
+		HTMLURL       string    `json:"html_url"`
+		RepositoryURL string    `json:"repository_url"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Draft         bool      `json:"draft"`
+		State         string    `json:"state"`
 		User          struct {
 			Login string `json:"login"`
 		} `json:"user"`
+		PullRequest struct {
+			MergedAt *time.Time `json:"merged_at"`
+		} `json:"pull_request"`
 	} `json:"items"`
 }
 
@@ -112,6 +397,9 @@ func (c GitHubAPIClient) searchPRs(ctx context.Context, token, q string) ([]PR,
 	qv := url.Values{}
 	qv.Set("q", q)
 	qv.Set("per_page", "20")
+	// Recent activity first so the page we fetch holds the PRs users care about
+	qv.Set("sort", "updated")
+	qv.Set("order", "desc")
 	u.RawQuery = qv.Encode()
 	var resp searchIssuesResponse
 	if err := c.getJSON(ctx, token, u.String(), &resp); err != nil {
@@ -119,147 +407,375 @@ func (c GitHubAPIClient) searchPRs(ctx context.Context, token, q string) ([]PR,
 	}
 	out := make([]PR, 0, len(resp.Items))
 	for _, it := range resp.Items {
-		repo := repoFromHTMLURL(it.HTMLURL)
+		repo := repoFromAPIURL(it.RepositoryURL)
+		if repo == "" {
+			repo = repoFromHTMLURL(it.HTMLURL)
+		}
+		status := it.State
+		if it.PullRequest.MergedAt != nil {
+			status = "merged"
+		} else if status == "" {
+			status = "open"
+		}
 		out = append(out, PR{
 			Number:     it.Number,
 			Title:      it.Title,
 			Author:     it.User.Login,
-			Status:     "open",
+			Status:     status,
 			URL:        it.HTMLURL,
 			Repository: repo,
+			CreatedAt:  it.CreatedAt,
+			UpdatedAt:  it.UpdatedAt,
+			IsDraft:    it.Draft,
 		})
 	}
+	SortPRs(out, "updated")
 	return out, nil
 }
 
 func (c GitHubAPIClient) ListPRsForReview(ctx context.Context, token string) ([]PR, error) {
 	// type:pr state:open review-requested:@me
-	return c.searchPRs(ctx, token, "type:pr state:open review-requested:@me")
+	return c.ListPRs(ctx, token, IntentListReview, PRFilter{})
 }
 
 func (c GitHubAPIClient) ListUserPRs(ctx context.Context, token string) ([]PR, error) {
 	// type:pr state:open author:@me
-	return c.searchPRs(ctx, token, "type:pr state:open author:@me")
+	return c.ListPRs(ctx, token, IntentListMine, PRFilter{})
+}
+
+// PRFilter narrows the PR list searches. The zero value means open PRs in any repo.
+type PRFilter struct {
+	Repo  string // owner/name
+	State string // one of PRStates; empty means open
+}
+
+// PRStates are the State values PRFilter accepts.
+var PRStates = []string{"open", "closed", "merged", "all"}
+
+// ValidPRState reports whether state is empty or one of PRStates.
+func ValidPRState(state string) bool {
+	if state == "" {
+		return true
+	}
+	for _, s := range PRStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// ListPRs searches the user's authored PRs (IntentListMine) or review requests
+// (IntentListReview), narrowed by filter.
+func (c GitHubAPIClient) ListPRs(ctx context.Context, token string, kind IntentKind, filter PRFilter) ([]PR, error) {
+	q, err := prSearchQuery(kind, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.searchPRs(ctx, token, q)
+}
+
+// prSearchQuery builds the search-issues query for kind and filter, e.g.
+// "type:pr is:merged author:@me repo:me/app".
+func prSearchQuery(kind IntentKind, filter PRFilter) (string, error) {
+	parts := []string{"type:pr"}
+	switch filter.State {
+	case "", "open":
+		parts = append(parts, "state:open")
+	case "closed":
+		parts = append(parts, "state:closed")
+	case "merged":
+		parts = append(parts, "is:merged")
+	case "all":
+	default:
+		return "", fmt.Errorf("invalid PR state %q", filter.State)
+	}
+	if kind == IntentListReview {
+		parts = append(parts, "review-requested:@me")
+	} else {
+		parts = append(parts, "author:@me")
+	}
+	if strings.TrimSpace(filter.Repo) != "" {
+		owner, name, err := parseRepo(filter.Repo)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "repo:"+owner+"/"+name)
+	}
+	return strings.Join(parts, " "), nil
 }
 
 // ReviewComment represents a pull request review comment (inline)
 type reviewComment struct {
-	User struct {
+	NodeID string `json:"node_id"`
+	User   struct {
 		Login string `json:"login"`
 	} `json:"user"`
-	Body string `json:"body"`
-	Path string `json:"path"`
-	Line int    `json:"line"`
+	Body      string `json:"body"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	CreatedAt string `json:"created_at"`
 }
 
 // IssueComment represents a general PR (issue) comment
 type issueComment struct {
-	User struct {
+	NodeID string `json:"node_id"`
+	User   struct {
 		Login string `json:"login"`
 	} `json:"user"`
 	Body      string `json:"body"`
 	CreatedAt string `json:"created_at"`
 }
 
-func (c GitHubAPIClient) GetPRComments(ctx context.Context, token, repo string, prNumber int) ([]Comment, error) {
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return nil, fmt.Errorf("invalid repo: %s", repo)
+// GetPRComments returns a PR's inline and general comments, oldest first. At most
+// maxComments are returned; the bool reports whether more were left out.
+func (c GitHubAPIClient) GetPRComments(ctx context.Context, token, repo string, prNumber int) ([]Comment, bool, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return nil, false, err
 	}
-	owner, name := ownerRepo[0], ownerRepo[1]
 	// Review comments (inline)
-	var review []reviewComment
-	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d/comments", owner, name, prNumber), &review); err != nil {
-		return nil, err
+	review, reviewTruncated, err := getPages[reviewComment](ctx, c, token, fmt.Sprintf("/repos/%s/%s/pulls/%d/comments?per_page=100", owner, name, prNumber), c.maxComments)
+	if err != nil {
+		return nil, false, err
 	}
 	// Issue comments (general)
-	var issue []issueComment
-	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, name, prNumber), &issue); err != nil {
-		return nil, err
+	issue, issueTruncated, err := getPages[issueComment](ctx, c, token, fmt.Sprintf("/repos/%s/%s/issues/%d/comments?per_page=100", owner, name, prNumber), c.maxComments)
+	if err != nil {
+		return nil, false, err
 	}
 	out := make([]Comment, 0, len(review)+len(issue))
+	// The same comment can surface through both endpoints; node IDs are global
+	seen := make(map[string]bool, len(review)+len(issue))
+	add := func(nodeID string, cm Comment) {
+		key := nodeID
+		if key == "" {
+			key = cm.Author + "\x00" + cm.Timestamp + "\x00" + cm.Body
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		out = append(out, cm)
+	}
 	for _, rc := range review {
-		out = append(out, Comment{Author: rc.User.Login, Body: rc.Body, Timestamp: "", Type: "inline", Path: rc.Path, Line: rc.Line})
+		add(rc.NodeID, Comment{Author: rc.User.Login, Body: rc.Body, Timestamp: rc.CreatedAt, Type: "inline", Path: rc.Path, Line: rc.Line})
 	}
 	for _, ic := range issue {
-		out = append(out, Comment{Author: ic.User.Login, Body: ic.Body, Timestamp: ic.CreatedAt, Type: "general"})
+		add(ic.NodeID, Comment{Author: ic.User.Login, Body: ic.Body, Timestamp: ic.CreatedAt, Type: "general"})
 	}
-	return out, nil
+	sortCommentsByTime(out)
+	truncated := reviewTruncated || issueTruncated
+	if len(out) > c.maxComments {
+		out = out[:c.maxComments]
+		truncated = true
+	}
+	return out, truncated, nil
 }
 
-func (c GitHubAPIClient) MergePR(ctx context.Context, token, repo string, prNumber int, method string) error {
+// sortCommentsByTime orders comments oldest first. Comments without a parseable
+// timestamp keep their relative order at the end.
+func sortCommentsByTime(comments []Comment) {
+	at := func(c Comment) (time.Time, bool) {
+		t, err := time.Parse(time.RFC3339, c.Timestamp)
+		return t, err == nil
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		ti, okI := at(comments[i])
+		tj, okJ := at(comments[j])
+		if okI != okJ {
+			return okI
+		}
+		return okI && ti.Before(tj)
+	})
+}
+
+// MergePR merges a PR. commitTitle and commitMessage override GitHub's generated
+// merge/squash commit text when non-empty.
+func (c GitHubAPIClient) MergePR(ctx context.Context, token, repo string, prNumber int, method, commitTitle, commitMessage string) error {
 	if method == "" {
 		method = "merge"
 	}
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return fmt.Errorf("invalid repo: %s", repo)
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
 	}
-	owner, name := ownerRepo[0], ownerRepo[1]
-	// Build minimal JSON body
-	body := strings.NewReader(fmt.Sprintf(`{"merge_method":"%s"}`, method))
-	resp, err := c.do(ctx, token, http.MethodPut, fmt.Sprintf("/repos/%s/%s/pulls/%d/merge", owner, name, prNumber), "application/vnd.github+json", body)
+	payload := map[string]string{"merge_method": method}
+	if t := strings.TrimSpace(commitTitle); t != "" {
+		payload["commit_title"] = t
+	}
+	if m := strings.TrimSpace(commitMessage); m != "" {
+		payload["commit_message"] = m
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, token, http.MethodPut, fmt.Sprintf("/repos/%s/%s/pulls/%d/merge", owner, name, prNumber), "application/vnd.github+json", bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("merge failed: %s", strings.TrimSpace(string(b)))
+		return responseError(resp, "merge")
 	}
+	c.statuses.invalidate(repo, prNumber)
 	return nil
 }
 
-func (c GitHubAPIClient) AddComment(ctx context.Context, token, repo string, prNumber int, body string) error {
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return fmt.Errorf("invalid repo: %s", repo)
+// AddComment posts a general comment on a PR and returns the new comment's ID.
+func (c GitHubAPIClient) AddComment(ctx context.Context, token, repo string, prNumber int, body string) (int64, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return 0, err
+	}
+	b, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, name, prNumber), "application/vnd.github+json", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, responseError(resp, "add comment")
+	}
+	c.statuses.invalidate(repo, prNumber)
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// ErrCommentNotFound matches the NotFoundError DeleteComment returns when the
+// comment no longer exists.
+var ErrCommentNotFound = errors.New("comment not found")
+
+// DeleteComment deletes an issue comment.
+// GitHub API: DELETE /repos/{owner}/{repo}/issues/comments/{comment_id}
+func (c GitHubAPIClient) DeleteComment(ctx context.Context, token, repo string, commentID int64) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
 	}
-	owner, name := ownerRepo[0], ownerRepo[1]
-	payload := strings.NewReader(fmt.Sprintf(`{"body":%q}`, body))
-	resp, err := c.do(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, name, prNumber), "application/vnd.github+json", payload)
+	resp, err := c.do(ctx, token, http.MethodDelete, fmt.Sprintf("/repos/%s/%s/issues/comments/%d", owner, name, commentID), "application/vnd.github+json", nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notFoundError(resp, "delete comment", ErrCommentNotFound)
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("add comment failed: %s", strings.TrimSpace(string(b)))
+		return responseError(resp, "delete comment")
 	}
 	return nil
 }
 
+// ClosePR closes a pull request without merging it.
+// GitHub API: PATCH /repos/{owner}/{repo}/pulls/{pull_number} with {"state":"closed"}
+func (c GitHubAPIClient) ClosePR(ctx context.Context, token, repo string, prNumber int) error {
+	return c.setPRState(ctx, token, repo, prNumber, "closed", "close pr")
+}
+
+// ErrReopenMerged is returned by ReopenPR when the pull request has already been merged.
+var ErrReopenMerged = errors.New("can't reopen a merged PR")
+
+// ReopenPR reopens a closed pull request. Merged PRs can't be reopened, so this
+// checks the PR first and returns ErrReopenMerged rather than GitHub's 422.
+func (c GitHubAPIClient) ReopenPR(ctx context.Context, token, repo string, prNumber int) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	var pr prDetails
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), &pr); err != nil {
+		return err
+	}
+	if pr.Merged {
+		return ErrReopenMerged
+	}
+	return c.setPRState(ctx, token, repo, prNumber, "open", "reopen pr")
+}
+
+func (c GitHubAPIClient) setPRState(ctx context.Context, token, repo string, prNumber int, state, what string) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{"state": state})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, token, http.MethodPatch, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), "application/vnd.github+json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, what)
+	}
+	c.statuses.invalidate(repo, prNumber)
+	return nil
+}
+
 // ReplyToReview posts a reply to a specific review comment thread.
 // GitHub API: POST /repos/{owner}/{repo}/pulls/{pull_number}/comments/{comment_id}/replies
 // Note: This endpoint creates a threaded reply under a review comment.
 func (c GitHubAPIClient) ReplyToReview(ctx context.Context, token, repo string, prNumber int, reviewID int, body string) error {
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return fmt.Errorf("invalid repo: %s", repo)
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
 	}
-	owner, name := ownerRepo[0], ownerRepo[1]
-	payload := strings.NewReader(fmt.Sprintf(`{"body":%q}`, body))
 	path := fmt.Sprintf("/repos/%s/%s/pulls/%d/comments/%d/replies", owner, name, prNumber, reviewID)
-	resp, err := c.do(ctx, token, http.MethodPost, path, "application/vnd.github+json", payload)
+	resp, err := c.do(ctx, token, http.MethodPost, path, "application/vnd.github+json", bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("reply to review failed: %s", strings.TrimSpace(string(b)))
+		return responseError(resp, "reply to review")
 	}
+	c.statuses.invalidate(repo, prNumber)
 	return nil
 }
 
 // PR details minimal subset
 type prDetails struct {
-	Mergeable *bool  `json:"mergeable"`
-	State     string `json:"state"`
-	HTMLURL   string `json:"html_url"`
+	NodeID string `json:"node_id"`
+	Draft  bool   `json:"draft"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Mergeable *bool     `json:"mergeable"`
+	Merged    bool      `json:"merged"`
+	State     string    `json:"state"`
+	HTMLURL   string    `json:"html_url"`
 	Head      struct {
-		SHA string `json:"sha"`
+		SHA  string `json:"sha"`
+		Ref  string `json:"ref"`
+		Repo *struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
 	} `json:"head"`
+	Base struct {
+		SHA string `json:"sha"`
+	} `json:"base"`
+	// "dirty" means merge conflicts; see mergeable_state in the pulls API
+	MergeableState string `json:"mergeable_state"`
 }
 
 type review struct {
@@ -267,6 +783,7 @@ type review struct {
 	User  struct {
 		Login string `json:"login"`
 	} `json:"user"`
+	SubmittedAt time.Time `json:"submitted_at"`
 }
 
 type commitStatus struct {
@@ -274,53 +791,136 @@ type commitStatus struct {
 	Statuses []struct {
 		State   string `json:"state"`
 		Context string `json:"context"`
+		// Link to the CI run's details; empty when the integration sets none
+		TargetURL string `json:"target_url"`
 	} `json:"statuses"`
 }
 
+// checkRuns is the check runs API's view of a commit. GitHub Actions and other
+// GitHub Apps report here rather than through commit statuses.
+type checkRuns struct {
+	CheckRuns []struct {
+		Name string `json:"name"`
+		// queued, in_progress or completed; conclusion is only set once completed
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"check_runs"`
+}
+
+// failedConclusion reports whether a completed check run or suite's conclusion
+// counts as failing, both for a PR's status and for what gets re-run.
+func failedConclusion(conclusion string) bool {
+	switch strings.ToLower(conclusion) {
+	case "failure", "timed_out", "cancelled", "action_required", "startup_failure":
+		return true
+	}
+	return false
+}
+
 func (c GitHubAPIClient) GetPRStatus(ctx context.Context, token, repo string, prNumber int) (Status, error) {
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return Status{}, fmt.Errorf("invalid repo: %s", repo)
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return Status{}, err
 	}
-	owner, name := ownerRepo[0], ownerRepo[1]
 	var pr prDetails
 	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), &pr); err != nil {
 		return Status{}, err
 	}
+	if st, ok := c.statuses.get(repo, prNumber, pr.Head.SHA); ok {
+		return st, nil
+	}
 	// Reviews (accumulate approvals)
-	var revs []review
-	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", owner, name, prNumber), &revs); err != nil {
+	revs, err := c.ListReviews(ctx, token, repo, prNumber)
+	if err != nil {
 		return Status{}, err
 	}
 	approvals := make([]string, 0)
 	for _, r := range revs {
-		if strings.EqualFold(r.State, "APPROVED") {
-			approvals = append(approvals, r.User.Login)
+		if r.State == "APPROVED" {
+			approvals = append(approvals, r.Reviewer)
 		}
 	}
-	// Status checks for head sha
+	// Status checks and check runs for head sha; either may be missing when the
+	// token can't read it, which leaves those checks out rather than failing
 	checksPassing, checksTotal := 0, 0
-	var cs commitStatus
+	var failing []string
+	var failingChecks []Check
 	if pr.Head.SHA != "" {
+		var cs commitStatus
 		if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/commits/%s/status", owner, name, pr.Head.SHA), &cs); err == nil {
-			checksTotal = len(cs.Statuses)
+			checksTotal += len(cs.Statuses)
 			for _, s := range cs.Statuses {
-				if strings.EqualFold(s.State, "success") {
+				switch {
+				case strings.EqualFold(s.State, "success"):
+					checksPassing++
+				case strings.EqualFold(s.State, "failure"), strings.EqualFold(s.State, "error"):
+					failing = append(failing, s.Context)
+					failingChecks = append(failingChecks, Check{Name: s.Context, URL: s.TargetURL})
+				}
+			}
+		}
+		var runs checkRuns
+		if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/commits/%s/check-runs?per_page=100", owner, name, pr.Head.SHA), &runs); err == nil {
+			checksTotal += len(runs.CheckRuns)
+			for _, r := range runs.CheckRuns {
+				if !strings.EqualFold(r.Status, "completed") {
+					continue
+				}
+				switch conclusion := strings.ToLower(r.Conclusion); {
+				// Skipped and neutral runs don't hold up a merge on GitHub either
+				case conclusion == "success", conclusion == "neutral", conclusion == "skipped":
 					checksPassing++
+				case failedConclusion(conclusion):
+					failing = append(failing, r.Name)
+					failingChecks = append(failingChecks, Check{Name: r.Name, URL: r.HTMLURL})
 				}
 			}
 		}
 	}
 	st := Status{
-		ChecksPassing: checksPassing,
-		ChecksTotal:   checksTotal,
-		Approvals:     approvals,
-		Mergeable:     pr.Mergeable != nil && *pr.Mergeable,
-		HasConflicts:  false,
+		ChecksPassing:   checksPassing,
+		ChecksTotal:     checksTotal,
+		Approvals:       approvals,
+		Mergeable:       pr.Mergeable != nil && *pr.Mergeable,
+		HasConflicts:    strings.EqualFold(pr.MergeableState, "dirty"),
+		FailingCheckIDs: failing,
+		FailingChecks:   failingChecks,
+	}
+	// GitHub works out mergeability in the background and reports null until it
+	// has; caching that would hold a clean PR at "not mergeable" for the whole TTL
+	if pr.Mergeable != nil {
+		c.statuses.put(repo, prNumber, pr.Head.SHA, st)
 	}
 	return st, nil
 }
 
+// maxPRReviews bounds how many reviews ListReviews collects for one PR. It is kept
+// apart from maxComments: reviews come oldest first, so a low cap would drop the
+// latest verdicts, which are the ones that count.
+const maxPRReviews = 1000
+
+// ListReviews returns every submitted review on a PR, oldest first, following
+// pagination up to maxPRReviews. Pending reviews, visible only to their author, are left out.
+func (c GitHubAPIClient) ListReviews(ctx context.Context, token, repo string, prNumber int) ([]Review, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	revs, _, err := getPages[review](ctx, c, token, fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews?per_page=100", owner, name, prNumber), maxPRReviews)
+	if err != nil {
+		return nil, err
+	}
+	reviews := make([]Review, 0, len(revs))
+	for _, r := range revs {
+		if strings.EqualFold(r.State, "PENDING") {
+			continue
+		}
+		reviews = append(reviews, Review{Reviewer: r.User.Login, State: strings.ToUpper(r.State), SubmittedAt: r.SubmittedAt})
+	}
+	return reviews, nil
+}
+
 type prFile struct {
 	Filename  string `json:"filename"`
 	Additions int    `json:"additions"`
@@ -329,23 +929,407 @@ type prFile struct {
 }
 
 func (c GitHubAPIClient) GetPRDiff(ctx context.Context, token, repo string, prNumber int) (Diff, error) {
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return Diff{}, fmt.Errorf("invalid repo: %s", repo)
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return Diff{}, err
 	}
-	owner, name := ownerRepo[0], ownerRepo[1]
 	path := fmt.Sprintf("/repos/%s/%s/pulls/%d/files?per_page=%s", owner, name, prNumber, url.QueryEscape(strconv.Itoa(100)))
-	var files []prFile
-	if err := c.getJSON(ctx, token, path, &files); err != nil {
+	files, truncated, err := getPages[prFile](ctx, c, token, path, c.maxDiffFiles)
+	if err != nil {
 		return Diff{}, err
 	}
+	diff := diffFromFiles(files)
+	diff.Truncated = truncated
+	return diff, nil
+}
+
+// diffFromFiles converts GitHub file entries into a Diff with aggregated totals.
+func diffFromFiles(files []prFile) Diff {
 	diff := Diff{Files: make([]DiffFile, 0, len(files))}
 	for _, f := range files {
-		df := DiffFile(f)
+		df := DiffFile{
+			Filename:  f.Filename,
+			Additions: f.Additions,
+			Deletions: f.Deletions,
+			Patch:     f.Patch,
+			Hunks:     parseHunks(f.Patch),
+		}
 		diff.Files = append(diff.Files, df)
 		diff.Additions += df.Additions
 		diff.Deletions += df.Deletions
 	}
 	diff.FilesChanged = len(diff.Files)
+	return diff
+}
+
+// compareResponse is the subset of GET /repos/{owner}/{repo}/compare/{base}...{head} we use.
+type compareResponse struct {
+	Files []prFile `json:"files"`
+}
+
+// GetPRDiffSince returns the changes between sinceSHA and the PR's current head,
+// so reviewers only see what's new since they last looked. An empty sinceSHA
+// compares from the PR base, i.e. the full PR diff. The result carries HeadSHA
+// so callers can record it as the new review point.
+func (c GitHubAPIClient) GetPRDiffSince(ctx context.Context, token, repo string, prNumber int, sinceSHA string) (Diff, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return Diff{}, err
+	}
+	var pr prDetails
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), &pr); err != nil {
+		return Diff{}, err
+	}
+	base := strings.TrimSpace(sinceSHA)
+	if base == "" {
+		base = pr.Base.SHA
+	}
+	if base == pr.Head.SHA {
+		return Diff{Files: []DiffFile{}, HeadSHA: pr.Head.SHA, BaseSHA: base}, nil
+	}
+	path := fmt.Sprintf("/repos/%s/%s/compare/%s...%s", owner, name, url.PathEscape(base), url.PathEscape(pr.Head.SHA))
+	var cmp compareResponse
+	if err := c.getJSON(ctx, token, path, &cmp); err != nil {
+		return Diff{}, err
+	}
+	diff := diffFromFiles(cmp.Files)
+	diff.HeadSHA = pr.Head.SHA
+	diff.BaseSHA = base
 	return diff, nil
 }
+
+// ErrNoCodeOwners is returned by GetCodeOwners when the repo has no CODEOWNERS file.
+var ErrNoCodeOwners = errors.New("no CODEOWNERS file")
+
+// codeOwnersLocations are checked in the order GitHub itself uses.
+var codeOwnersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// GetCodeOwners fetches the raw CODEOWNERS content from the repo's default branch.
+func (c GitHubAPIClient) GetCodeOwners(ctx context.Context, token, repo string) (string, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return "", err
+	}
+	for _, loc := range codeOwnersLocations {
+		resp, err := c.do(ctx, token, http.MethodGet, fmt.Sprintf("/repos/%s/%s/contents/%s", owner, name, loc), "application/vnd.github.raw", nil)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err := responseError(resp, "get codeowners")
+			resp.Body.Close()
+			return "", err
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", ErrNoCodeOwners
+}
+
+// RequestReviewers asks the given users to review a PR.
+// GitHub API: POST /repos/{owner}/{repo}/pulls/{pull_number}/requested_reviewers
+// GitHub answers 422 without saying which user was rejected, so on 422 each reviewer is
+// checked for collaborator access and the failures are returned as InvalidReviewersError.
+func (c GitHubAPIClient) RequestReviewers(ctx context.Context, token, repo string, prNumber int, reviewers []string) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string][]string{"reviewers": reviewers})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls/%d/requested_reviewers", owner, name, prNumber), "application/vnd.github+json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		if invalid := c.nonCollaborators(ctx, token, owner, name, reviewers); len(invalid) > 0 {
+			return &InvalidReviewersError{Reviewers: invalid}
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, "request reviewers")
+	}
+	return nil
+}
+
+// nonCollaborators returns the users GitHub reports as not collaborators on the repo.
+// Users that can't be checked (e.g. no permission to list collaborators) are not reported.
+func (c GitHubAPIClient) nonCollaborators(ctx context.Context, token, owner, name string, users []string) []string {
+	var out []string
+	for _, u := range users {
+		resp, err := c.do(ctx, token, http.MethodGet, fmt.Sprintf("/repos/%s/%s/collaborators/%s", owner, name, url.PathEscape(u)), "application/vnd.github+json", nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// AddLabels adds labels to a PR, creating any that don't exist in the repo yet.
+// GitHub API: POST /repos/{owner}/{repo}/issues/{issue_number}/labels
+func (c GitHubAPIClient) AddLabels(ctx context.Context, token, repo string, prNumber int, labels []string) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string][]string{"labels": labels})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/labels", owner, name, prNumber), "application/vnd.github+json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, "add labels")
+	}
+	return nil
+}
+
+// ErrLabelNotFound matches the NotFoundError RemoveLabel returns when the PR
+// doesn't have the label.
+var ErrLabelNotFound = errors.New("label not on pr")
+
+// RemoveLabel removes a single label from a PR.
+// GitHub API: DELETE /repos/{owner}/{repo}/issues/{issue_number}/labels/{name}
+func (c GitHubAPIClient) RemoveLabel(ctx context.Context, token, repo string, prNumber int, label string) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, token, http.MethodDelete, fmt.Sprintf("/repos/%s/%s/issues/%d/labels/%s", owner, name, prNumber, url.PathEscape(label)), "application/vnd.github+json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notFoundError(resp, "remove label", ErrLabelNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, "remove label")
+	}
+	return nil
+}
+
+// GetPR fetches a single PR including its description.
+func (c GitHubAPIClient) GetPR(ctx context.Context, token, repo string, prNumber int) (PR, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return PR{}, err
+	}
+	var pr prDetails
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), &pr); err != nil {
+		return PR{}, err
+	}
+	status := pr.State
+	if pr.Merged {
+		status = "merged"
+	}
+	var headRepo string
+	if pr.Head.Repo != nil {
+		headRepo = pr.Head.Repo.FullName
+	}
+	return PR{
+		Number:     pr.Number,
+		Title:      pr.Title,
+		Author:     pr.User.Login,
+		Status:     status,
+		URL:        pr.HTMLURL,
+		Repository: owner + "/" + name,
+		Body:       pr.Body,
+		HeadRef:    pr.Head.Ref,
+		HeadRepo:   headRepo,
+		CreatedAt:  pr.CreatedAt,
+		UpdatedAt:  pr.UpdatedAt,
+		IsDraft:    pr.Draft,
+	}, nil
+}
+
+// ErrBranchNotFound matches the NotFoundError DeleteBranch returns when the branch
+// is already gone.
+var ErrBranchNotFound = errors.New("branch not found")
+
+// DeleteBranch deletes a branch of repo.
+// GitHub API: DELETE /repos/{owner}/{repo}/git/refs/heads/{branch}
+func (c GitHubAPIClient) DeleteBranch(ctx context.Context, token, repo, branch string) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(branch) == "" {
+		return errors.New("branch is required")
+	}
+	// Branch names may contain slashes, which stay as path separators in the ref
+	segs := strings.Split(branch, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	resp, err := c.do(ctx, token, http.MethodDelete, fmt.Sprintf("/repos/%s/%s/git/refs/heads/%s", owner, name, strings.Join(segs, "/")), "application/vnd.github+json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// GitHub answers 422 "Reference does not exist" for a branch that's already deleted
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity {
+		return notFoundError(resp, "delete branch", ErrBranchNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, "delete branch")
+	}
+	return nil
+}
+
+// maxPRCommits is the most commits GitHub's list-commits endpoint returns for a PR.
+const maxPRCommits = 250
+
+// ListPRCommits returns a PR's commits, oldest first, following pagination up to
+// the 250 commits GitHub lists.
+func (c GitHubAPIClient) ListPRCommits(ctx context.Context, token, repo string, prNumber int) ([]Commit, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	type prCommit struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"commit"`
+		Author *struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	}
+	raw, _, err := getPages[prCommit](ctx, c, token, fmt.Sprintf("/repos/%s/%s/pulls/%d/commits?per_page=100", owner, name, prNumber), maxPRCommits)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]Commit, 0, len(raw))
+	for _, rc := range raw {
+		author := rc.Commit.Author.Name
+		// author is null when the commit email isn't linked to a GitHub account
+		if rc.Author != nil && rc.Author.Login != "" {
+			author = rc.Author.Login
+		}
+		commits = append(commits, Commit{SHA: rc.SHA, Message: rc.Commit.Message, Author: author})
+	}
+	return commits, nil
+}
+
+// maxUserRepos bounds how many of the user's repos SearchUserRepos scans.
+const maxUserRepos = 1000
+
+// SearchUserRepos returns the repos the token's user can access, as owner,
+// collaborator or org member, whose name contains query (case-insensitively).
+// An empty query returns every repo scanned.
+func (c GitHubAPIClient) SearchUserRepos(ctx context.Context, token, query string) ([]Repo, error) {
+	raw, _, err := getPages[userRepo](ctx, c, token, "/user/repos?per_page=100&affiliation=owner,collaborator,organization_member&sort=pushed", maxUserRepos)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+	repos := make([]Repo, 0)
+	for _, r := range raw {
+		if query != "" && !strings.Contains(strings.ToLower(r.Name), query) {
+			continue
+		}
+		repos = append(repos, r.repo())
+	}
+	return repos, nil
+}
+
+// GetRepo fetches one repo ("owner/name"). A repo that doesn't exist or the token
+// can't see is a NotFoundError.
+// GitHub API: GET /repos/{owner}/{repo}
+func (c GitHubAPIClient) GetRepo(ctx context.Context, token, repo string) (Repo, error) {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return Repo{}, err
+	}
+	var raw userRepo
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s", owner, name), &raw); err != nil {
+		return Repo{}, err
+	}
+	return raw.repo(), nil
+}
+
+// userRepo is the part of GitHub's repository object Repo is built from.
+type userRepo struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Private  bool   `json:"private"`
+	HTMLURL  string `json:"html_url"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+func (r userRepo) repo() Repo {
+	return Repo{FullName: r.FullName, Owner: r.Owner.Login, Name: r.Name, Private: r.Private, URL: r.HTMLURL}
+}
+
+// ErrNoFailingChecks is returned by RerunFailedChecks when no check suite on the
+// PR's head commit has failed.
+var ErrNoFailingChecks = errors.New("no failing checks")
+
+// RerunFailedChecks asks GitHub to re-run every failed check suite on a PR's head
+// commit.
+// GitHub API: POST /repos/{owner}/{repo}/check-suites/{check_suite_id}/rerequest
+func (c GitHubAPIClient) RerunFailedChecks(ctx context.Context, token, repo string, prNumber int) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	var pr prDetails
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), &pr); err != nil {
+		return err
+	}
+	var suites struct {
+		CheckSuites []struct {
+			ID         int64  `json:"id"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_suites"`
+	}
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/commits/%s/check-suites?per_page=100", owner, name, pr.Head.SHA), &suites); err != nil {
+		return err
+	}
+	rerun := 0
+	for _, suite := range suites.CheckSuites {
+		if !failedConclusion(suite.Conclusion) {
+			continue
+		}
+		resp, err := c.do(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/%s/check-suites/%d/rerequest", owner, name, suite.ID), "application/vnd.github+json", nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err := responseError(resp, "rerun check suite")
+			resp.Body.Close()
+			return err
+		}
+		resp.Body.Close()
+		rerun++
+	}
+	if rerun == 0 {
+		return ErrNoFailingChecks
+	}
+	c.statuses.invalidate(repo, prNumber)
+	return nil
+}
@@ -0,0 +1,796 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient serves the REST API from mux. The handlers see paths under
+// /api/v3, since a bare host is taken for a GitHub Enterprise Server.
+func newTestClient(t *testing.T, mux *http.ServeMux, opts ...Option) MCPClient {
+	t.Helper()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return NewMCPClient(append([]Option{WithBaseURL(ts.URL), WithHTTPClient(ts.Client())}, opts...)...)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Errorf("encode response: %v", err)
+	}
+}
+
+func TestNewMCPClientUsesInjectedHTTPClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "gitter-test" {
+			t.Errorf("User-Agent = %q", got)
+		}
+		writeJSON(t, w, map[string]any{
+			"number":   5,
+			"title":    "Fix auth",
+			"state":    "open",
+			"draft":    true,
+			"user":     map[string]any{"login": "alice"},
+			"html_url": "https://github.com/acme/app/pull/5",
+			"head":     map[string]any{"ref": "fix-auth", "sha": "abc", "repo": map[string]any{"full_name": "acme/app"}},
+		})
+	})
+	c := newTestClient(t, mux, WithUserAgent("gitter-test"))
+
+	pr, err := c.GetPR(context.Background(), "tok", "acme/app", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PR{Number: 5, Title: "Fix auth", Author: "alice", Status: "open", URL: "https://github.com/acme/app/pull/5", Repository: "acme/app", HeadRef: "fix-auth", HeadRepo: "acme/app", IsDraft: true}
+	if pr != want {
+		t.Errorf("GetPR = %+v, want %+v", pr, want)
+	}
+}
+
+func TestNormalizeAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "", want: DefaultAPIBaseURL},
+		{raw: "https://api.github.com/", want: DefaultAPIBaseURL},
+		{raw: "https://github.com", want: DefaultAPIBaseURL},
+		{raw: "https://GitHub.com/", want: DefaultAPIBaseURL},
+		{raw: "https://www.github.com", want: DefaultAPIBaseURL},
+		{raw: "https://ghe.acme.io", want: "https://ghe.acme.io/api/v3"},
+		{raw: "https://ghe.acme.io/api/v3/", want: "https://ghe.acme.io/api/v3"},
+		{raw: "http://127.0.0.1:8080/custom", want: "http://127.0.0.1:8080/custom"},
+	}
+	for _, tc := range tests {
+		if got := NormalizeAPIBaseURL(tc.raw); got != tc.want {
+			t.Errorf("NormalizeAPIBaseURL(%q) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestGetRepoNotFound(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(t, w, map[string]any{"message": "Not Found"})
+	})
+	c := newTestClient(t, mux)
+
+	_, err := c.GetRepo(context.Background(), "tok", "acme/gone")
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("GetRepo error = %v, want a NotFoundError", err)
+	}
+}
+
+// prStatusMux serves the endpoints GetPRStatus reads for acme/app#5 at head sha abc.
+// checkRuns, when nil, makes the check runs endpoint fail as for a token without access.
+func prStatusMux(t *testing.T, statuses, checkRuns []map[string]any) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]any{"number": 5, "mergeable": true, "mergeable_state": "clean", "head": map[string]any{"sha": "abc"}})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/reviews", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []map[string]any{{"state": "APPROVED", "user": map[string]any{"login": "bob"}}})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]any{"state": "failure", "statuses": statuses})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		if checkRuns == nil {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(t, w, map[string]any{"message": "Resource not accessible by integration"})
+			return
+		}
+		writeJSON(t, w, map[string]any{"total_count": len(checkRuns), "check_runs": checkRuns})
+	})
+	return mux
+}
+
+func TestGetPRStatusMergesCheckRuns(t *testing.T) {
+	statuses := []map[string]any{
+		{"state": "success", "context": "ci/jenkins"},
+		{"state": "failure", "context": "lint", "target_url": "https://ci.example.com/lint/1"},
+		{"state": "pending", "context": "coverage"},
+	}
+	runs := []map[string]any{
+		{"name": "build", "status": "completed", "conclusion": "success"},
+		{"name": "test", "status": "completed", "conclusion": "failure", "html_url": "https://github.com/acme/app/runs/2"},
+		{"name": "e2e", "status": "completed", "conclusion": "timed_out", "html_url": "https://github.com/acme/app/runs/3"},
+		{"name": "docs", "status": "completed", "conclusion": "skipped"},
+		{"name": "deploy", "status": "in_progress"},
+	}
+	tests := []struct {
+		name        string
+		runs        []map[string]any
+		wantPassing int
+		wantTotal   int
+		wantFailing []Check
+	}{
+		{
+			name:        "statuses and check runs",
+			runs:        runs,
+			wantPassing: 3,
+			wantTotal:   8,
+			wantFailing: []Check{
+				{Name: "lint", URL: "https://ci.example.com/lint/1"},
+				{Name: "test", URL: "https://github.com/acme/app/runs/2"},
+				{Name: "e2e", URL: "https://github.com/acme/app/runs/3"},
+			},
+		},
+		{
+			name:        "check runs unreadable",
+			wantPassing: 1,
+			wantTotal:   3,
+			wantFailing: []Check{{Name: "lint", URL: "https://ci.example.com/lint/1"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, prStatusMux(t, statuses, tc.runs))
+			st, err := c.GetPRStatus(context.Background(), "tok", "acme/app", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.ChecksPassing != tc.wantPassing || st.ChecksTotal != tc.wantTotal {
+				t.Errorf("checks = %d of %d passing, want %d of %d", st.ChecksPassing, st.ChecksTotal, tc.wantPassing, tc.wantTotal)
+			}
+			if !reflect.DeepEqual(st.FailingChecks, tc.wantFailing) {
+				t.Errorf("failing checks = %+v, want %+v", st.FailingChecks, tc.wantFailing)
+			}
+			if len(st.FailingCheckIDs) != len(tc.wantFailing) {
+				t.Errorf("failing check ids = %v", st.FailingCheckIDs)
+			}
+			if !st.Mergeable || len(st.Approvals) != 1 || st.Approvals[0] != "bob" {
+				t.Errorf("status = %+v, want mergeable and approved by bob", st)
+			}
+		})
+	}
+}
+
+func TestNotFoundErrorsAreTyped(t *testing.T) {
+	ctx := context.Background()
+	sentinels := []error{ErrCommentNotFound, ErrLabelNotFound, ErrBranchNotFound}
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		call   func(c MCPClient) error
+		want   error
+	}{
+		{name: "comment", path: "/api/v3/repos/acme/app/issues/comments/42", status: http.StatusNotFound, want: ErrCommentNotFound,
+			call: func(c MCPClient) error { return c.DeleteComment(ctx, "tok", "acme/app", 42) }},
+		{name: "label", path: "/api/v3/repos/acme/app/issues/5/labels/bug", status: http.StatusNotFound, want: ErrLabelNotFound,
+			call: func(c MCPClient) error { return c.RemoveLabel(ctx, "tok", "acme/app", 5, "bug") }},
+		{name: "branch", path: "/api/v3/repos/acme/app/git/refs/heads/fix/auth", status: http.StatusNotFound, want: ErrBranchNotFound,
+			call: func(c MCPClient) error { return c.DeleteBranch(ctx, "tok", "acme/app", "fix/auth") }},
+		{name: "branch already deleted", path: "/api/v3/repos/acme/app/git/refs/heads/fix", status: http.StatusUnprocessableEntity, want: ErrBranchNotFound,
+			call: func(c MCPClient) error { return c.DeleteBranch(ctx, "tok", "acme/app", "fix") }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc(tc.path, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(RequestIDHeader, "req-1")
+				w.WriteHeader(tc.status)
+				writeJSON(t, w, map[string]any{"message": "Not Found"})
+			})
+			err := tc.call(newTestClient(t, mux))
+
+			var notFound *NotFoundError
+			if !errors.As(err, &notFound) {
+				t.Fatalf("error = %v, want a NotFoundError", err)
+			}
+			if notFound.StatusCode != tc.status || notFound.RequestID != "req-1" {
+				t.Errorf("NotFoundError = %+v", notFound.APIError)
+			}
+			for _, s := range sentinels {
+				if got := errors.Is(err, s); got != (s == tc.want) {
+					t.Errorf("errors.Is(err, %v) = %v", s, got)
+				}
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Error("NotFoundError doesn't unwrap to an APIError")
+			}
+		})
+	}
+}
+
+func TestDeleteCommentServerErrorIsNotNotFound(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/issues/comments/42", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	err := newTestClient(t, mux).DeleteComment(context.Background(), "tok", "acme/app", 42)
+	var notFound *NotFoundError
+	if err == nil || errors.As(err, &notFound) || errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("error = %v, want a plain APIError", err)
+	}
+}
+
+func TestRequestsCarryUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "default", want: DefaultUserAgent},
+		{name: "configured", opts: []Option{WithUserAgent("gitter/1.2 (+ops@example.com)")}, want: "gitter/1.2 (+ops@example.com)"},
+		{name: "blank falls back", opts: []Option{WithUserAgent("  ")}, want: DefaultUserAgent},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("User-Agent"))
+				writeJSON(t, w, map[string]any{"number": 5})
+			})
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/merge", func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("User-Agent"))
+				writeJSON(t, w, map[string]any{"merged": true})
+			})
+			c := newTestClient(t, mux, tc.opts...)
+			if _, err := c.GetPR(context.Background(), "tok", "acme/app", 5); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.MergePR(context.Background(), "tok", "acme/app", 5, "merge", "", ""); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || got[0] != tc.want || got[1] != tc.want {
+				t.Errorf("User-Agent = %q, want %q on every request", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestErrorsCarryGitHubRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		check   func(t *testing.T, err error)
+	}{
+		{name: "api error", status: http.StatusInternalServerError, check: func(t *testing.T, err error) {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.RequestID != "ABCD:1234" {
+				t.Fatalf("error = %#v, want an APIError with the request id", err)
+			}
+			if !strings.Contains(err.Error(), "request id ABCD:1234") {
+				t.Errorf("Error() = %q doesn't mention the request id", err)
+			}
+		}},
+		{name: "rate limit", status: http.StatusForbidden, headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000000"}, check: func(t *testing.T, err error) {
+			var rl *RateLimitError
+			if !errors.As(err, &rl) || rl.RequestID != "ABCD:1234" || rl.ResetAt.Unix() != 1700000000 {
+				t.Fatalf("error = %#v, want a RateLimitError with the request id", err)
+			}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(RequestIDHeader, "ABCD:1234")
+				for k, v := range tc.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+				writeJSON(t, w, map[string]any{"message": "Server Error"})
+			})
+			_, err := newTestClient(t, mux).GetPR(context.Background(), "tok", "acme/app", 5)
+			tc.check(t, err)
+		})
+	}
+}
+
+func TestClosePRPatchesState(t *testing.T) {
+	var method, body string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/me/proj/pulls/88", func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		writeJSON(t, w, map[string]any{"number": 88, "state": "closed"})
+	})
+	if err := newTestClient(t, mux).ClosePR(context.Background(), "tok", "me/proj", 88); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPatch || body != `{"state":"closed"}` {
+		t.Errorf("got %s %s, want PATCH {\"state\":\"closed\"}", method, body)
+	}
+}
+
+func TestCommentBodiesAreValidJSON(t *testing.T) {
+	// a spoken transcript can carry control characters that Go quoting would
+	// escape as \x.., which isn't JSON
+	const text = "ship it\x01 \U0001F680 \"now\"\n"
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		path string
+		call func(c MCPClient) error
+	}{
+		{name: "comment", path: "/api/v3/repos/acme/app/issues/5/comments",
+			call: func(c MCPClient) error { _, err := c.AddComment(ctx, "tok", "acme/app", 5, text); return err }},
+		{name: "review reply", path: "/api/v3/repos/acme/app/pulls/5/comments/9/replies",
+			call: func(c MCPClient) error { return c.ReplyToReview(ctx, "tok", "acme/app", 5, 9, text) }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body map[string]string
+			mux := http.NewServeMux()
+			mux.HandleFunc(tc.path, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("request body isn't JSON: %v", err)
+				}
+				w.WriteHeader(http.StatusCreated)
+				writeJSON(t, w, map[string]any{"id": 1})
+			})
+			if err := tc.call(newTestClient(t, mux)); err != nil {
+				t.Fatal(err)
+			}
+			if body["body"] != text {
+				t.Errorf("body = %q, want %q", body["body"], text)
+			}
+		})
+	}
+}
+
+func TestGetPRDiffFollowsPages(t *testing.T) {
+	pages := map[string][]map[string]any{
+		"": {
+			{"filename": "a.go", "additions": 10, "deletions": 1, "patch": "@@ -1 +1 @@"},
+			{"filename": "b.go", "additions": 5, "deletions": 0},
+		},
+		"2": {
+			{"filename": "c.go", "additions": 1, "deletions": 7},
+		},
+	}
+	tests := []struct {
+		name          string
+		opts          []Option
+		wantFiles     []string
+		wantAdditions int
+		wantDeletions int
+		wantTruncated bool
+	}{
+		{name: "both pages", wantFiles: []string{"a.go", "b.go", "c.go"}, wantAdditions: 16, wantDeletions: 8},
+		{name: "cap reached on the last file", opts: []Option{WithMaxDiffFiles(3)}, wantFiles: []string{"a.go", "b.go", "c.go"}, wantAdditions: 16, wantDeletions: 8},
+		{name: "cap cuts the first page", opts: []Option{WithMaxDiffFiles(1)}, wantFiles: []string{"a.go"}, wantAdditions: 10, wantDeletions: 1, wantTruncated: true},
+		{name: "cap at a page boundary", opts: []Option{WithMaxDiffFiles(2)}, wantFiles: []string{"a.go", "b.go"}, wantAdditions: 15, wantDeletions: 1, wantTruncated: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/files", func(w http.ResponseWriter, r *http.Request) {
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					w.Header().Set("Link", `<http://`+r.Host+`/api/v3/repos/acme/app/pulls/5/files?per_page=100&page=2>; rel="next", <http://`+r.Host+`/api/v3/repos/acme/app/pulls/5/files?per_page=100&page=2>; rel="last"`)
+				}
+				writeJSON(t, w, pages[page])
+			})
+			diff, err := newTestClient(t, mux, tc.opts...).GetPRDiff(context.Background(), "tok", "acme/app", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, f := range diff.Files {
+				names = append(names, f.Filename)
+			}
+			if !reflect.DeepEqual(names, tc.wantFiles) {
+				t.Errorf("files = %v, want %v", names, tc.wantFiles)
+			}
+			if diff.FilesChanged != len(tc.wantFiles) || diff.Additions != tc.wantAdditions || diff.Deletions != tc.wantDeletions {
+				t.Errorf("totals = %d files +%d -%d, want %d +%d -%d", diff.FilesChanged, diff.Additions, diff.Deletions, len(tc.wantFiles), tc.wantAdditions, tc.wantDeletions)
+			}
+			if diff.Truncated != tc.wantTruncated {
+				t.Errorf("truncated = %v, want %v", diff.Truncated, tc.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestRerunFailedChecksRerequestsFailedSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		suites  []map[string]any
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "every failing conclusion",
+			suites: []map[string]any{
+				{"id": 1, "conclusion": "failure"},
+				{"id": 2, "conclusion": "cancelled"},
+				{"id": 3, "conclusion": "action_required"},
+				{"id": 4, "conclusion": "success"},
+				{"id": 5, "conclusion": "neutral"},
+				{"id": 6, "conclusion": nil},
+				{"id": 7, "conclusion": "timed_out"},
+				{"id": 8, "conclusion": "startup_failure"},
+			},
+			want: []string{"1", "2", "3", "7", "8"},
+		},
+		{
+			name:    "nothing failed",
+			suites:  []map[string]any{{"id": 4, "conclusion": "success"}, {"id": 6, "conclusion": nil}},
+			wantErr: ErrNoFailingChecks,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var rerun []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, map[string]any{"number": 5, "head": map[string]any{"sha": "abc"}})
+			})
+			mux.HandleFunc("/api/v3/repos/acme/app/commits/abc/check-suites", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, map[string]any{"total_count": len(tc.suites), "check_suites": tc.suites})
+			})
+			mux.HandleFunc("/api/v3/repos/acme/app/check-suites/", func(w http.ResponseWriter, r *http.Request) {
+				id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v3/repos/acme/app/check-suites/"), "/rerequest")
+				if r.Method != http.MethodPost || !ok {
+					t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+				}
+				rerun = append(rerun, id)
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			err := newTestClient(t, mux).RerunFailedChecks(context.Background(), "tok", "acme/app", 5)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(rerun, tc.want) {
+				t.Errorf("re-ran suites %v, want %v", rerun, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRepo(t *testing.T) {
+	tests := []struct {
+		repo      string
+		wantOwner string
+		wantName  string
+		wantErr   bool
+	}{
+		{repo: "acme/app", wantOwner: "acme", wantName: "app"},
+		{repo: "  acme/app  ", wantOwner: "acme", wantName: "app"},
+		{repo: "https://github.com/acme/app", wantOwner: "acme", wantName: "app"},
+		{repo: "HTTPS://GitHub.com/acme/app/", wantOwner: "acme", wantName: "app"},
+		{repo: "http://github.com/acme/app", wantOwner: "acme", wantName: "app"},
+		{repo: "github.com/acme/app/", wantOwner: "acme", wantName: "app"},
+		{repo: "acme/app/", wantOwner: "acme", wantName: "app"},
+		{repo: "@acme/app", wantOwner: "acme", wantName: "app"},
+		// A bare name needs an owner; resolving one is the caller's job
+		{repo: "app", wantErr: true},
+		{repo: "", wantErr: true},
+		{repo: "acme/", wantErr: true},
+		{repo: "/app", wantErr: true},
+		{repo: "https://github.com/acme/app/pull/5", wantErr: true},
+		{repo: "https://gitlab.com/acme/app", wantErr: true},
+	}
+	for _, tc := range tests {
+		owner, name, err := parseRepo(tc.repo)
+		if (err != nil) != tc.wantErr || owner != tc.wantOwner || name != tc.wantName {
+			t.Errorf("parseRepo(%q) = %q, %q, %v; want %q, %q, error %v", tc.repo, owner, name, err, tc.wantOwner, tc.wantName, tc.wantErr)
+		}
+	}
+}
+
+func TestGetPRDiffSinceComparesToHead(t *testing.T) {
+	tests := []struct {
+		name        string
+		since       string
+		wantCompare string
+		wantBase    string
+		wantFiles   int
+	}{
+		{name: "since the reviewed commit", since: "rev1", wantCompare: "rev1...head9", wantBase: "rev1", wantFiles: 1},
+		{name: "nothing reviewed compares with the base", wantCompare: "base0...head9", wantBase: "base0", wantFiles: 1},
+		{name: "already at head", since: "head9", wantBase: "head9"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var compared string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, map[string]any{"number": 5, "head": map[string]any{"sha": "head9"}, "base": map[string]any{"sha": "base0"}})
+			})
+			mux.HandleFunc("/api/v3/repos/acme/app/compare/", func(w http.ResponseWriter, r *http.Request) {
+				compared = strings.TrimPrefix(r.URL.Path, "/api/v3/repos/acme/app/compare/")
+				writeJSON(t, w, map[string]any{"files": []map[string]any{
+					{"filename": "a.go", "status": "modified", "additions": 2, "deletions": 1, "patch": "@@ -1,2 +1,3 @@"},
+				}})
+			})
+
+			diff, err := newTestClient(t, mux).GetPRDiffSince(context.Background(), "tok", "acme/app", 5, tc.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compared != tc.wantCompare {
+				t.Errorf("compared %q, want %q", compared, tc.wantCompare)
+			}
+			if diff.HeadSHA != "head9" || diff.BaseSHA != tc.wantBase || len(diff.Files) != tc.wantFiles {
+				t.Errorf("diff = %s...%s with %d files, want %s...head9 with %d", diff.BaseSHA, diff.HeadSHA, len(diff.Files), tc.wantBase, tc.wantFiles)
+			}
+			if tc.wantFiles > 0 && (diff.Additions != 2 || diff.Deletions != 1 || len(diff.Files[0].Hunks) != 1) {
+				t.Errorf("diff totals = +%d -%d, hunks %+v", diff.Additions, diff.Deletions, diff.Files[0].Hunks)
+			}
+		})
+	}
+}
+
+func TestMergePRSendsCommitText(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		title   string
+		message string
+		want    map[string]string
+	}{
+		{name: "github's defaults", want: map[string]string{"merge_method": "merge"}},
+		{name: "squash with title and message", method: "squash", title: "Add login (#5)", message: "Adds OAuth login.\n\nCloses #3", want: map[string]string{"merge_method": "squash", "commit_title": "Add login (#5)", "commit_message": "Adds OAuth login.\n\nCloses #3"}},
+		{name: "title only", method: "merge", title: "  Merge login  ", want: map[string]string{"merge_method": "merge", "commit_title": "Merge login"}},
+		{name: "blank text is left to github", method: "rebase", title: " ", message: "\n", want: map[string]string{"merge_method": "rebase"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var method string
+			var body map[string]string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/merge", func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				writeJSON(t, w, map[string]any{"merged": true})
+			})
+			if err := newTestClient(t, mux).MergePR(context.Background(), "tok", "acme/app", 5, tc.method, tc.title, tc.message); err != nil {
+				t.Fatal(err)
+			}
+			if method != http.MethodPut || !reflect.DeepEqual(body, tc.want) {
+				t.Errorf("got %s %v, want PUT %v", method, body, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetPRCommentsInterleavesByTime(t *testing.T) {
+	user := func(login string) map[string]any { return map[string]any{"login": login} }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/comments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []map[string]any{
+			{"node_id": "RC_1", "user": user("bob"), "body": "nit: rename", "path": "a.go", "line": 3, "created_at": "2026-03-01T10:05:00Z"},
+			{"node_id": "RC_2", "user": user("carol"), "body": "why?", "path": "b.go", "line": 9, "created_at": "2026-03-01T10:20:00Z"},
+		})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/issues/5/comments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []map[string]any{
+			{"node_id": "IC_1", "user": user("alice"), "body": "ready for review", "created_at": "2026-03-01T10:00:00Z"},
+			// Surfaced by both endpoints; kept once, as the inline comment
+			{"node_id": "RC_2", "user": user("carol"), "body": "why?", "created_at": "2026-03-01T10:20:00Z"},
+			{"node_id": "IC_2", "user": user("alice"), "body": "addressed", "created_at": "2026-03-01T10:10:00Z"},
+			{"user": user("dave"), "body": "no node id", "created_at": "not a time"},
+		})
+	})
+
+	comments, truncated, err := newTestClient(t, mux).GetPRComments(context.Background(), "tok", "acme/app", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Comment{
+		{Author: "alice", Body: "ready for review", Timestamp: "2026-03-01T10:00:00Z", Type: "general"},
+		{Author: "bob", Body: "nit: rename", Timestamp: "2026-03-01T10:05:00Z", Type: "inline", Path: "a.go", Line: 3},
+		{Author: "alice", Body: "addressed", Timestamp: "2026-03-01T10:10:00Z", Type: "general"},
+		{Author: "carol", Body: "why?", Timestamp: "2026-03-01T10:20:00Z", Type: "inline", Path: "b.go", Line: 9},
+		// Unparseable timestamps sort last
+		{Author: "dave", Body: "no node id", Timestamp: "not a time", Type: "general"},
+	}
+	if truncated || !reflect.DeepEqual(comments, want) {
+		t.Errorf("comments = %+v (truncated %v), want %+v", comments, truncated, want)
+	}
+}
+
+func TestGetPRCommentsFollowsPages(t *testing.T) {
+	comment := func(id, ts string) map[string]any {
+		return map[string]any{"node_id": id, "user": map[string]any{"login": "alice"}, "body": id, "created_at": ts}
+	}
+	pages := map[string][]map[string]any{
+		"":  {comment("IC_1", "2026-03-01T10:00:00Z"), comment("IC_2", "2026-03-01T10:01:00Z")},
+		"2": {comment("IC_3", "2026-03-01T10:02:00Z")},
+	}
+	tests := []struct {
+		name          string
+		opts          []Option
+		wantBodies    []string
+		wantTruncated bool
+	}{
+		{name: "both pages", wantBodies: []string{"IC_1", "IC_2", "IC_3"}},
+		{name: "cap cuts the first page", opts: []Option{WithMaxComments(1)}, wantBodies: []string{"IC_1"}, wantTruncated: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/comments", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, []map[string]any{})
+			})
+			mux.HandleFunc("/api/v3/repos/acme/app/issues/5/comments", func(w http.ResponseWriter, r *http.Request) {
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					w.Header().Set("Link", `<http://`+r.Host+`/api/v3/repos/acme/app/issues/5/comments?per_page=100&page=2>; rel="next"`)
+				}
+				writeJSON(t, w, pages[page])
+			})
+			comments, truncated, err := newTestClient(t, mux, tc.opts...).GetPRComments(context.Background(), "tok", "acme/app", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bodies []string
+			for _, c := range comments {
+				bodies = append(bodies, c.Body)
+			}
+			if !reflect.DeepEqual(bodies, tc.wantBodies) {
+				t.Errorf("comments = %v, want %v", bodies, tc.wantBodies)
+			}
+			if truncated != tc.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tc.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestListPRCommits(t *testing.T) {
+	commit := func(sha, msg, name string, login any) map[string]any {
+		return map[string]any{"sha": sha, "commit": map[string]any{"message": msg, "author": map[string]any{"name": name}}, "author": login}
+	}
+	pages := map[string][]map[string]any{
+		"":  {commit("a1", "Add login\n\nWith tests", "Alice A", map[string]any{"login": "alice"}), commit("b2", "Fix typo", "Bob B", nil)},
+		"2": {commit("c3", "Bump deps", "Carol C", map[string]any{"login": "carol"})},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/12/commits", func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			w.Header().Set("Link", `<http://`+r.Host+`/api/v3/repos/acme/app/pulls/12/commits?per_page=100&page=2>; rel="next"`)
+		}
+		writeJSON(t, w, pages[page])
+	})
+	commits, err := newTestClient(t, mux).ListPRCommits(context.Background(), "tok", "acme/app", 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Commit{
+		{SHA: "a1", Message: "Add login\n\nWith tests", Author: "alice"},
+		// No linked GitHub account: the git author name stands in
+		{SHA: "b2", Message: "Fix typo", Author: "Bob B"},
+		{SHA: "c3", Message: "Bump deps", Author: "carol"},
+	}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("commits = %+v, want %+v", commits, want)
+	}
+}
+
+func TestListReviewsMixedStates(t *testing.T) {
+	rev := func(login, state string, submitted any) map[string]any {
+		return map[string]any{"user": map[string]any{"login": login}, "state": state, "submitted_at": submitted}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/reviews", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []map[string]any{
+			rev("alice", "APPROVED", "2026-03-01T10:00:00Z"),
+			rev("bob", "changes_requested", "2026-03-01T11:00:00Z"),
+			// Only its author can see a pending review
+			rev("carol", "PENDING", nil),
+			rev("dave", "COMMENTED", "2026-03-01T12:00:00Z"),
+			rev("erin", "DISMISSED", "2026-03-01T13:00:00Z"),
+		})
+	})
+	reviews, err := newTestClient(t, mux).ListReviews(context.Background(), "tok", "acme/app", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	want := []Review{
+		{Reviewer: "alice", State: "APPROVED", SubmittedAt: at("2026-03-01T10:00:00Z")},
+		{Reviewer: "bob", State: "CHANGES_REQUESTED", SubmittedAt: at("2026-03-01T11:00:00Z")},
+		{Reviewer: "dave", State: "COMMENTED", SubmittedAt: at("2026-03-01T12:00:00Z")},
+		{Reviewer: "erin", State: "DISMISSED", SubmittedAt: at("2026-03-01T13:00:00Z")},
+	}
+	if !reflect.DeepEqual(reviews, want) {
+		t.Errorf("reviews = %+v, want %+v", reviews, want)
+	}
+}
+
+func TestListReviewsIgnoresTheCommentCap(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/reviews", func(w http.ResponseWriter, r *http.Request) {
+		review := map[string]any{"user": map[string]any{"login": "alice"}, "state": "CHANGES_REQUESTED"}
+		if r.URL.Query().Get("page") == "2" {
+			review["state"] = "APPROVED"
+		} else {
+			w.Header().Set("Link", `<http://`+r.Host+`/api/v3/repos/acme/app/pulls/5/reviews?per_page=100&page=2>; rel="next"`)
+		}
+		writeJSON(t, w, []map[string]any{review})
+	})
+	// The newest review is on the last page; capping at maxComments would lose it
+	reviews, err := newTestClient(t, mux, WithMaxComments(1)).ListReviews(context.Background(), "tok", "acme/app", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 2 || reviews[1].State != "APPROVED" {
+		t.Errorf("reviews = %+v, want both pages", reviews)
+	}
+}
+
+func TestPRSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    IntentKind
+		filter  PRFilter
+		want    string
+		wantErr bool
+	}{
+		{name: "mine defaults to open", kind: IntentListMine, want: "type:pr state:open author:@me"},
+		{name: "review requests", kind: IntentListReview, want: "type:pr state:open review-requested:@me"},
+		{name: "closed in a repo", kind: IntentListMine, filter: PRFilter{Repo: "me/app", State: "closed"}, want: "type:pr state:closed author:@me repo:me/app"},
+		{name: "merged", kind: IntentListMine, filter: PRFilter{State: "merged"}, want: "type:pr is:merged author:@me"},
+		{name: "all states", kind: IntentListReview, filter: PRFilter{State: "all"}, want: "type:pr review-requested:@me"},
+		{name: "repo url", kind: IntentListMine, filter: PRFilter{Repo: "https://github.com/me/app"}, want: "type:pr state:open author:@me repo:me/app"},
+		{name: "unknown state", kind: IntentListMine, filter: PRFilter{State: "draft"}, wantErr: true},
+		{name: "bad repo", kind: IntentListMine, filter: PRFilter{Repo: "not a repo"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := prSearchQuery(tc.kind, tc.filter)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("query = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
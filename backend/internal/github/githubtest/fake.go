@@ -0,0 +1,288 @@
+// Package githubtest provides in-memory stand-ins for the github package's
+// MCPClient and Classifier, for tests that exercise intent handling without GitHub
+// or OpenAI.
+package githubtest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	gh "zana-speech-backend/internal/github"
+)
+
+// FakeCall is one recorded FakeMCPClient call. Repo and PRNumber are empty for
+// calls that don't target a PR; Args holds the remaining arguments in order.
+type FakeCall struct {
+	Method   string
+	Token    string
+	Repo     string
+	PRNumber int
+	Args     []any
+}
+
+// FakeMCPClient is an in-memory github.MCPClient for exercising intent handling
+// without GitHub. Set the canned responses before use; Errors, keyed by method
+// name (e.g. "MergePR"), makes that method fail instead. Every call is recorded.
+type FakeMCPClient struct {
+	// MinePRs answers ListUserPRs and ListPRs for IntentListMine; ReviewPRs the review listings
+	MinePRs           []gh.PR
+	ReviewPRs         []gh.PR
+	Comments          []gh.Comment
+	CommentsTruncated bool
+	Status            gh.Status
+	Diff              gh.Diff
+	PR                gh.PR
+	CodeOwners        string
+	User              gh.User
+	Commits           []gh.Commit
+	Reviews           []gh.Review
+	// Repos answers SearchUserRepos, filtered by name like the real client
+	Repos []gh.Repo
+	// CommentID is returned by AddComment
+	CommentID int64
+	Errors    map[string]error
+
+	mu    sync.Mutex
+	calls []FakeCall
+}
+
+var _ gh.MCPClient = (*FakeMCPClient)(nil)
+
+// Calls returns every recorded call in order.
+func (f *FakeMCPClient) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// CallsTo returns the recorded calls of one method in order.
+func (f *FakeMCPClient) CallsTo(method string) []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []FakeCall
+	for _, c := range f.calls {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Reset forgets the recorded calls; canned responses are kept.
+func (f *FakeMCPClient) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+func (f *FakeMCPClient) record(c FakeCall) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, c)
+	return f.Errors[c.Method]
+}
+
+func (f *FakeMCPClient) ListPRsForReview(ctx context.Context, token string) ([]gh.PR, error) {
+	if err := f.record(FakeCall{Method: "ListPRsForReview", Token: token}); err != nil {
+		return nil, err
+	}
+	return f.ReviewPRs, nil
+}
+
+func (f *FakeMCPClient) ListUserPRs(ctx context.Context, token string) ([]gh.PR, error) {
+	if err := f.record(FakeCall{Method: "ListUserPRs", Token: token}); err != nil {
+		return nil, err
+	}
+	return f.MinePRs, nil
+}
+
+func (f *FakeMCPClient) ListPRs(ctx context.Context, token string, kind gh.IntentKind, filter gh.PRFilter) ([]gh.PR, error) {
+	if err := f.record(FakeCall{Method: "ListPRs", Token: token, Repo: filter.Repo, Args: []any{kind, filter}}); err != nil {
+		return nil, err
+	}
+	if kind == gh.IntentListReview {
+		return f.ReviewPRs, nil
+	}
+	return f.MinePRs, nil
+}
+
+func (f *FakeMCPClient) GetPRComments(ctx context.Context, token, repo string, prNumber int) ([]gh.Comment, bool, error) {
+	if err := f.record(FakeCall{Method: "GetPRComments", Token: token, Repo: repo, PRNumber: prNumber}); err != nil {
+		return nil, false, err
+	}
+	return f.Comments, f.CommentsTruncated, nil
+}
+
+func (f *FakeMCPClient) MergePR(ctx context.Context, token, repo string, prNumber int, method, commitTitle, commitMessage string) error {
+	return f.record(FakeCall{Method: "MergePR", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{method, commitTitle, commitMessage}})
+}
+
+func (f *FakeMCPClient) AddComment(ctx context.Context, token, repo string, prNumber int, body string) (int64, error) {
+	if err := f.record(FakeCall{Method: "AddComment", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{body}}); err != nil {
+		return 0, err
+	}
+	return f.CommentID, nil
+}
+
+func (f *FakeMCPClient) DeleteComment(ctx context.Context, token, repo string, commentID int64) error {
+	return f.record(FakeCall{Method: "DeleteComment", Token: token, Repo: repo, Args: []any{commentID}})
+}
+
+func (f *FakeMCPClient) ReplyToReview(ctx context.Context, token, repo string, prNumber int, reviewID int, body string) error {
+	return f.record(FakeCall{Method: "ReplyToReview", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{reviewID, body}})
+}
+
+func (f *FakeMCPClient) GetPRStatus(ctx context.Context, token, repo string, prNumber int) (gh.Status, error) {
+	if err := f.record(FakeCall{Method: "GetPRStatus", Token: token, Repo: repo, PRNumber: prNumber}); err != nil {
+		return gh.Status{}, err
+	}
+	return f.Status, nil
+}
+
+func (f *FakeMCPClient) GetPRDiff(ctx context.Context, token, repo string, prNumber int) (gh.Diff, error) {
+	if err := f.record(FakeCall{Method: "GetPRDiff", Token: token, Repo: repo, PRNumber: prNumber}); err != nil {
+		return gh.Diff{}, err
+	}
+	return f.Diff, nil
+}
+
+func (f *FakeMCPClient) ClosePR(ctx context.Context, token, repo string, prNumber int) error {
+	return f.record(FakeCall{Method: "ClosePR", Token: token, Repo: repo, PRNumber: prNumber})
+}
+
+func (f *FakeMCPClient) ReopenPR(ctx context.Context, token, repo string, prNumber int) error {
+	return f.record(FakeCall{Method: "ReopenPR", Token: token, Repo: repo, PRNumber: prNumber})
+}
+
+func (f *FakeMCPClient) GetPRDiffSince(ctx context.Context, token, repo string, prNumber int, sinceSHA string) (gh.Diff, error) {
+	if err := f.record(FakeCall{Method: "GetPRDiffSince", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{sinceSHA}}); err != nil {
+		return gh.Diff{}, err
+	}
+	return f.Diff, nil
+}
+
+func (f *FakeMCPClient) GetCodeOwners(ctx context.Context, token, repo string) (string, error) {
+	if err := f.record(FakeCall{Method: "GetCodeOwners", Token: token, Repo: repo}); err != nil {
+		return "", err
+	}
+	return f.CodeOwners, nil
+}
+
+func (f *FakeMCPClient) RequestReviewers(ctx context.Context, token, repo string, prNumber int, reviewers []string) error {
+	return f.record(FakeCall{Method: "RequestReviewers", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{reviewers}})
+}
+
+func (f *FakeMCPClient) AddLabels(ctx context.Context, token, repo string, prNumber int, labels []string) error {
+	return f.record(FakeCall{Method: "AddLabels", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{labels}})
+}
+
+func (f *FakeMCPClient) RemoveLabel(ctx context.Context, token, repo string, prNumber int, label string) error {
+	return f.record(FakeCall{Method: "RemoveLabel", Token: token, Repo: repo, PRNumber: prNumber, Args: []any{label}})
+}
+
+func (f *FakeMCPClient) GetPR(ctx context.Context, token, repo string, prNumber int) (gh.PR, error) {
+	if err := f.record(FakeCall{Method: "GetPR", Token: token, Repo: repo, PRNumber: prNumber}); err != nil {
+		return gh.PR{}, err
+	}
+	return f.PR, nil
+}
+
+func (f *FakeMCPClient) MarkReady(ctx context.Context, token, repo string, prNumber int) error {
+	return f.record(FakeCall{Method: "MarkReady", Token: token, Repo: repo, PRNumber: prNumber})
+}
+
+func (f *FakeMCPClient) GetAuthenticatedUser(ctx context.Context, token string) (gh.User, error) {
+	if err := f.record(FakeCall{Method: "GetAuthenticatedUser", Token: token}); err != nil {
+		return gh.User{}, err
+	}
+	return f.User, nil
+}
+
+func (f *FakeMCPClient) ListPRCommits(ctx context.Context, token, repo string, prNumber int) ([]gh.Commit, error) {
+	if err := f.record(FakeCall{Method: "ListPRCommits", Token: token, Repo: repo, PRNumber: prNumber}); err != nil {
+		return nil, err
+	}
+	return f.Commits, nil
+}
+
+func (f *FakeMCPClient) ListReviews(ctx context.Context, token, repo string, prNumber int) ([]gh.Review, error) {
+	if err := f.record(FakeCall{Method: "ListReviews", Token: token, Repo: repo, PRNumber: prNumber}); err != nil {
+		return nil, err
+	}
+	return f.Reviews, nil
+}
+
+func (f *FakeMCPClient) SearchUserRepos(ctx context.Context, token, query string) ([]gh.Repo, error) {
+	if err := f.record(FakeCall{Method: "SearchUserRepos", Token: token, Args: []any{query}}); err != nil {
+		return nil, err
+	}
+	var out []gh.Repo
+	for _, r := range f.Repos {
+		if strings.Contains(strings.ToLower(r.Name), strings.ToLower(strings.TrimSpace(query))) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// GetRepo answers from Repos by full name, and with a NotFoundError otherwise.
+func (f *FakeMCPClient) GetRepo(ctx context.Context, token, repo string) (gh.Repo, error) {
+	if err := f.record(FakeCall{Method: "GetRepo", Token: token, Repo: repo}); err != nil {
+		return gh.Repo{}, err
+	}
+	for _, r := range f.Repos {
+		if strings.EqualFold(r.FullName, repo) {
+			return r, nil
+		}
+	}
+	return gh.Repo{}, &gh.NotFoundError{APIError: &gh.APIError{Op: "get repo", StatusCode: http.StatusNotFound, Message: "Not Found"}}
+}
+
+func (f *FakeMCPClient) DeleteBranch(ctx context.Context, token, repo, branch string) error {
+	return f.record(FakeCall{Method: "DeleteBranch", Token: token, Repo: repo, Args: []any{branch}})
+}
+
+func (f *FakeMCPClient) RerunFailedChecks(ctx context.Context, token, repo string, prNumber int) error {
+	return f.record(FakeCall{Method: "RerunFailedChecks", Token: token, Repo: repo, PRNumber: prNumber})
+}
+
+// FakeClassifier is a github.Classifier that hands out canned intents in order, repeating
+// the last one once they run out. Err, when set, fails every call instead.
+type FakeClassifier struct {
+	Intents []*gh.ClassifiedIntent
+	Err     error
+
+	mu    sync.Mutex
+	calls int
+}
+
+var _ gh.Classifier = (*FakeClassifier)(nil)
+
+// ClassifyChat returns the next canned intent; chat is ignored.
+func (f *FakeClassifier) ClassifyChat(ctx context.Context, chat []openai.ChatCompletionMessage) (*gh.ClassifiedIntent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if len(f.Intents) == 0 {
+		return nil, nil
+	}
+	i := f.calls - 1
+	if i >= len(f.Intents) {
+		i = len(f.Intents) - 1
+	}
+	return f.Intents[i], nil
+}
+
+// Calls reports how many times ClassifyChat was called.
+func (f *FakeClassifier) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
@@ -0,0 +1,84 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// graphQLURL derives the GraphQL endpoint from the REST base: api.github.com/graphql
+// on github.com, {host}/api/graphql on Enterprise Server.
+func graphQLURL(restBase string) string {
+	if strings.HasSuffix(restBase, "/api/v3") {
+		return strings.TrimSuffix(restBase, "/v3") + "/graphql"
+	}
+	return restBase + "/graphql"
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphql runs a query or mutation and decodes its data into out (which may be nil).
+func (c GitHubAPIClient) graphql(ctx context.Context, token, query string, variables map[string]any, out any) error {
+	b, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	resp, err := c.doURL(ctx, token, http.MethodPost, graphQLURL(c.baseAPI), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, "graphql")
+	}
+	var gr graphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
+		return err
+	}
+	if len(gr.Errors) > 0 {
+		msgs := make([]string, 0, len(gr.Errors))
+		for _, e := range gr.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("graphql failed: %s", strings.Join(msgs, "; "))
+	}
+	if out == nil || len(gr.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(gr.Data, out)
+}
+
+// ErrNotDraft is returned by MarkReady when the PR is already ready for review.
+var ErrNotDraft = errors.New("pr is not a draft")
+
+const markReadyMutation = `mutation($id: ID!) {
+  markPullRequestReadyForReview(input: {pullRequestId: $id}) {
+    pullRequest { isDraft }
+  }
+}`
+
+// MarkReady promotes a draft PR to ready for review. REST has no endpoint for this,
+// so it looks up the PR's node id and runs the markPullRequestReadyForReview mutation.
+func (c GitHubAPIClient) MarkReady(ctx context.Context, token, repo string, prNumber int) error {
+	owner, name, err := parseRepo(repo)
+	if err != nil {
+		return err
+	}
+	var pr prDetails
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, prNumber), &pr); err != nil {
+		return err
+	}
+	if !pr.Draft {
+		return ErrNotDraft
+	}
+	return c.graphql(ctx, token, markReadyMutation, map[string]any{"id": pr.NodeID}, nil)
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -33,13 +35,37 @@ type ClassifiedIntent struct {
 	Message    string                 `json:"message,omitempty"`
 }
 
+// Classifier turns a conversation into a ClassifiedIntent. IntentClassifier is the
+// LLM-backed implementation; githubtest.FakeClassifier stands in for it in tests.
+type Classifier interface {
+	ClassifyChat(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error)
+}
+
+var _ Classifier = (*IntentClassifier)(nil)
+
+// ChatCompleter runs a chat completion. *openai.Client is one; the server wraps it
+// to fall back to other models when the requested one is overloaded.
+type ChatCompleter interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
 type IntentClassifier struct {
 	spec   IntentSpec
-	client *openai.Client
+	client ChatCompleter
 	model  string
+	tools  []openai.Tool
+	// argTypes holds the intent names replies may use and their args' JSON types
+	argTypes map[string]map[string]string
+	// promptPrefix is the system text plus function schema for the prompt path, built
+	// once at load; it is never modified afterwards so concurrent classifies can share it
+	promptPrefix string
+	// noTools is set once the model rejects tool calling; later calls go straight to the prompt path
+	noTools atomic.Bool
+	// timeout bounds each classification request
+	timeout time.Duration
 }
 
-func LoadIntentClassifier(path string, client *openai.Client, model string) (*IntentClassifier, error) {
+func LoadIntentClassifier(path string, client ChatCompleter, model string) (*IntentClassifier, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -48,100 +74,210 @@ func LoadIntentClassifier(path string, client *openai.Client, model string) (*In
 	if err := yaml.Unmarshal(b, &spec); err != nil {
 		return nil, err
 	}
-	return &IntentClassifier{spec: spec, client: client, model: model}, nil
+	prefix, err := specPromptPrefix(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &IntentClassifier{spec: spec, client: client, model: model, tools: specTools(spec), argTypes: specArgTypes(spec), promptPrefix: prefix, timeout: defaultClassifyTimeout}, nil
 }
 
-// ClassifyChat accepts a full chat history with roles and classifies the user's intent
-// using the same intent spec. It prepends the system instructions and function schema
-// then appends the provided chat messages as-is.
-func (c *IntentClassifier) ClassifyChat(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error) {
-	fmt.Println("classifying chat", chat)
-	sys := c.spec.System
+// specPromptPrefix renders the static head of the prompt-path system message: the
+// spec's system text followed by the function schema as JSON.
+func specPromptPrefix(spec IntentSpec) (string, error) {
 	var fnSchema []map[string]interface{}
-	for _, f := range c.spec.Functions {
+	for _, f := range spec.Functions {
 		fnSchema = append(fnSchema, map[string]interface{}{
 			"name":        f.Name,
 			"description": f.Description,
 			"args_schema": f.ArgsSchema,
 		})
 	}
-	schemaJSON, _ := json.Marshal(fnSchema)
-	styleT := c.spec.Style.Temperature
-	if styleT <= 0 {
-		styleT = 0.1
+	schemaJSON, err := json.Marshal(fnSchema)
+	if err != nil {
+		return "", fmt.Errorf("intent spec functions: %w", err)
 	}
-	maxTok := c.spec.Style.MaxTokens
-	if maxTok <= 0 {
-		maxTok = 300
+	return spec.System + "\n\nFunctions:\n" + string(schemaJSON), nil
+}
+
+// SetTimeout sets how long a single classification may take. Non-positive values
+// are ignored.
+func (c *IntentClassifier) SetTimeout(d time.Duration) {
+	if d > 0 {
+		c.timeout = d
 	}
+}
 
-	// Build a compact transcript and embed it into the single system message to avoid role ambiguity
-	var b strings.Builder
-	b.WriteString(sys)
-	b.WriteString("\n\nFunctions:\n")
-	b.WriteString(string(schemaJSON))
-	b.WriteString("\n\nTranscript (role: content):\n")
-	for _, m := range chat {
-		role := strings.ToUpper(m.Role)
-		if role == "" {
-			role = "USER"
+// ClassifyChat accepts a full chat history with roles and classifies the user's intent
+// using the same intent spec. It asks the model for a structured tool call and falls
+// back to the prompt-based JSON path when the model doesn't support tools. Either way
+// the result is checked against the spec by validateIntent.
+func (c *IntentClassifier) ClassifyChat(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error) {
+	out, err := c.classify(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+	validateIntent(c.argTypes, out)
+	return out, nil
+}
+
+func (c *IntentClassifier) classify(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error) {
+	if !c.noTools.Load() {
+		out, err := c.classifyWithTools(ctx, chat)
+		if err == nil {
+			return out, nil
 		}
-		// Collapse whitespace to keep prompt compact
-		content := strings.TrimSpace(m.Content)
-		content = strings.ReplaceAll(content, "\n\n", "\n")
-		b.WriteString(role)
-		b.WriteString(": ")
-		b.WriteString(content)
-		b.WriteString("\n")
+		if !isToolsUnsupported(err) {
+			return nil, err
+		}
+		slog.Info("model does not support tools, using prompt classification", "model", c.model, "error", err)
+		c.noTools.Store(true)
 	}
+	return c.classifyWithPrompt(ctx, chat)
+}
+
+// classifyWithPrompt embeds the function schema in the system prompt and parses the
+// model's free-form JSON reply.
+func (c *IntentClassifier) classifyWithPrompt(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error) {
+	styleT, maxTok := c.style()
+
+	var b strings.Builder
+	b.Grow(len(c.promptPrefix) + transcriptSize(chat) + 256)
+	b.WriteString(c.promptPrefix)
+	writeTranscript(&b, chat)
 	b.WriteString("\nInstructions: Use the transcript to extract any missing arguments. Do not re-ask for details clearly present in earlier turns. If multiple repositories share the same PR number, ask a targeted choice. Output ONLY the JSON object.\n")
 
 	messages := []openai.ChatCompletionMessage{
 		{Role: openai.ChatMessageRoleSystem, Content: b.String()},
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	raw, err := c.completePrompt(ctx, messages, styleT, maxTok)
+	if err != nil {
+		return nil, err
+	}
+	out, err := parseClassifierOutput(raw)
+	if err != nil {
+		// Models that wrap the answer in prose usually comply when told once more
+		slog.Debug("classifier returned non-JSON, retrying", "model", c.model, "raw", raw)
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: raw},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: jsonOnlyReminder},
+		)
+		if raw, err = c.completePrompt(ctx, messages, styleT, maxTok); err != nil {
+			return nil, err
+		}
+		if out, err = parseClassifierOutput(raw); err != nil {
+			slog.Debug("classifier returned non-JSON after retry", "model", c.model, "raw", raw)
+			return nil, err
+		}
+	}
+	if out.Args == nil {
+		out.Args = map[string]interface{}{}
+	}
+	return out, nil
+}
+
+// jsonOnlyReminder follows a reply that couldn't be parsed when classifying by prompt.
+const jsonOnlyReminder = "Return only the JSON object described above: no code fences, no explanation, nothing before or after it."
+
+// completePrompt runs one prompt-path completion and returns the reply text.
+func (c *IntentClassifier) completePrompt(ctx context.Context, messages []openai.ChatCompletionMessage, temperature float32, maxTokens int) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model:       c.model,
-		Temperature: styleT,
-		MaxTokens:   maxTok,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
 		Messages:    messages,
 	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices")
+		return "", fmt.Errorf("no choices")
 	}
-	raw := resp.Choices[0].Message.Content
+	return resp.Choices[0].Message.Content, nil
+}
+
+// parseClassifierOutput extracts the intent from a prompt-path reply. Besides bare
+// JSON it accepts a markdown code fence around the object and prose before or after
+// it; when the reply holds several objects the first that decodes wins.
+func parseClassifierOutput(raw string) (*ClassifiedIntent, error) {
 	var out ClassifiedIntent
-	if err := json.Unmarshal([]byte(raw), &out); err != nil {
-		first := -1
-		last := -1
-		for i, r := range raw {
-			if r == '{' {
-				first = i
-				break
-			}
-		}
-		for i := len(raw) - 1; i >= 0; i-- {
-			if raw[i] == '}' {
-				last = i
-				break
-			}
+	err := json.Unmarshal([]byte(raw), &out)
+	if err == nil {
+		return &out, nil
+	}
+	text := stripCodeFence(raw)
+	for i := strings.IndexByte(text, '{'); i >= 0; {
+		var candidate ClassifiedIntent
+		// Decode stops at the end of the first value, ignoring whatever follows
+		if json.NewDecoder(strings.NewReader(text[i:])).Decode(&candidate) == nil {
+			return &candidate, nil
 		}
-		if first >= 0 && last > first {
-			if err2 := json.Unmarshal([]byte(raw[first:last+1]), &out); err2 != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+		next := strings.IndexByte(text[i+1:], '{')
+		if next < 0 {
+			break
 		}
+		i += next + 1
 	}
-	if out.Args == nil {
-		out.Args = map[string]interface{}{}
+	return nil, fmt.Errorf("classifier output is not JSON: %w", err)
+}
+
+// stripCodeFence returns the body of the first ``` fenced block in s (a language
+// tag such as json on the opening line is dropped), or s unchanged when there is none.
+func stripCodeFence(s string) string {
+	start := strings.Index(s, "```")
+	if start < 0 {
+		return s
+	}
+	body := s[start+3:]
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 && !strings.Contains(body[:nl], "{") {
+		body = body[nl+1:]
+	}
+	if end := strings.Index(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return body
+}
+
+const defaultClassifyTimeout = 10 * time.Second
+
+// style returns the spec's temperature and max tokens with defaults applied.
+func (c *IntentClassifier) style() (float32, int) {
+	styleT := c.spec.Style.Temperature
+	if styleT <= 0 {
+		styleT = 0.1
+	}
+	maxTok := c.spec.Style.MaxTokens
+	if maxTok <= 0 {
+		maxTok = 300
+	}
+	return styleT, maxTok
+}
+
+// transcriptSize estimates the bytes writeTranscript will add, so builders can be sized up front.
+func transcriptSize(chat []openai.ChatCompletionMessage) int {
+	n := 32
+	for _, m := range chat {
+		n += len(m.Role) + len(m.Content) + 3
+	}
+	return n
+}
+
+// writeTranscript appends a compact transcript to the single system message to avoid role ambiguity.
+func writeTranscript(b *strings.Builder, chat []openai.ChatCompletionMessage) {
+	b.WriteString("\n\nTranscript (role: content):\n")
+	for _, m := range chat {
+		role := strings.ToUpper(m.Role)
+		if role == "" {
+			role = "USER"
+		}
+		// Collapse whitespace to keep prompt compact
+		content := strings.TrimSpace(m.Content)
+		content = strings.ReplaceAll(content, "\n\n", "\n")
+		b.WriteString(role)
+		b.WriteString(": ")
+		b.WriteString(content)
+		b.WriteString("\n")
 	}
-	fmt.Println("classified chat", out)
-	return &out, nil
 }
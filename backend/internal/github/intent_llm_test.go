@@ -0,0 +1,182 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// stubCompletions serves chat completions whose content is taken from replies in
+// order, recording every request it gets.
+type stubCompletions struct {
+	mu       sync.Mutex
+	replies  []string
+	requests []openai.ChatCompletionRequest
+}
+
+func (s *stubCompletions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	reply := s.replies[0]
+	if len(s.replies) > 1 {
+		s.replies = s.replies[1:]
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply}}},
+	})
+}
+
+// newPromptClassifier loads the real intent spec against a stub API, pinned to the
+// prompt path.
+func newPromptClassifier(t testing.TB, stub http.Handler) *IntentClassifier {
+	t.Helper()
+	ts := httptest.NewServer(stub)
+	t.Cleanup(ts.Close)
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = ts.URL + "/v1"
+	c, err := LoadIntentClassifier("../prompts/intent.yaml", openai.NewClientWithConfig(cfg), "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.noTools.Store(true)
+	return c
+}
+
+func TestParseClassifierOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "bare", raw: `{"type":"merge_pr","args":{"pr_number":5},"confidence":0.9}`, wantType: "merge_pr"},
+		{name: "fenced with language", raw: "```json\n{\"type\":\"merge_pr\",\"args\":{}}\n```", wantType: "merge_pr"},
+		{name: "fenced without language", raw: "```\n{\"type\":\"list_prs_mine\"}\n```", wantType: "list_prs_mine"},
+		{name: "fence on one line", raw: "```{\"type\":\"list_prs_mine\"}```", wantType: "list_prs_mine"},
+		{name: "prose before and after", raw: "Sure! Here you go: {\"type\":\"describe_pr\",\"args\":{\"repo\":\"acme/app\"}} Let me know.", wantType: "describe_pr"},
+		{name: "prose around a fence", raw: "The intent is:\n```json\n{\"type\":\"open_pr\"}\n```\nHope that helps.", wantType: "open_pr"},
+		{name: "several objects, first wins", raw: `{"type":"merge_pr"} {"type":"close_pr"}`, wantType: "merge_pr"},
+		{name: "stray brace before the object", raw: "Using {braces} loosely: {\"type\":\"mark_ready\"}", wantType: "mark_ready"},
+		{name: "garbage", raw: "I'm not sure what you mean.", wantErr: true},
+		{name: "truncated", raw: `{"type":"merge_pr","args":{`, wantErr: true},
+		{name: "empty", raw: "", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := parseClassifierOutput(tc.raw)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseClassifierOutput = %+v, want an error", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Type != tc.wantType {
+				t.Errorf("type = %q, want %q", out.Type, tc.wantType)
+			}
+		})
+	}
+}
+
+func TestClassifyWithPromptRetriesOnce(t *testing.T) {
+	chat := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "merge acme/app #5"}}
+	tests := []struct {
+		name      string
+		replies   []string
+		wantType  string
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "json first time", replies: []string{`{"type":"merge_pr","args":{"repo":"acme/app","pr_number":5},"confidence":0.9}`}, wantType: "merge_pr", wantCalls: 1},
+		{name: "fenced first time", replies: []string{"```json\n{\"type\":\"merge_pr\",\"args\":{}}\n```"}, wantType: "merge_pr", wantCalls: 1},
+		{name: "json after reminder", replies: []string{"You want to merge a PR.", `{"type":"merge_pr","args":{}}`}, wantType: "merge_pr", wantCalls: 2},
+		{name: "never json", replies: []string{"You want to merge a PR.", "Still prose."}, wantCalls: 2, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &stubCompletions{replies: tc.replies}
+			c := newPromptClassifier(t, stub)
+			out, err := c.ClassifyChat(context.Background(), chat)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("ClassifyChat = %+v, %v", out, err)
+			}
+			if len(stub.requests) != tc.wantCalls {
+				t.Fatalf("made %d completion calls, want %d", len(stub.requests), tc.wantCalls)
+			}
+			if !tc.wantErr {
+				if out.Type != tc.wantType || out.Args == nil {
+					t.Errorf("intent = %+v, want %s with args", out, tc.wantType)
+				}
+			}
+			if tc.wantCalls < 2 {
+				return
+			}
+			retry := stub.requests[1].Messages
+			if n := len(retry); n != 3 || retry[1].Content != tc.replies[0] || retry[2].Content != jsonOnlyReminder {
+				t.Errorf("retry messages = %+v, want the first reply then the reminder", retry)
+			}
+		})
+	}
+}
+
+// BenchmarkClassifyPrompt compares building the prompt-path system message from the
+// spec on every call with appending the transcript to the prefix cached at load.
+func BenchmarkClassifyPrompt(b *testing.B) {
+	c := newPromptClassifier(b, http.NotFoundHandler())
+	chat := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "show my open PRs"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "You have 2 open PRs: acme/app#5 and acme/api#12."},
+		{Role: openai.ChatMessageRoleUser, Content: "merge the first one"},
+	}
+	b.Run("rebuilt", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			prefix, err := specPromptPrefix(c.spec)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var sb strings.Builder
+			sb.WriteString(prefix)
+			writeTranscript(&sb, chat)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var sb strings.Builder
+			sb.Grow(len(c.promptPrefix) + transcriptSize(chat) + 256)
+			sb.WriteString(c.promptPrefix)
+			writeTranscript(&sb, chat)
+		}
+	})
+}
+
+// BenchmarkClassifyChat measures a whole prompt-path classification against a local
+// stub, so it mostly reflects the client's own overhead.
+func BenchmarkClassifyChat(b *testing.B) {
+	c := newPromptClassifier(b, &stubCompletions{replies: []string{`{"type":"merge_pr","args":{"index":"1"},"confidence":0.9}`}})
+	chat := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "merge the first one"}}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.ClassifyChat(ctx, chat); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package github
+
+import (
+	"context"
+	"errors"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrNoIntent is returned by RulesClassifier when the latest user message matches
+// no rule; callers should treat the turn as plain chat.
+var ErrNoIntent = errors.New("no intent matched")
+
+// RulesClassifier is a Classifier built on DetectIntent's keyword rules. It needs no
+// model but only recognizes the PR listing intents.
+type RulesClassifier struct{}
+
+var _ Classifier = RulesClassifier{}
+
+// ClassifyChat matches the most recent user message in chat.
+func (RulesClassifier) ClassifyChat(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error) {
+	for i := len(chat) - 1; i >= 0; i-- {
+		if chat[i].Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		detected := DetectIntent(chat[i].Content)
+		if detected.Kind == IntentUnknown {
+			return nil, ErrNoIntent
+		}
+		return &ClassifiedIntent{Type: string(detected.Kind), Args: map[string]interface{}{}, Confidence: 1}, nil
+	}
+	return nil, ErrNoIntent
+}
@@ -0,0 +1,49 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRulesClassifier(t *testing.T) {
+	user := func(s string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: s}
+	}
+	assistant := func(s string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: s}
+	}
+	tests := []struct {
+		name string
+		chat []openai.ChatCompletionMessage
+		// want is the intent type, "" for ErrNoIntent
+		want string
+	}{
+		{name: "my prs", chat: []openai.ChatCompletionMessage{user("show my PRs")}, want: string(IntentListMine)},
+		{name: "review queue", chat: []openai.ChatCompletionMessage{user("what do I need to review?")}, want: string(IntentListReview)},
+		{name: "latest user message decides", chat: []openai.ChatCompletionMessage{user("show my PRs"), assistant("Here they are"), user("thanks!")}},
+		{name: "assistant turns are skipped", chat: []openai.ChatCompletionMessage{user("show my PRs"), assistant("what do I need to review?")}, want: string(IntentListMine)},
+		{name: "merging is beyond the rules", chat: []openai.ChatCompletionMessage{user("merge PR 5 in acme/app")}},
+		{name: "no user message", chat: []openai.ChatCompletionMessage{assistant("Hi!")}},
+		{name: "empty chat"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ci, err := RulesClassifier{}.ClassifyChat(context.Background(), tc.chat)
+			if tc.want == "" {
+				if !errors.Is(err, ErrNoIntent) || ci != nil {
+					t.Fatalf("ClassifyChat = %+v, %v; want ErrNoIntent", ci, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ci.Type != tc.want || ci.Confidence != 1 || ci.Args == nil {
+				t.Errorf("ClassifyChat = %+v, want %s with full confidence", ci, tc.want)
+			}
+		})
+	}
+}
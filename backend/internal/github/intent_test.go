@@ -0,0 +1,25 @@
+package github
+
+import "testing"
+
+func TestDetectIntent(t *testing.T) {
+	tests := []struct {
+		message string
+		want    IntentKind
+	}{
+		{"Show my PRs", IntentListMine},
+		{"what am I working on?", IntentListMine},
+		{"list my open pull requests please", IntentListMine},
+		{"What do I need to review?", IntentListReview},
+		{"any PRs to review", IntentListReview},
+		{"which prs want my review", IntentListReview},
+		{"merge PR 5 in acme/app", IntentUnknown},
+		{"hello", IntentUnknown},
+		{"   ", IntentUnknown},
+	}
+	for _, tc := range tests {
+		if got := DetectIntent(tc.message).Kind; got != tc.want {
+			t.Errorf("DetectIntent(%q) = %q, want %q", tc.message, got, tc.want)
+		}
+	}
+}
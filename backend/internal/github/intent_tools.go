@@ -0,0 +1,128 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Meta intents the classifier may return in addition to the spec's functions.
+const (
+	intentClarify        = "clarify"
+	intentNotImplemented = "not_implemented"
+)
+
+// specTools converts the YAML function list into OpenAI tool definitions. Every tool
+// also accepts confidence and message so the call maps directly onto ClassifiedIntent.
+func specTools(spec IntentSpec) []openai.Tool {
+	tools := make([]openai.Tool, 0, len(spec.Functions)+2)
+	for _, f := range spec.Functions {
+		tools = append(tools, newIntentTool(f.Name, f.Description, f.ArgsSchema))
+	}
+	// clarify keeps any already-extracted slots so context survives the follow-up turn
+	tools = append(tools, newIntentTool(intentClarify,
+		"Ask the user a short, friendly question when the request lacks information. Include any arguments already extracted.",
+		map[string]interface{}{
+			"repo":      map[string]interface{}{"type": "string", "description": "owner/repo"},
+			"pr_number": map[string]interface{}{"type": "integer"},
+			"review_id": map[string]interface{}{"type": "integer"},
+		}))
+	tools = append(tools, newIntentTool(intentNotImplemented,
+		"Use when no function fits or the request is out of scope. Explain briefly in message.",
+		nil))
+	return tools
+}
+
+func newIntentTool(name, description string, args map[string]interface{}) openai.Tool {
+	props := map[string]interface{}{
+		"confidence": map[string]interface{}{"type": "number", "description": "0..1"},
+		"message":    map[string]interface{}{"type": "string", "description": "Short reply for the user, when needed"},
+	}
+	for k, v := range args {
+		props[k] = v
+	}
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": props,
+				"required":   []string{"confidence"},
+			},
+		},
+	}
+}
+
+// classifyWithTools asks the model to call exactly one intent tool and decodes the call.
+func (c *IntentClassifier) classifyWithTools(ctx context.Context, chat []openai.ChatCompletionMessage) (*ClassifiedIntent, error) {
+	styleT, maxTok := c.style()
+
+	var b strings.Builder
+	b.Grow(len(c.spec.System) + transcriptSize(chat) + 256)
+	b.WriteString(c.spec.System)
+	writeTranscript(&b, chat)
+	b.WriteString("\nInstructions: Use the transcript to extract any missing arguments. Do not re-ask for details clearly present in earlier turns. If multiple repositories share the same PR number, ask a targeted choice. Respond by calling exactly one tool; put confidence and any message in its arguments.\n")
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       c.model,
+		Temperature: styleT,
+		MaxTokens:   maxTok,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: b.String()},
+		},
+		Tools:      c.tools,
+		ToolChoice: "required",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices")
+	}
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("model returned no tool call")
+	}
+	return intentFromToolCall(calls[0].Function)
+}
+
+// intentFromToolCall maps a tool call onto ClassifiedIntent, lifting confidence and
+// message out of the argument object.
+func intentFromToolCall(call openai.FunctionCall) (*ClassifiedIntent, error) {
+	args := map[string]interface{}{}
+	if s := strings.TrimSpace(call.Arguments); s != "" {
+		if err := json.Unmarshal([]byte(s), &args); err != nil {
+			return nil, fmt.Errorf("invalid tool arguments for %s: %w", call.Name, err)
+		}
+	}
+	out := &ClassifiedIntent{Type: call.Name, Args: args}
+	if v, ok := args["confidence"].(float64); ok {
+		out.Confidence = float32(v)
+	}
+	if v, ok := args["message"].(string); ok {
+		out.Message = v
+	}
+	delete(args, "confidence")
+	delete(args, "message")
+	return out, nil
+}
+
+// isToolsUnsupported reports whether the API rejected the request because the model
+// can't do tool calling.
+func isToolsUnsupported(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusBadRequest {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "tool") || strings.Contains(msg, "function")
+}
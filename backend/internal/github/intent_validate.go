@@ -0,0 +1,112 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// specArgTypes maps each intent the classifier may return to the JSON types of its
+// declared args. Meta intents are included so their names pass validation; args a
+// schema doesn't declare are never checked.
+func specArgTypes(spec IntentSpec) map[string]map[string]string {
+	types := make(map[string]map[string]string, len(spec.Functions)+3)
+	for _, f := range spec.Functions {
+		args := make(map[string]string, len(f.ArgsSchema))
+		for name, schema := range f.ArgsSchema {
+			if m, ok := schema.(map[string]interface{}); ok {
+				if t, ok := m["type"].(string); ok {
+					args[name] = t
+				}
+			}
+		}
+		types[f.Name] = args
+	}
+	// Mirrors the clarify tool in specTools
+	types[intentClarify] = map[string]string{"repo": "string", "pr_number": "integer", "review_id": "integer"}
+	types[intentNotImplemented] = map[string]string{}
+	types[string(IntentUnknown)] = map[string]string{}
+	return types
+}
+
+// validateIntent checks a classification against the spec. An intent type the spec
+// doesn't know becomes unknown rather than failing the request; args of the wrong
+// type are converted when that's lossless ("true" for a boolean) and dropped
+// otherwise, so handlers see them as missing and ask for them again.
+func validateIntent(argTypes map[string]map[string]string, out *ClassifiedIntent) {
+	args, ok := argTypes[out.Type]
+	if !ok {
+		slog.Warn("classifier returned unrecognized type, treating it as unknown", "type", out.Type)
+		out.Type = string(IntentUnknown)
+		return
+	}
+	for name, want := range args {
+		v, present := out.Args[name]
+		if !present {
+			continue
+		}
+		if v == nil {
+			delete(out.Args, name)
+			continue
+		}
+		fixed, ok := coerceArg(v, want)
+		if !ok {
+			slog.Warn("dropping mistyped intent arg", "type", out.Type, "arg", name, "want", want, "got", fmt.Sprintf("%T", v))
+			delete(out.Args, name)
+			continue
+		}
+		out.Args[name] = fixed
+	}
+}
+
+// coerceArg reports whether v is usable as the JSON schema type want, returning it
+// converted where needed. Numeric strings stay strings for integers ("#5" is how
+// people say PR numbers), and a lone string stands in for a list.
+func coerceArg(v interface{}, want string) (interface{}, bool) {
+	switch want {
+	case "string":
+		_, ok := v.(string)
+		return v, ok
+	case "integer":
+		switch n := v.(type) {
+		case float64:
+			return v, n == math.Trunc(n)
+		case json.Number:
+			_, err := strconv.Atoi(n.String())
+			return v, err == nil
+		case string:
+			_, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(n), "#"))
+			return v, err == nil
+		}
+		return v, false
+	case "number":
+		switch n := v.(type) {
+		case float64, json.Number:
+			return v, true
+		case string:
+			_, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			return v, err == nil
+		}
+		return v, false
+	case "boolean":
+		switch b := v.(type) {
+		case bool:
+			return v, true
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+			return parsed, err == nil
+		}
+		return v, false
+	case "array":
+		switch v.(type) {
+		case []interface{}, string:
+			return v, true
+		}
+		return v, false
+	}
+	// Types the spec doesn't use yet are passed through unchecked
+	return v, true
+}
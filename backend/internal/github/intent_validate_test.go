@@ -0,0 +1,102 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestValidateIntent(t *testing.T) {
+	c := newPromptClassifier(t, http.NotFoundHandler())
+	tests := []struct {
+		name     string
+		in       ClassifiedIntent
+		wantType string
+		wantArgs map[string]interface{}
+	}{
+		{
+			name:     "unknown type becomes unknown",
+			in:       ClassifiedIntent{Type: "delete_repo", Args: map[string]interface{}{"repo": "acme/app"}},
+			wantType: "unknown",
+			wantArgs: map[string]interface{}{"repo": "acme/app"},
+		},
+		{
+			name:     "meta intents are known",
+			in:       ClassifiedIntent{Type: "clarify", Args: map[string]interface{}{"pr_number": float64(5)}},
+			wantType: "clarify",
+			wantArgs: map[string]interface{}{"pr_number": float64(5)},
+		},
+		{
+			name:     "whole float64 is an integer",
+			in:       ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"repo": "acme/app", "pr_number": float64(5)}},
+			wantType: "merge_pr",
+			wantArgs: map[string]interface{}{"repo": "acme/app", "pr_number": float64(5)},
+		},
+		{
+			name:     "fractional float64 is not an integer",
+			in:       ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"pr_number": 5.5}},
+			wantType: "merge_pr",
+			wantArgs: map[string]interface{}{},
+		},
+		{
+			name:     "spoken pr number string is kept",
+			in:       ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"pr_number": "#5"}},
+			wantType: "merge_pr",
+			wantArgs: map[string]interface{}{"pr_number": "#5"},
+		},
+		{
+			name:     "mistyped args are dropped",
+			in:       ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"repo": float64(7), "pr_number": "five", "force": "maybe"}},
+			wantType: "merge_pr",
+			wantArgs: map[string]interface{}{},
+		},
+		{
+			name:     "boolean string is converted",
+			in:       ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"force": "true", "delete_branch": false}},
+			wantType: "merge_pr",
+			wantArgs: map[string]interface{}{"force": true, "delete_branch": false},
+		},
+		{
+			name:     "null arg is dropped",
+			in:       ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"repo": nil}},
+			wantType: "merge_pr",
+			wantArgs: map[string]interface{}{},
+		},
+		{
+			name:     "single string stands in for a list",
+			in:       ClassifiedIntent{Type: "assign_reviewers", Args: map[string]interface{}{"reviewers": "bob", "labels": float64(1)}},
+			wantType: "assign_reviewers",
+			// labels isn't an assign_reviewers arg, so it isn't checked
+			wantArgs: map[string]interface{}{"reviewers": "bob", "labels": float64(1)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out := tc.in
+			validateIntent(c.argTypes, &out)
+			if out.Type != tc.wantType {
+				t.Errorf("type = %q, want %q", out.Type, tc.wantType)
+			}
+			if !reflect.DeepEqual(out.Args, tc.wantArgs) {
+				t.Errorf("args = %#v, want %#v", out.Args, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestClassifyChatValidatesReply(t *testing.T) {
+	stub := &stubCompletions{replies: []string{`{"type":"merge_pr","args":{"repo":"acme/app","pr_number":5,"force":"yes"},"confidence":0.8}`}}
+	c := newPromptClassifier(t, stub)
+	out, err := c.ClassifyChat(context.Background(), []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "merge acme/app 5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// JSON numbers arrive as float64; "yes" isn't a boolean ParseBool accepts
+	want := map[string]interface{}{"repo": "acme/app", "pr_number": float64(5)}
+	if out.Type != "merge_pr" || !reflect.DeepEqual(out.Args, want) {
+		t.Errorf("ClassifyChat = %s %#v, want merge_pr %#v", out.Type, out.Args, want)
+	}
+}
@@ -12,18 +12,26 @@ func ListUserPRs(ctx context.Context, mcp MCPClient, token string) ([]PR, error)
 	return mcp.ListUserPRs(ctx, token)
 }
 
-func GetPRComments(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) ([]Comment, error) {
+func ListPRs(ctx context.Context, mcp MCPClient, token string, kind IntentKind, filter PRFilter) ([]PR, error) {
+	return mcp.ListPRs(ctx, token, kind, filter)
+}
+
+func GetPRComments(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) ([]Comment, bool, error) {
 	return mcp.GetPRComments(ctx, token, repo, prNumber)
 }
 
-func MergePR(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, method string) error {
-	return mcp.MergePR(ctx, token, repo, prNumber, method)
+func MergePR(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, method, commitTitle, commitMessage string) error {
+	return mcp.MergePR(ctx, token, repo, prNumber, method, commitTitle, commitMessage)
 }
 
-func AddComment(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, body string) error {
+func AddComment(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, body string) (int64, error) {
 	return mcp.AddComment(ctx, token, repo, prNumber, body)
 }
 
+func DeleteComment(ctx context.Context, mcp MCPClient, token, repo string, commentID int64) error {
+	return mcp.DeleteComment(ctx, token, repo, commentID)
+}
+
 func ReplyToReview(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, reviewID int, body string) error {
 	return mcp.ReplyToReview(ctx, token, repo, prNumber, reviewID, body)
 }
@@ -35,3 +43,67 @@ func GetPRStatus(ctx context.Context, mcp MCPClient, token, repo string, prNumbe
 func GetPRDiff(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) (Diff, error) {
 	return mcp.GetPRDiff(ctx, token, repo, prNumber)
 }
+
+func ClosePR(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) error {
+	return mcp.ClosePR(ctx, token, repo, prNumber)
+}
+
+func ReopenPR(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) error {
+	return mcp.ReopenPR(ctx, token, repo, prNumber)
+}
+
+func GetPRDiffSince(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, sinceSHA string) (Diff, error) {
+	return mcp.GetPRDiffSince(ctx, token, repo, prNumber, sinceSHA)
+}
+
+func GetCodeOwners(ctx context.Context, mcp MCPClient, token, repo string) (string, error) {
+	return mcp.GetCodeOwners(ctx, token, repo)
+}
+
+func RequestReviewers(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, reviewers []string) error {
+	return mcp.RequestReviewers(ctx, token, repo, prNumber, reviewers)
+}
+
+func AddLabels(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, labels []string) error {
+	return mcp.AddLabels(ctx, token, repo, prNumber, labels)
+}
+
+func RemoveLabel(ctx context.Context, mcp MCPClient, token, repo string, prNumber int, label string) error {
+	return mcp.RemoveLabel(ctx, token, repo, prNumber, label)
+}
+
+func GetPR(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) (PR, error) {
+	return mcp.GetPR(ctx, token, repo, prNumber)
+}
+
+func MarkReady(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) error {
+	return mcp.MarkReady(ctx, token, repo, prNumber)
+}
+
+func GetAuthenticatedUser(ctx context.Context, mcp MCPClient, token string) (User, error) {
+	return mcp.GetAuthenticatedUser(ctx, token)
+}
+
+func ListPRCommits(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) ([]Commit, error) {
+	return mcp.ListPRCommits(ctx, token, repo, prNumber)
+}
+
+func ListReviews(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) ([]Review, error) {
+	return mcp.ListReviews(ctx, token, repo, prNumber)
+}
+
+func SearchUserRepos(ctx context.Context, mcp MCPClient, token, query string) ([]Repo, error) {
+	return mcp.SearchUserRepos(ctx, token, query)
+}
+
+func GetRepo(ctx context.Context, mcp MCPClient, token, repo string) (Repo, error) {
+	return mcp.GetRepo(ctx, token, repo)
+}
+
+func DeleteBranch(ctx context.Context, mcp MCPClient, token, repo, branch string) error {
+	return mcp.DeleteBranch(ctx, token, repo, branch)
+}
+
+func RerunFailedChecks(ctx context.Context, mcp MCPClient, token, repo string, prNumber int) error {
+	return mcp.RerunFailedChecks(ctx, token, repo, prNumber)
+}
@@ -0,0 +1,115 @@
+package github
+
+import (
+	"container/list"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusCache is a bounded LRU of PR statuses keyed by "repo#number@sha". Checks
+// and mergeability rarely change without a new commit, so repeated "is PR 5
+// ready?" questions within the TTL skip the review and status lookups. Statuses
+// go in and come out as copies, so callers can't change a cached entry. A nil
+// *statusCache caches nothing. It is safe for concurrent use.
+type statusCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type statusEntry struct {
+	key     string
+	status  Status
+	expires time.Time
+}
+
+// newStatusCache returns nil, disabling caching, when size or ttl is not positive.
+func newStatusCache(size int, ttl time.Duration) *statusCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &statusCache{
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func statusKey(repo string, prNumber int, sha string) string {
+	return fmt.Sprintf("%s#%d@%s", strings.ToLower(repo), prNumber, sha)
+}
+
+func (c *statusCache) get(repo string, prNumber int, sha string) (Status, bool) {
+	if c == nil || sha == "" {
+		return Status{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[statusKey(repo, prNumber, sha)]
+	if !ok {
+		return Status{}, false
+	}
+	e := el.Value.(*statusEntry)
+	if !c.now().Before(e.expires) {
+		c.order.Remove(el)
+		delete(c.items, e.key)
+		return Status{}, false
+	}
+	c.order.MoveToFront(el)
+	return cloneStatus(e.status), true
+}
+
+func (c *statusCache) put(repo string, prNumber int, sha string, st Status) {
+	if c == nil || sha == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st = cloneStatus(st)
+	key := statusKey(repo, prNumber, sha)
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*statusEntry)
+		e.status, e.expires = st, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&statusEntry{key: key, status: st, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*statusEntry).key)
+	}
+}
+
+// cloneStatus copies st's slices so the copy shares no backing arrays with st.
+func cloneStatus(st Status) Status {
+	st.Approvals = slices.Clone(st.Approvals)
+	st.FailingCheckIDs = slices.Clone(st.FailingCheckIDs)
+	st.FailingChecks = slices.Clone(st.FailingChecks)
+	return st
+}
+
+// invalidate drops every cached status of a PR, whatever its head commit.
+func (c *statusCache) invalidate(repo string, prNumber int) {
+	if c == nil {
+		return
+	}
+	prefix := statusKey(repo, prNumber, "")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.order.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
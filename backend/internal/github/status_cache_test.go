@@ -0,0 +1,272 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestStatusCache returns a cache running on the clock now.
+func newTestStatusCache(t *testing.T, size int, ttl time.Duration, now *time.Time) *statusCache {
+	t.Helper()
+	c := newStatusCache(size, ttl)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+func TestStatusCache(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	c := newTestStatusCache(t, 2, time.Minute, &now)
+	st := func(n int) Status { return Status{ChecksTotal: n} }
+
+	c.put("acme/app", 5, "abc", st(1))
+	if got, ok := c.get("Acme/App", 5, "abc"); !ok || got.ChecksTotal != 1 {
+		t.Errorf("get = %+v, %v; want the cached status, whatever the repo's case", got, ok)
+	}
+	if _, ok := c.get("acme/app", 5, "def"); ok {
+		t.Error("a new head commit hit the old commit's status")
+	}
+	if _, ok := c.get("acme/app", 6, "abc"); ok {
+		t.Error("another PR hit")
+	}
+
+	// Expires after the TTL
+	now = now.Add(59 * time.Second)
+	if _, ok := c.get("acme/app", 5, "abc"); !ok {
+		t.Error("expired before the TTL")
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.get("acme/app", 5, "abc"); ok {
+		t.Error("served after the TTL")
+	}
+	if len(c.items) != 0 || c.order.Len() != 0 {
+		t.Errorf("expired entry kept: %d items", len(c.items))
+	}
+
+	// Putting again refreshes both the status and its expiry
+	c.put("acme/app", 5, "abc", st(1))
+	now = now.Add(30 * time.Second)
+	c.put("acme/app", 5, "abc", st(2))
+	now = now.Add(45 * time.Second)
+	if got, ok := c.get("acme/app", 5, "abc"); !ok || got.ChecksTotal != 2 {
+		t.Errorf("get after re-put = %+v, %v", got, ok)
+	}
+}
+
+func TestStatusCacheHandsOutCopies(t *testing.T) {
+	now := time.Now()
+	c := newTestStatusCache(t, 10, time.Minute, &now)
+
+	st := Status{Approvals: []string{"alice"}, FailingCheckIDs: []string{"lint"}, FailingChecks: []Check{{Name: "lint"}}}
+	c.put("acme/app", 5, "abc", st)
+	st.Approvals[0] = "mallory"
+
+	got, _ := c.get("acme/app", 5, "abc")
+	got.FailingCheckIDs[0] = "changed"
+	got.FailingChecks[0].Name = "changed"
+
+	again, _ := c.get("acme/app", 5, "abc")
+	want := Status{Approvals: []string{"alice"}, FailingCheckIDs: []string{"lint"}, FailingChecks: []Check{{Name: "lint"}}}
+	if !reflect.DeepEqual(again, want) {
+		t.Errorf("cached status = %+v, want %+v untouched", again, want)
+	}
+}
+
+func TestStatusCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	c := newTestStatusCache(t, 2, time.Minute, &now)
+
+	c.put("acme/app", 1, "a", Status{})
+	c.put("acme/app", 2, "b", Status{})
+	// Reading #1 makes #2 the least recently used
+	if _, ok := c.get("acme/app", 1, "a"); !ok {
+		t.Fatal("miss on #1")
+	}
+	c.put("acme/app", 3, "c", Status{})
+
+	for _, tc := range []struct {
+		pr   int
+		sha  string
+		want bool
+	}{{1, "a", true}, {2, "b", false}, {3, "c", true}} {
+		if _, ok := c.get("acme/app", tc.pr, tc.sha); ok != tc.want {
+			t.Errorf("#%d cached = %v, want %v", tc.pr, ok, tc.want)
+		}
+	}
+	if len(c.items) != 2 {
+		t.Errorf("%d items, want the bound of 2", len(c.items))
+	}
+}
+
+func TestStatusCacheInvalidate(t *testing.T) {
+	now := time.Now()
+	c := newTestStatusCache(t, 10, time.Minute, &now)
+	c.put("acme/app", 5, "old", Status{})
+	c.put("acme/app", 5, "new", Status{})
+	c.put("acme/app", 50, "abc", Status{})
+	c.put("acme/api", 5, "abc", Status{})
+
+	c.invalidate("ACME/app", 5)
+	for _, tc := range []struct {
+		repo string
+		pr   int
+		sha  string
+		want bool
+	}{
+		{"acme/app", 5, "old", false},
+		{"acme/app", 5, "new", false},
+		// "acme/app#5@" must not prefix-match #50
+		{"acme/app", 50, "abc", true},
+		{"acme/api", 5, "abc", true},
+	} {
+		if _, ok := c.get(tc.repo, tc.pr, tc.sha); ok != tc.want {
+			t.Errorf("%s#%d@%s cached = %v, want %v", tc.repo, tc.pr, tc.sha, ok, tc.want)
+		}
+	}
+}
+
+func TestStatusCacheDisabled(t *testing.T) {
+	for _, tc := range []struct {
+		size int
+		ttl  time.Duration
+	}{{0, time.Minute}, {10, 0}, {-1, -time.Second}} {
+		if c := newStatusCache(tc.size, tc.ttl); c != nil {
+			t.Errorf("newStatusCache(%d, %v) = %v, want nil", tc.size, tc.ttl, c)
+		}
+	}
+	// A nil cache is usable and caches nothing
+	var c *statusCache
+	c.put("acme/app", 5, "abc", Status{})
+	c.invalidate("acme/app", 5)
+	if _, ok := c.get("acme/app", 5, "abc"); ok {
+		t.Error("nil cache hit")
+	}
+
+	// Without a head commit there is nothing to key on
+	now := time.Now()
+	c = newTestStatusCache(t, 10, time.Minute, &now)
+	c.put("acme/app", 5, "", Status{})
+	if _, ok := c.get("acme/app", 5, ""); ok || len(c.items) != 0 {
+		t.Error("cached a status without a head commit")
+	}
+}
+
+func TestGetPRStatusUsesCache(t *testing.T) {
+	var head atomic.Value
+	head.Store("abc")
+	var lookups atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			writeJSON(t, w, map[string]any{"number": 5})
+			return
+		}
+		writeJSON(t, w, map[string]any{"number": 5, "mergeable": true, "head": map[string]any{"sha": head.Load()}})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/reviews", func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		writeJSON(t, w, []map[string]any{})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/commits/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]any{"state": "success"})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/merge", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]any{"merged": true})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/issues/5/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, map[string]any{"id": 1})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/comments/9/replies", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, map[string]any{"id": 2})
+	})
+
+	client := newTestClient(t, mux, WithStatusCache(10, time.Minute)).(GitHubAPIClient)
+	now := time.Now()
+	client.statuses.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		before func() error
+		// wantLookup is whether the status is fetched rather than served from cache
+		wantLookup bool
+	}{
+		{name: "first ask", wantLookup: true},
+		{name: "asked again", wantLookup: false},
+		{name: "new commit pushed", before: func() error { head.Store("def"); return nil }, wantLookup: true},
+		{name: "same commit again", wantLookup: false},
+		{name: "ttl passed", before: func() error { now = now.Add(time.Minute); return nil }, wantLookup: true},
+		{name: "commented", before: func() error { _, err := client.AddComment(ctx, "tok", "acme/app", 5, "lgtm"); return err }, wantLookup: true},
+		{name: "replied to a review", before: func() error { return client.ReplyToReview(ctx, "tok", "acme/app", 5, 9, "done") }, wantLookup: true},
+		{name: "closed", before: func() error { return client.ClosePR(ctx, "tok", "acme/app", 5) }, wantLookup: true},
+		{name: "reopened", before: func() error { return client.ReopenPR(ctx, "tok", "acme/app", 5) }, wantLookup: true},
+		{name: "merged", before: func() error { return client.MergePR(ctx, "tok", "acme/app", 5, "merge", "", "") }, wantLookup: true},
+		{name: "settled again", wantLookup: false},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			if err := step.before(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		before := lookups.Load()
+		if _, err := client.GetPRStatus(ctx, "tok", "acme/app", 5); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if fetched := lookups.Load() > before; fetched != step.wantLookup {
+			t.Errorf("%s: fetched = %v, want %v", step.name, fetched, step.wantLookup)
+		}
+	}
+}
+
+func TestGetPRStatusSkipsCacheUntilMergeableIsKnown(t *testing.T) {
+	// GitHub answers null while it computes mergeability after a push
+	var mergeable atomic.Value
+	mergeable.Store([]byte("null"))
+	var lookups atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"number":5,"mergeable":%s,"head":{"sha":"abc"}}`, mergeable.Load())
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/pulls/5/reviews", func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		writeJSON(t, w, []map[string]any{})
+	})
+	mux.HandleFunc("/api/v3/repos/acme/app/commits/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]any{"state": "success"})
+	})
+	client := newTestClient(t, mux, WithStatusCache(10, time.Minute))
+	ctx := context.Background()
+
+	st, err := client.GetPRStatus(ctx, "tok", "acme/app", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mergeable {
+		t.Fatal("mergeable before GitHub knew")
+	}
+
+	mergeable.Store([]byte("true"))
+	st, err = client.GetPRStatus(ctx, "tok", "acme/app", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Mergeable || lookups.Load() != 2 {
+		t.Fatalf("mergeable = %v after %d lookups, want true after 2", st.Mergeable, lookups.Load())
+	}
+
+	// Once known, the status is cached
+	if _, err := client.GetPRStatus(ctx, "tok", "acme/app", 5); err != nil {
+		t.Fatal(err)
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("%d lookups, want the known status served from cache", n)
+	}
+}
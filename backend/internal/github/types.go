@@ -1,5 +1,10 @@
 package github
 
+import (
+	"sort"
+	"time"
+)
+
 // PR holds minimal PR metadata needed by voice flow
 type PR struct {
 	Number     int    `json:"number"`
@@ -8,6 +13,16 @@ type PR struct {
 	Status     string `json:"status"`
 	URL        string `json:"url"`
 	Repository string `json:"repository"`
+	// Body is the PR description; only populated by GetPR
+	Body string `json:"body,omitempty"`
+	// HeadRef is the branch the PR merges from and HeadRepo ("owner/name") the repo
+	// it lives in, which differs from Repository for forks and is empty once a fork
+	// is deleted; only populated by GetPR
+	HeadRef   string    `json:"headRef,omitempty"`
+	HeadRepo  string    `json:"headRepo,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	IsDraft   bool      `json:"isDraft"`
 }
 
 type Comment struct {
@@ -26,6 +41,38 @@ type Status struct {
 	Mergeable       bool     `json:"mergeable"`
 	HasConflicts    bool     `json:"hasConflicts"`
 	FailingCheckIDs []string `json:"failingCheckIds,omitempty"`
+	// FailingChecks pairs each failing check with its details link
+	FailingChecks []Check `json:"failingChecks,omitempty"`
+}
+
+// Review is one submitted review on a PR, as listed by ListReviews.
+type Review struct {
+	Reviewer    string    `json:"reviewer"`
+	State       string    `json:"state"` // APPROVED | CHANGES_REQUESTED | COMMENTED | DISMISSED
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// Check is one CI status check on a PR's head commit.
+type Check struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Repo is a repository the user can access, as returned by SearchUserRepos.
+type Repo struct {
+	FullName string `json:"fullName"` // owner/name
+	Owner    string `json:"owner"`
+	Name     string `json:"name"`
+	Private  bool   `json:"private"`
+	URL      string `json:"url"`
+}
+
+// Commit is one commit on a PR, as listed by ListPRCommits.
+type Commit struct {
+	SHA     string `json:"sha"`
+	Message string `json:"message"`
+	// Author is the GitHub login, or the git author name for unlinked commits
+	Author string `json:"author"`
 }
 
 type Diff struct {
@@ -33,11 +80,50 @@ type Diff struct {
 	Additions    int        `json:"additions"`
 	Deletions    int        `json:"deletions"`
 	Files        []DiffFile `json:"files"`
+	// Truncated is set when the PR has more files than the client fetches
+	Truncated bool `json:"truncated,omitempty"`
+	// Set for incremental diffs: the range compared is BaseSHA...HeadSHA
+	BaseSHA string `json:"baseSha,omitempty"`
+	HeadSHA string `json:"headSha,omitempty"`
+}
+
+// WithoutPatches returns a copy of d with each file's patch text and hunks removed,
+// keeping names and line counts. Used to keep responses small for huge PRs.
+func (d Diff) WithoutPatches() Diff {
+	files := make([]DiffFile, len(d.Files))
+	for i, f := range d.Files {
+		f.Patch = ""
+		f.Hunks = nil
+		files[i] = f
+	}
+	d.Files = files
+	return d
 }
 
 type DiffFile struct {
-	Filename  string `json:"filename"`
-	Additions int    `json:"additions"`
-	Deletions int    `json:"deletions"`
-	Patch     string `json:"patch,omitempty"`
+	Filename  string     `json:"filename"`
+	Additions int        `json:"additions"`
+	Deletions int        `json:"deletions"`
+	Patch     string     `json:"patch,omitempty"`
+	Hunks     []DiffHunk `json:"hunks,omitempty"`
+}
+
+// DiffHunk describes one @@ block of a patch so clients can map lines
+// without re-parsing the raw patch.
+type DiffHunk struct {
+	OldStart int    `json:"oldStart"`
+	OldLines int    `json:"oldLines"`
+	NewStart int    `json:"newStart"`
+	NewLines int    `json:"newLines"`
+	Section  string `json:"section,omitempty"`
+}
+
+// SortPRs orders PRs newest first by "created" or "updated" (the default) time.
+func SortPRs(prs []PR, by string) {
+	sort.SliceStable(prs, func(i, j int) bool {
+		if by == "created" {
+			return prs[i].CreatedAt.After(prs[j].CreatedAt)
+		}
+		return prs[i].UpdatedAt.After(prs[j].UpdatedAt)
+	})
 }
@@ -0,0 +1,93 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// User is the account behind a token, as reported by GET /user.
+type User struct {
+	Login     string `json:"login"`
+	Name      string `json:"name,omitempty"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
+	// OAuth scopes granted to the token; empty for fine-grained and GitHub App tokens
+	Scopes []string `json:"scopes"`
+}
+
+// GetAuthenticatedUser returns the token's account and, for OAuth and classic
+// tokens, the scopes GitHub lists in X-OAuth-Scopes.
+func (c GitHubAPIClient) GetAuthenticatedUser(ctx context.Context, token string) (User, error) {
+	resp, err := c.do(ctx, token, http.MethodGet, "/user", "application/vnd.github+json", nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return User{}, responseError(resp, "get user")
+	}
+	var body struct {
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return User{}, err
+	}
+	return User{
+		Login:     body.Login,
+		Name:      body.Name,
+		AvatarURL: body.AvatarURL,
+		Scopes:    ParseScopes(resp.Header.Get("X-OAuth-Scopes")),
+	}, nil
+}
+
+// ParseScopes splits an X-OAuth-Scopes header ("repo, read:org") into scope names.
+// It never returns nil, so an empty grant encodes as [].
+func ParseScopes(header string) []string {
+	scopes := []string{}
+	for _, s := range strings.Split(header, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// impliedScopes lists the scopes a parent OAuth scope grants on its own.
+var impliedScopes = map[string][]string{
+	"repo":             {"repo:status", "repo_deployment", "public_repo", "repo:invite", "security_events"},
+	"admin:org":        {"write:org", "read:org"},
+	"write:org":        {"read:org"},
+	"admin:repo_hook":  {"write:repo_hook", "read:repo_hook"},
+	"write:repo_hook":  {"read:repo_hook"},
+	"admin:public_key": {"write:public_key", "read:public_key"},
+	"write:public_key": {"read:public_key"},
+	"admin:gpg_key":    {"write:gpg_key", "read:gpg_key"},
+	"write:gpg_key":    {"read:gpg_key"},
+	"user":             {"read:user", "user:email", "user:follow"},
+	"write:packages":   {"read:packages"},
+}
+
+// ScopeCheck returns the required scopes that granted doesn't cover, taking parent
+// scopes into account (repo covers public_repo, user covers read:user). An empty
+// result means the token has everything required.
+func ScopeCheck(granted, required []string) []string {
+	have := make(map[string]bool, len(granted))
+	for _, g := range granted {
+		g = strings.ToLower(strings.TrimSpace(g))
+		have[g] = true
+		for _, child := range impliedScopes[g] {
+			have[child] = true
+		}
+	}
+	var missing []string
+	for _, r := range required {
+		r = strings.TrimSpace(r)
+		if r != "" && !have[strings.ToLower(r)] {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,103 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetAuthenticatedUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		scopes    *string
+		status    int
+		want      User
+		wantErrAs any
+	}{
+		{name: "oauth token", scopes: strPtr("repo, read:org,  user:email"), status: http.StatusOK,
+			want: User{Login: "octocat", Name: "The Octocat", AvatarURL: "https://avatars.test/u/1", Scopes: []string{"repo", "read:org", "user:email"}}},
+		{name: "empty grant", scopes: strPtr(""), status: http.StatusOK,
+			want: User{Login: "octocat", Name: "The Octocat", AvatarURL: "https://avatars.test/u/1", Scopes: []string{}}},
+		// Fine-grained and App tokens send no header
+		{name: "fine-grained token", status: http.StatusOK,
+			want: User{Login: "octocat", Name: "The Octocat", AvatarURL: "https://avatars.test/u/1", Scopes: []string{}}},
+		{name: "bad credentials", status: http.StatusUnauthorized, wantErrAs: new(*UnauthorizedError)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+					t.Errorf("Authorization = %q", got)
+				}
+				if tc.scopes != nil {
+					w.Header().Set("X-OAuth-Scopes", *tc.scopes)
+				}
+				if tc.status != http.StatusOK {
+					w.WriteHeader(tc.status)
+					writeJSON(t, w, map[string]string{"message": "Bad credentials"})
+					return
+				}
+				writeJSON(t, w, map[string]any{"login": "octocat", "name": "The Octocat", "avatar_url": "https://avatars.test/u/1", "id": 1})
+			})
+			user, err := newTestClient(t, mux).GetAuthenticatedUser(context.Background(), "tok")
+			if tc.wantErrAs != nil {
+				if !errors.As(err, tc.wantErrAs) {
+					t.Fatalf("err = %v, want %T", err, tc.wantErrAs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(user, tc.want) {
+				t.Errorf("user = %+v, want %+v", user, tc.want)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"repo, read:org", []string{"repo", "read:org"}},
+		{" repo ,,user ", []string{"repo", "user"}},
+		{"", []string{}},
+	}
+	for _, tc := range tests {
+		if got := ParseScopes(tc.header); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseScopes(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestScopeCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required []string
+		want     []string
+	}{
+		{name: "all granted", granted: []string{"repo", "read:user"}, required: []string{"repo", "read:user"}},
+		{name: "missing repo", granted: []string{"read:user"}, required: []string{"repo", "read:user"}, want: []string{"repo"}},
+		{name: "parent covers child", granted: []string{"repo", "user"}, required: []string{"public_repo", "read:user", "user:email"}},
+		{name: "chained parents", granted: []string{"admin:org"}, required: []string{"read:org"}},
+		{name: "child doesn't cover parent", granted: []string{"public_repo"}, required: []string{"repo"}, want: []string{"repo"}},
+		{name: "case and spaces ignored", granted: []string{" Repo "}, required: []string{"REPO", " "}},
+		{name: "nothing granted", required: []string{"repo", "read:org"}, want: []string{"repo", "read:org"}},
+		{name: "nothing required", granted: []string{"repo"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ScopeCheck(tc.granted, tc.required); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ScopeCheck(%q, %q) = %q, want %q", tc.granted, tc.required, got, tc.want)
+			}
+		})
+	}
+}
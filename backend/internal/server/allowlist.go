@@ -0,0 +1,29 @@
+package server
+
+import "strings"
+
+// repoAllowed reports whether REPO_ALLOWLIST lets intents act on repo. Entries are
+// "owner/repo" or "owner/*", matched case-insensitively; an empty list allows all.
+func (s *Server) repoAllowed(repo string) bool {
+	return repoMatchesAllowlist(s.cfg.RepoAllowlist, repo)
+}
+
+func repoMatchesAllowlist(allowlist []string, repo string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	owner, name, ok := strings.Cut(strings.TrimSpace(repo), "/")
+	if !ok || owner == "" || name == "" {
+		return false
+	}
+	for _, entry := range allowlist {
+		o, n, ok := strings.Cut(entry, "/")
+		if !ok || !strings.EqualFold(o, owner) {
+			continue
+		}
+		if n == "*" || strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"testing"
+
+	"zana-speech-backend/internal/config"
+	gh "zana-speech-backend/internal/github"
+)
+
+func TestRepoMatchesAllowlist(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		repo      string
+		want      bool
+	}{
+		{name: "empty allowlist allows all", repo: "anyone/anything", want: true},
+		{name: "owner wildcard", allowlist: []string{"acme/*"}, repo: "acme/app", want: true},
+		{name: "owner wildcard, other owner", allowlist: []string{"acme/*"}, repo: "other/app"},
+		{name: "exact repo", allowlist: []string{"acme/app"}, repo: "acme/app", want: true},
+		{name: "exact repo, sibling", allowlist: []string{"acme/app"}, repo: "acme/api"},
+		{name: "owner case", allowlist: []string{"Acme/*"}, repo: "acme/app", want: true},
+		{name: "repo case", allowlist: []string{"acme/App"}, repo: "ACME/app", want: true},
+		{name: "any entry matches", allowlist: []string{"other/*", "acme/app"}, repo: "acme/app", want: true},
+		{name: "bare name isn't matched", allowlist: []string{"acme/*"}, repo: "app"},
+		{name: "missing name", allowlist: []string{"acme/*"}, repo: "acme/"},
+		{name: "entry without a slash is ignored", allowlist: []string{"acme"}, repo: "acme/app"},
+		{name: "padded repo", allowlist: []string{"acme/app"}, repo: " acme/app ", want: true},
+	}
+	for _, tc := range tests {
+		if got := repoMatchesAllowlist(tc.allowlist, tc.repo); got != tc.want {
+			t.Errorf("%s: repoMatchesAllowlist(%v, %q) = %v, want %v", tc.name, tc.allowlist, tc.repo, got, tc.want)
+		}
+	}
+}
+
+func TestAllowlistAppliesToResolvedBareNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		wantType  string
+	}{
+		{name: "resolved into an allowed owner", allowlist: []string{"alice/*"}, wantType: "pr_closed"},
+		{name: "resolved outside the allowlist", allowlist: []string{"acme/*"}, wantType: "error"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok", RepoAllowlist: tc.allowlist})
+			s.store.SetUsername(testSession, "alice")
+			fake.Repos = []gh.Repo{{FullName: "alice/app", Owner: "alice", Name: "app"}}
+
+			_, resp := handle(t, s, "close_pr", map[string]any{"repo": "app", "pr_number": float64(3)})
+			if resp.Type != tc.wantType {
+				t.Fatalf("type = %s, want %s", resp.Type, tc.wantType)
+			}
+			closes := fake.CallsTo("ClosePR")
+			if tc.wantType == "pr_closed" && (len(closes) != 1 || closes[0].Repo != "alice/app") {
+				t.Errorf("close calls = %+v, want alice/app", closes)
+			}
+			if tc.wantType == "error" && len(closes) != 0 {
+				t.Errorf("closed %+v outside the allowlist", closes)
+			}
+		})
+	}
+}
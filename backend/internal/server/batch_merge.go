@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gh "zana-speech-backend/internal/github"
+)
+
+const (
+	// Concurrent PRs checked/merged by merge_approved
+	mergeApprovedWorkers = 4
+	// Per-PR budget so one slow PR doesn't hold up the batch
+	mergeApprovedPRTimeout = 30 * time.Second
+)
+
+// batchMergeResult is the outcome for one PR in a merge_approved batch.
+type batchMergeResult struct {
+	PR     gh.PR
+	Merged bool
+	Reason string
+}
+
+// mergeApproved checks each PR's status and merges the ones that are approved, green
+// and mergeable, each with the session's token for its repo. Results keep the order of prs.
+func (s *Server) mergeApproved(ctx context.Context, sessionID string, prs []gh.PR, method string) []batchMergeResult {
+	return s.eachPR(ctx, prs, func(ctx context.Context, pr gh.PR) batchMergeResult {
+		token := s.getGitHubTokenForRepo(ctx, sessionID, pr.Repository)
+		res := s.checkReady(ctx, token, pr)
+		if res.Reason != "" {
+			return res
+		}
+		if err := s.mcp.MergePR(ctx, token, pr.Repository, pr.Number, method, "", ""); err != nil {
+			logger(ctx).Warn("batch merge failed", "repo", pr.Repository, "pr", pr.Number, "error", err)
+			res.Reason = mergeFailureReason(err)
+			return res
+		}
+		res.Merged = true
+		return res
+	})
+}
+
+// mergeFailureReason explains a failed MergePR for a batch summary, passing on
+// GitHub's own message when it gave one.
+func mergeFailureReason(err error) string {
+	var apiErr *gh.APIError
+	if !errors.As(err, &apiErr) {
+		return "couldn't reach GitHub"
+	}
+	if msg := strings.TrimSuffix(strings.TrimSpace(apiErr.Message), "."); msg != "" {
+		return "GitHub refused the merge: " + msg
+	}
+	return "GitHub refused the merge"
+}
+
+// readyToMerge is mergeApproved without the merging, for confirming the batch first:
+// it splits the results into the PRs mergeApproved would merge now and the ones it
+// would skip.
+func (s *Server) readyToMerge(ctx context.Context, sessionID string, prs []gh.PR) (ready, skipped []batchMergeResult) {
+	for _, r := range s.eachPR(ctx, prs, func(ctx context.Context, pr gh.PR) batchMergeResult {
+		return s.checkReady(ctx, s.getGitHubTokenForRepo(ctx, sessionID, pr.Repository), pr)
+	}) {
+		if r.Reason == "" {
+			ready = append(ready, r)
+		} else {
+			skipped = append(skipped, r)
+		}
+	}
+	return ready, skipped
+}
+
+// eachPR runs fn over prs on mergeApprovedWorkers goroutines, each call with its own
+// mergeApprovedPRTimeout budget. Results keep the order of prs.
+func (s *Server) eachPR(ctx context.Context, prs []gh.PR, fn func(context.Context, gh.PR) batchMergeResult) []batchMergeResult {
+	results := make([]batchMergeResult, len(prs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < mergeApprovedWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				prCtx, cancel := context.WithTimeout(ctx, mergeApprovedPRTimeout)
+				results[i] = fn(prCtx, prs[i])
+				cancel()
+			}
+		}()
+	}
+	for i := range prs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// checkReady returns a result with Reason set when pr shouldn't be merged in a batch.
+func (s *Server) checkReady(ctx context.Context, token string, pr gh.PR) batchMergeResult {
+	res := batchMergeResult{PR: pr}
+	if !s.repoAllowed(pr.Repository) {
+		res.Reason = "not an allowed repo"
+		return res
+	}
+	if pr.IsDraft {
+		res.Reason = "still a draft"
+		return res
+	}
+	st, err := s.mcp.GetPRStatus(ctx, token, pr.Repository, pr.Number)
+	if err != nil {
+		res.Reason = "couldn't read its status"
+		return res
+	}
+	res.Reason = notReadyReason(st)
+	return res
+}
+
+// notReadyReason explains why a PR shouldn't be merged in a batch, or returns "" when it's ready.
+func notReadyReason(st gh.Status) string {
+	switch {
+	case len(st.Approvals) == 0:
+		return "no approvals"
+	case st.ChecksPassing < st.ChecksTotal:
+		return fmt.Sprintf("%d of %d checks passing", st.ChecksPassing, st.ChecksTotal)
+	case st.HasConflicts:
+		return "merge conflicts"
+	case !st.Mergeable:
+		return "not mergeable yet"
+	}
+	return ""
+}
+
+// mergeBlockers lists what stands in the way of merging a single PR, for speech; an
+// empty list means GitHub should accept the merge. Unlike a batch, approvals and
+// still-running checks don't block: branch protection decides those.
+func mergeBlockers(st gh.Status) []string {
+	var blockers []string
+	switch n := len(st.FailingCheckIDs); {
+	case n == 1:
+		blockers = append(blockers, "1 check is failing")
+	case n > 1:
+		blockers = append(blockers, fmt.Sprintf("%d checks are failing", n))
+	}
+	if st.HasConflicts {
+		blockers = append(blockers, "it has merge conflicts")
+	} else if !st.Mergeable {
+		blockers = append(blockers, "GitHub hasn't marked it mergeable yet")
+	}
+	return blockers
+}
+
+// deleteMergedBranch deletes a just-merged PR's head branch and returns the branch
+// name and a spoken note on the outcome for the merge reply. Branches in forks are
+// left alone; they belong to someone else.
+func (s *Server) deleteMergedBranch(ctx context.Context, token, repo string, prNumber int) (string, bool, string) {
+	pr, err := s.mcp.GetPR(ctx, token, repo, prNumber)
+	if err != nil {
+		logger(ctx).Warn("look up merged pr branch failed", "repo", repo, "pr", prNumber, "error", err)
+		return "", false, "I couldn't look up its branch to delete it."
+	}
+	if pr.HeadRef == "" || !strings.EqualFold(pr.HeadRepo, repo) {
+		return pr.HeadRef, false, "I left its branch alone since it's in a fork."
+	}
+	if err := s.mcp.DeleteBranch(ctx, token, repo, pr.HeadRef); err != nil {
+		if errors.Is(err, gh.ErrBranchNotFound) {
+			return pr.HeadRef, false, fmt.Sprintf("The %s branch was already deleted.", pr.HeadRef)
+		}
+		logger(ctx).Warn("delete merged branch failed", "repo", repo, "branch", pr.HeadRef, "error", err)
+		return pr.HeadRef, false, fmt.Sprintf("I couldn't delete the %s branch.", pr.HeadRef)
+	}
+	return pr.HeadRef, true, fmt.Sprintf("Deleted the %s branch.", pr.HeadRef)
+}
+
+// batchPendingPRs turns PRs into pending-intent args for a batch merge confirmation.
+// They are stored as plain maps so they survive the Redis store's JSON round trip.
+func batchPendingPRs(results []batchMergeResult) []any {
+	out := make([]any, 0, len(results))
+	for _, r := range results {
+		out = append(out, map[string]any{"repo": r.PR.Repository, "pr_number": r.PR.Number, "title": r.PR.Title})
+	}
+	return out
+}
+
+// prsFromPending reads back the PRs batchPendingPRs stored.
+func prsFromPending(v any) []gh.PR {
+	items, _ := v.([]any)
+	prs := make([]gh.PR, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		n, ok := argInt(m, "pr_number")
+		if repo := argString(m, "repo"); ok && repo != "" && n > 0 {
+			prs = append(prs, gh.PR{Repository: repo, Number: n, Title: argString(m, "title")})
+		}
+	}
+	return prs
+}
+
+// batchItems renders results for an intent payload; skipped ones carry their reason.
+func batchItems(results []batchMergeResult) []map[string]any {
+	items := make([]map[string]any, 0, len(results))
+	for _, r := range results {
+		item := map[string]any{"repo": r.PR.Repository, "prNumber": r.PR.Number, "title": r.PR.Title}
+		if !r.Merged && r.Reason != "" {
+			item["reason"] = r.Reason
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// summarizeBatchMerge renders batch results as a short spoken summary.
+func summarizeBatchMerge(results []batchMergeResult) string {
+	var merged, skipped []string
+	for _, r := range results {
+		ref := fmt.Sprintf("%s#%d", r.PR.Repository, r.PR.Number)
+		if r.Merged {
+			merged = append(merged, ref)
+		} else {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", ref, r.Reason))
+		}
+	}
+	var b strings.Builder
+	if len(merged) == 0 {
+		b.WriteString("I didn't merge anything.")
+	} else {
+		fmt.Fprintf(&b, "Merged %d PR%s: %s.", len(merged), plural(len(merged)), strings.Join(merged, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, " Skipped %d: %s.", len(skipped), strings.Join(skipped, "; "))
+	}
+	return b.String()
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	openai "github.com/sashabaranov/go-openai"
+
+	"zana-speech-backend/internal/config"
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/github/githubtest"
+	"zana-speech-backend/internal/store"
+	"zana-speech-backend/internal/types"
+)
+
+// stubOpenAI answers chat completions, streamed or not, with reply, or fails them all
+// with status when it is set. It counts the completions asked for.
+type stubOpenAI struct {
+	reply  string
+	status int
+	calls  atomic.Int32
+}
+
+func (o *stubOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.calls.Add(1)
+	if o.status != 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(o.status)
+		fmt.Fprint(w, `{"error":{"message":"stub failure","type":"server_error"}}`)
+		return
+	}
+	var req openai.ChatCompletionRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: o.reply}}},
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, word := range strings.SplitAfter(o.reply, " ") {
+		b, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: word}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", b)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// newChatTestServer is newTestServer with chat completions served by o and the
+// classifier's answer fixed to ci, or to err when ci is nil.
+func newChatTestServer(t *testing.T, o *stubOpenAI, ci *gh.ClassifiedIntent, err error) (*Server, *githubtest.FakeMCPClient) {
+	t.Helper()
+	s, fake := newTestServer(t, config.Config{
+		GitHubToken:       "tok",
+		SessionCookieName: "session_id",
+		MaxMessageLength:  1000,
+		ChatTimeout:       5 * time.Second,
+		StreamTimeout:     5 * time.Second,
+		Model:             "test-model",
+	})
+	ts := httptest.NewServer(o)
+	t.Cleanup(ts.Close)
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = ts.URL + "/v1"
+	s.client = openai.NewClientWithConfig(cfg)
+	classifier := &githubtest.FakeClassifier{Err: err}
+	if ci != nil {
+		classifier.Intents = []*gh.ClassifiedIntent{ci}
+	}
+	s.intent = classifier
+	return s, fake
+}
+
+func chatRequest(message string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(fmt.Sprintf(`{"message":%q}`, message)))
+	r.AddCookie(&http.Cookie{Name: "session_id", Value: testSession})
+	return r
+}
+
+func TestChatHandlesIntents(t *testing.T) {
+	merge := &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9}
+	tests := []struct {
+		name      string
+		intent    *gh.ClassifiedIntent
+		err       error
+		wantCode  int
+		wantReply string
+		// wantIntent is the intent type returned, "" for a plain completion
+		wantIntent      string
+		wantMerges      int
+		wantCompletions int32
+	}{
+		{name: "merge runs", intent: merge, wantCode: http.StatusOK, wantReply: "acme/app#5", wantIntent: "merged", wantMerges: 1},
+		{name: "no intent is answered by the model", err: gh.ErrNoIntent, wantCode: http.StatusOK, wantReply: "Hello there, how can I help?", wantCompletions: 1},
+		{name: "heuristic miss", wantCode: http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &stubOpenAI{reply: "Hello there, how can I help?"}
+			s, fake := newChatTestServer(t, o, tc.intent, tc.err)
+
+			rec := httptest.NewRecorder()
+			s.handleChat(rec, chatRequest("hello"))
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+			}
+			if got := len(fake.CallsTo("MergePR")); got != tc.wantMerges {
+				t.Errorf("merges = %d, want %d", got, tc.wantMerges)
+			}
+			if n := o.calls.Load(); n != tc.wantCompletions {
+				t.Errorf("made %d completions, want %d", n, tc.wantCompletions)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var resp types.ChatResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			gotIntent := ""
+			if resp.Intent != nil {
+				gotIntent = resp.Intent.Type
+			}
+			if !strings.Contains(resp.Reply, tc.wantReply) || gotIntent != tc.wantIntent {
+				t.Errorf("reply = %q (%q), want %q with %q", resp.Reply, gotIntent, tc.wantReply, tc.wantIntent)
+			}
+			history := s.history(testSession)
+			if last := history[len(history)-1]; last.Role != "assistant" || last.Content != resp.Reply {
+				t.Errorf("last history entry = %+v, want the reply", last)
+			}
+		})
+	}
+}
+
+func TestChatRouteAnswersSmallTalkInRulesMode(t *testing.T) {
+	o := &stubOpenAI{reply: "Doing well, thanks!"}
+	s, _ := newChatTestServer(t, o, nil, nil)
+	s.intent = gh.RulesClassifier{}
+	s.router = chi.NewRouter()
+	s.routes()
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest("how are you today?"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+	var resp types.ChatResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reply != "Doing well, thanks!" || resp.Intent != nil {
+		t.Errorf("reply = %q (%+v), want the completion and no intent", resp.Reply, resp.Intent)
+	}
+}
+
+func TestChatStreamHandlesIntentsFirst(t *testing.T) {
+	merge := &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9}
+	tests := []struct {
+		name       string
+		intent     *gh.ClassifiedIntent
+		err        error
+		wantBody   string
+		wantIntent string
+		wantMerges int
+	}{
+		{name: "no intent streams the model", err: gh.ErrNoIntent, wantBody: "Hello there, how can I help?"},
+		{name: "merge message triggers the merge", intent: merge, wantBody: "acme/app#5", wantIntent: "merged", wantMerges: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &stubOpenAI{reply: "Hello there, how can I help?"}
+			s, fake := newChatTestServer(t, o, tc.intent, tc.err)
+
+			rec := httptest.NewRecorder()
+			s.handleChatStream(rec, chatRequest("merge acme/app 5"))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("body = %q, want %q", rec.Body, tc.wantBody)
+			}
+			if got := rec.Header().Get("X-Intent-Type"); got != tc.wantIntent {
+				t.Errorf("X-Intent-Type = %q, want %q", got, tc.wantIntent)
+			}
+			if got := len(fake.CallsTo("MergePR")); got != tc.wantMerges {
+				t.Errorf("merges = %d, want %d", got, tc.wantMerges)
+			}
+		})
+	}
+}
+
+func TestChatAddCommentPostsTheNextMessageVerbatim(t *testing.T) {
+	const comment = `Looks good, but rename "cfg" to "config" — thanks! 🚀` + "\n\\o/"
+	commentOn := &gh.ClassifiedIntent{Type: "add_comment", Args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9}
+	s, _ := newChatTestServer(t, &stubOpenAI{}, commentOn, nil)
+
+	// The real REST client, so what reaches GitHub is the JSON it would send
+	var posted []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/app/issues/5/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		posted, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":77}`)
+	})
+	gitHub := httptest.NewServer(mux)
+	t.Cleanup(gitHub.Close)
+	s.mcp = gh.NewMCPClient(gh.WithBaseURL(gitHub.URL), gh.WithHTTPClient(gitHub.Client()))
+
+	for _, turn := range []struct{ message, wantReply, wantIntent string }{
+		{message: "comment on acme/app 5", wantReply: "What should the comment say?", wantIntent: "clarify"},
+		{message: comment, wantReply: "Added your comment to PR #5.", wantIntent: "comment_added"},
+	} {
+		rec := httptest.NewRecorder()
+		s.handleChat(rec, chatRequest(turn.message))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d (%s)", turn.message, rec.Code, rec.Body)
+		}
+		var resp types.ChatResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Reply != turn.wantReply || resp.Intent == nil || resp.Intent.Type != turn.wantIntent {
+			t.Fatalf("%q: reply = %q (%+v), want %q with %q", turn.message, resp.Reply, resp.Intent, turn.wantReply, turn.wantIntent)
+		}
+	}
+
+	want, _ := json.Marshal(map[string]string{"body": comment})
+	if string(posted) != string(want) {
+		t.Errorf("posted %s, want %s", posted, want)
+	}
+	if _, _, pending := s.store.GetPendingIntent(testSession); pending {
+		t.Error("the add_comment follow-up is still pending")
+	}
+}
+
+func TestChatResetForgetsListingsAndPendingQuestions(t *testing.T) {
+	s, fake := newChatTestServer(t, &stubOpenAI{}, nil, nil)
+	fake.MinePRs = []gh.PR{{Number: 5, Repository: "acme/app", Title: "Fix auth"}, {Number: 9, Repository: "acme/api", Title: "Bump deps"}}
+	s.intent = &githubtest.FakeClassifier{Intents: []*gh.ClassifiedIntent{
+		{Type: "list_prs_mine", Args: map[string]any{}, Confidence: 0.9},
+		{Type: "merge_pr", Args: map[string]any{}, Confidence: 0.9},
+		{Type: "reset_context", Args: map[string]any{}, Confidence: 0.9},
+	}}
+
+	for _, turn := range []struct{ message, wantIntent string }{
+		{message: "show my PRs", wantIntent: "show_prs"},
+		{message: "merge it", wantIntent: "clarify"},
+		{message: "never mind, start over", wantIntent: "reset_context"},
+	} {
+		rec := httptest.NewRecorder()
+		s.handleChat(rec, chatRequest(turn.message))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d (%s)", turn.message, rec.Code, rec.Body)
+		}
+		var resp types.ChatResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Intent == nil || resp.Intent.Type != turn.wantIntent {
+			t.Fatalf("%q: reply = %q (%+v), want %q", turn.message, resp.Reply, resp.Intent, turn.wantIntent)
+		}
+		if turn.wantIntent == "clarify" {
+			// Make sure there is something for the reset to clear
+			if _, _, pending := s.store.GetPendingIntent(testSession); !pending {
+				t.Fatal("the merge question left nothing pending")
+			}
+			if prs, _ := s.store.GetLastPRs(testSession); len(prs) != 2 {
+				t.Fatalf("last listing = %v, want both PRs", prs)
+			}
+		}
+	}
+
+	if pType, _, pending := s.store.GetPendingIntent(testSession); pending {
+		t.Errorf("pending %s survived the reset", pType)
+	}
+	if prs, _ := s.store.GetLastPRs(testSession); len(prs) != 0 {
+		t.Errorf("last listing = %v after the reset, want none", prs)
+	}
+	if got := len(fake.CallsTo("MergePR")); got != 0 {
+		t.Errorf("merged %d PRs", got)
+	}
+}
+
+func TestClassifierFailureFallsBackToHeuristic(t *testing.T) {
+	tests := []struct {
+		name       string
+		classifier func(t *testing.T) gh.Classifier
+		message    string
+		wantType   string
+		wantCalls  []string
+	}{
+		{name: "openai down, my prs", classifier: failingOpenAIClassifier, message: "show my PRs", wantType: "show_prs", wantCalls: []string{"ListPRs list_prs_mine"}},
+		{name: "openai down, review queue", classifier: failingOpenAIClassifier, message: "what do I need to review?", wantType: "show_prs", wantCalls: []string{"ListPRs list_prs_review"}},
+		{name: "openai down, nothing recognisable", classifier: failingOpenAIClassifier, message: "merge PR 5 in acme/app"},
+		{name: "no classifier configured", classifier: func(*testing.T) gh.Classifier { return nil }, message: "show my PRs", wantType: "show_prs", wantCalls: []string{"ListPRs list_prs_mine"}},
+		// No rule matching is an answer, not a failure: it's left to the chat model
+		{name: "rules found nothing", classifier: func(*testing.T) gh.Classifier { return &githubtest.FakeClassifier{Err: gh.ErrNoIntent} }, message: "show my PRs"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			s.intent = nil
+			if c := tc.classifier(t); c != nil {
+				s.intent = c
+			}
+			s.appendMessage(testSession, store.Message{Role: "user", Content: tc.message})
+
+			reply, resp, ok := s.classifyAndHandle(context.Background(), testSession, tc.message)
+			if ok != (tc.wantType != "") {
+				t.Fatalf("handled = %v (%q), want %v", ok, reply, tc.wantType != "")
+			}
+			if ok && resp.Type != tc.wantType {
+				t.Errorf("type = %q, want %q", resp.Type, tc.wantType)
+			}
+			var calls []string
+			for _, c := range fake.CallsTo("ListPRs") {
+				calls = append(calls, fmt.Sprintf("ListPRs %s", c.Args[0]))
+			}
+			if n := len(fake.Calls()); n != len(calls) {
+				t.Errorf("made %d GitHub calls besides listing", n-len(calls))
+			}
+			if strings.Join(calls, ",") != strings.Join(tc.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// failingOpenAIClassifier is the real classifier talking to an OpenAI that
+// answers every request with a 500.
+func failingOpenAIClassifier(t *testing.T) gh.Classifier {
+	ts := httptest.NewServer(&stubOpenAI{status: http.StatusInternalServerError})
+	t.Cleanup(ts.Close)
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = ts.URL + "/v1"
+	c, err := gh.LoadIntentClassifier("../prompts/intent.yaml", openai.NewClientWithConfig(cfg), "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSystemPromptLeadsTrimmedHistory(t *testing.T) {
+	s, _ := newTestServer(t, config.Config{})
+	s.store = store.NewMemoryStore(3)
+	s.store.SetSystemPrompt(testSession, "be brief")
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		s.appendMessage(testSession, store.Message{Role: "user", Content: c})
+		// Re-sending the same system prompt each turn mustn't add to history
+		s.store.SetSystemPrompt(testSession, "be brief")
+	}
+	got := s.convertMessages(testSession, s.history(testSession))
+	want := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+		{Role: "user", Content: "c"},
+		{Role: "user", Content: "d"},
+		{Role: "user", Content: "e"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %+v, want %+v", got, want)
+	}
+}
@@ -1,25 +1,25 @@
 package server
 
 import (
-	"fmt"
 	"net/http"
-	"time"
+	"strings"
 )
 
-const (
-	// CookieName is the name of the session cookie
-	CookieName = "zana_session"
-	// CookieMaxAge is the duration the cookie is valid (15 minutes)
-	CookieMaxAge = 15 * time.Minute
-)
-
-// SetSessionCookie sets an HTTP-only session cookie with 15-minute expiration
-func SetSessionCookie(w http.ResponseWriter, r *http.Request, sessionID string) {
-	// Detect if request is over HTTPS
-	isSecure := r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+// isSecureRequest reports whether the session cookie should be Secure. COOKIE_SECURE
+// overrides detection for TLS-terminating proxies that don't set X-Forwarded-Proto.
+func (s *Server) isSecureRequest(r *http.Request) bool {
+	switch strings.ToLower(s.cfg.CookieSecure) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
 
-	fmt.Println("isSecure", isSecure)
-	
+// setSessionCookie sets an HTTP-only session cookie that lives for SessionTTL
+func (s *Server) setSessionCookie(w http.ResponseWriter, r *http.Request, sessionID string) {
+	isSecure := s.isSecureRequest(r)
 
 	// Use SameSite=None for cross-origin when secure, Lax otherwise
 	sameSite := http.SameSiteLaxMode
@@ -28,10 +28,11 @@ func SetSessionCookie(w http.ResponseWriter, r *http.Request, sessionID string)
 	}
 
 	cookie := &http.Cookie{
-		Name:     CookieName,
+		Name:     s.cfg.SessionCookieName,
 		Value:    sessionID,
 		Path:     "/",
-		MaxAge:   int(CookieMaxAge.Seconds()),
+		Domain:   s.cfg.CookieDomain,
+		MaxAge:   int(s.cfg.SessionTTL.Seconds()),
 		HttpOnly: true,
 		SameSite: sameSite,
 		Secure:   isSecure,
@@ -39,25 +40,43 @@ func SetSessionCookie(w http.ResponseWriter, r *http.Request, sessionID string)
 	http.SetCookie(w, cookie)
 }
 
-// ClearSessionCookie removes the session cookie
-func ClearSessionCookie(w http.ResponseWriter) {
+// clearSessionCookie removes the session cookie
+func (s *Server) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
 	cookie := &http.Cookie{
-		Name:     CookieName,
+		Name:     s.cfg.SessionCookieName,
 		Value:    "",
 		Path:     "/",
+		Domain:   s.cfg.CookieDomain,
 		MaxAge:   -1,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-		Secure:   false,
+		Secure:   s.isSecureRequest(r),
 	}
 	http.SetCookie(w, cookie)
 }
 
-// GetSessionCookie reads the session ID from the cookie
-func GetSessionCookie(r *http.Request) (string, error) {
-	cookie, err := r.Cookie(CookieName)
+// sessionCookie reads the session ID from the cookie
+func (s *Server) sessionCookie(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(s.cfg.SessionCookieName)
 	if err != nil {
 		return "", err
 	}
 	return cookie.Value, nil
 }
+
+// refreshSession re-issues the session cookie with a fresh expiry whenever a request
+// carries one, so active users get a sliding session. It only ever re-sets the value
+// the browser already sent, and skips the OAuth callback and logout, which manage the
+// cookie themselves.
+func (s *Server) refreshSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/github/callback", "/api/github/logout":
+		default:
+			if sid, err := s.sessionCookie(r); err == nil && sid != "" {
+				s.setSessionCookie(w, r, sid)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zana-speech-backend/internal/config"
+)
+
+func TestRefreshSessionSlidesExpiry(t *testing.T) {
+	s, _ := newTestServer(t, config.Config{SessionCookieName: "session_id", SessionTTL: 15 * time.Minute})
+	var reached int
+	h := s.refreshSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached++ }))
+
+	tests := []struct {
+		name string
+		path string
+		// cookie is the session cookie sent, nil for none
+		cookie *string
+		// wantRefresh is whether the response re-issues the session cookie
+		wantRefresh bool
+	}{
+		{name: "no session yet", path: "/api/chat"},
+		{name: "empty session", path: "/api/chat", cookie: ptr("")},
+		{name: "active session", path: "/api/chat", cookie: ptr(testSession), wantRefresh: true},
+		{name: "second request in the window", path: "/api/github/status", cookie: ptr(testSession), wantRefresh: true},
+		{name: "oauth callback sets its own cookie", path: "/api/github/callback", cookie: ptr(testSession)},
+		{name: "logout clears the cookie", path: "/api/github/logout", cookie: ptr(testSession)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.cookie != nil {
+				req.AddCookie(&http.Cookie{Name: "session_id", Value: *tc.cookie})
+			}
+			rec := httptest.NewRecorder()
+			before := reached
+			h.ServeHTTP(rec, req)
+			if reached != before+1 {
+				t.Fatal("request did not reach the handler")
+			}
+			cookies := rec.Result().Cookies()
+			if !tc.wantRefresh {
+				if len(cookies) != 0 {
+					t.Errorf("set %v, want no cookie", cookies)
+				}
+				return
+			}
+			if len(cookies) != 1 {
+				t.Fatalf("cookies = %v, want the session cookie", cookies)
+			}
+			c := cookies[0]
+			if c.Name != "session_id" || c.Value != testSession || c.MaxAge != 15*60 || !c.HttpOnly || c.Path != "/" {
+				t.Errorf("cookie = %+v, want the session re-issued for 15m", c)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	gh "zana-speech-backend/internal/github"
+)
+
+const (
+	// Descriptions up to this many characters are read out as-is
+	describeMaxChars = 400
+	// Longest description sent to the model for summarizing
+	describeSummaryInputCap = 8000
+)
+
+// describePR renders a PR's title and description for speech. Long descriptions are
+// summarized by the chat model, falling back to a trimmed excerpt if that fails.
+func (s *Server) describePR(ctx context.Context, pr gh.PR) string {
+	head := fmt.Sprintf("PR #%d in %s is %q", pr.Number, pr.Repository, pr.Title)
+	if pr.Author != "" {
+		head += " by " + pr.Author
+	}
+	body := strings.Join(strings.Fields(pr.Body), " ")
+	if body == "" {
+		return head + ". It doesn't have a description."
+	}
+	if len(body) > describeMaxChars {
+		if summary, err := s.summarizeDescription(ctx, pr.Title, body); err == nil && summary != "" {
+			body = summary
+		} else {
+			if err != nil {
+				logger(ctx).Warn("describe pr summary failed", "error", err)
+			}
+			body = trimToWord(body, describeMaxChars)
+		}
+	}
+	return head + ". " + body
+}
+
+// summarizeDescription asks the chat model for a short spoken summary of a PR description.
+func (s *Server) summarizeDescription(ctx context.Context, title, body string) (string, error) {
+	if len(body) > describeSummaryInputCap {
+		body = body[:describeSummaryInputCap]
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	resp, _, err := completeWithFallback(ctx, s.client, s.models(), openai.ChatCompletionRequest{
+		Temperature: 0.2,
+		MaxTokens:   120,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "Summarize this pull request description in at most two short sentences suitable for reading aloud. No markdown, links or lists."},
+			{Role: openai.ChatMessageRoleUser, Content: "Title: " + title + "\n\n" + body},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices")
+	}
+	return trimToWord(strings.TrimSpace(resp.Choices[0].Message.Content), describeMaxChars), nil
+}
+
+// trimToWord shortens s to at most max bytes, cutting at a word boundary and adding an ellipsis.
+func trimToWord(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := s[:max]
+	if i := strings.LastIndex(cut, " "); i > max/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
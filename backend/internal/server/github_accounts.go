@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"zana-speech-backend/internal/store"
+)
+
+// githubAccount is one connected GitHub account as reported to the frontend.
+type githubAccount struct {
+	Login   string `json:"login"`
+	Default bool   `json:"default"`
+}
+
+// GET /api/github/accounts
+// Returns { accounts: [{ login, default }] }, default account first. Without a
+// database a session has at most the one account it signed in with.
+func (s *Server) handleGitHubAccounts(w http.ResponseWriter, r *http.Request) {
+	sid := s.getSessionID(r)
+	if strings.TrimSpace(s.getGitHubToken(sid)) == "" {
+		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
+		return
+	}
+	accounts := []githubAccount{}
+	if s.databaseStore != nil && sid != "" {
+		auths, err := s.databaseStore.ListGitHubAuth(sid)
+		if err != nil {
+			logger(r.Context()).Error("list github accounts failed", "error", err)
+			s.writeError(w, http.StatusInternalServerError, "failed to list GitHub accounts")
+			return
+		}
+		for _, a := range auths {
+			accounts = append(accounts, githubAccount{Login: a.GitHubOwner, Default: a.IsDefault})
+		}
+	} else if login := strings.TrimSpace(s.store.GetUsername(sid)); login != "" {
+		accounts = append(accounts, githubAccount{Login: login, Default: true})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"accounts": accounts})
+}
+
+// githubAccounts lists the session's stored accounts, default first; nil without a database.
+func (s *Server) githubAccounts(ctx context.Context, sessionID string) []store.GitHubAuth {
+	if s.databaseStore == nil || sessionID == "" {
+		return nil
+	}
+	auths, err := s.databaseStore.ListGitHubAuth(sessionID)
+	if err != nil {
+		logger(ctx).Error("list github accounts failed", "error", err)
+		return nil
+	}
+	return auths
+}
+
+// getGitHubTokenForRepo picks the token for acting on repo ("owner/name"): when the
+// session has several accounts and one of them is the repo's owner, that account's
+// token is used. Org repos and anything ambiguous fall back to the default account.
+func (s *Server) getGitHubTokenForRepo(ctx context.Context, sessionID, repo string) string {
+	owner, _, _ := strings.Cut(repo, "/")
+	if owner = strings.TrimSpace(owner); owner != "" {
+		if accounts := s.githubAccounts(ctx, sessionID); len(accounts) > 1 {
+			for _, a := range accounts {
+				if strings.EqualFold(a.GitHubOwner, owner) && strings.TrimSpace(a.GitHubToken) != "" {
+					return s.accountToken(a)
+				}
+			}
+		}
+	}
+	return s.getGitHubToken(sessionID)
+}
+
+// accountLogins returns the logins of accounts in order.
+func accountLogins(accounts []store.GitHubAuth) []string {
+	logins := make([]string, 0, len(accounts))
+	for _, a := range accounts {
+		logins = append(logins, a.GitHubOwner)
+	}
+	return logins
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"zana-speech-backend/internal/config"
+	"zana-speech-backend/internal/db/dbtest"
+	"zana-speech-backend/internal/store"
+)
+
+// withAccounts gives s a database with logins connected to testSession in order, so
+// the last one is the default.
+func withAccounts(t *testing.T, s *Server, logins ...string) {
+	t.Helper()
+	s.databaseStore = store.NewDatabaseStore(dbtest.New(t), 40)
+	for _, login := range logins {
+		if err := s.databaseStore.SaveGitHubAuth(testSession, "gho_"+login, login, "", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getAccounts(t *testing.T, s *Server) (int, []githubAccount) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/github/accounts", nil)
+	req.Header.Set("X-Session-Id", testSession)
+	rec := httptest.NewRecorder()
+	s.handleGitHubAccounts(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	var body struct {
+		Accounts []githubAccount `json:"accounts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Accounts == nil {
+		t.Errorf("accounts = null in %s, want a list", rec.Body)
+	}
+	return rec.Code, body.Accounts
+}
+
+func TestGitHubAccounts(t *testing.T) {
+	t.Run("not connected", func(t *testing.T) {
+		s, _ := newTestServer(t, config.Config{})
+		if code, _ := getAccounts(t, s); code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", code)
+		}
+	})
+
+	t.Run("without a database", func(t *testing.T) {
+		s, _ := newTestServer(t, config.Config{GitHubToken: "tok"})
+		if _, accounts := getAccounts(t, s); len(accounts) != 0 {
+			t.Errorf("accounts = %v before the login is known, want none", accounts)
+		}
+		s.store.SetUsername(testSession, "alice")
+		if _, accounts := getAccounts(t, s); !reflect.DeepEqual(accounts, []githubAccount{{Login: "alice", Default: true}}) {
+			t.Errorf("accounts = %v, want alice as the default", accounts)
+		}
+	})
+
+	t.Run("database accounts default first", func(t *testing.T) {
+		s, _ := newTestServer(t, config.Config{})
+		withAccounts(t, s, "alice", "bob")
+		want := []githubAccount{{Login: "bob", Default: true}, {Login: "alice"}}
+		if code, accounts := getAccounts(t, s); code != http.StatusOK || !reflect.DeepEqual(accounts, want) {
+			t.Errorf("got %d %v, want %v", code, accounts, want)
+		}
+	})
+}
+
+func TestSwitchAccountIntent(t *testing.T) {
+	t.Run("not connected", func(t *testing.T) {
+		s, _ := newTestServer(t, config.Config{})
+		if _, resp := handle(t, s, "switch_account", map[string]any{"account": "alice"}); resp.Type != "require_github_auth" {
+			t.Errorf("type = %q, want require_github_auth", resp.Type)
+		}
+	})
+
+	t.Run("one account", func(t *testing.T) {
+		s, _ := newTestServer(t, config.Config{GitHubToken: "tok"})
+		reply, resp := handle(t, s, "switch_account", map[string]any{"account": "alice"})
+		if reply != "You only have one GitHub account connected. Connect another one and I can switch between them." || resp.Payload["switched"] != false {
+			t.Errorf("got %q %v", reply, resp.Payload)
+		}
+	})
+
+	tests := []struct {
+		name         string
+		account      string
+		wantType     string
+		wantReply    string
+		wantDefault  string
+		wantUsername string
+	}{
+		{name: "which one", wantType: "clarify", wantReply: "Which account should I switch to: bob, alice or carol?", wantDefault: "bob"},
+		{name: "switches", account: "@ALICE", wantType: "switch_account", wantReply: "Switched to alice. I'll still use your other accounts for their own repos.", wantDefault: "alice", wantUsername: "alice"},
+		{name: "not connected here", account: "dave", wantType: "switch_account", wantReply: "dave isn't connected here. Your accounts are bob, alice and carol.", wantDefault: "bob"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t, config.Config{})
+			withAccounts(t, s, "carol", "alice", "bob")
+			args := map[string]any{}
+			if tc.account != "" {
+				args["account"] = tc.account
+			}
+			reply, resp := handle(t, s, "switch_account", args)
+			if resp.Type != tc.wantType || reply != tc.wantReply {
+				t.Errorf("got %s %q, want %s %q", resp.Type, reply, tc.wantType, tc.wantReply)
+			}
+			if auth, err := s.databaseStore.GetGitHubAuth(testSession); err != nil || auth == nil || auth.GitHubOwner != tc.wantDefault {
+				t.Errorf("default account = %+v (%v), want %s", auth, err, tc.wantDefault)
+			}
+			if got := s.store.GetUsername(testSession); got != tc.wantUsername {
+				t.Errorf("username = %q, want %q", got, tc.wantUsername)
+			}
+		})
+	}
+}
@@ -1,21 +1,40 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"golang.org/x/oauth2"
+
+	gh "zana-speech-backend/internal/github"
 	"zana-speech-backend/internal/store"
 )
 
+// tokenExchanger is the subset of *oauth2.Config used by the callback handler,
+// so the code exchange can be stubbed in tests.
+type tokenExchanger interface {
+	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
+}
+
+// usernameFetcher resolves the GitHub login for an access token, empty on failure,
+// along with the token's granted OAuth scopes (nil when GitHub doesn't report them).
+type usernameFetcher func(accessToken string) (string, []string)
+
 // GET /api/github/status
 // Returns { authenticated: bool, username?: string }
 func (s *Server) handleGitHubStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	sid := getSessionID(r)
+	sid := s.getSessionID(r)
 
 	var authed bool
 	var username string
@@ -43,17 +62,47 @@ func (s *Server) handleGitHubStatus(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-// GET /api/github/auth?sessionId=...
-// Initiates OAuth flow and returns { url } to redirect the browser
+// GET /api/github/me
+// Returns the connected account: { login, name?, avatarUrl?, scopes }
+func (s *Server) handleGitHubMe(w http.ResponseWriter, r *http.Request) {
+	sid := s.getSessionID(r)
+	token := s.getGitHubToken(sid)
+	if strings.TrimSpace(token) == "" {
+		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
+	defer cancel()
+	user, err := s.mcp.GetAuthenticatedUser(ctx, token)
+	if err != nil {
+		s.writeGitHubError(w, err, "failed to fetch GitHub user")
+		return
+	}
+	if sid != "" && user.Login != "" {
+		s.store.SetUsername(sid, user.Login)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+// GET /api/github/auth?sessionId=...&add_account=true
+// Initiates OAuth flow and returns { url } to redirect the browser. add_account asks
+// GitHub to show its account picker so a second account can be connected.
 func (s *Server) handleGitHubAuth(w http.ResponseWriter, r *http.Request) {
 	if s.oauthCfg == nil || s.oauthCfg.ClientID == "" || s.oauthCfg.ClientSecret == "" {
 		s.writeError(w, http.StatusBadRequest, "github oauth not configured")
 		return
 	}
-	sid := getOrCreateSessionID(r, w)
+	sid := s.getOrCreateSessionID(r, w)
 	state := randomState()
-	s.store.SetOAuthState(sid, state)
-	url := s.oauthCfg.AuthCodeURL(state)
+	// PKCE: an intercepted code is useless without the verifier, which never leaves the server
+	verifier := oauth2.GenerateVerifier()
+	s.store.SetOAuthState(sid, state, verifier)
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if addAccount, _ := strconv.ParseBool(r.URL.Query().Get("add_account")); addAccount {
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", "select_account"))
+	}
+	url := s.oauthCfg.AuthCodeURL(state, opts...)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Session-Id", sid)
 	_ = json.NewEncoder(w).Encode(map[string]string{"url": url, "sessionId": sid})
@@ -72,25 +121,26 @@ func (s *Server) handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "missing state or code")
 		return
 	}
-	sid := s.store.GetSessionByOAuthState(state)
-	if sid == "" || s.store.GetOAuthState(sid) != state {
-		s.writeError(w, http.StatusBadRequest, "invalid oauth state")
+	// Single use: the state is gone after this, even if the exchange below fails
+	sid, verifier := s.store.ConsumeOAuthState(state)
+	if sid == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid or expired oauth state")
 		return
 	}
 
-	fmt.Println("sid", sid)
-	fmt.Println("state", state)
-	fmt.Println("code", code)
-
 	ctx := r.Context()
-	tok, err := s.oauthCfg.Exchange(ctx, code)
+	var opts []oauth2.AuthCodeOption
+	if verifier != "" {
+		opts = append(opts, oauth2.VerifierOption(verifier))
+	}
+	tok, err := s.oauthExchanger.Exchange(ctx, code, opts...)
 	if err != nil {
 		s.writeError(w, http.StatusBadGateway, "token exchange failed")
 		return
 	}
 
 	// Fetch username for database storage
-	username := fetchGitHubUsername(tok.AccessToken)
+	username, scopes := s.usernameFetcher(tok.AccessToken)
 	if username == "" {
 		s.writeError(w, http.StatusInternalServerError, "failed to fetch GitHub username")
 		return
@@ -98,28 +148,114 @@ func (s *Server) handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 
 	// Store in database if available, otherwise fall back to file storage
 	if s.databaseStore != nil {
-		if err := s.databaseStore.SaveGitHubAuth(sid, tok.AccessToken, username); err != nil {
+		if err := s.databaseStore.SaveGitHubAuth(sid, tok.AccessToken, username, tok.RefreshToken, tok.Expiry); err != nil {
 			s.writeError(w, http.StatusInternalServerError, "failed to save GitHub auth to database")
 			return
 		}
 	} else {
 		// Fallback to file storage
-		if err := s.tokenStore.Write(&store.GitHubToken{AccessToken: tok.AccessToken, TokenType: tok.TokenType}); err != nil {
+		if err := s.tokenStore.Write(&store.GitHubToken{AccessToken: tok.AccessToken, TokenType: tok.TokenType, RefreshToken: tok.RefreshToken, Expiry: tok.Expiry, SessionID: sid}); err != nil {
 			s.writeError(w, http.StatusInternalServerError, "token persist failed")
 			return
 		}
 	}
 
-	// Store username in memory store for quick access
+	// Store username in memory store for quick access; a newly connected account
+	// becomes the session's default
 	s.store.SetUsername(sid, username)
-	s.store.ClearOAuthState(sid)
 
 	// Set session cookie so popup and main window share the same session
-	SetSessionCookie(w, r, sid)
+	s.setSessionCookie(w, r, sid)
 
-	// Redirect to frontend with success indicator
-	redirectURL := fmt.Sprintf("%s?githubAuth=success", s.cfg.FrontendURL)
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	// Redirect to frontend with success indicator, flagging scopes the user didn't
+	// grant so the UI can explain why merges will fail before one does
+	q := url.Values{"githubAuth": {"success"}}
+	if scopes != nil {
+		if missing := gh.ScopeCheck(scopes, s.cfg.GitHubScopes); len(missing) > 0 {
+			logger(r.Context()).Warn("github auth is missing scopes", "login", username, "missing", strings.Join(missing, ", "))
+			for _, m := range missing {
+				q.Add("warning", "missing_"+strings.ReplaceAll(m, ":", "_")+"_scope")
+			}
+		}
+	}
+	http.Redirect(w, r, s.cfg.FrontendURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// POST /api/github/logout
+// Disconnects GitHub for the session: revokes every connected account's OAuth token (best effort),
+// removes the session's stored auth, and clears the session cookie. The token file is
+// shared by every session, so it is only revoked and cleared by the session that connected it.
+func (s *Server) handleGitHubLogout(w http.ResponseWriter, r *http.Request) {
+	sid := s.getSessionID(r)
+
+	// Collect OAuth tokens to revoke; never revoke the static config token
+	var tokens []string
+	for _, a := range s.githubAccounts(r.Context(), sid) {
+		if strings.TrimSpace(a.GitHubToken) != "" {
+			tokens = append(tokens, a.GitHubToken)
+		}
+	}
+	fileTok, _ := s.tokenStore.Read()
+	ownsFile := sid != "" && fileTok != nil && fileTok.SessionID == sid
+	if ownsFile {
+		tokens = append(tokens, fileTok.AccessToken)
+	}
+	for _, t := range tokens {
+		if err := s.revokeGitHubToken(r.Context(), t); err != nil {
+			logger(r.Context()).Warn("github token revocation failed", "error", err)
+		}
+	}
+
+	if s.databaseStore != nil && sid != "" {
+		if err := s.databaseStore.DeleteGitHubAuth(sid); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to remove GitHub auth")
+			return
+		}
+	}
+	if ownsFile {
+		if err := s.tokenStore.Clear(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to remove GitHub token")
+			return
+		}
+	}
+	if sid != "" {
+		s.store.ClearUsername(sid)
+		s.store.ClearOAuthState(sid)
+	}
+	s.clearSessionCookie(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+// revokeGitHubToken invalidates an OAuth token via DELETE /applications/{client_id}/token.
+// It is a no-op when OAuth isn't configured.
+func (s *Server) revokeGitHubToken(ctx context.Context, accessToken string) error {
+	if s.oauthCfg == nil || s.oauthCfg.ClientID == "" || s.oauthCfg.ClientSecret == "" {
+		return nil
+	}
+	body, _ := json.Marshal(map[string]string{"access_token": accessToken})
+	u := fmt.Sprintf("%s/applications/%s/token", gh.NormalizeAPIBaseURL(s.cfg.GitHubAPIBaseURL), url.PathEscape(s.oauthCfg.ClientID))
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.oauthCfg.ClientID, s.oauthCfg.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 404 means the token was already revoked or never belonged to this app
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("revoke token failed: %d %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
 }
 
 func randomState() string {
@@ -128,24 +264,36 @@ func randomState() string {
 	return base64.RawURLEncoding.EncodeToString(b[:])
 }
 
-// Minimal call to get the GitHub username; avoid adding HTTP client deps, use stdlib
-func fetchGitHubUsername(accessToken string) string {
-	req, _ := http.NewRequest("GET", "https://api.github.com/user", nil)
+// githubUsernameFetcher binds fetchGitHubUsername to an API base URL (public or Enterprise).
+func githubUsernameFetcher(apiBase string) usernameFetcher {
+	return func(accessToken string) (string, []string) {
+		return fetchGitHubUsername(apiBase, accessToken)
+	}
+}
+
+// Minimal call to get the GitHub username and granted scopes; avoid adding HTTP client deps, use stdlib
+func fetchGitHubUsername(apiBase, accessToken string) (string, []string) {
+	req, _ := http.NewRequest("GET", apiBase+"/user", nil)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Set("Accept", "application/vnd.github+json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return ""
+		return "", nil
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return ""
+		return "", nil
 	}
 	var body struct {
 		Login string `json:"login"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return ""
+		return "", nil
+	}
+	// Fine-grained and GitHub App tokens carry no X-OAuth-Scopes header at all
+	var scopes []string
+	if _, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		scopes = gh.ParseScopes(resp.Header.Get("X-OAuth-Scopes"))
 	}
-	return strings.TrimSpace(body.Login)
+	return strings.TrimSpace(body.Login), scopes
 }
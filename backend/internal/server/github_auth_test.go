@@ -0,0 +1,405 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+
+	"zana-speech-backend/internal/config"
+	"zana-speech-backend/internal/db/dbtest"
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/store"
+)
+
+// stubExchanger hands out tok, or fails with err, recording what it was asked.
+type stubExchanger struct {
+	tok   *oauth2.Token
+	err   error
+	codes []string
+	opts  int
+}
+
+func (e *stubExchanger) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	e.codes = append(e.codes, code)
+	e.opts = len(opts)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.tok, nil
+}
+
+func newOAuthTestServer(t *testing.T, ex tokenExchanger, fetch usernameFetcher) *Server {
+	t.Helper()
+	s, _ := newTestServer(t, config.Config{
+		SessionCookieName: "session_id",
+		FrontendURL:       "http://app.test/",
+		GitHubScopes:      []string{"repo", "read:user"},
+	})
+	s.oauthCfg = &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Endpoint:     oauth2.Endpoint{AuthURL: "https://github.com/login/oauth/authorize", TokenURL: "https://github.com/login/oauth/access_token"},
+	}
+	s.oauthExchanger = ex
+	s.usernameFetcher = fetch
+	return s
+}
+
+func callback(s *Server, state, code string) *httptest.ResponseRecorder {
+	q := url.Values{"state": {state}, "code": {code}}
+	rec := httptest.NewRecorder()
+	s.handleGitHubCallback(rec, httptest.NewRequest(http.MethodGet, "/api/github/callback?"+q.Encode(), nil))
+	return rec
+}
+
+func TestGitHubAuthStartsPKCEFlow(t *testing.T) {
+	s := newOAuthTestServer(t, &stubExchanger{}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/github/auth?add_account=true", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: testSession})
+	rec := httptest.NewRecorder()
+	s.handleGitHubAuth(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+	var body struct {
+		URL       string `json:"url"`
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(body.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") == "" || q.Get("state") != s.store.GetOAuthState(testSession) {
+		t.Errorf("state = %q, stored %q", q.Get("state"), s.store.GetOAuthState(testSession))
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("auth url %s has no S256 challenge", body.URL)
+	}
+	if q.Get("prompt") != "select_account" {
+		t.Errorf("prompt = %q, want select_account", q.Get("prompt"))
+	}
+	if body.SessionID != testSession {
+		t.Errorf("sessionId = %q", body.SessionID)
+	}
+}
+
+func TestGitHubCallback(t *testing.T) {
+	goodTok := &oauth2.Token{AccessToken: "gho_abc", TokenType: "bearer", RefreshToken: "ghr_def"}
+	tests := []struct {
+		name     string
+		state    string
+		ex       *stubExchanger
+		login    string
+		scopes   []string
+		wantCode int
+		// wantWarnings are the warning params on the success redirect
+		wantWarnings []string
+	}{
+		{name: "happy path", state: "good", ex: &stubExchanger{tok: goodTok}, login: "alice", scopes: []string{"repo", "read:user"}, wantCode: http.StatusFound},
+		{name: "fine-grained token reports no scopes", state: "good", ex: &stubExchanger{tok: goodTok}, login: "alice", wantCode: http.StatusFound},
+		{name: "missing scope is flagged", state: "good", ex: &stubExchanger{tok: goodTok}, login: "alice", scopes: []string{"read:user"}, wantCode: http.StatusFound, wantWarnings: []string{"missing_repo_scope"}},
+		{name: "invalid state", state: "forged", ex: &stubExchanger{tok: goodTok}, login: "alice", wantCode: http.StatusBadRequest},
+		{name: "exchange fails", state: "good", ex: &stubExchanger{err: errors.New("bad_verification_code")}, login: "alice", wantCode: http.StatusBadGateway},
+		{name: "username fetch fails", state: "good", ex: &stubExchanger{tok: goodTok}, wantCode: http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newOAuthTestServer(t, tc.ex, func(accessToken string) (string, []string) {
+				if accessToken != goodTok.AccessToken {
+					t.Errorf("username fetched with %q", accessToken)
+				}
+				return tc.login, tc.scopes
+			})
+			s.store.SetOAuthState(testSession, "good", "verifier")
+
+			rec := callback(s, tc.state, "code-1")
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+			}
+			if tc.state == "good" && (len(tc.ex.codes) != 1 || tc.ex.codes[0] != "code-1" || tc.ex.opts != 1) {
+				t.Errorf("exchanged %v with %d options, want code-1 with the PKCE verifier", tc.ex.codes, tc.ex.opts)
+			}
+			if tc.state != "good" && len(tc.ex.codes) != 0 {
+				t.Error("exchanged a code for an invalid state")
+			}
+			// The state is spent whatever happened after it was checked
+			if tc.state == "good" && s.store.GetOAuthState(testSession) != "" {
+				t.Error("oauth state survived the callback")
+			}
+
+			tok, _ := s.tokenStore.Read()
+			if tc.wantCode != http.StatusFound {
+				if tok != nil || s.store.GetUsername(testSession) != "" {
+					t.Errorf("failed callback stored token %v, username %q", tok, s.store.GetUsername(testSession))
+				}
+				return
+			}
+			if tok == nil || tok.AccessToken != goodTok.AccessToken || tok.RefreshToken != goodTok.RefreshToken {
+				t.Errorf("stored token = %+v", tok)
+			}
+			if got := s.store.GetUsername(testSession); got != tc.login {
+				t.Errorf("username = %q, want %q", got, tc.login)
+			}
+			loc, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil || !strings.HasPrefix(loc.String(), "http://app.test/") || loc.Query().Get("githubAuth") != "success" {
+				t.Errorf("redirect = %q", rec.Header().Get("Location"))
+			}
+			if got := loc.Query()["warning"]; !reflect.DeepEqual(got, tc.wantWarnings) {
+				t.Errorf("warnings = %v, want %v", got, tc.wantWarnings)
+			}
+			if c := rec.Result().Cookies(); len(c) != 1 || c[0].Name != "session_id" || c[0].Value != testSession {
+				t.Errorf("cookies = %v, want the session cookie", c)
+			}
+		})
+	}
+}
+
+func TestGitHubCallbackStateIsSingleUse(t *testing.T) {
+	ex := &stubExchanger{tok: &oauth2.Token{AccessToken: "gho_abc"}}
+	s := newOAuthTestServer(t, ex, func(string) (string, []string) { return "alice", nil })
+	s.store.SetOAuthState(testSession, "good", "verifier")
+
+	if rec := callback(s, "good", "code-1"); rec.Code != http.StatusFound {
+		t.Fatalf("first callback status = %d", rec.Code)
+	}
+	if rec := callback(s, "good", "code-1"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("replayed callback status = %d, want 400", rec.Code)
+	}
+	if len(ex.codes) != 1 {
+		t.Errorf("exchanged %d codes, want 1", len(ex.codes))
+	}
+}
+
+func TestFetchGitHubUsername(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		scopes     *string
+		wantLogin  string
+		wantScopes []string
+	}{
+		{name: "classic token", status: http.StatusOK, scopes: ptr("repo, read:user"), wantLogin: "alice", wantScopes: []string{"repo", "read:user"}},
+		{name: "token without scopes header", status: http.StatusOK, wantLogin: "alice"},
+		{name: "rejected token", status: http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/user" || r.Header.Get("Authorization") != "Bearer gho_abc" {
+					t.Errorf("request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				if tc.scopes != nil {
+					w.Header().Set("X-OAuth-Scopes", *tc.scopes)
+				}
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(map[string]string{"login": " alice "})
+			}))
+			defer ts.Close()
+
+			login, scopes := githubUsernameFetcher(ts.URL)("gho_abc")
+			if login != tc.wantLogin || !reflect.DeepEqual(scopes, tc.wantScopes) {
+				t.Errorf("fetch = %q %v, want %q %v", login, scopes, tc.wantLogin, tc.wantScopes)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestGitHubMe(t *testing.T) {
+	octocat := gh.User{Login: "octocat", AvatarURL: "https://avatars.test/u/1", Scopes: []string{"repo", "read:user"}}
+	tests := []struct {
+		name      string
+		token     string
+		err       error
+		wantCode  int
+		wantLogin string
+	}{
+		{name: "signed in", token: "tok", wantCode: http.StatusOK, wantLogin: "octocat"},
+		{name: "not signed in", wantCode: http.StatusUnauthorized},
+		{name: "token rejected", token: "tok", err: &gh.UnauthorizedError{APIError: &gh.APIError{StatusCode: http.StatusUnauthorized}}, wantCode: http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: tc.token, GitHubTimeout: 5 * time.Second})
+			s.router = chi.NewRouter()
+			s.routes()
+			fake.User = octocat
+			fake.Errors = map[string]error{"GetAuthenticatedUser": tc.err}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/github/me", nil)
+			req.Header.Set("X-Session-Id", testSession)
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var got gh.User
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, octocat) {
+				t.Errorf("me = %+v, want %+v", got, octocat)
+			}
+			if got := s.store.GetUsername(testSession); got != tc.wantLogin {
+				t.Errorf("cached username = %q, want %q", got, tc.wantLogin)
+			}
+		})
+	}
+}
+
+func TestWhoamiIntent(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		cached     string
+		wantType   string
+		wantReply  string
+		wantLookup int
+	}{
+		{name: "asks github once", token: "tok", wantType: "whoami", wantReply: "You're signed in as octocat.", wantLookup: 1},
+		{name: "uses the login cached at oauth time", token: "tok", cached: "alice", wantType: "whoami", wantReply: "You're signed in as alice."},
+		{name: "not signed in", wantType: "require_github_auth", wantReply: "You're not signed in to GitHub yet."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: tc.token})
+			fake.User = gh.User{Login: "octocat"}
+			if tc.cached != "" {
+				s.store.SetUsername(testSession, tc.cached)
+			}
+			reply, resp := handle(t, s, "whoami", nil)
+			if resp.Type != tc.wantType || !strings.HasPrefix(reply, tc.wantReply) {
+				t.Errorf("got %s %q, want %s %q", resp.Type, reply, tc.wantType, tc.wantReply)
+			}
+			if got := len(fake.CallsTo("GetAuthenticatedUser")); got != tc.wantLookup {
+				t.Errorf("user lookups = %d, want %d", got, tc.wantLookup)
+			}
+		})
+	}
+}
+
+// newLogoutTestServer is newOAuthTestServer with routes and a fake GitHub that
+// records the tokens revoked through it.
+func newLogoutTestServer(t *testing.T) (*Server, *[]string) {
+	t.Helper()
+	s := newOAuthTestServer(t, &stubExchanger{}, nil)
+	var revoked []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/applications/client-id/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); r.Method != http.MethodDelete || id != "client-id" || secret != "client-secret" {
+			t.Errorf("revocation = %s as %s", r.Method, id)
+		}
+		var body struct {
+			AccessToken string `json:"access_token"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		revoked = append(revoked, body.AccessToken)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	s.cfg.GitHubAPIBaseURL = ts.URL
+	s.router = chi.NewRouter()
+	s.routes()
+	return s, &revoked
+}
+
+// logout posts to the logout route as testSession and checks what every logout
+// does: the username and cookie are cleared and the reply is {"ok":true}.
+func logout(t *testing.T, s *Server) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/github/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: testSession})
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"ok":true}` {
+		t.Fatalf("logout = %d %s, want 200 {\"ok\":true}", rec.Code, rec.Body)
+	}
+	if got := s.store.GetUsername(testSession); got != "" {
+		t.Errorf("username = %q after logout", got)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session_id" || cookies[0].Value != "" || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want the session cookie cleared", cookies)
+	}
+}
+
+func TestGitHubLogoutTokenFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// owner is the session that connected the token file
+		owner       string
+		wantRevoked []string
+		wantKept    bool
+	}{
+		{name: "own token is revoked and cleared", owner: testSession, wantRevoked: []string{"gho_file"}},
+		{name: "another session's token is left alone", owner: "s_other", wantKept: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, revoked := newLogoutTestServer(t)
+			if err := s.tokenStore.Write(&store.GitHubToken{AccessToken: "gho_file", SessionID: tc.owner}); err != nil {
+				t.Fatal(err)
+			}
+			s.store.SetUsername(testSession, "alice")
+
+			logout(t, s)
+			if !reflect.DeepEqual(*revoked, tc.wantRevoked) {
+				t.Errorf("revoked %v, want %v", *revoked, tc.wantRevoked)
+			}
+			tok, err := s.tokenStore.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept := tok != nil; kept != tc.wantKept {
+				t.Errorf("token file kept = %v, want %v", kept, tc.wantKept)
+			}
+		})
+	}
+}
+
+func TestGitHubLogoutDeletesDatabaseAuth(t *testing.T) {
+	s, revoked := newLogoutTestServer(t)
+	s.databaseStore = store.NewDatabaseStore(dbtest.New(t), 40)
+	for _, a := range []struct{ owner, token string }{{"bob", "gho_bob"}, {"alice", "gho_alice"}} {
+		if err := s.databaseStore.SaveGitHubAuth(testSession, a.token, a.owner, "", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.databaseStore.SaveGitHubAuth("s_other", "gho_carol", "carol", "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	s.store.SetUsername(testSession, "alice")
+
+	logout(t, s)
+	got := append([]string(nil), *revoked...)
+	sort.Strings(got)
+	if want := []string{"gho_alice", "gho_bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("revoked %v, want %v", got, want)
+	}
+	if auths, err := s.databaseStore.ListGitHubAuth(testSession); err != nil || len(auths) != 0 {
+		t.Errorf("session auth after logout = %v, %v; want none", auths, err)
+	}
+	if auths, err := s.databaseStore.ListGitHubAuth("s_other"); err != nil || len(auths) != 1 {
+		t.Errorf("other session's auth = %v, %v; want it kept", auths, err)
+	}
+}
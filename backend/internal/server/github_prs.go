@@ -3,12 +3,15 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+
+	gh "zana-speech-backend/internal/github"
 )
 
 // GET /api/github/prs/review
@@ -23,13 +26,19 @@ func (s *Server) handlePRsForReview(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
 		return
 	}
-	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	sortBy, ok := prSortParam(r)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "sort must be created or updated")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
 	defer cancel()
 	prs, err := s.mcp.ListPRsForReview(ctx, token)
 	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "failed to list PRs for review")
+		s.writeGitHubError(w, err, "failed to list PRs for review")
 		return
 	}
+	gh.SortPRs(prs, sortBy)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"prs": prs})
 }
@@ -46,17 +55,46 @@ func (s *Server) handlePRsMine(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
 		return
 	}
-	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	sortBy, ok := prSortParam(r)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "sort must be created or updated")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
 	defer cancel()
 	prs, err := s.mcp.ListUserPRs(ctx, token)
 	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "failed to list user PRs")
+		s.writeGitHubError(w, err, "failed to list user PRs")
 		return
 	}
+	gh.SortPRs(prs, sortBy)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"prs": prs})
 }
 
+// prSortParam reads ?sort=created|updated for PR listings, defaulting to updated.
+func prSortParam(r *http.Request) (string, bool) {
+	switch v := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("sort"))); v {
+	case "":
+		return "updated", true
+	case "created", "updated":
+		return v, true
+	default:
+		return "", false
+	}
+}
+
+// filesOnlyParam reads the optional files_only flag of the diff routes, which drops
+// patch text from the response for very large PRs.
+func filesOnlyParam(r *http.Request) (bool, bool) {
+	v := strings.TrimSpace(r.URL.Query().Get("files_only"))
+	if v == "" {
+		return false, true
+	}
+	b, err := strconv.ParseBool(v)
+	return b, err == nil
+}
+
 // GET /api/github/repos/{owner}/{repo}/prs/{number}/comments
 func (s *Server) handlePRComments(w http.ResponseWriter, r *http.Request) {
 	token := s.cfg.GitHubToken
@@ -78,15 +116,15 @@ func (s *Server) handlePRComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	repo := owner + "/" + repoName
-	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
 	defer cancel()
-	comments, err := s.mcp.GetPRComments(ctx, token, repo, prNumber)
+	comments, truncated, err := s.mcp.GetPRComments(ctx, token, repo, prNumber)
 	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "failed to fetch PR comments")
+		s.writeGitHubError(w, err, "failed to fetch PR comments")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"comments": comments})
+	_ = json.NewEncoder(w).Encode(map[string]any{"comments": comments, "truncated": truncated})
 }
 
 // POST /api/github/repos/{owner}/{repo}/prs/{number}/comments
@@ -117,10 +155,56 @@ func (s *Server) handleAddPRComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	repo := owner + "/" + repoName
-	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
+	defer cancel()
+	id, err := s.mcp.AddComment(ctx, token, repo, prNumber, body.Body)
+	if err != nil {
+		s.writeGitHubError(w, err, "failed to add comment")
+		return
+	}
+	if sid := s.getSessionID(r); sid != "" {
+		s.store.SetLastComment(sid, repo, prNumber, id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "id": id})
+}
+
+// POST /api/github/repos/{owner}/{repo}/prs/{number}/comments/{reviewId}/replies
+func (s *Server) handleReplyToReview(w http.ResponseWriter, r *http.Request) {
+	token := s.cfg.GitHubToken
+	if strings.TrimSpace(token) == "" {
+		if t, _ := s.tokenStore.Read(); t != nil {
+			token = t.AccessToken
+		}
+	}
+	if strings.TrimSpace(token) == "" {
+		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
+		return
+	}
+	owner := chi.URLParam(r, "owner")
+	repoName := chi.URLParam(r, "repo")
+	prNumber, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil || owner == "" || repoName == "" || prNumber <= 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid repo or PR number")
+		return
+	}
+	reviewID, err := strconv.Atoi(chi.URLParam(r, "reviewId"))
+	if err != nil || reviewID <= 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid review comment id")
+		return
+	}
+	var body struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Body) == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid reply body")
+		return
+	}
+	repo := owner + "/" + repoName
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
 	defer cancel()
-	if err := s.mcp.AddComment(ctx, token, repo, prNumber, body.Body); err != nil {
-		s.writeError(w, http.StatusBadGateway, "failed to add comment")
+	if err := s.mcp.ReplyToReview(ctx, token, repo, prNumber, reviewID, body.Body); err != nil {
+		s.writeGitHubError(w, err, "failed to reply to review comment")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -149,13 +233,16 @@ func (s *Server) handleMergePR(w http.ResponseWriter, r *http.Request) {
 	}
 	var body struct {
 		Method string `json:"method"`
+		// Optional commit title/message for the merge or squash commit
+		CommitTitle   string `json:"commitTitle"`
+		CommitMessage string `json:"commitMessage"`
 	}
 	_ = json.NewDecoder(r.Body).Decode(&body)
 	repo := owner + "/" + repoName
-	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout+5*time.Second)
 	defer cancel()
-	if err := s.mcp.MergePR(ctx, token, repo, prNumber, strings.ToLower(strings.TrimSpace(body.Method))); err != nil {
-		s.writeError(w, http.StatusBadGateway, "merge failed")
+	if err := s.mcp.MergePR(ctx, token, repo, prNumber, strings.ToLower(strings.TrimSpace(body.Method)), body.CommitTitle, body.CommitMessage); err != nil {
+		s.writeGitHubError(w, err, "merge failed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -183,18 +270,18 @@ func (s *Server) handlePRStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	repo := owner + "/" + repoName
-	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout)
 	defer cancel()
 	st, err := s.mcp.GetPRStatus(ctx, token, repo, prNumber)
 	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "failed to fetch PR status")
+		s.writeGitHubError(w, err, "failed to fetch PR status")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"status": st})
 }
 
-// GET /api/github/repos/{owner}/{repo}/prs/{number}/diff
+// GET /api/github/repos/{owner}/{repo}/prs/{number}/diff[?files_only=true]
 func (s *Server) handlePRDiff(w http.ResponseWriter, r *http.Request) {
 	token := s.cfg.GitHubToken
 	if strings.TrimSpace(token) == "" {
@@ -214,14 +301,160 @@ func (s *Server) handlePRDiff(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "invalid repo or PR number")
 		return
 	}
+	filesOnly, ok := filesOnlyParam(r)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "files_only must be true or false")
+		return
+	}
 	repo := owner + "/" + repoName
-	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout+5*time.Second)
 	defer cancel()
 	df, err := s.mcp.GetPRDiff(ctx, token, repo, prNumber)
 	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "failed to fetch PR diff")
+		s.writeGitHubError(w, err, "failed to fetch PR diff")
 		return
 	}
+	if filesOnly {
+		df = df.WithoutPatches()
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"diff": df})
 }
+
+// GET /api/github/repos/{owner}/{repo}/prs/{number}/diff/since?sha=...[&files_only=true]
+// Returns only the changes since sha, or since the last head this session reviewed.
+// The returned head becomes the session's new review point.
+func (s *Server) handlePRDiffSince(w http.ResponseWriter, r *http.Request) {
+	token := s.cfg.GitHubToken
+	if strings.TrimSpace(token) == "" {
+		if t, _ := s.tokenStore.Read(); t != nil {
+			token = t.AccessToken
+		}
+	}
+	if strings.TrimSpace(token) == "" {
+		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
+		return
+	}
+	owner := chi.URLParam(r, "owner")
+	repoName := chi.URLParam(r, "repo")
+	numStr := chi.URLParam(r, "number")
+	prNumber, err := strconv.Atoi(numStr)
+	if err != nil || owner == "" || repoName == "" || prNumber <= 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid repo or PR number")
+		return
+	}
+	filesOnly, ok := filesOnlyParam(r)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "files_only must be true or false")
+		return
+	}
+	repo := owner + "/" + repoName
+	sid := s.getSessionID(r)
+	since := strings.TrimSpace(r.URL.Query().Get("sha"))
+	if since == "" && sid != "" {
+		since = s.store.GetReviewedSHA(sid, repo, prNumber)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout+5*time.Second)
+	defer cancel()
+	df, err := s.mcp.GetPRDiffSince(ctx, token, repo, prNumber, since)
+	if err != nil {
+		s.writeGitHubError(w, err, "failed to fetch PR diff")
+		return
+	}
+	if sid != "" && df.HeadSHA != "" {
+		s.store.SetReviewedSHA(sid, repo, prNumber, df.HeadSHA)
+	}
+	if filesOnly {
+		df = df.WithoutPatches()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"diff": df})
+}
+
+// suggestReviewers matches the PR's changed files against the repo's CODEOWNERS.
+// Returns gh.ErrNoCodeOwners when the repo has no CODEOWNERS file.
+func (s *Server) suggestReviewers(ctx context.Context, token, repo string, prNumber int) ([]string, error) {
+	owners, err := s.mcp.GetCodeOwners(ctx, token, repo)
+	if err != nil {
+		return nil, err
+	}
+	df, err := s.mcp.GetPRDiff(ctx, token, repo, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(df.Files))
+	for _, f := range df.Files {
+		paths = append(paths, f.Filename)
+	}
+	return gh.SuggestReviewers(owners, paths), nil
+}
+
+// GET /api/github/repos/{owner}/{repo}/prs/{number}/reviewers/suggested
+func (s *Server) handleSuggestReviewers(w http.ResponseWriter, r *http.Request) {
+	token := s.cfg.GitHubToken
+	if strings.TrimSpace(token) == "" {
+		if t, _ := s.tokenStore.Read(); t != nil {
+			token = t.AccessToken
+		}
+	}
+	if strings.TrimSpace(token) == "" {
+		s.writeError(w, http.StatusUnauthorized, "not authenticated with GitHub")
+		return
+	}
+	owner := chi.URLParam(r, "owner")
+	repoName := chi.URLParam(r, "repo")
+	numStr := chi.URLParam(r, "number")
+	prNumber, err := strconv.Atoi(numStr)
+	if err != nil || owner == "" || repoName == "" || prNumber <= 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid repo or PR number")
+		return
+	}
+	repo := owner + "/" + repoName
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.GitHubTimeout+5*time.Second)
+	defer cancel()
+	reviewers, err := s.suggestReviewers(ctx, token, repo, prNumber)
+	if errors.Is(err, gh.ErrNoCodeOwners) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"reviewers": []string{}, "codeowners": false})
+		return
+	}
+	if err != nil {
+		s.writeGitHubError(w, err, "failed to suggest reviewers")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"reviewers": reviewers, "codeowners": true})
+}
+
+// writeGitHubError answers a failed GitHub call with the status the failure maps
+// to: 401 for a revoked or expired token, 404 for a missing PR or repo, 403 for a
+// token without access, 409/422 for requests GitHub refused, 429 when rate limited.
+// Anything else is an upstream failure and gets 502 with msg.
+func (s *Server) writeGitHubError(w http.ResponseWriter, err error, msg string) {
+	var (
+		rl        *gh.RateLimitError
+		notFound  *gh.NotFoundError
+		forbidden *gh.ForbiddenError
+		conflict  *gh.ConflictError
+		invalid   *gh.ValidationError
+	)
+	switch {
+	case errors.As(err, &rl):
+		if !rl.ResetAt.IsZero() {
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(rl.ResetAt.Unix(), 10))
+		}
+		s.writeError(w, http.StatusTooManyRequests, "GitHub rate limit exceeded")
+	case gh.IsBadCredentials(err):
+		s.writeError(w, http.StatusUnauthorized, "GitHub token is no longer valid; sign in again")
+	case errors.As(err, &notFound):
+		s.writeError(w, http.StatusNotFound, "repository or pull request not found")
+	case errors.As(err, &forbidden):
+		s.writeError(w, http.StatusForbidden, "GitHub denied access: "+forbidden.Message)
+	case errors.As(err, &conflict):
+		s.writeError(w, http.StatusConflict, msg+": "+conflict.Message)
+	case errors.As(err, &invalid):
+		s.writeError(w, http.StatusUnprocessableEntity, msg+": "+invalid.Message)
+	default:
+		s.writeError(w, http.StatusBadGateway, msg)
+	}
+}
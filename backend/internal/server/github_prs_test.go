@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"zana-speech-backend/internal/config"
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/types"
+)
+
+func TestPRHandlersMapGitHubErrors(t *testing.T) {
+	apiErr := func(code int, msg string) *gh.APIError {
+		return &gh.APIError{Op: "get", StatusCode: code, Message: msg}
+	}
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  int
+		wantError string
+	}{
+		{name: "missing PR or repo", err: &gh.NotFoundError{APIError: apiErr(404, "Not Found")}, wantCode: http.StatusNotFound, wantError: "repository or pull request not found"},
+		{name: "token lacks scope", err: &gh.ForbiddenError{APIError: apiErr(403, "Resource not accessible by integration")}, wantCode: http.StatusForbidden, wantError: "GitHub denied access: Resource not accessible by integration"},
+		{name: "revoked token", err: &gh.ForbiddenError{APIError: apiErr(403, "Bad credentials")}, wantCode: http.StatusUnauthorized, wantError: "sign in again"},
+		{name: "unauthorized", err: &gh.UnauthorizedError{APIError: apiErr(401, "Bad credentials")}, wantCode: http.StatusUnauthorized, wantError: "sign in again"},
+		{name: "conflict", err: &gh.ConflictError{APIError: apiErr(409, "head moved")}, wantCode: http.StatusConflict, wantError: "head moved"},
+		{name: "validation", err: &gh.ValidationError{APIError: apiErr(422, "bad ref")}, wantCode: http.StatusUnprocessableEntity, wantError: "bad ref"},
+		{name: "rate limited", err: &gh.RateLimitError{ResetAt: time.Unix(1700000000, 0)}, wantCode: http.StatusTooManyRequests, wantError: "rate limit"},
+		{name: "upstream failure", err: apiErr(500, "Server Error"), wantCode: http.StatusBadGateway, wantError: "failed to fetch"},
+		{name: "network failure", err: errors.New("dial tcp: connection refused"), wantCode: http.StatusBadGateway, wantError: "failed to fetch"},
+	}
+	endpoints := []struct{ method, path string }{
+		{"GetPRComments", "/api/github/repos/acme/app/prs/5/comments"},
+		{"GetPRStatus", "/api/github/repos/acme/app/prs/5/status"},
+	}
+	for _, ep := range endpoints {
+		for _, tc := range tests {
+			t.Run(ep.method+"/"+tc.name, func(t *testing.T) {
+				s, fake := newTestServer(t, config.Config{GitHubToken: "tok", GitHubTimeout: 5 * time.Second})
+				s.router = chi.NewRouter()
+				s.routes()
+				fake.Errors = map[string]error{ep.method: tc.err}
+
+				rec := httptest.NewRecorder()
+				s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ep.path, nil))
+				if rec.Code != tc.wantCode {
+					t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+				}
+				var body types.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(body.Error, tc.wantError) {
+					t.Errorf("error = %q, want %q", body.Error, tc.wantError)
+				}
+				if tc.wantCode == http.StatusTooManyRequests && rec.Header().Get("X-RateLimit-Reset") != "1700000000" {
+					t.Errorf("X-RateLimit-Reset = %q", rec.Header().Get("X-RateLimit-Reset"))
+				}
+				if calls := fake.CallsTo(ep.method); len(calls) != 1 || calls[0].Repo != "acme/app" || calls[0].PRNumber != 5 {
+					t.Errorf("calls = %+v", calls)
+				}
+			})
+		}
+	}
+}
+
+func TestPRDiffSinceRemembersReviewedHead(t *testing.T) {
+	s, fake := newTestServer(t, config.Config{GitHubToken: "tok", GitHubTimeout: 5 * time.Second})
+	s.router = chi.NewRouter()
+	s.routes()
+
+	steps := []struct {
+		name      string
+		query     string
+		head      string
+		wantSince string
+	}{
+		{name: "first look compares with the base", head: "h1", wantSince: ""},
+		{name: "next look starts at the reviewed head", head: "h2", wantSince: "h1"},
+		{name: "an explicit sha wins", query: "?sha=abc", head: "h3", wantSince: "abc"},
+		{name: "then the latest head is remembered", head: "h3", wantSince: "h3"},
+	}
+	for _, step := range steps {
+		fake.Diff = gh.Diff{HeadSHA: step.head}
+		req := httptest.NewRequest(http.MethodGet, "/api/github/repos/acme/app/prs/5/diff/since"+step.query, nil)
+		req.Header.Set("X-Session-Id", testSession)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d (%s)", step.name, rec.Code, rec.Body)
+		}
+		calls := fake.CallsTo("GetPRDiffSince")
+		if got := calls[len(calls)-1].Args[0]; got != step.wantSince {
+			t.Errorf("%s: diffed since %q, want %q", step.name, got, step.wantSince)
+		}
+	}
+	if got := s.store.GetReviewedSHA(testSession, "acme/app", 5); got != "h3" {
+		t.Errorf("reviewed sha = %q, want h3", got)
+	}
+	// Other sessions keep their own place
+	if got := s.store.GetReviewedSHA("someone-else", "acme/app", 5); got != "" {
+		t.Errorf("another session's reviewed sha = %q", got)
+	}
+}
+
+func TestPRListingsSort(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	// #1 is the oldest but was touched last; #3 is the newest but untouched since
+	prs := []gh.PR{
+		{Number: 2, CreatedAt: day(2), UpdatedAt: day(4)},
+		{Number: 1, CreatedAt: day(1), UpdatedAt: day(9)},
+		{Number: 3, CreatedAt: day(3), UpdatedAt: day(3)},
+	}
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []int
+	}{
+		{query: "", wantCode: http.StatusOK, want: []int{1, 2, 3}},
+		{query: "?sort=updated", wantCode: http.StatusOK, want: []int{1, 2, 3}},
+		{query: "?sort=created", wantCode: http.StatusOK, want: []int{3, 2, 1}},
+		{query: "?sort=Created", wantCode: http.StatusOK, want: []int{3, 2, 1}},
+		{query: "?sort=popularity", wantCode: http.StatusBadRequest},
+	}
+	endpoints := []struct{ method, path string }{
+		{"ListUserPRs", "/api/github/prs/mine"},
+		{"ListPRsForReview", "/api/github/prs/review"},
+	}
+	for _, ep := range endpoints {
+		for _, tc := range tests {
+			t.Run(ep.path+tc.query, func(t *testing.T) {
+				s, fake := newTestServer(t, config.Config{GitHubToken: "tok", GitHubTimeout: 5 * time.Second})
+				s.router = chi.NewRouter()
+				s.routes()
+				fake.MinePRs = append([]gh.PR(nil), prs...)
+				fake.ReviewPRs = append([]gh.PR(nil), prs...)
+
+				rec := httptest.NewRecorder()
+				s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ep.path+tc.query, nil))
+				if rec.Code != tc.wantCode {
+					t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+				}
+				if tc.wantCode != http.StatusOK {
+					if n := len(fake.CallsTo(ep.method)); n != 0 {
+						t.Errorf("asked GitHub %d times for a bad request", n)
+					}
+					return
+				}
+				var body struct{ PRs []gh.PR }
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				var got []int
+				for _, p := range body.PRs {
+					got = append(got, p.Number)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+					t.Errorf("order = %v, want %v", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestPRDiffFilesOnly(t *testing.T) {
+	diff := gh.Diff{
+		FilesChanged: 1,
+		Additions:    3,
+		Deletions:    1,
+		HeadSHA:      "h1",
+		Files:        []gh.DiffFile{{Filename: "a.go", Additions: 3, Deletions: 1, Patch: "@@ -1 +1,3 @@", Hunks: []gh.DiffHunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 3}}}},
+	}
+	tests := []struct {
+		query       string
+		wantCode    int
+		wantPatches bool
+	}{
+		{query: "", wantCode: http.StatusOK, wantPatches: true},
+		{query: "?files_only=false", wantCode: http.StatusOK, wantPatches: true},
+		{query: "?files_only=true", wantCode: http.StatusOK},
+		{query: "?files_only=1", wantCode: http.StatusOK},
+		{query: "?files_only=yes", wantCode: http.StatusBadRequest},
+	}
+	endpoints := []struct{ method, path string }{
+		{"GetPRDiff", "/api/github/repos/acme/app/prs/5/diff"},
+		{"GetPRDiffSince", "/api/github/repos/acme/app/prs/5/diff/since"},
+	}
+	for _, ep := range endpoints {
+		for _, tc := range tests {
+			t.Run(ep.path+tc.query, func(t *testing.T) {
+				s, fake := newTestServer(t, config.Config{GitHubToken: "tok", GitHubTimeout: 5 * time.Second})
+				s.router = chi.NewRouter()
+				s.routes()
+				fake.Diff = diff
+
+				rec := httptest.NewRecorder()
+				s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ep.path+tc.query, nil))
+				if rec.Code != tc.wantCode {
+					t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+				}
+				if tc.wantCode != http.StatusOK {
+					if n := len(fake.CallsTo(ep.method)); n != 0 {
+						t.Errorf("asked GitHub %d times for a bad request", n)
+					}
+					return
+				}
+				var body struct{ Diff gh.Diff }
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				f := body.Diff.Files[0]
+				if hasPatch := f.Patch != "" || len(f.Hunks) > 0; hasPatch != tc.wantPatches {
+					t.Errorf("patch %q, hunks %v; want patches %v", f.Patch, f.Hunks, tc.wantPatches)
+				}
+				// Names and counts stay either way
+				if f.Filename != "a.go" || f.Additions != 3 || body.Diff.Additions != 3 || body.Diff.FilesChanged != 1 {
+					t.Errorf("diff = %+v", body.Diff)
+				}
+			})
+		}
+	}
+	if diff.Files[0].Patch == "" {
+		t.Error("WithoutPatches changed the caller's diff")
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"zana-speech-backend/internal/types"
+)
+
+const (
+	// chatBodySlack is room in a chat request body for the system prompt and JSON
+	// framing on top of the message itself
+	chatBodySlack = 64 << 10
+	// multipartSlack covers form boundaries and the small fields sent with an upload
+	multipartSlack = 1 << 20
+	// multipartMemory is how much of an upload ParseMultipartForm keeps in memory
+	multipartMemory = 32 << 20
+)
+
+// decodeChatRequest reads a chat request body, rejecting bodies and messages over
+// the configured size with 413 and malformed JSON with 400. It writes the error
+// response itself and reports whether the handler should continue.
+func (s *Server) decodeChatRequest(w http.ResponseWriter, r *http.Request) (types.ChatRequest, bool) {
+	var req types.ChatRequest
+	// A character is at most four bytes of UTF-8
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.MaxMessageLength)*4+chatBodySlack)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return req, false
+		}
+		s.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return req, false
+	}
+	if msg := s.messageTooLong(req.Message); msg != "" {
+		s.writeError(w, http.StatusRequestEntityTooLarge, msg)
+		return req, false
+	}
+	return req, true
+}
+
+// messageTooLong explains why text exceeds MaxMessageLength, or returns "" when it fits.
+func (s *Server) messageTooLong(text string) string {
+	if n := utf8.RuneCountInString(text); n > s.cfg.MaxMessageLength {
+		return fmt.Sprintf("message is too long (%d characters, max %d)", n, s.cfg.MaxMessageLength)
+	}
+	return ""
+}
+
+// parseAudioForm parses a voice upload, capping the body so an oversized recording
+// is refused with 413 before it is buffered or sent for transcription. Like
+// decodeChatRequest it writes the error response and reports whether to continue.
+func (s *Server) parseAudioForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxAudioBytes+multipartSlack)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, s.audioTooLarge())
+			return false
+		}
+		s.writeError(w, http.StatusBadRequest, "invalid multipart form")
+		return false
+	}
+	for _, header := range r.MultipartForm.File["file"] {
+		if header.Size > s.cfg.MaxAudioBytes {
+			s.writeError(w, http.StatusRequestEntityTooLarge, s.audioTooLarge())
+			return false
+		}
+	}
+	return true
+}
+
+// audioTooLarge is the error reported for recordings over MaxAudioBytes.
+func (s *Server) audioTooLarge() string {
+	return fmt.Sprintf("audio file too large (max %d MB)", s.cfg.MaxAudioBytes>>20)
+}
+
+// audioExtensions are the recording formats accepted for transcription.
+var audioExtensions = map[string]bool{".mp3": true, ".wav": true, ".m4a": true, ".webm": true, ".ogg": true}
+
+const unsupportedAudio = "unsupported audio format; upload mp3, wav, m4a, webm or ogg"
+
+// audioProblem explains why a recording named filename whose first bytes are head
+// isn't acceptable audio, or returns "" when it is. The extension must be on the
+// allowlist and the sniffed content type must not be clearly something else (text,
+// images, documents); formats the sniffer doesn't know pass as binary.
+func audioProblem(filename string, head []byte) string {
+	if !audioExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return unsupportedAudio
+	}
+	ct, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	switch {
+	case strings.HasPrefix(ct, "audio/"), ct == "video/webm", ct == "video/mp4", ct == "application/ogg", ct == "application/octet-stream":
+		return ""
+	}
+	return fmt.Sprintf("%s doesn't look like audio (%s); upload mp3, wav, m4a, webm or ogg", filepath.Base(filename), ct)
+}
+
+// checkAudioUpload sniffs an uploaded recording and rewinds it for transcription,
+// answering 400 when it isn't acceptable audio. It reports whether to continue.
+func (s *Server) checkAudioUpload(w http.ResponseWriter, file multipart.File, filename string) bool {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "could not read audio file")
+		return false
+	}
+	if msg := audioProblem(filename, head[:n]); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		s.writeError(w, http.StatusBadRequest, "could not read audio file")
+		return false
+	}
+	return true
+}
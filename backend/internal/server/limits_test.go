@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"zana-speech-backend/internal/config"
+)
+
+// newVoiceTestServer is newTestServer with Whisper answering "list my pull requests"
+// and counting the transcriptions asked for. No GitHub account is connected, so a
+// transcribed upload is answered with require_github_auth.
+func newVoiceTestServer(t *testing.T, cfg config.Config) (*Server, *atomic.Int32) {
+	t.Helper()
+	s, _ := newTestServer(t, cfg)
+	var transcriptions atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			http.NotFound(w, r)
+			return
+		}
+		transcriptions.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"text":"list my pull requests"}`)
+	}))
+	t.Cleanup(ts.Close)
+	oc := openai.DefaultConfig("test")
+	oc.BaseURL = ts.URL + "/v1"
+	s.client = openai.NewClientWithConfig(oc)
+	return s, &transcriptions
+}
+
+// voiceUpload builds a /api/voice request uploading content as filename.
+func voiceUpload(t *testing.T, filename string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/voice", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+// wavHeader is enough of a RIFF/WAVE file for content sniffing to call it audio.
+var wavHeader = []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+
+func TestOversizedRequestsAreRejected(t *testing.T) {
+	limits := config.Config{MaxMessageLength: 20, MaxAudioBytes: 1 << 10, VoiceTimeout: 5 * time.Second}
+
+	t.Run("chat", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			body     string
+			wantCode int
+		}{
+			{name: "message at the limit", body: `{"message":"` + strings.Repeat("a", 20) + `"}`, wantCode: http.StatusOK},
+			// Characters, not bytes, are counted
+			{name: "multibyte message at the limit", body: `{"message":"` + strings.Repeat("é", 20) + `"}`, wantCode: http.StatusOK},
+			{name: "message over the limit", body: `{"message":"` + strings.Repeat("a", 21) + `"}`, wantCode: http.StatusRequestEntityTooLarge},
+			{name: "body over the byte cap", body: `{"message":"hi","system":"` + strings.Repeat("a", 20*4+chatBodySlack) + `"}`, wantCode: http.StatusRequestEntityTooLarge},
+			{name: "malformed body", body: `{"message":`, wantCode: http.StatusBadRequest},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				s, _ := newTestServer(t, limits)
+				rec := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(tc.body))
+				_, ok := s.decodeChatRequest(rec, r)
+				if tc.wantCode == http.StatusOK {
+					if !ok {
+						t.Fatalf("rejected with %d (%s)", rec.Code, rec.Body)
+					}
+					return
+				}
+				if ok || rec.Code != tc.wantCode {
+					t.Fatalf("status = %d (ok %v), want %d", rec.Code, ok, tc.wantCode)
+				}
+				if got := rec.Header().Get("Content-Type"); got != "application/json" {
+					t.Errorf("Content-Type = %q, want a JSON error", got)
+				}
+			})
+		}
+	})
+
+	t.Run("audio", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			size     int
+			wantCode int
+		}{
+			{name: "file at the limit", size: 1 << 10, wantCode: http.StatusOK},
+			{name: "file over the limit", size: 1<<10 + 1, wantCode: http.StatusRequestEntityTooLarge},
+			{name: "body over the byte cap", size: 1<<10 + multipartSlack, wantCode: http.StatusRequestEntityTooLarge},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				s, transcriptions := newVoiceTestServer(t, limits)
+				audio := append(append([]byte{}, wavHeader...), make([]byte, tc.size-len(wavHeader))...)
+				rec := httptest.NewRecorder()
+				s.handleVoice(rec, voiceUpload(t, "clip.wav", audio))
+				if rec.Code != tc.wantCode {
+					t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+				}
+				wantTranscriptions := int32(0)
+				if tc.wantCode == http.StatusOK {
+					wantTranscriptions = 1
+				} else if !strings.Contains(rec.Body.String(), "audio file too large") {
+					t.Errorf("body = %s, want the size error", rec.Body)
+				}
+				if got := transcriptions.Load(); got != wantTranscriptions {
+					t.Errorf("transcriptions = %d, want %d", got, wantTranscriptions)
+				}
+			})
+		}
+	})
+}
+
+func TestAudioUploadFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		filename  string
+		content   []byte
+		wantError string
+	}{
+		{name: "wav", filename: "clip.wav", content: wavHeader},
+		{name: "extension case is ignored", filename: "CLIP.WAV", content: wavHeader},
+		{name: "webm", filename: "clip.webm", content: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01webm")},
+		// The sniffer doesn't know m4a; unknown binary passes on its extension
+		{name: "m4a", filename: "clip.m4a", content: []byte{0, 0, 0, 0x20, 'f', 't', 'y', 'p', 'M', '4', 'A', ' ', 0x80, 0x81}},
+		{name: "text extension", filename: "notes.txt", content: wavHeader, wantError: "unsupported audio format"},
+		{name: "no extension", filename: "clip", content: wavHeader, wantError: "unsupported audio format"},
+		{name: "text renamed to mp3", filename: "notes.mp3", content: []byte("just some notes, not audio"), wantError: "notes.mp3 doesn't look like audio (text/plain)"},
+		{name: "image renamed to ogg", filename: "photo.ogg", content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), wantError: "photo.ogg doesn't look like audio (image/png)"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, transcriptions := newVoiceTestServer(t, config.Config{MaxMessageLength: 100, MaxAudioBytes: 1 << 20, VoiceTimeout: 5 * time.Second})
+			rec := httptest.NewRecorder()
+			s.handleVoice(rec, voiceUpload(t, tc.filename, tc.content))
+			if tc.wantError == "" {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+				}
+				if got := transcriptions.Load(); got != 1 {
+					t.Errorf("transcriptions = %d, want 1", got)
+				}
+				return
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (%s)", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantError) {
+				t.Errorf("body = %s, want %q", rec.Body, tc.wantError)
+			}
+			if got := transcriptions.Load(); got != 0 {
+				t.Errorf("transcriptions = %d, want none for a rejected upload", got)
+			}
+		})
+	}
+}
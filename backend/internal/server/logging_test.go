@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs routes the default slog logger into a buffer for the test's duration.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		// wantID is the expected ID; "" means a freshly generated one
+		wantID string
+	}{
+		{name: "no incoming id", incoming: ""},
+		{name: "incoming id is reused", incoming: "edge-1234", wantID: "edge-1234"},
+		{name: "id with spaces is replaced", incoming: "bad id"},
+		{name: "overlong id is replaced", incoming: strings.Repeat("a", 65)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			var seen string
+			h := requestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+				logger(r.Context()).Info("inside")
+				w.WriteHeader(http.StatusTeapot)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+			if tc.incoming != "" {
+				req.Header.Set(RequestIDHeader, tc.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(RequestIDHeader)
+			if tc.wantID != "" && got != tc.wantID {
+				t.Errorf("response id = %q, want %q", got, tc.wantID)
+			}
+			if tc.wantID == "" && (len(got) != 16 || got == tc.incoming) {
+				t.Errorf("response id = %q, want a generated 16-char id", got)
+			}
+			if seen != got {
+				t.Errorf("handler saw id %q, response carries %q", seen, got)
+			}
+
+			var lines []map[string]any
+			for _, l := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var m map[string]any
+				if err := json.Unmarshal([]byte(l), &m); err != nil {
+					t.Fatalf("log line %q: %v", l, err)
+				}
+				lines = append(lines, m)
+			}
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want 2", len(lines))
+			}
+			for _, m := range lines {
+				if m["request_id"] != got {
+					t.Errorf("log %q has request_id %v, want %q", m["msg"], m["request_id"], got)
+				}
+			}
+			if access := lines[1]; access["msg"] != "request" || access["status"] != float64(http.StatusTeapot) {
+				t.Errorf("access log = %v", access)
+			}
+		})
+	}
+}
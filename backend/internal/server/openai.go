@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"zana-speech-backend/internal/config"
+)
+
+// newOpenAIClient builds the OpenAI client from config: api.openai.com by default,
+// or a proxy, organization or Azure OpenAI resource when those are configured.
+func newOpenAIClient(cfg config.Config) *openai.Client {
+	var oc openai.ClientConfig
+	if cfg.OpenAIAPIType == "azure" {
+		oc = openai.DefaultAzureConfig(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL)
+		if cfg.OpenAIAPIVersion != "" {
+			oc.APIVersion = cfg.OpenAIAPIVersion
+		}
+		// Unmapped models fall back to the library's default deployment naming
+		defaultMapper := oc.AzureModelMapperFunc
+		oc.AzureModelMapperFunc = func(model string) string {
+			if d, ok := cfg.OpenAIAzureDeployments[model]; ok {
+				return d
+			}
+			return defaultMapper(model)
+		}
+		return openai.NewClientWithConfig(oc)
+	}
+	oc = openai.DefaultConfig(cfg.OpenAIAPIKey)
+	if cfg.OpenAIBaseURL != "" {
+		oc.BaseURL = cfg.OpenAIBaseURL
+	}
+	oc.OrgID = cfg.OpenAIOrgID
+	return openai.NewClientWithConfig(oc)
+}
+
+// completeWithFallback runs req against each of models in turn, moving to the next
+// one only when a model is overloaded (429) or unavailable (404). It returns the
+// response with the model that produced it; req.Model is ignored.
+func completeWithFallback(ctx context.Context, client *openai.Client, models []string, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, string, error) {
+	var lastErr error
+	for i, model := range models {
+		req.Model = model
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err == nil {
+			logFallback(models, i)
+			return resp, model, nil
+		}
+		lastErr = err
+		if !isFallbackError(err) || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("openai model unavailable, trying next", "model", model, "error", err)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no models configured")
+	}
+	return openai.ChatCompletionResponse{}, "", lastErr
+}
+
+// streamWithFallback is completeWithFallback for streamed completions. Only opening
+// the stream falls back; errors mid-stream are the caller's.
+func streamWithFallback(ctx context.Context, client *openai.Client, models []string, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, string, error) {
+	var lastErr error
+	for i, model := range models {
+		req.Model = model
+		stream, err := client.CreateChatCompletionStream(ctx, req)
+		if err == nil {
+			logFallback(models, i)
+			return stream, model, nil
+		}
+		lastErr = err
+		if !isFallbackError(err) || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("openai model unavailable, trying next", "model", model, "error", err)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no models configured")
+	}
+	return nil, "", lastErr
+}
+
+// logFallback notes when a request was served by a model other than the primary.
+func logFallback(models []string, served int) {
+	if served > 0 {
+		slog.Info("openai served by fallback model", "model", models[served], "primary", models[0])
+	}
+}
+
+// isFallbackError reports whether another model might succeed where this one failed.
+func isFallbackError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode == http.StatusNotFound
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusTooManyRequests || reqErr.HTTPStatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// fallbackCompleter hands the intent classifier completions that fall back to other
+// models: the requested model first, then fallbacks.
+type fallbackCompleter struct {
+	client    *openai.Client
+	fallbacks []string
+}
+
+func (f fallbackCompleter) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, _, err := completeWithFallback(ctx, f.client, append([]string{req.Model}, f.fallbacks...), req)
+	return resp, err
+}
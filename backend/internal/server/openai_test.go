@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"zana-speech-backend/internal/config"
+)
+
+// modelEndpoint fakes the chat completions API, failing requests for the models in
+// status with that status and answering the rest with the model's name. It records
+// the models asked for in order.
+type modelEndpoint struct {
+	status map[string]int
+
+	mu    sync.Mutex
+	asked []string
+}
+
+func (e *modelEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	e.mu.Lock()
+	e.asked = append(e.asked, req.Model)
+	e.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if code := e.status[req.Model]; code != 0 {
+		w.WriteHeader(code)
+		fmt.Fprint(w, `{"error":{"message":"model busy","type":"server_error"}}`)
+		return
+	}
+	if req.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		b, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: req.Model}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", b)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: req.Model}}},
+	})
+}
+
+func newModelTestClient(t *testing.T, e *modelEndpoint) *openai.Client {
+	t.Helper()
+	ts := httptest.NewServer(e)
+	t.Cleanup(ts.Close)
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = ts.URL + "/v1"
+	return openai.NewClientWithConfig(cfg)
+}
+
+func TestCompleteWithFallback(t *testing.T) {
+	models := []string{"primary", "second", "third"}
+	tests := []struct {
+		name      string
+		status    map[string]int
+		want      string
+		wantAsked []string
+		wantErr   bool
+	}{
+		{name: "primary answers", want: "primary", wantAsked: []string{"primary"}},
+		{name: "overloaded primary falls back", status: map[string]int{"primary": http.StatusTooManyRequests}, want: "second", wantAsked: []string{"primary", "second"}},
+		{name: "missing model falls back", status: map[string]int{"primary": http.StatusNotFound, "second": http.StatusTooManyRequests}, want: "third", wantAsked: models},
+		{name: "server error doesn't fall back", status: map[string]int{"primary": http.StatusInternalServerError}, wantAsked: []string{"primary"}, wantErr: true},
+		{name: "every model overloaded", status: map[string]int{"primary": 429, "second": 429, "third": 429}, wantAsked: models, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &modelEndpoint{status: tc.status}
+			client := newModelTestClient(t, e)
+
+			resp, model, err := completeWithFallback(context.Background(), client, models, openai.ChatCompletionRequest{
+				Model:    "ignored",
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (model != tc.want || resp.Choices[0].Message.Content != tc.want) {
+				t.Errorf("served by %q (%q), want %q", model, resp.Choices[0].Message.Content, tc.want)
+			}
+			if !reflect.DeepEqual(e.asked, tc.wantAsked) {
+				t.Errorf("asked %v, want %v", e.asked, tc.wantAsked)
+			}
+
+			// Streams open the same way
+			e.asked = nil
+			stream, model, err := streamWithFallback(context.Background(), client, models, openai.ChatCompletionRequest{
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+				Stream:   true,
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("stream err = %v, want error %v", err, tc.wantErr)
+			}
+			if stream != nil {
+				stream.Close()
+			}
+			if !tc.wantErr && model != tc.want {
+				t.Errorf("stream served by %q, want %q", model, tc.want)
+			}
+			if !reflect.DeepEqual(e.asked, tc.wantAsked) {
+				t.Errorf("stream asked %v, want %v", e.asked, tc.wantAsked)
+			}
+		})
+	}
+}
+
+func TestFallbackCompleterTriesRequestedModelFirst(t *testing.T) {
+	e := &modelEndpoint{status: map[string]int{"intent-model": http.StatusTooManyRequests}}
+	f := fallbackCompleter{client: newModelTestClient(t, e), fallbacks: []string{"backup"}}
+
+	resp, err := f.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "intent-model",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "backup" {
+		t.Errorf("served by %q, want backup", got)
+	}
+	if want := []string{"intent-model", "backup"}; !reflect.DeepEqual(e.asked, want) {
+		t.Errorf("asked %v, want %v", e.asked, want)
+	}
+}
+
+func TestNewOpenAIClient(t *testing.T) {
+	type seen struct{ path, apiVersion, auth, apiKey, org string }
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		model string
+		want  seen
+	}{
+		{
+			name:  "base URL and organization",
+			cfg:   config.Config{OpenAIAPIKey: "sk-test", OpenAIOrgID: "org-acme"},
+			model: "gpt-4o-mini",
+			want:  seen{path: "/v1/chat/completions", auth: "Bearer sk-test", org: "org-acme"},
+		},
+		{
+			name:  "azure deployment mapping",
+			cfg:   config.Config{OpenAIAPIKey: "az-test", OpenAIAPIType: "azure", OpenAIAPIVersion: "2024-06-01", OpenAIAzureDeployments: map[string]string{"gpt-4o-mini": "mini"}},
+			model: "gpt-4o-mini",
+			want:  seen{path: "/openai/deployments/mini/chat/completions", apiVersion: "2024-06-01", apiKey: "az-test"},
+		},
+		{
+			// The library's default naming drops the dots Azure doesn't allow
+			name:  "azure unmapped model",
+			cfg:   config.Config{OpenAIAPIKey: "az-test", OpenAIAPIType: "azure", OpenAIAPIVersion: "2024-06-01"},
+			model: "gpt-3.5-turbo",
+			want:  seen{path: "/openai/deployments/gpt-35-turbo/chat/completions", apiVersion: "2024-06-01", apiKey: "az-test"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got seen
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = seen{
+					path:       r.URL.Path,
+					apiVersion: r.URL.Query().Get("api-version"),
+					auth:       r.Header.Get("Authorization"),
+					apiKey:     r.Header.Get("api-key"),
+					org:        r.Header.Get("OpenAI-Organization"),
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "hello"}}},
+				})
+			}))
+			defer ts.Close()
+			tc.cfg.OpenAIBaseURL = ts.URL
+			if tc.cfg.OpenAIAPIType == "" {
+				tc.cfg.OpenAIBaseURL += "/v1"
+			}
+
+			resp, err := newOpenAIClient(tc.cfg).CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+				Model:    tc.model,
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Choices[0].Message.Content != "hello" {
+				t.Errorf("reply = %q, want hello", resp.Choices[0].Message.Content)
+			}
+			if got != tc.want {
+				t.Errorf("request = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limiterIdleTTL is how long an unused bucket is kept before cleanup drops it.
+const limiterIdleTTL = 10 * time.Minute
+
+// tokenBucket refills at rate tokens per second up to burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds one token bucket per client key.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token for key. When none is left it returns false and how long
+// until the next token is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweepLocked(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweepLocked drops buckets idle longer than limiterIdleTTL; callers must hold l.mu.
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > limiterIdleTTL {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimit throttles requests per session, answering 429 with Retry-After once a
+// client's bucket is empty. Session IDs come from the client, so only ones the store
+// knows get their own bucket; anything else, including made-up IDs that would
+// otherwise each start with a full bucket, is limited per remote IP.
+func (s *Server) rateLimit(l *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Webhook deliveries carry no session and would all share GitHub's ip
+			// bucket; their signature is the access control
+			if r.Method == http.MethodOptions || r.URL.Path == "/api/health" || r.URL.Path == "/api/github/webhook" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := "ip:" + clientIP(r)
+			if sid := s.getSessionID(r); sid != "" && s.store.HasSession(sid) {
+				key = "session:" + sid
+			}
+			if ok, wait := l.allow(key); !ok {
+				secs := int(math.Ceil(wait.Seconds()))
+				if secs < 1 {
+					secs = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				s.writeError(w, http.StatusTooManyRequests, "too many requests; slow down a little")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the request's remote IP without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
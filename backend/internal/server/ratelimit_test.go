@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zana-speech-backend/internal/config"
+	"zana-speech-backend/internal/store"
+)
+
+func TestRateLimit(t *testing.T) {
+	const burst = 3
+	tests := []struct {
+		name string
+		// session returns the X-Session-Id for the i-th request, "" for none
+		session func(i int) string
+		// known sessions are written to the store first
+		known []string
+	}{
+		{
+			name:    "anonymous requests share the ip's bucket",
+			session: func(int) string { return "" },
+		},
+		{
+			name:    "a fresh made-up session id per request is still limited by ip",
+			session: func(i int) string { return fmt.Sprintf("s_forged_%d", i) },
+		},
+		{
+			name:    "a known session is limited on its own",
+			session: func(int) string { return "s_known" },
+			known:   []string{"s_known"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t, config.Config{SessionCookieName: "session_id"})
+			for _, sid := range tc.known {
+				s.store.Append(sid, store.Message{Role: "user", Content: "hi"})
+			}
+			l := newRateLimiter(1, burst)
+			now := time.Now()
+			l.now = func() time.Time { return now }
+			h := s.rateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i := 0; i <= burst; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+				req.RemoteAddr = "203.0.113.7:4242"
+				if sid := tc.session(i); sid != "" {
+					req.Header.Set("X-Session-Id", sid)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				want := http.StatusOK
+				if i == burst {
+					want = http.StatusTooManyRequests
+				}
+				if rec.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+				}
+				if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+					t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitKnownSessionDoesNotSpendIPBucket(t *testing.T) {
+	s, _ := newTestServer(t, config.Config{SessionCookieName: "session_id"})
+	s.store.Append("s_known", store.Message{Role: "user", Content: "hi"})
+	l := newRateLimiter(1, 1)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	h := s.rateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(sid string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/github/status", nil)
+		req.RemoteAddr = "203.0.113.7:4242"
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sid})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("s_known"); code != http.StatusOK {
+		t.Fatalf("known session: status %d", code)
+	}
+	if code := serve("s_unknown"); code != http.StatusOK {
+		t.Fatalf("unknown session from the same ip: status %d, want its own ip bucket", code)
+	}
+	if code := serve("s_unknown_2"); code != http.StatusTooManyRequests {
+		t.Fatalf("second unknown session: status %d, want 429", code)
+	}
+}
@@ -1,14 +1,20 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -25,29 +31,70 @@ import (
 )
 
 type Server struct {
-	router        *chi.Mux
-	store         *store.MemoryStore
-	client        *openai.Client
-	cfg           config.Config
-	oauthCfg      *oauth2.Config
+	router   *chi.Mux
+	store    store.Store
+	client   *openai.Client
+	cfg      config.Config
+	oauthCfg *oauth2.Config
+	// OAuth seams; default to oauthCfg and fetchGitHubUsername, swappable in tests
+	oauthExchanger  tokenExchanger
+	oauthRefresher  tokenRefresher
+	usernameFetcher usernameFetcher
+	// refreshMu serializes OAuth token refreshes; GitHub refresh tokens are single use
+	refreshMu     sync.Mutex
 	tokenStore    *store.FileTokenStore
 	database      *db.DB
 	databaseStore *store.DatabaseStore
 	mcp           gh.MCPClient
-	// LLM-based intent classifier
-	intent *gh.IntentClassifier
+	// appTokens mints GitHub App installation tokens; nil unless an App is configured
+	appTokens *gh.AppTokenSource
+	// elevenBaseURL is the ElevenLabs API root; elevenLabsBaseURL unless a test points it elsewhere
+	elevenBaseURL string
+	// voices caches the ElevenLabs voice list for /api/tts/voices
+	voices voicesCache
+	// Intent classifier; the LLM-backed one in production, swappable in tests
+	intent gh.Classifier
+	// stopJanitor ends the stores' background sweepers
+	stopJanitor context.CancelFunc
+	// clients are the open WebSocket connections webhook notifications go to
+	clients wsClients
+	// shutdown is closed by Close so hijacked WebSocket connections can say goodbye
+	shutdown  chan struct{}
+	closeOnce sync.Once
 }
 
 func NewServer(cfg config.Config) (*Server, error) {
-	client := openai.NewClient(cfg.OpenAIAPIKey)
-	ms := store.NewMemoryStore(40)
+	client := newOpenAIClient(cfg)
+	const maxHistory = 40
+	// Session state: Redis when configured (shared across replicas), memory otherwise
+	var ms store.Store
+	var memStore *store.MemoryStore
+	if cfg.RedisURL != "" {
+		rs, err := store.NewRedisStore(cfg.RedisURL, maxHistory, cfg.SessionIdleTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize redis store: %w", err)
+		}
+		slog.Info("redis session store connected")
+		if cfg.HistoryTrim == "tokens" {
+			rs.SetTokenBudget(cfg.HistoryTokenBudget)
+		}
+		ms = rs
+	} else {
+		memStore = store.NewMemoryStore(maxHistory)
+		memStore.SetSessionTTL(cfg.SessionIdleTTL)
+		if cfg.HistoryTrim == "tokens" {
+			memStore.SetTokenBudget(cfg.HistoryTokenBudget)
+		}
+		ms = memStore
+	}
 	r := chi.NewRouter()
+	r.Use(requestLogger)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{cfg.AllowedOrigin},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"},
-		ExposedHeaders:   []string{"X-Session-Id"},
+		ExposedHeaders:   []string{"X-Session-Id", RequestIDHeader, "X-Transcript", "X-Reply", "X-Intent-Type", "X-TTS-Provider"},
 		AllowCredentials: true, // Enable credentials for cookies
 		MaxAge:           300,
 	}))
@@ -71,37 +118,90 @@ func NewServer(cfg config.Config) (*Server, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize database: %w", err)
 		}
-		log.Println("database connection established")
+		slog.Info("database connection established")
 
-		// Run migrations
-		// if err := database.RunMigrations("./migrations"); err != nil {
-		// 	database.Close()
-		// 	return nil, fmt.Errorf("failed to run migrations: %w", err)
-		// }
-		log.Println("database migrations completed")
+		// Run migrations embedded in the binary
+		if err := database.RunEmbeddedMigrations(); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+		slog.Info("database migrations completed")
 
-		databaseStore = store.NewDatabaseStore(database)
+		databaseStore = store.NewDatabaseStore(database, maxHistory)
 	} else {
-		log.Println("warning: DB_URL not provided, using file-based storage only")
+		slog.Warn("DB_URL not provided, using file-based storage only")
 	}
 
-	mcp := gh.NewMCPClient(cfg.GitHubMCPAddress, cfg.GitHubMCPEnabled)
-	intent, err := gh.LoadIntentClassifier("internal/prompts/intent.yaml", client, cfg.Model)
-	if err != nil {
-		log.Println("error loading intent classifier", err)
-		return nil, fmt.Errorf("failed to load intent classifier: %w", err)
+	mcp := gh.NewMCPClient(
+		gh.WithBaseURL(cfg.GitHubAPIBaseURL),
+		gh.WithUserAgent(cfg.GitHubUserAgent),
+		gh.WithMaxDiffFiles(cfg.GitHubMaxDiffFiles),
+		gh.WithMaxComments(cfg.GitHubMaxComments),
+		gh.WithTimeout(cfg.GitHubTimeout),
+		gh.WithStatusCache(cfg.GitHubStatusCacheSize, cfg.GitHubStatusCacheTTL),
+	)
+	var appTokens *gh.AppTokenSource
+	if cfg.GitHubAppID != "" {
+		key := []byte(cfg.GitHubAppPrivateKey)
+		var err error
+		if len(key) == 0 {
+			if key, err = os.ReadFile(cfg.GitHubAppPrivateKeyFile); err != nil {
+				return nil, fmt.Errorf("failed to read github app private key: %w", err)
+			}
+		}
+		appTokens, err = gh.NewAppTokenSource(cfg.GitHubAppID, cfg.GitHubAppInstallationID, key,
+			gh.WithBaseURL(cfg.GitHubAPIBaseURL),
+			gh.WithUserAgent(cfg.GitHubUserAgent),
+			gh.WithTimeout(cfg.GitHubTimeout),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize github app auth: %w", err)
+		}
+		slog.Info("github app installation auth enabled")
+	}
+	var intent gh.Classifier
+	switch cfg.IntentClassifier {
+	case "rules":
+		slog.Info("using rules-based intent classifier")
+		intent = gh.RulesClassifier{}
+	default:
+		llm, err := gh.LoadIntentClassifier("internal/prompts/intent.yaml", fallbackCompleter{client: client, fallbacks: cfg.ModelFallbacks}, cfg.Model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load intent classifier: %w", err)
+		}
+		llm.SetTimeout(cfg.ClassifyTimeout)
+		intent = llm
 	}
 	s := &Server{
-		router:        r,
-		store:         ms,
-		client:        client,
-		cfg:           cfg,
-		oauthCfg:      oCfg,
-		tokenStore:    ts,
-		database:      database,
-		databaseStore: databaseStore,
-		mcp:           mcp,
-		intent:        intent,
+		router:          r,
+		store:           ms,
+		client:          client,
+		cfg:             cfg,
+		oauthCfg:        oCfg,
+		oauthExchanger:  oCfg,
+		oauthRefresher:  oCfg,
+		usernameFetcher: githubUsernameFetcher(gh.NormalizeAPIBaseURL(cfg.GitHubAPIBaseURL)),
+		tokenStore:      ts,
+		database:        database,
+		databaseStore:   databaseStore,
+		mcp:             mcp,
+		appTokens:       appTokens,
+		elevenBaseURL:   elevenLabsBaseURL,
+		intent:          intent,
+		shutdown:        make(chan struct{}),
+	}
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	s.stopJanitor = stopJanitor
+	// Redis expires keys itself; only the memory store needs sweeping
+	if memStore != nil {
+		memStore.StartJanitor(janitorCtx, time.Minute)
+	}
+	if databaseStore != nil {
+		databaseStore.StartAuthJanitor(janitorCtx, time.Hour, cfg.GitHubAuthMaxAge)
+	}
+	r.Use(s.refreshSession)
+	if cfg.RateLimitRPS > 0 {
+		r.Use(s.rateLimit(newRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)))
 	}
 	s.routes()
 	return s, nil
@@ -111,47 +211,100 @@ func (s *Server) routes() {
 	s.router.Get("/api/health", s.handleHealth)
 	s.router.Post("/api/chat", s.handleChat)
 	s.router.Post("/api/chat/stream", s.handleChatStream)
+	s.router.Post("/api/chat/stream/sse", s.handleChatStreamSSE)
+	s.router.Get("/api/session/history", s.handleSessionHistory)
+	s.router.Delete("/api/session/history", s.handleResetSessionHistory)
 	s.router.Post("/api/voice", s.handleVoice)
+	s.router.Post("/api/voice/speak", s.handleVoiceSpeak)
+	s.router.Get("/api/ws", s.handleWS)
 	s.router.Post("/api/tts", s.handleTTS)
+	s.router.Post("/api/tts/stream", s.handleTTSStream)
 	s.router.Get("/api/tts/voices", s.handleTTSVoices)
 	// GitHub OAuth
 	s.router.Get("/api/github/status", s.handleGitHubStatus)
+	s.router.Get("/api/github/me", s.handleGitHubMe)
+	s.router.Get("/api/github/accounts", s.handleGitHubAccounts)
 	s.router.Get("/api/github/auth", s.handleGitHubAuth)
 	s.router.Get("/api/github/callback", s.handleGitHubCallback)
+	s.router.Post("/api/github/logout", s.handleGitHubLogout)
+	s.router.Post("/api/github/webhook", s.handleGitHubWebhook)
 	// PR listing
 	s.router.Get("/api/github/prs/review", s.handlePRsForReview)
 	s.router.Get("/api/github/prs/mine", s.handlePRsMine)
 	// PR details operations
 	s.router.Get("/api/github/repos/{owner}/{repo}/prs/{number}/comments", s.handlePRComments)
 	s.router.Post("/api/github/repos/{owner}/{repo}/prs/{number}/comments", s.handleAddPRComment)
+	s.router.Post("/api/github/repos/{owner}/{repo}/prs/{number}/comments/{reviewId}/replies", s.handleReplyToReview)
 	s.router.Post("/api/github/repos/{owner}/{repo}/prs/{number}/merge", s.handleMergePR)
 	s.router.Get("/api/github/repos/{owner}/{repo}/prs/{number}/status", s.handlePRStatus)
 	s.router.Get("/api/github/repos/{owner}/{repo}/prs/{number}/diff", s.handlePRDiff)
+	s.router.Get("/api/github/repos/{owner}/{repo}/prs/{number}/diff/since", s.handlePRDiffSince)
+	s.router.Get("/api/github/repos/{owner}/{repo}/prs/{number}/reviewers/suggested", s.handleSuggestReviewers)
 }
 
 func (s *Server) Router() http.Handler { return s.router }
 
+// Close stops background goroutines and releases the database and session store.
+// Call it after the HTTP server has shut down; it is safe to call more than once.
+func (s *Server) Close() error {
+	var errs []error
+	s.closeOnce.Do(func() {
+		close(s.shutdown)
+		if s.stopJanitor != nil {
+			s.stopJanitor()
+		}
+		if c, ok := s.store.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+		if s.database != nil {
+			errs = append(errs, s.database.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// GET /api/health
+// Reports 503 when a configured database is unreachable so load balancers stop
+// routing here; a missing OpenAI key only marks the instance degraded.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]string{"status": "ok", "database": "not_configured", "openai": "configured"}
+	code := http.StatusOK
+	if strings.TrimSpace(s.cfg.OpenAIAPIKey) == "" {
+		resp["openai"] = "missing_key"
+		resp["status"] = "degraded"
+	}
+	if s.database != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err := s.database.HealthCheckContext(ctx); err != nil {
+			logger(r.Context()).Error("health check database failed", "error", err)
+			resp["database"] = "down"
+			resp["status"] = "down"
+			code = http.StatusServiceUnavailable
+		} else {
+			resp["database"] = "ok"
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
 func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
-	var req types.ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid JSON body")
+	req, ok := s.decodeChatRequest(w, r)
+	if !ok {
 		return
 	}
-	sid := getOrCreateSessionID(r, w)
+	sid := s.getOrCreateSessionID(r, w)
 	if strings.TrimSpace(req.Message) == "" {
 		s.writeError(w, http.StatusBadRequest, "message is required")
 		return
 	}
 
 	if req.System != "" {
-		s.store.Append(sid, store.Message{Role: "system", Content: req.System})
+		s.store.SetSystemPrompt(sid, req.System)
 	}
-	s.store.Append(sid, store.Message{Role: "user", Content: req.Message})
+	s.appendMessage(sid, store.Message{Role: "user", Content: req.Message})
 
 	// Check if GitHub account is connected for this session
 	token := s.getGitHubToken(sid)
@@ -168,15 +321,15 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Single-pass LLM intent classification and handling
-	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.ChatTimeout)
 	defer cancel()
-	reply, intent, ok := s.classifyAndHandle(ctx, sid, req.Message)
+	reply, intent, ok := s.answer(ctx, sid, req.Message)
 	if !ok {
-		log.Printf("[chat] intent classification failed for message: %s", req.Message)
+		logger(ctx).Warn("chat intent not handled")
 		s.writeError(w, http.StatusInternalServerError, "I'm having trouble understanding your request right now. Please try again.")
 		return
 	}
-	s.store.Append(sid, store.Message{Role: "assistant", Content: reply})
+	s.appendMessage(sid, store.Message{Role: "assistant", Content: reply})
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Session-Id", sid)
 	_ = json.NewEncoder(w).Encode(types.ChatResponse{SessionID: sid, Reply: reply, Intent: intent})
@@ -188,38 +341,81 @@ func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusInternalServerError, "streaming unsupported")
 		return
 	}
-	var req types.ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid JSON body")
+	req, ok := s.decodeChatRequest(w, r)
+	if !ok {
 		return
 	}
-	sid := getOrCreateSessionID(r, w)
+	sid := s.getOrCreateSessionID(r, w)
 	if strings.TrimSpace(req.Message) == "" {
 		s.writeError(w, http.StatusBadRequest, "message is required")
 		return
 	}
 	if req.System != "" {
-		s.store.Append(sid, store.Message{Role: "system", Content: req.System})
+		s.store.SetSystemPrompt(sid, req.System)
 	}
-	s.store.Append(sid, store.Message{Role: "user", Content: req.Message})
+	s.appendMessage(sid, store.Message{Role: "user", Content: req.Message})
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("X-Session-Id", sid)
 	w.Header().Set("Cache-Control", "no-cache")
 
-	ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+	// Same auth gate and intent handling as handleChat; the intent type travels in
+	// X-Intent-Type since the body is plain text
+	if strings.TrimSpace(s.getGitHubToken(sid)) == "" {
+		reply := "Please connect your GitHub account to use this application. This service helps you manage GitHub pull requests - fetching, listing, merging, and viewing PR comments."
+		w.Header().Set("X-Intent-Type", "require_github_auth")
+		_, _ = w.Write([]byte(reply))
+		return
+	}
+	cctx, ccancel := context.WithTimeout(r.Context(), s.cfg.ChatTimeout)
+	reply, intent, handled := s.classifyAndHandle(cctx, sid, req.Message)
+	ccancel()
+	if handled {
+		s.appendMessage(sid, store.Message{Role: "assistant", Content: reply})
+		if intent != nil {
+			w.Header().Set("X-Intent-Type", intent.Type)
+		}
+		_, _ = w.Write([]byte(reply))
+		flusher.Flush()
+		return
+	}
+
+	// Nothing actionable: stream a normal completion
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.StreamTimeout)
 	defer cancel()
-	messages := s.convertMessages(s.store.Get(sid))
+	final, err := s.streamCompletion(ctx, sid, func(chunk string) error {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && final == "" {
+		logger(ctx).Error("openai stream failed", "error", err)
+		s.writeError(w, http.StatusBadGateway, "chat stream init failed")
+		return
+	}
+	if strings.TrimSpace(final) != "" {
+		s.appendMessage(sid, store.Message{Role: "assistant", Content: final})
+	}
+}
+
+// models is the chat model followed by its fallbacks, for completeWithFallback.
+func (s *Server) models() []string {
+	return append([]string{s.cfg.Model}, s.cfg.ModelFallbacks...)
+}
 
-	stream, err := s.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
-		Model:    s.cfg.Model,
-		Messages: messages,
+// streamCompletion streams a plain chat completion over the session history, handing
+// each content delta to onChunk, and returns the accumulated text. A failing onChunk
+// (e.g. the client went away) stops the stream early. Errors after the first chunk are
+// logged and the partial text is returned with them.
+func (s *Server) streamCompletion(ctx context.Context, sessionID string, onChunk func(string) error) (string, error) {
+	stream, _, err := streamWithFallback(ctx, s.client, s.models(), openai.ChatCompletionRequest{
+		Messages: s.convertMessages(sessionID, s.history(sessionID)),
 		Stream:   true,
 	})
 	if err != nil {
-		log.Println("openai stream error:", err)
-		s.writeError(w, http.StatusBadGateway, "chat stream init failed")
-		return
+		return "", err
 	}
 	defer stream.Close()
 
@@ -230,8 +426,8 @@ func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		if err != nil {
-			log.Println("stream recv error:", err)
-			break
+			logger(ctx).Error("stream recv failed", "error", err)
+			return builder.String(), err
 		}
 		if len(response.Choices) == 0 {
 			continue
@@ -241,48 +437,37 @@ func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		builder.WriteString(chunk)
-		_, _ = w.Write([]byte(chunk))
-		flusher.Flush()
-	}
-	final := builder.String()
-	if strings.TrimSpace(final) != "" {
-		s.store.Append(sid, store.Message{Role: "assistant", Content: final})
+		if err := onChunk(chunk); err != nil {
+			return builder.String(), err
+		}
 	}
+	return builder.String(), nil
 }
 
 func (s *Server) handleVoice(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid multipart form")
+	if !s.parseAudioForm(w, r) {
 		return
 	}
 	// Get or create session ID (cookie-based)
-	sid := getOrCreateSessionID(r, w)
+	sid := s.getOrCreateSessionID(r, w)
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		s.writeError(w, http.StatusBadRequest, "audio file is required (field 'file')")
 		return
 	}
 	defer file.Close()
+	if !s.checkAudioUpload(w, file, header.Filename) {
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 180*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.VoiceTimeout)
 	defer cancel()
 
-	tr, err := s.client.CreateTranscription(ctx, openai.AudioRequest{
-		Model:    s.cfg.STTModel,
-		Reader:   file,
-		FilePath: header.Filename,
-	})
-	if err != nil {
-		log.Println("transcription error:", err)
-		s.writeError(w, http.StatusBadGateway, "transcription failed")
-		return
-	}
-	transcribed := strings.TrimSpace(tr.Text)
-	if transcribed == "" {
-		s.writeError(w, http.StatusBadGateway, "empty transcription")
+	transcribed, ok := s.transcribe(ctx, w, r, file, header.Filename)
+	if !ok {
 		return
 	}
-	s.store.Append(sid, store.Message{Role: "user", Content: transcribed})
+	s.appendMessage(sid, store.Message{Role: "user", Content: transcribed})
 
 	// Check if GitHub account is connected for this session
 	token := s.getGitHubToken(sid)
@@ -300,13 +485,13 @@ func (s *Server) handleVoice(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Single-pass LLM intent classification and handling (voice)
-	reply, intent, ok := s.classifyAndHandle(ctx, sid, transcribed)
+	reply, intent, ok := s.answer(ctx, sid, transcribed)
 	if !ok {
-		log.Printf("[voice] intent classification failed for message: %s", transcribed)
+		logger(ctx).Warn("voice intent not handled")
 		s.writeError(w, http.StatusInternalServerError, "I'm having trouble understanding your request right now. Please try again.")
 		return
 	}
-	s.store.Append(sid, store.Message{Role: "assistant", Content: reply})
+	s.appendMessage(sid, store.Message{Role: "assistant", Content: reply})
 
 	// Return JSON (frontend will speak via browser TTS)
 	w.Header().Set("Content-Type", "application/json")
@@ -314,14 +499,91 @@ func (s *Server) handleVoice(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(types.ChatResponse{SessionID: sid, Reply: reply, Transcript: transcribed, Intent: intent})
 }
 
-func (s *Server) convertMessages(msgs []store.Message) []openai.ChatCompletionMessage {
-	out := make([]openai.ChatCompletionMessage, 0, len(msgs))
+var errEmptyTranscription = errors.New("empty transcription")
+
+// transcribe runs speech-to-text on an uploaded audio file, honouring the form's
+// optional language and prompt fields. On failure it writes the error response itself
+// and returns false.
+func (s *Server) transcribe(ctx context.Context, w http.ResponseWriter, r *http.Request, file io.Reader, filename string) (string, bool) {
+	transcribed, err := s.speechToText(ctx, file, filename, r.FormValue("language"), r.FormValue("prompt"))
+	if errors.Is(err, errEmptyTranscription) {
+		s.writeError(w, http.StatusBadGateway, "empty transcription")
+		return "", false
+	}
+	if err != nil {
+		logger(ctx).Error("transcription failed", "error", err)
+		s.writeError(w, http.StatusBadGateway, "transcription failed")
+		return "", false
+	}
+	return transcribed, true
+}
+
+// speechToText transcribes audio with Whisper. An empty prompt uses cfg.STTPrompt and
+// an unsupported language is dropped in favour of auto-detection.
+func (s *Server) speechToText(ctx context.Context, audio io.Reader, filename, language, prompt string) (string, error) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		prompt = s.cfg.STTPrompt
+	}
+	tr, err := s.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    s.cfg.STTModel,
+		Reader:   audio,
+		FilePath: filename,
+		Language: transcriptionLanguage(language),
+		Prompt:   prompt,
+	})
+	if err != nil {
+		return "", err
+	}
+	transcribed := strings.TrimSpace(tr.Text)
+	if transcribed == "" {
+		return "", errEmptyTranscription
+	}
+	return transcribed, nil
+}
+
+// appendMessage records a chat message, preferring the database so history
+// survives restarts and is shared across replicas. Falls back to memory on error.
+func (s *Server) appendMessage(sessionID string, msg store.Message) {
+	if s.databaseStore != nil {
+		err := s.databaseStore.AppendMessage(sessionID, msg)
+		if err == nil {
+			return
+		}
+		slog.Error("database append message failed", "error", err)
+	}
+	s.store.Append(sessionID, msg)
+}
+
+// history returns the session's chat history from the database when configured,
+// falling back to the in-memory store. The database trims by count only, so the
+// token budget is applied here on read.
+func (s *Server) history(sessionID string) []store.Message {
+	if s.databaseStore != nil {
+		msgs, err := s.databaseStore.GetMessages(sessionID)
+		if err == nil {
+			if s.cfg.HistoryTrim == "tokens" {
+				msgs = store.TrimToTokenBudget(msgs, s.cfg.HistoryTokenBudget, store.EstimateTokens(s.store.GetSystemPrompt(sessionID)))
+			}
+			return msgs
+		}
+		slog.Error("database get messages failed", "error", err)
+	}
+	return s.store.Get(sessionID)
+}
+
+// convertMessages turns stored history into chat messages, led by the session's
+// pinned system prompt when it has one.
+func (s *Server) convertMessages(sessionID string, msgs []store.Message) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(msgs)+1)
+	if system := s.store.GetSystemPrompt(sessionID); system != "" {
+		out = append(out, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: system})
+	}
 	for _, m := range msgs {
 		role := m.Role
 		if role == "" {
 			role = openai.ChatMessageRoleUser
 		}
-		fmt.Println("role", role, m.Content)
 		out = append(out, openai.ChatCompletionMessage{Role: role, Content: m.Content})
 	}
 
@@ -339,9 +601,9 @@ func newSessionID() string {
 }
 
 // getSessionID retrieves the session ID from cookie or query parameter/header
-func getSessionID(r *http.Request) string {
+func (s *Server) getSessionID(r *http.Request) string {
 	// Try cookie first
-	if cookie, err := GetSessionCookie(r); err == nil && cookie != "" {
+	if cookie, err := s.sessionCookie(r); err == nil && cookie != "" {
 		return cookie
 	}
 	// Fall back to header
@@ -356,14 +618,11 @@ func getSessionID(r *http.Request) string {
 }
 
 // getOrCreateSessionID gets existing session ID or creates a new one, setting the cookie
-func getOrCreateSessionID(r *http.Request, w http.ResponseWriter) string {
-	sid := getSessionID(r)
+func (s *Server) getOrCreateSessionID(r *http.Request, w http.ResponseWriter) string {
+	sid := s.getSessionID(r)
 	if sid == "" {
 		sid = newSessionID()
-		log.Printf("[session] creating new session: %s for endpoint: %s", sid, r.URL.Path)
-		SetSessionCookie(w, r, sid)
-	} else {
-		log.Printf("[session] reusing existing session: %s for endpoint: %s", sid, r.URL.Path)
+		s.setSessionCookie(w, r, sid)
 	}
 	return sid
 }
@@ -371,18 +630,31 @@ func getOrCreateSessionID(r *http.Request, w http.ResponseWriter) string {
 // getGitHubToken retrieves the GitHub token for a session with proper fallback:
 // 1. Try database (session-specific token)
 // 2. Try file-based token store (OAuth token)
-// 3. Try config (fallback)
+// Expiring OAuth tokens from either are refreshed first when close to expiry.
+// 3. Try the GitHub App installation token, when an App is configured
+// 4. Try config (fallback)
 func (s *Server) getGitHubToken(sessionID string) string {
 	// First priority: Check database for session-specific token
 	if s.databaseStore != nil {
 		if auth, err := s.databaseStore.GetGitHubAuth(sessionID); err == nil && auth != nil && strings.TrimSpace(auth.GitHubToken) != "" {
-			return auth.GitHubToken
+			return s.accountToken(*auth)
 		}
 	}
 
 	// Second priority: Check file-based token store (OAuth flow)
 	if token, err := s.tokenStore.Read(); err == nil && token != nil && strings.TrimSpace(token.AccessToken) != "" {
-		return token.AccessToken
+		return s.fileToken(token)
+	}
+
+	// Third priority: GitHub App installation token, cached until near expiry
+	if s.appTokens != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.GitHubTimeout)
+		defer cancel()
+		token, err := s.appTokens.Token(ctx)
+		if err == nil {
+			return token
+		}
+		slog.Warn("github app token failed", "error", err)
 	}
 
 	// Last priority: Fall back to config token
@@ -392,25 +664,113 @@ func (s *Server) getGitHubToken(sessionID string) string {
 // classifyAndHandle: LLM classifies a single intent and we handle it once.
 // Returns reply text and a structured intent for the frontend.
 func (s *Server) classifyAndHandle(ctx context.Context, sessionID, message string) (string, *types.IntentResponse, bool) {
-	fmt.Println("classifying and handling", message)
-	if s.intent == nil {
+	reply, intent, ok, _ := s.route(ctx, sessionID, message)
+	return reply, intent, ok
+}
+
+// answer is classifyAndHandle for the JSON endpoints. A message the classifier finds
+// no intent in is plain chat and is answered by a chat completion over the session
+// history, as the streaming endpoints answer it; the intent is nil then.
+func (s *Server) answer(ctx context.Context, sessionID, message string) (string, *types.IntentResponse, bool) {
+	reply, intent, ok, err := s.route(ctx, sessionID, message)
+	if ok || !errors.Is(err, gh.ErrNoIntent) {
+		return reply, intent, ok
+	}
+	resp, _, err := completeWithFallback(ctx, s.client, s.models(), openai.ChatCompletionRequest{
+		Messages: s.convertMessages(sessionID, s.history(sessionID)),
+	})
+	if err != nil || len(resp.Choices) == 0 {
+		logger(ctx).Error("chat completion failed", "error", err)
 		return "", nil, false
 	}
+	return resp.Choices[0].Message.Content, nil, true
+}
+
+// route does the work of classifyAndHandle, also returning gh.ErrNoIntent when the
+// classifier found nothing to act on.
+func (s *Server) route(ctx context.Context, sessionID, message string) (string, *types.IntentResponse, bool, error) {
+	// A pending merge confirmation is answered with a plain yes or no; anything else
+	// drops it and is classified as a new request, so nothing merges without a yes
+	if pType, pArgs, ok := s.store.GetPendingIntent(sessionID); ok && pType == "confirm_merge" {
+		switch {
+		case isAffirmative(message):
+			args := make(map[string]interface{}, len(pArgs)+1)
+			for k, v := range pArgs {
+				args[k] = v
+			}
+			args["confirmed"] = true
+			s.store.ClearPendingIntent(sessionID)
+			typ := "merge_pr"
+			if batch, _ := pArgs["batch"].(bool); batch {
+				typ = "merge_approved"
+			}
+			reply, intent, ok := s.handleWithArgs(ctx, sessionID, &gh.ClassifiedIntent{Type: typ, Args: args, Confidence: 1})
+			return reply, intent, ok, nil
+		case isNegative(message):
+			s.store.ClearPendingIntent(sessionID)
+			if batch, _ := pArgs["batch"].(bool); batch {
+				return "Okay, I won't merge them.", &types.IntentResponse{Type: "merge_cancelled"}, true, nil
+			}
+			return "Okay, I won't merge it.", &types.IntentResponse{Type: "merge_cancelled"}, true, nil
+		}
+		s.store.ClearPendingIntent(sessionID)
+	}
+	// A comment body we just asked for is taken verbatim; classifying it could turn
+	// "merge this after lunch" into a merge
+	if pType, pArgs, ok := s.store.GetPendingIntent(sessionID); ok && pType == "add_comment" && pArgs["awaiting"] == "body" {
+		if isNegative(message) {
+			s.store.ClearPendingIntent(sessionID)
+			return "Okay, I won't add a comment.", &types.IntentResponse{Type: "not_implemented"}, true, nil
+		}
+		reply, intent, ok := s.handleWithArgs(ctx, sessionID, &gh.ClassifiedIntent{
+			Type:       "add_comment",
+			Args:       map[string]interface{}{"body": message},
+			Confidence: 1,
+		})
+		return reply, intent, ok, nil
+	}
+	if s.intent == nil {
+		reply, intent, ok := s.handleHeuristic(ctx, sessionID, message)
+		return reply, intent, ok, nil
+	}
 	// Convert full history to chat messages for role-aware classification.
 	// Do NOT append the latest user message again; it is already included from store.
-	chat := s.convertMessages(s.store.Get(sessionID))
+	chat := s.convertMessages(sessionID, s.history(sessionID))
 
 	ci, err := s.intent.ClassifyChat(ctx, chat)
+	if errors.Is(err, gh.ErrNoIntent) {
+		return "", nil, false, err
+	}
 	if err != nil || ci == nil {
-		fmt.Println("error classifying chat", err)
+		logger(ctx).Warn("intent classification failed", "error", err)
+		reply, intent, ok := s.handleHeuristic(ctx, sessionID, message)
+		return reply, intent, ok, nil
+	}
+	logger(ctx).Debug("classified intent", "type", ci.Type, "confidence", ci.Confidence)
+	reply, intent, ok := s.handleWithArgs(ctx, sessionID, ci)
+	return reply, intent, ok, nil
+}
+
+// handleHeuristic keeps the list intents working when the LLM classifier is unavailable
+// by falling back to keyword detection. Anything else still fails.
+func (s *Server) handleHeuristic(ctx context.Context, sessionID, message string) (string, *types.IntentResponse, bool) {
+	detected := gh.DetectIntent(message)
+	if detected.Kind == gh.IntentUnknown {
 		return "", nil, false
 	}
-	fmt.Println("classified chat", ci)
-	return s.handleWithArgs(ctx, sessionID, ci)
+	logger(ctx).Info("classifier unavailable, heuristic matched", "intent", detected.Kind)
+	return s.handleWithArgs(ctx, sessionID, &gh.ClassifiedIntent{
+		Type:       string(detected.Kind),
+		Args:       map[string]interface{}{},
+		Confidence: 1,
+	})
 }
 
 // handleWithArgs routes a classified intent, applying autofill and pending storage rules.
 func (s *Server) handleWithArgs(ctx context.Context, sessionID string, ci *gh.ClassifiedIntent) (string, *types.IntentResponse, bool) {
+	if reply, resp, ok := s.confirmLowConfidence(sessionID, ci); ok {
+		return reply, resp, true
+	}
 	// Merge with any pending intent to support slot-filling across turns
 	targetType := ci.Type
 	// Copy args from classifier
@@ -423,6 +783,14 @@ func (s *Server) handleWithArgs(ctx context.Context, sessionID string, ci *gh.Cl
 		if targetType == "clarify" && pType != "" {
 			targetType = pType
 		}
+		// "The one in me/app" answers a which-repo question even when the classifier
+		// files it as something else; keep going with the pending intent
+		switch targetType {
+		case "focus_pr", "unknown", "not_implemented", "":
+			if pType != "" && s.isRepoAnswer(sessionID, pArgs, mergedArgs) {
+				targetType = pType
+			}
+		}
 		if targetType == pType && targetType != "" {
 			// Fill any missing args from pending
 			for k, v := range pArgs {
@@ -435,268 +803,1629 @@ func (s *Server) handleWithArgs(ctx context.Context, sessionID string, ci *gh.Cl
 
 	switch targetType {
 	case "list_prs_mine", "list_prs_review":
-		fmt.Println("listing PRs", targetType)
-		token := s.getGitHubToken(sessionID)
+		filter := gh.PRFilter{State: strings.ToLower(argString(mergedArgs, "state"))}
+		var ambiguous bool
+		var which string
+		filter.Repo, ambiguous, which = s.resolveRepo(ctx, sessionID, argString(mergedArgs, "repo"), 0)
+		if ambiguous {
+			s.store.SetPendingIntent(sessionID, targetType, mergedArgs)
+			return which, &types.IntentResponse{Type: "clarify"}, true
+		}
+		if filter.Repo != "" && !s.repoAllowed(filter.Repo) {
+			s.store.ClearPendingIntent(sessionID)
+			return "I'm not allowed to touch that repo.", &types.IntentResponse{Type: "error", Payload: map[string]any{"repo": filter.Repo, "reason": "repo_not_allowed"}}, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, filter.Repo)
 		if strings.TrimSpace(token) == "" {
 			// Ask user to auth via friendly reply and structured intent.
 			reply := "Whoops! I need your GitHub connection to fetch your pull requests. Let's connect GitHub first."
 			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
 		}
-		var prs []gh.PR
-		var err error
-		if targetType == "list_prs_mine" {
-			prs, err = s.mcp.ListUserPRs(ctx, token)
-		} else {
-			prs, err = s.mcp.ListPRsForReview(ctx, token)
-		}
-		if err != nil {
-			reply := "I couldn't fetch your pull requests from GitHub right now. This might be a temporary issue with GitHub's API. Try again in a moment?"
-			return reply, &types.IntentResponse{Type: "error"}, true
-		}
 		kind := gh.IntentListMine
+		listKind := "mine"
 		if targetType == "list_prs_review" {
 			kind = gh.IntentListReview
+			listKind = "review"
+		}
+		if !gh.ValidPRState(filter.State) {
+			reply := "I can list open, closed, merged or all pull requests. Which would you like?"
+			return reply, &types.IntentResponse{Type: "clarify"}, true
+		}
+		// Filtered listings are cached separately from the plain ones
+		cacheKind := listKind
+		if filter != (gh.PRFilter{}) {
+			cacheKind = listKind + "|" + strings.ToLower(filter.Repo) + "|" + filter.State
+		}
+		// Serve repeats within a minute from cache; search is limited to 30 req/min
+		prs, cached := s.store.GetCachedPRs(sessionID, cacheKind)
+		if !cached {
+			var err error
+			prs, err = s.mcp.ListPRs(ctx, token, kind, filter)
+			if err != nil {
+				return s.githubFailureReply(ctx, sessionID, token, err, filter.Repo, 0, "I couldn't fetch your pull requests from GitHub right now. This might be a temporary issue with GitHub's API. Try again in a moment?")
+			}
+			s.store.SetCachedPRs(sessionID, cacheKind, prs)
 		}
 		// Cache last PRs for auto-resolution by PR number (7m TTL in store)
 		if len(prs) > 0 {
 			refs := make([]store.PRRef, 0, len(prs))
 			for _, p := range prs {
-				refs = append(refs, store.PRRef{Number: p.Number, Repository: p.Repository})
+				refs = append(refs, store.PRRef{Number: p.Number, Repository: p.Repository, Title: p.Title, Author: p.Author, URL: p.URL})
 			}
 			s.store.SetLastPRs(sessionID, refs)
 		}
-		// Clear any pending intent when listing
+		// Clear any pending intent and focus when listing; the topic has changed
 		s.store.ClearPendingIntent(sessionID)
-		reply := s.formatPRListReply(kind, prs)
-		listKind := "mine"
-		if kind == gh.IntentListReview {
-			listKind = "review"
-		}
-		return reply, &types.IntentResponse{Type: "show_prs", Payload: map[string]any{"prs": prs, "kind": listKind}}, true
-	case "get_pr_comments":
-		fmt.Println("getting PR comments", targetType)
-		repo, _ := mergedArgs["repo"].(string)
-		var prNumber int
-		if n, ok := mergedArgs["pr_number"].(float64); ok {
-			prNumber = int(n)
-		} else if n2, ok2 := mergedArgs["pr_number"].(int); ok2 {
-			prNumber = n2
-		}
-		// Resolve bare repo to owner/repo if possible
-		repo = strings.TrimSpace(repo)
-		if repo != "" && !strings.Contains(repo, "/") {
-			// Build owner/repo using username from session or default config
-			owner := strings.TrimSpace(s.store.GetUsername(sessionID))
-			if owner == "" {
-				owner = strings.TrimSpace(s.cfg.DefaultRepoOwner)
-			}
-			if owner != "" {
-				repo = owner + "/" + repo
-			}
-		}
-		// Attempt auto-resolve repo via last listed PRs when missing
-		repo = strings.TrimSpace(repo)
-		if repo == "" && prNumber > 0 {
-			if refs, ok := s.store.GetLastPRs(sessionID); ok {
-				matches := make([]string, 0, 2)
-				for _, r := range refs {
-					if r.Number == prNumber {
-						matches = append(matches, r.Repository)
-					}
-				}
-				if len(matches) == 1 {
-					repo = matches[0]
-				} else if len(matches) > 1 {
-					// Targeted clarification with options
-					msg := fmt.Sprintf("Did you mean PR %d in %s?", prNumber, strings.Join(matches, " or "))
-					// store pending with known pr_number
-					mergedArgs["pr_number"] = prNumber
-					s.store.SetPendingIntent(sessionID, "get_pr_comments", mergedArgs)
-					return msg, &types.IntentResponse{Type: "clarify"}, true
-				}
-			}
+		s.store.ClearFocusedPR(sessionID)
+		reply := s.formatPRListReply(kind, filter, prs)
+		if cached {
+			reply += " (Showing cached results from a moment ago.)"
 		}
-		// If still missing args, ask targeted clarifications and persist pending intent
-		repo = strings.TrimSpace(repo)
-		if repo == "" && prNumber <= 0 {
-			msg := "Which repository and PR number should I look at?"
-			s.store.SetPendingIntent(sessionID, "get_pr_comments", mergedArgs)
-			return msg, &types.IntentResponse{Type: "clarify"}, true
+		payload := map[string]any{"prs": prs, "kind": listKind, "cached": cached}
+		if filter.Repo != "" {
+			payload["repo"] = filter.Repo
 		}
-		if repo == "" {
-			msg := fmt.Sprintf("Which repo is PR %d in?", prNumber)
-			s.store.SetPendingIntent(sessionID, "get_pr_comments", mergedArgs)
-			return msg, &types.IntentResponse{Type: "clarify"}, true
+		if filter.State != "" {
+			payload["state"] = filter.State
 		}
-		if prNumber <= 0 {
-			msg := fmt.Sprintf("Which PR number in %s?", repo)
-			s.store.SetPendingIntent(sessionID, "get_pr_comments", mergedArgs)
-			return msg, &types.IntentResponse{Type: "clarify"}, true
+		return reply, &types.IntentResponse{Type: "show_prs", Payload: payload}, true
+	case "get_pr_comments":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repository and PR number should I look at?")
+		if !ok {
+			return clarify, clarifyResp, true
 		}
 
-		token := s.getGitHubToken(sessionID)
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
 		if strings.TrimSpace(token) == "" {
 			reply := "I need your GitHub connection to fetch PR comments. Let's connect GitHub first."
 			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
 		}
 
-		fmt.Println("Getting PR comments", repo, prNumber)
-		comments, err := s.mcp.GetPRComments(ctx, token, repo, prNumber)
+		comments, truncated, err := s.mcp.GetPRComments(ctx, token, repo, prNumber)
 		if err != nil {
-			fmt.Println("Error fetching comments", err)
-			reply := "I couldn't retrieve the PR comments from GitHub. This could be a temporary GitHub API issue or the PR might not exist. Mind trying again?"
-			return reply, &types.IntentResponse{Type: "error"}, true
+			logger(ctx).Warn("fetch pr comments failed", "repo", repo, "pr", prNumber, "error", err)
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't retrieve the PR comments from GitHub. This could be a temporary GitHub API issue or the PR might not exist. Mind trying again?")
 		}
 		// Update memory on success
 		s.store.ClearPendingIntent(sessionID)
-		reply := fmt.Sprintf("I found %d comment(s) on GitHub pull request %s#%d.", len(comments), repo, prNumber)
-		return reply, &types.IntentResponse{Type: "show_comments", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "comments": comments}}, true
+		reply := formatCommentsReply(repo, prNumber, comments, truncated, s.cfg.SpokenCommentLimit)
+		return reply, &types.IntentResponse{Type: "show_comments", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "comments": comments, "truncated": truncated}}, true
 	case "merge_pr":
-		fmt.Println("merging PR", targetType)
-		repo, _ := mergedArgs["repo"].(string)
-		var prNumber int
-		if n, ok := mergedArgs["pr_number"].(float64); ok {
-			prNumber = int(n)
-		} else if n2, ok2 := mergedArgs["pr_number"].(int); ok2 {
-			prNumber = n2
-		}
-		method, _ := mergedArgs["merge_method"].(string)
-		method = strings.ToLower(strings.TrimSpace(method))
+		method := strings.ToLower(argString(mergedArgs, "merge_method"))
 		if method == "" {
 			method = "merge"
 		}
-		// Resolve repo owner/repo if only name given
-		repo = strings.TrimSpace(repo)
-		if repo != "" && !strings.Contains(repo, "/") {
-			owner := strings.TrimSpace(s.store.GetUsername(sessionID))
-			if owner == "" {
-				owner = strings.TrimSpace(s.cfg.DefaultRepoOwner)
-			}
-			if owner != "" {
-				repo = owner + "/" + repo
-			}
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I merge?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to merge pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		// A double-sent transcript shouldn't try to merge twice
+		action := actionKey(targetType, repo, prNumber)
+		if s.store.RecentlyDone(sessionID, action) {
+			s.store.ClearPendingIntent(sessionID)
+			return "I just merged that one.", &types.IntentResponse{Type: "merged", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "method": method, "duplicate": true}}, true
 		}
-		// Attempt auto-resolve repo via last listed PRs when missing
-		if repo == "" && prNumber > 0 {
-			if refs, ok := s.store.GetLastPRs(sessionID); ok {
-				matches := make([]string, 0, 2)
-				for _, r := range refs {
-					if r.Number == prNumber {
-						matches = append(matches, r.Repository)
-					}
+		commitTitle := argString(mergedArgs, "commit_title")
+		commitMessage := argString(mergedArgs, "commit_message")
+		force, _ := mergedArgs["force"].(bool)
+		confirmed, _ := mergedArgs["confirmed"].(bool)
+		deleteBranch := s.cfg.DeleteBranchOnMerge
+		if v, ok := mergedArgs["delete_branch"].(bool); ok {
+			deleteBranch = v
+		}
+		// Check before asking for confirmation; a confirmed merge was checked a turn ago
+		if s.cfg.MergePrecheck && !force && !confirmed {
+			st, err := s.mcp.GetPRStatus(ctx, token, repo, prNumber)
+			if err != nil {
+				if reply, resp, ok := s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, ""); ok {
+					return reply, resp, true
+				}
+				// The check is advisory; let GitHub decide
+				logger(ctx).Warn("merge pre-check failed", "repo", repo, "pr", prNumber, "error", err)
+			} else if blockers := mergeBlockers(st); len(blockers) > 0 {
+				// Keep the merge pending, forced, so "yes, force it" goes straight to GitHub
+				pending := map[string]any{"repo": repo, "pr_number": prNumber, "merge_method": method, "force": true, "delete_branch": deleteBranch}
+				if commitTitle != "" {
+					pending["commit_title"] = commitTitle
 				}
-				if len(matches) == 1 {
-					repo = matches[0]
-				} else if len(matches) > 1 {
-					msg := fmt.Sprintf("Did you mean PR %d in %s?", prNumber, strings.Join(matches, " or "))
-					mergedArgs["pr_number"] = prNumber
-					s.store.SetPendingIntent(sessionID, "merge_pr", mergedArgs)
-					return msg, &types.IntentResponse{Type: "clarify"}, true
+				if commitMessage != "" {
+					pending["commit_message"] = commitMessage
 				}
+				s.store.SetPendingIntent(sessionID, "confirm_merge", pending)
+				reply := fmt.Sprintf("I didn't merge PR #%d because %s. Want me to force the merge anyway?", prNumber, joinNames(blockers))
+				return reply, &types.IntentResponse{Type: "merge_blocked", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reasons": blockers, "status": st}}, true
 			}
 		}
-		// Missing fields clarifications
-		if repo == "" && prNumber <= 0 {
-			msg := "Which repo and PR should I merge?"
-			s.store.SetPendingIntent(sessionID, "merge_pr", mergedArgs)
-			return msg, &types.IntentResponse{Type: "clarify"}, true
+		if s.cfg.RequireMergeConfirmation && !confirmed {
+			pending := map[string]any{"repo": repo, "pr_number": prNumber, "merge_method": method, "delete_branch": deleteBranch}
+			if commitTitle != "" {
+				pending["commit_title"] = commitTitle
+			}
+			if commitMessage != "" {
+				pending["commit_message"] = commitMessage
+			}
+			if force {
+				pending["force"] = true
+			}
+			s.store.SetPendingIntent(sessionID, "confirm_merge", pending)
+			reply := fmt.Sprintf("Merge PR #%d in %s using %s? Say yes to confirm.", prNumber, repo, method)
+			return reply, &types.IntentResponse{Type: "confirm_merge", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "method": method}}, true
+		}
+		if err := s.mcp.MergePR(ctx, token, repo, prNumber, method, commitTitle, commitMessage); err != nil {
+			var conflict *gh.ConflictError
+			if errors.As(err, &conflict) && conflict.StatusCode == http.StatusMethodNotAllowed && conflict.Message != "" {
+				// 405 is GitHub's own refusal, e.g. branch protection; it says why
+				reply := fmt.Sprintf("GitHub refused to merge PR #%d: %s.", prNumber, strings.TrimSuffix(conflict.Message, "."))
+				return reply, &types.IntentResponse{Type: "error", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reason": "not_mergeable", "forced": force}}, true
+			}
+			if errors.As(err, &conflict) {
+				reply := fmt.Sprintf("GitHub won't merge PR #%d: there are merge conflicts or the branch changed since it was checked. Want me to check the PR status?", prNumber)
+				return reply, &types.IntentResponse{Type: "error", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reason": "conflict"}}, true
+			}
+			var invalid *gh.ValidationError
+			if errors.As(err, &invalid) {
+				reply := fmt.Sprintf("GitHub rejected the merge of PR #%d: %s.", prNumber, strings.TrimSuffix(invalid.Message, "."))
+				return reply, &types.IntentResponse{Type: "error", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reason": "invalid"}}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't merge the pull request on GitHub. This could be due to failing checks, merge conflicts, or insufficient permissions. Would you like me to check the PR status?")
 		}
-		if repo == "" {
-			msg := fmt.Sprintf("Which repo is PR %d in?", prNumber)
-			s.store.SetPendingIntent(sessionID, "merge_pr", mergedArgs)
-			return msg, &types.IntentResponse{Type: "clarify"}, true
+		s.store.MarkActionDone(sessionID, action)
+		s.store.ClearPendingIntent(sessionID)
+		s.store.ClearCachedPRs(sessionID)
+		reply := fmt.Sprintf("Successfully merged GitHub pull request %s#%d using %s method.", repo, prNumber, method)
+		payload := map[string]any{"repo": repo, "prNumber": prNumber, "method": method}
+		if deleteBranch {
+			branch, deleted, note := s.deleteMergedBranch(ctx, token, repo, prNumber)
+			reply += " " + note
+			payload["branch"] = branch
+			payload["branchDeleted"] = deleted
 		}
-		if prNumber <= 0 {
-			msg := fmt.Sprintf("Which PR number in %s?", repo)
-			s.store.SetPendingIntent(sessionID, "merge_pr", mergedArgs)
-			return msg, &types.IntentResponse{Type: "clarify"}, true
+		return reply, &types.IntentResponse{Type: "merged", Payload: payload}, true
+	case "merge_approved":
+		method := strings.ToLower(argString(mergedArgs, "merge_method"))
+		if method == "" {
+			method = "merge"
 		}
 		token := s.getGitHubToken(sessionID)
 		if strings.TrimSpace(token) == "" {
 			reply := "I need your GitHub connection to merge pull requests. Let's connect GitHub first."
 			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
 		}
-		if err := s.mcp.MergePR(ctx, token, repo, prNumber, method); err != nil {
-			reply := "I couldn't merge the pull request on GitHub. This could be due to failing checks, merge conflicts, or insufficient permissions. Would you like me to check the PR status?"
-			return reply, &types.IntentResponse{Type: "error"}, true
+		// A confirmed batch merges the PRs that were listed in the question, no others
+		confirmed, _ := mergedArgs["confirmed"].(bool)
+		var prs []gh.PR
+		if confirmed {
+			prs = prsFromPending(mergedArgs["prs"])
+		} else {
+			var err error
+			prs, err = s.mcp.ListUserPRs(ctx, token)
+			if err != nil {
+				return s.githubFailureReply(ctx, sessionID, token, err, "", 0, "I couldn't fetch your pull requests from GitHub just now. Want me to try again?")
+			}
 		}
 		s.store.ClearPendingIntent(sessionID)
-		reply := fmt.Sprintf("Successfully merged GitHub pull request %s#%d using %s method.", repo, prNumber, method)
-		return reply, &types.IntentResponse{Type: "merged", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "method": method}}, true
-	case "clarify":
-		// Use LLM-provided playful message
-		msg := strings.TrimSpace(ci.Message)
-		if msg == "" {
-			msg = "Mind giving me a tiny bit more detail? I promise I listen better than your rubber duck."
+		if len(prs) == 0 {
+			return "You don't have any open pull requests to merge.", &types.IntentResponse{Type: "batch_merged", Payload: map[string]any{"merged": []any{}, "skipped": []any{}}}, true
 		}
-		// Capture any args we already know (transcript mode only uses payload)
-		repo, _ := mergedArgs["repo"].(string)
-
-		var prNumber int
-		if n, ok := mergedArgs["pr_number"].(float64); ok {
-			prNumber = int(n)
-		} else if n2, ok2 := mergedArgs["pr_number"].(int); ok2 {
-			prNumber = n2
+		if s.cfg.RequireMergeConfirmation && !confirmed {
+			ready, skipped := s.readyToMerge(ctx, sessionID, prs)
+			if len(ready) == 0 {
+				return summarizeBatchMerge(skipped), &types.IntentResponse{Type: "batch_merged", Payload: map[string]any{"merged": []any{}, "skipped": batchItems(skipped), "method": method}}, true
+			}
+			s.store.SetPendingIntent(sessionID, "confirm_merge", map[string]any{"batch": true, "merge_method": method, "prs": batchPendingPRs(ready)})
+			refs := make([]string, len(ready))
+			for i, r := range ready {
+				refs[i] = fmt.Sprintf("%s#%d", r.PR.Repository, r.PR.Number)
+			}
+			reply := fmt.Sprintf("Merge %d PR%s using %s: %s? Say yes to confirm.", len(ready), plural(len(ready)), method, joinNames(refs))
+			return reply, &types.IntentResponse{Type: "confirm_merge", Payload: map[string]any{"prs": batchItems(ready), "skipped": batchItems(skipped), "method": method}}, true
 		}
-		var reviewID int
-		if rid, ok := mergedArgs["review_id"].(float64); ok {
-			reviewID = int(rid)
+		results := s.mergeApproved(ctx, sessionID, prs, method)
+		s.store.ClearCachedPRs(sessionID)
+		var merged, skipped []batchMergeResult
+		for _, r := range results {
+			if r.Merged {
+				merged = append(merged, r)
+			} else {
+				skipped = append(skipped, r)
+			}
 		}
-
-		repo = strings.TrimSpace(repo)
-		// No slot memory update; transcript carries context
-		payload := map[string]any{}
-		if repo != "" {
-			payload["repo"] = repo
+		return summarizeBatchMerge(results), &types.IntentResponse{Type: "batch_merged", Payload: map[string]any{"merged": batchItems(merged), "skipped": batchItems(skipped), "method": method}}, true
+	case "close_pr":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I close?")
+		if !ok {
+			return clarify, clarifyResp, true
 		}
-		if prNumber > 0 {
-			payload["prNumber"] = prNumber
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to close pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
 		}
-		if reviewID > 0 {
-			payload["reviewId"] = reviewID
+		action := actionKey(targetType, repo, prNumber)
+		if s.store.RecentlyDone(sessionID, action) {
+			s.store.ClearPendingIntent(sessionID)
+			return "I just closed that one.", &types.IntentResponse{Type: "pr_closed", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "duplicate": true}}, true
 		}
-		// Keep pending intent if any exists so follow-up can merge
-		if pType, pArgs, ok := s.store.GetPendingIntent(sessionID); ok && pType != "" {
-			// Merge any new info into pending and refresh TTL
-			for k, v := range payload {
-				pArgs[k] = v
-			}
-			s.store.SetPendingIntent(sessionID, pType, pArgs)
+		if err := s.mcp.ClosePR(ctx, token, repo, prNumber); err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't close the pull request on GitHub. Want me to try again?")
 		}
-		return msg, &types.IntentResponse{Type: "clarify", Payload: payload}, true
-	case "not_implemented", "unknown":
-		// Treat unknown as not_implemented; use LLM-provided playful message
-		msg := strings.TrimSpace(ci.Message)
-		if msg == "" {
-			msg = "I haven't learned that trick yet — but I'm practicing!"
+		s.store.MarkActionDone(sessionID, action)
+		s.store.ClearPendingIntent(sessionID)
+		s.store.ClearCachedPRs(sessionID)
+		reply := fmt.Sprintf("Closed PR #%d in %s without merging.", prNumber, repo)
+		return reply, &types.IntentResponse{Type: "pr_closed", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+	case "reopen_pr":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I reopen?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to reopen pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if err := s.mcp.ReopenPR(ctx, token, repo, prNumber); err != nil {
+			if errors.Is(err, gh.ErrReopenMerged) {
+				s.store.ClearPendingIntent(sessionID)
+				reply := fmt.Sprintf("PR #%d in %s was already merged, so I can't reopen it.", prNumber, repo)
+				return reply, &types.IntentResponse{Type: "error"}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't reopen the pull request on GitHub. The branch may have been deleted.")
 		}
-		// Do not carry stale pending intents across unknowns
 		s.store.ClearPendingIntent(sessionID)
-		return msg, &types.IntentResponse{Type: "not_implemented"}, true
-	default:
-		return "", nil, false
-	}
-}
-
-// (no-op helpers removed; transcript-only mode)
-
-// Removed per-session slot memory; classification uses full chat transcript
-
-func (s *Server) formatPRListReply(kind gh.IntentKind, prs []gh.PR) string {
-	if len(prs) == 0 {
-		if kind == gh.IntentListReview {
-			return "You have no GitHub pull requests to review at the moment."
+		s.store.ClearCachedPRs(sessionID)
+		reply := fmt.Sprintf("PR #%d in %s is open again.", prNumber, repo)
+		return reply, &types.IntentResponse{Type: "pr_reopened", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+	case "assign_reviewers":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I request reviews on?")
+		if !ok {
+			return clarify, clarifyResp, true
 		}
-		return "You have no open pull requests on GitHub."
-	}
-	max := 5
+		reviewers := stringListArg(mergedArgs, "reviewers")
+		if len(reviewers) == 0 {
+			mergedArgs["repo"] = repo
+			mergedArgs["pr_number"] = prNumber
+			s.store.SetPendingIntent(sessionID, targetType, mergedArgs)
+			reply := fmt.Sprintf("Who should I ask to review PR #%d?", prNumber)
+			return reply, &types.IntentResponse{Type: "clarify", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to request reviews. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if err := s.mcp.RequestReviewers(ctx, token, repo, prNumber, reviewers); err != nil {
+			var invalid *gh.InvalidReviewersError
+			if errors.As(err, &invalid) {
+				reply := fmt.Sprintf("I couldn't request a review from %s — they don't look like collaborators on %s.", strings.Join(invalid.Reviewers, " or "), repo)
+				return reply, &types.IntentResponse{Type: "error", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "invalidReviewers": invalid.Reviewers}}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't request those reviews on GitHub. Want me to try again?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Asked %s to review PR #%d in %s.", joinNames(reviewers), prNumber, repo)
+		return reply, &types.IntentResponse{Type: "reviewers_requested", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reviewers": reviewers}}, true
+	case "add_labels", "remove_label":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I label?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		labels := stringListArg(mergedArgs, "labels")
+		if len(labels) == 0 {
+			labels = stringListArg(mergedArgs, "label")
+		}
+		if len(labels) == 0 {
+			mergedArgs["repo"] = repo
+			mergedArgs["pr_number"] = prNumber
+			s.store.SetPendingIntent(sessionID, targetType, mergedArgs)
+			reply := fmt.Sprintf("Which label should I add to PR #%d?", prNumber)
+			if targetType == "remove_label" {
+				reply = fmt.Sprintf("Which label should I take off PR #%d?", prNumber)
+			}
+			return reply, &types.IntentResponse{Type: "clarify", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to change labels. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if targetType == "remove_label" {
+			label := labels[0]
+			if err := s.mcp.RemoveLabel(ctx, token, repo, prNumber, label); err != nil {
+				if errors.Is(err, gh.ErrLabelNotFound) {
+					s.store.ClearPendingIntent(sessionID)
+					reply := fmt.Sprintf("PR #%d didn't have the %q label, so there was nothing to remove.", prNumber, label)
+					return reply, &types.IntentResponse{Type: "label_removed", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "label": label, "removed": false}}, true
+				}
+				return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't remove that label on GitHub. Want me to try again?")
+			}
+			s.store.ClearPendingIntent(sessionID)
+			reply := fmt.Sprintf("Removed the %q label from PR #%d in %s.", label, prNumber, repo)
+			return reply, &types.IntentResponse{Type: "label_removed", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "label": label, "removed": true}}, true
+		}
+		if err := s.mcp.AddLabels(ctx, token, repo, prNumber, labels); err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't add those labels on GitHub. Want me to try again?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Labeled PR #%d in %s as %s.", prNumber, repo, joinNames(labels))
+		return reply, &types.IntentResponse{Type: "labels_added", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "labels": labels}}, true
+	case "describe_pr":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I describe?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to read pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		pr, err := s.mcp.GetPR(ctx, token, repo, prNumber)
+		if err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't fetch that pull request from GitHub. Double-check the repo and number?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		return s.describePR(ctx, pr), &types.IntentResponse{Type: "pr_description", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "pr": pr}}, true
+	case "open_pr":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I open?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		// Listed PRs already carry their links; only ask GitHub for ones we haven't seen
+		var prURL string
+		if refs, ok := s.store.GetLastPRs(sessionID); ok {
+			for _, r := range refs {
+				if r.Number == prNumber && strings.EqualFold(r.Repository, repo) {
+					prURL = r.URL
+				}
+			}
+		}
+		if prURL == "" {
+			token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+			if strings.TrimSpace(token) == "" {
+				reply := "I need your GitHub connection to look up pull requests. Let's connect GitHub first."
+				return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+			}
+			pr, err := s.mcp.GetPR(ctx, token, repo, prNumber)
+			if err != nil {
+				return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't fetch that pull request from GitHub. Double-check the repo and number?")
+			}
+			prURL = pr.URL
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Here's the link to PR #%d.", prNumber)
+		return reply, &types.IntentResponse{Type: "open_url", Payload: map[string]any{"url": prURL, "repo": repo, "prNumber": prNumber}}, true
+	case "mark_ready":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I mark as ready for review?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to update pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if err := s.mcp.MarkReady(ctx, token, repo, prNumber); err != nil {
+			if errors.Is(err, gh.ErrNotDraft) {
+				s.store.ClearPendingIntent(sessionID)
+				reply := fmt.Sprintf("PR #%d in %s isn't a draft — it's already ready for review.", prNumber, repo)
+				return reply, &types.IntentResponse{Type: "pr_ready", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't mark that pull request as ready on GitHub. Want me to try again?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		s.store.ClearCachedPRs(sessionID)
+		reply := fmt.Sprintf("PR #%d in %s is now ready for review.", prNumber, repo)
+		return reply, &types.IntentResponse{Type: "pr_ready", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+	case "get_pr_status":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I check?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to check pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		st, err := s.mcp.GetPRStatus(ctx, token, repo, prNumber)
+		if err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't get the status of that pull request from GitHub. Double-check the repo and PR number?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := formatStatusReply(prNumber, st)
+		return reply, &types.IntentResponse{Type: "pr_status", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "status": st}}, true
+	case "get_failing_checks":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I check?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to check pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		st, err := s.mcp.GetPRStatus(ctx, token, repo, prNumber)
+		if err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't get the checks for that pull request from GitHub. Double-check the repo and PR number?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		failing := st.FailingChecks
+		if failing == nil {
+			failing = []gh.Check{}
+		}
+		reply := formatFailingChecksReply(prNumber, st)
+		return reply, &types.IntentResponse{Type: "failing_checks", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "failing": failing, "checksPassing": st.ChecksPassing, "checksTotal": st.ChecksTotal}}, true
+	case "rerun_checks":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I re-run the checks on?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to re-run checks. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if err := s.mcp.RerunFailedChecks(ctx, token, repo, prNumber); err != nil {
+			if errors.Is(err, gh.ErrNoFailingChecks) {
+				s.store.ClearPendingIntent(sessionID)
+				reply := fmt.Sprintf("Nothing has failed on PR #%d, so there's nothing to re-run.", prNumber)
+				return reply, &types.IntentResponse{Type: "checks_rerun", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "rerun": false}}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't re-run the checks on GitHub. Want me to try again?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Re-running the failed checks on PR #%d.", prNumber)
+		return reply, &types.IntentResponse{Type: "checks_rerun", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "rerun": true}}, true
+	case "get_pr_reviews":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I check the reviews on?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to check pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		reviews, err := s.mcp.ListReviews(ctx, token, repo, prNumber)
+		if err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't get the reviews for that pull request from GitHub. Double-check the repo and PR number?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		if reviews == nil {
+			reviews = []gh.Review{}
+		}
+		reply := formatReviewsReply(prNumber, reviews)
+		return reply, &types.IntentResponse{Type: "pr_reviews", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reviews": reviews}}, true
+	case "get_pr_diff":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I look at the changes for?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to read pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		diff, err := s.mcp.GetPRDiff(ctx, token, repo, prNumber)
+		if err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't fetch the changes for that pull request from GitHub. Double-check the repo and PR number?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := formatDiffReply(prNumber, diff)
+		return reply, &types.IntentResponse{Type: "pr_diff", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "diff": diff}}, true
+	case "list_pr_commits":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I list the commits for?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to read pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		commits, err := s.mcp.ListPRCommits(ctx, token, repo, prNumber)
+		if err != nil {
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't fetch the commits for that pull request from GitHub. Double-check the repo and PR number?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		if commits == nil {
+			commits = []gh.Commit{}
+		}
+		reply := formatCommitsReply(prNumber, commits)
+		return reply, &types.IntentResponse{Type: "pr_commits", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "commits": commits}}, true
+	case "add_comment":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I comment on?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		body := argString(mergedArgs, "body")
+		if body == "" {
+			mergedArgs["repo"] = repo
+			mergedArgs["pr_number"] = prNumber
+			mergedArgs["awaiting"] = "body"
+			s.store.SetPendingIntent(sessionID, targetType, mergedArgs)
+			return "What should the comment say?", &types.IntentResponse{Type: "clarify", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to comment on pull requests. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		commentID, err := s.mcp.AddComment(ctx, token, repo, prNumber, body)
+		if err != nil {
+			var invalid *gh.ValidationError
+			if errors.As(err, &invalid) {
+				reply := fmt.Sprintf("GitHub rejected that comment: %s.", strings.TrimSuffix(invalid.Message, "."))
+				return reply, &types.IntentResponse{Type: "error"}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't add that comment on GitHub. Want me to try again?")
+		}
+		s.store.SetLastComment(sessionID, repo, prNumber, commentID)
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Added your comment to PR #%d.", prNumber)
+		return reply, &types.IntentResponse{Type: "comment_added", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "body": body}}, true
+	case "undo_comment":
+		last, ok := s.store.GetLastComment(sessionID)
+		if !ok {
+			s.store.ClearPendingIntent(sessionID)
+			return "There's no recent comment of yours to undo.", &types.IntentResponse{Type: "comment_deleted", Payload: map[string]any{"deleted": false}}, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, last.Repository)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to delete comments. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if err := s.mcp.DeleteComment(ctx, token, last.Repository, last.ID); err != nil {
+			if errors.Is(err, gh.ErrCommentNotFound) {
+				s.store.ClearLastComment(sessionID)
+				return "That comment is already gone.", &types.IntentResponse{Type: "comment_deleted", Payload: map[string]any{"deleted": false}}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, last.Repository, 0, "I couldn't delete that comment on GitHub. Want me to try again?")
+		}
+		s.store.ClearLastComment(sessionID)
+		s.store.ClearPendingIntent(sessionID)
+		return "Deleted that comment.", &types.IntentResponse{Type: "comment_deleted", Payload: map[string]any{"deleted": true, "repo": last.Repository, "prNumber": last.PRNumber, "commentId": last.ID}}, true
+	case "reply_to_review":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR is the review comment on?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		reviewID, _ := argInt(mergedArgs, "review_id")
+		body := argString(mergedArgs, "body")
+		if reviewID <= 0 || body == "" {
+			mergedArgs["repo"] = repo
+			mergedArgs["pr_number"] = prNumber
+			s.store.SetPendingIntent(sessionID, targetType, mergedArgs)
+			reply := fmt.Sprintf("Which review comment on PR #%d should I reply to?", prNumber)
+			if reviewID > 0 {
+				reply = "What should the reply say?"
+			}
+			return reply, &types.IntentResponse{Type: "clarify", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to reply to reviews. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		if err := s.mcp.ReplyToReview(ctx, token, repo, prNumber, reviewID, body); err != nil {
+			// A missing review comment isn't a missing PR
+			var notFound *gh.NotFoundError
+			if errors.As(err, &notFound) {
+				reply := fmt.Sprintf("I couldn't find that review comment on PR #%d; it may have been deleted.", prNumber)
+				return reply, &types.IntentResponse{Type: "error"}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't post that reply on GitHub. Want me to try again?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Replied to the review thread on PR #%d.", prNumber)
+		return reply, &types.IntentResponse{Type: "review_reply", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reviewId": reviewID}}, true
+	case "whoami":
+		token := s.getGitHubToken(sessionID)
+		if strings.TrimSpace(token) == "" {
+			reply := "You're not signed in to GitHub yet. Let's connect your account first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		// The login is cached at OAuth time; static tokens have to ask GitHub
+		login := strings.TrimSpace(s.store.GetUsername(sessionID))
+		if login == "" {
+			user, err := s.mcp.GetAuthenticatedUser(ctx, token)
+			if err != nil {
+				return s.githubFailureReply(ctx, sessionID, token, err, "", 0, "I couldn't check which GitHub account you're using just now. Want me to try again?")
+			}
+			login = user.Login
+			s.store.SetUsername(sessionID, login)
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("You're signed in as %s.", login)
+		payload := map[string]any{"login": login}
+		if accounts := s.githubAccounts(ctx, sessionID); len(accounts) > 1 {
+			logins := accountLogins(accounts)
+			reply = fmt.Sprintf("You're signed in as %s, out of %s.", login, joinNames(logins))
+			payload["accounts"] = logins
+		}
+		return reply, &types.IntentResponse{Type: "whoami", Payload: payload}, true
+	case "switch_account":
+		if strings.TrimSpace(s.getGitHubToken(sessionID)) == "" {
+			reply := "You're not signed in to GitHub yet. Let's connect your account first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		accounts := s.githubAccounts(ctx, sessionID)
+		if len(accounts) < 2 {
+			s.store.ClearPendingIntent(sessionID)
+			reply := "You only have one GitHub account connected. Connect another one and I can switch between them."
+			return reply, &types.IntentResponse{Type: "switch_account", Payload: map[string]any{"switched": false, "accounts": accountLogins(accounts)}}, true
+		}
+		logins := accountLogins(accounts)
+		account := strings.TrimPrefix(argString(mergedArgs, "account"), "@")
+		if account == "" {
+			s.store.SetPendingIntent(sessionID, targetType, mergedArgs)
+			reply := fmt.Sprintf("Which account should I switch to: %s?", joinOr(logins))
+			return reply, &types.IntentResponse{Type: "clarify", Payload: map[string]any{"accounts": logins}}, true
+		}
+		login := ""
+		for _, a := range accounts {
+			if strings.EqualFold(a.GitHubOwner, account) {
+				login = a.GitHubOwner
+			}
+		}
+		if login == "" {
+			s.store.ClearPendingIntent(sessionID)
+			reply := fmt.Sprintf("%s isn't connected here. Your accounts are %s.", account, joinNames(logins))
+			return reply, &types.IntentResponse{Type: "switch_account", Payload: map[string]any{"switched": false, "accounts": logins}}, true
+		}
+		if _, err := s.databaseStore.SetDefaultGitHubAuth(sessionID, login); err != nil {
+			logger(ctx).Warn("switch github account failed", "error", err)
+			reply := "I couldn't switch accounts just now. Want me to try again?"
+			return reply, &types.IntentResponse{Type: "error"}, true
+		}
+		s.store.SetUsername(sessionID, login)
+		// Listings like "my PRs" depend on the account
+		s.store.ClearCachedPRs(sessionID)
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Switched to %s. I'll still use your other accounts for their own repos.", login)
+		return reply, &types.IntentResponse{Type: "switch_account", Payload: map[string]any{"switched": true, "login": login, "accounts": logins}}, true
+	case "reset_context":
+		if err := s.resetConversation(sessionID, false); err != nil {
+			logger(ctx).Warn("reset conversation failed", "error", err)
+			reply := "I couldn't clear our conversation just now. Want me to try again?"
+			return reply, &types.IntentResponse{Type: "error"}, true
+		}
+		return "Okay, starting fresh.", &types.IntentResponse{Type: "reset_context"}, true
+	case "suggest_reviewers":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should I find reviewers for?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+		if strings.TrimSpace(token) == "" {
+			reply := "I need your GitHub connection to look up reviewers. Let's connect GitHub first."
+			return reply, &types.IntentResponse{Type: "require_github_auth"}, true
+		}
+		reviewers, err := s.suggestReviewers(ctx, token, repo, prNumber)
+		if err != nil {
+			if errors.Is(err, gh.ErrNoCodeOwners) {
+				s.store.ClearPendingIntent(sessionID)
+				reply := fmt.Sprintf("%s doesn't have a CODEOWNERS file, so I can't suggest reviewers for PR #%d.", repo, prNumber)
+				return reply, &types.IntentResponse{Type: "suggested_reviewers", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reviewers": []string{}}}, true
+			}
+			return s.githubFailureReply(ctx, sessionID, token, err, repo, prNumber, "I couldn't work out reviewers from GitHub right now. Mind trying again in a moment?")
+		}
+		s.store.ClearPendingIntent(sessionID)
+		var reply string
+		if len(reviewers) == 0 {
+			reply = fmt.Sprintf("CODEOWNERS doesn't cover the files changed in PR #%d.", prNumber)
+		} else {
+			reply = fmt.Sprintf("Based on CODEOWNERS, I'd ask %s to review PR #%d.", strings.Join(reviewers, ", "), prNumber)
+		}
+		return reply, &types.IntentResponse{Type: "suggested_reviewers", Payload: map[string]any{"repo": repo, "prNumber": prNumber, "reviewers": reviewers}}, true
+	case "focus_pr":
+		repo, prNumber, clarify, clarifyResp, ok := s.resolvePRTarget(ctx, sessionID, targetType, mergedArgs, "Which repo and PR should we look at?")
+		if !ok {
+			return clarify, clarifyResp, true
+		}
+		s.store.ClearPendingIntent(sessionID)
+		reply := fmt.Sprintf("Okay, let's talk about PR #%d in %s. What would you like to do with it?", prNumber, repo)
+		return reply, &types.IntentResponse{Type: "pr_focused", Payload: map[string]any{"repo": repo, "prNumber": prNumber}}, true
+	case "clarify":
+		// Use LLM-provided playful message
+		msg := strings.TrimSpace(ci.Message)
+		if msg == "" {
+			msg = "Mind giving me a tiny bit more detail? I promise I listen better than your rubber duck."
+		}
+		// Capture any args we already know (transcript mode only uses payload)
+		repo := argString(mergedArgs, "repo")
+		prNumber, _ := argInt(mergedArgs, "pr_number")
+		reviewID, _ := argInt(mergedArgs, "review_id")
+
+		// No slot memory update; transcript carries context
+		payload := map[string]any{}
+		if repo != "" {
+			payload["repo"] = repo
+		}
+		if prNumber > 0 {
+			payload["prNumber"] = prNumber
+		}
+		if reviewID > 0 {
+			payload["reviewId"] = reviewID
+		}
+		// Keep pending intent if any exists so follow-up can merge
+		if pType, pArgs, ok := s.store.GetPendingIntent(sessionID); ok && pType != "" {
+			// Merge any new info into pending and refresh TTL
+			for k, v := range payload {
+				pArgs[k] = v
+			}
+			s.store.SetPendingIntent(sessionID, pType, pArgs)
+		}
+		return msg, &types.IntentResponse{Type: "clarify", Payload: payload}, true
+	case "not_implemented", "unknown":
+		// Treat unknown as not_implemented; use LLM-provided playful message
+		msg := strings.TrimSpace(ci.Message)
+		if msg == "" {
+			msg = "I haven't learned that trick yet — but I'm practicing!"
+		}
+		// Do not carry stale pending intents across unknowns
+		s.store.ClearPendingIntent(sessionID)
+		return msg, &types.IntentResponse{Type: "not_implemented"}, true
+	default:
+		return "", nil, false
+	}
+}
+
+// confirmLowConfidence turns an actionable intent the classifier wasn't sure about into
+// a clarify turn that echoes it back, keeping it pending so a "yes" can complete it.
+// A zero confidence means the model didn't report one and is not downgraded.
+func (s *Server) confirmLowConfidence(sessionID string, ci *gh.ClassifiedIntent) (string, *types.IntentResponse, bool) {
+	switch ci.Type {
+	case "clarify", "not_implemented", "unknown", "":
+		return "", nil, false
+	}
+	if ci.Confidence <= 0 || float64(ci.Confidence) >= s.cfg.IntentConfidenceThreshold {
+		return "", nil, false
+	}
+	s.store.SetPendingIntent(sessionID, ci.Type, ci.Args)
+	reply := fmt.Sprintf("Did you want me to %s? I wasn't totally sure.", describeIntent(ci))
+	payload := map[string]any{"intent": ci.Type, "confidence": ci.Confidence}
+	if repo := argString(ci.Args, "repo"); repo != "" {
+		payload["repo"] = repo
+	}
+	if n, ok := argInt(ci.Args, "pr_number"); ok && n > 0 {
+		payload["prNumber"] = n
+	}
+	return reply, &types.IntentResponse{Type: "clarify", Payload: payload}, true
+}
+
+// describeIntent renders a classified intent as a short phrase for confirmations.
+func describeIntent(ci *gh.ClassifiedIntent) string {
+	var pr string
+	if n, ok := argInt(ci.Args, "pr_number"); ok && n > 0 {
+		pr = fmt.Sprintf("PR %d", n)
+	} else {
+		pr = "that PR"
+	}
+	if repo := argString(ci.Args, "repo"); repo != "" {
+		pr += " in " + repo
+	}
+	switch ci.Type {
+	case "list_prs_mine":
+		return "list your pull requests"
+	case "list_prs_review":
+		return "list the pull requests waiting for your review"
+	case "merge_pr":
+		return "merge " + pr
+	case "merge_approved":
+		return "merge all of your approved pull requests"
+	case "close_pr":
+		return "close " + pr
+	case "reopen_pr":
+		return "reopen " + pr
+	case "get_pr_comments":
+		return "show the comments on " + pr
+	case "assign_reviewers":
+		return "request reviews on " + pr
+	case "add_labels":
+		return "label " + pr
+	case "remove_label":
+		return "remove a label from " + pr
+	case "describe_pr":
+		return "describe " + pr
+	case "open_pr":
+		return "open " + pr + " in your browser"
+	case "mark_ready":
+		return "mark " + pr + " as ready for review"
+	case "get_pr_status":
+		return "check the status of " + pr
+	case "get_failing_checks":
+		return "list the failing checks on " + pr
+	case "rerun_checks":
+		return "re-run the failed checks on " + pr
+	case "get_pr_reviews":
+		return "tell you who reviewed " + pr
+	case "get_pr_diff":
+		return "summarize the changes in " + pr
+	case "list_pr_commits":
+		return "list the commits in " + pr
+	case "add_comment":
+		return "comment on " + pr
+	case "undo_comment":
+		return "delete your last comment"
+	case "reply_to_review":
+		return "reply to a review comment on " + pr
+	case "whoami":
+		return "tell you which GitHub account you're signed in as"
+	case "switch_account":
+		if account := argString(ci.Args, "account"); account != "" {
+			return "switch to your " + account + " GitHub account"
+		}
+		return "switch GitHub accounts"
+	case "reset_context":
+		return "forget our conversation and start over"
+	case "suggest_reviewers":
+		return "suggest reviewers for " + pr
+	case "focus_pr":
+		return "switch to " + pr
+	default:
+		return strings.ReplaceAll(ci.Type, "_", " ")
+	}
+}
+
+// formatStatusReply speaks a PR's approvals, checks and mergeability, naming what's
+// in the way when it can't be merged.
+func formatStatusReply(prNumber int, st gh.Status) string {
+	approvals := fmt.Sprintf("%d approval%s", len(st.Approvals), plural(len(st.Approvals)))
+	checks := "no checks reported"
+	if st.ChecksTotal > 0 {
+		checks = fmt.Sprintf("%d of %d checks passing", st.ChecksPassing, st.ChecksTotal)
+	}
+	if st.Mergeable && !st.HasConflicts {
+		return fmt.Sprintf("PR #%d has %s, %s, and is mergeable.", prNumber, approvals, checks)
+	}
+	var blockers []string
+	if st.HasConflicts {
+		blockers = append(blockers, "it has merge conflicts")
+	}
+	if len(st.FailingCheckIDs) > 0 {
+		blockers = append(blockers, "failing checks: "+joinNames(st.FailingCheckIDs))
+	}
+	reply := fmt.Sprintf("PR #%d has %s, %s, and isn't mergeable yet", prNumber, approvals, checks)
+	if len(blockers) > 0 {
+		reply += " — " + strings.Join(blockers, "; ")
+	}
+	return reply + "."
+}
+
+// formatFailingChecksReply names a PR's failing checks, or says that none are failing.
+func formatFailingChecksReply(prNumber int, st gh.Status) string {
+	if len(st.FailingChecks) == 0 {
+		switch {
+		case st.ChecksTotal == 0:
+			return fmt.Sprintf("PR #%d has no checks reported.", prNumber)
+		case st.ChecksTotal == 1 && st.ChecksPassing == 1:
+			return fmt.Sprintf("The one check on PR #%d is passing.", prNumber)
+		case st.ChecksPassing == st.ChecksTotal:
+			return fmt.Sprintf("All %d checks on PR #%d are passing.", st.ChecksTotal, prNumber)
+		}
+		return fmt.Sprintf("Nothing is failing on PR #%d; %d of %d checks have passed so far.", prNumber, st.ChecksPassing, st.ChecksTotal)
+	}
+	names := make([]string, 0, len(st.FailingChecks))
+	for _, c := range st.FailingChecks {
+		names = append(names, c.Name)
+	}
+	if len(names) == 1 {
+		return fmt.Sprintf("1 check is failing on PR #%d: %s.", prNumber, names[0])
+	}
+	return fmt.Sprintf("%d checks are failing on PR #%d: %s.", len(names), prNumber, joinNames(names))
+}
+
+// formatReviewsReply says where each reviewer landed, in the order they first
+// reviewed: "On PR #5, alice approved and bob requested changes." A later comment
+// doesn't undo someone's approval or change request, as on GitHub.
+func formatReviewsReply(prNumber int, reviews []gh.Review) string {
+	if len(reviews) == 0 {
+		return fmt.Sprintf("Nobody has reviewed PR #%d yet.", prNumber)
+	}
+	var order []string
+	latest := make(map[string]string, len(reviews))
+	for _, r := range reviews {
+		who := r.Reviewer
+		if who == "" {
+			who = "someone"
+		}
+		prev, seen := latest[who]
+		if !seen {
+			order = append(order, who)
+		}
+		if seen && r.State == "COMMENTED" && prev != "COMMENTED" {
+			continue
+		}
+		latest[who] = r.State
+	}
+	parts := make([]string, 0, len(order))
+	for _, who := range order {
+		var verb string
+		switch latest[who] {
+		case "APPROVED":
+			verb = "approved"
+		case "CHANGES_REQUESTED":
+			verb = "requested changes"
+		case "DISMISSED":
+			verb = "had their review dismissed"
+		default:
+			verb = "commented"
+		}
+		parts = append(parts, who+" "+verb)
+	}
+	return fmt.Sprintf("On PR #%d, %s.", prNumber, joinNames(parts))
+}
+
+// diffSummaryTopFiles is how many of the most-changed files a spoken diff summary names.
+const diffSummaryTopFiles = 3
+
+// formatDiffReply gives a spoken overview of a diff: file count, line totals and the
+// most-changed files. Patches themselves are left to the payload.
+func formatDiffReply(prNumber int, diff gh.Diff) string {
+	if diff.FilesChanged == 0 {
+		return fmt.Sprintf("PR #%d doesn't change any files.", prNumber)
+	}
+	files := fmt.Sprintf("%d file%s", diff.FilesChanged, plural(diff.FilesChanged))
+	if diff.Truncated {
+		files = "more than " + files
+	}
+	reply := fmt.Sprintf("PR #%d changes %s, with %d addition%s and %d deletion%s.",
+		prNumber, files, diff.Additions, plural(diff.Additions), diff.Deletions, plural(diff.Deletions))
+
+	top := make([]gh.DiffFile, len(diff.Files))
+	copy(top, diff.Files)
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Additions+top[i].Deletions > top[j].Additions+top[j].Deletions
+	})
+	if len(top) > diffSummaryTopFiles {
+		top = top[:diffSummaryTopFiles]
+	}
+	names := make([]string, 0, len(top))
+	for _, f := range top {
+		n := f.Additions + f.Deletions
+		names = append(names, fmt.Sprintf("%s (%d line%s)", f.Filename, n, plural(n)))
+	}
+	if len(diff.Files) == 1 {
+		return reply + " The file is " + names[0] + "."
+	}
+	return reply + " Most changed: " + joinNames(names) + "."
+}
+
+// spokenCommitLimit is how many commit messages a commits reply reads out.
+const spokenCommitLimit = 3
+
+// formatCommitsReply counts a PR's commits and reads out the first few subject
+// lines, oldest first: "PR #12 has 4 commits: Fix login by alice; ...; and 1 more."
+func formatCommitsReply(prNumber int, commits []gh.Commit) string {
+	if len(commits) == 0 {
+		return fmt.Sprintf("PR #%d has no commits.", prNumber)
+	}
+	reply := fmt.Sprintf("PR #%d has %d commit%s", prNumber, len(commits), plural(len(commits)))
+	spoken := commits
+	if len(spoken) > spokenCommitLimit {
+		spoken = spoken[:spokenCommitLimit]
+	}
+	parts := make([]string, 0, len(spoken))
+	for _, c := range spoken {
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		part := speakableText(subject, spokenCommentChars)
+		if part == "" {
+			part = "(no message)"
+		}
+		if c.Author != "" {
+			part += " by " + c.Author
+		}
+		parts = append(parts, part)
+	}
+	reply += ": " + strings.Join(parts, "; ")
+	if more := len(commits) - len(spoken); more > 0 {
+		return reply + fmt.Sprintf("; and %d more.", more)
+	}
+	return reply + "."
+}
+
+// spokenCommentChars caps how much of one comment's body a spoken reply reads out.
+const spokenCommentChars = 120
+
+// formatCommentsReply reads out the first limit comments, oldest first, telling inline
+// comments ("bob commented on line 42 of server.go") apart from general ones, and
+// says how many more there are. The full comments are left to the payload.
+func formatCommentsReply(repo string, prNumber int, comments []gh.Comment, truncated bool, limit int) string {
+	if len(comments) == 0 {
+		return fmt.Sprintf("There are no comments on PR #%d in %s yet.", prNumber, repo)
+	}
+	count := fmt.Sprintf("%d comment%s", len(comments), plural(len(comments)))
+	if truncated {
+		count = "more than " + count
+	}
+	reply := fmt.Sprintf("PR #%d in %s has %s.", prNumber, repo, count)
+	if limit <= 0 {
+		return reply
+	}
+	spoken := comments
+	if len(spoken) > limit {
+		spoken = spoken[:limit]
+	}
+	parts := make([]string, 0, len(spoken))
+	for _, c := range spoken {
+		parts = append(parts, speakComment(c))
+	}
+	reply += " " + strings.Join(parts, "; ")
+	if more := len(comments) - len(spoken); more > 0 || truncated {
+		if truncated {
+			return reply + "; and more."
+		}
+		return reply + fmt.Sprintf("; and %d more.", more)
+	}
+	return reply + "."
+}
+
+// speakComment phrases one comment as "alice wrote: ...", "bob reviewed: ..." or, for
+// inline comments, "carol commented on line 42 of server.go: ...".
+func speakComment(c gh.Comment) string {
+	who := c.Author
+	if who == "" {
+		who = "someone"
+	}
+	body := speakableText(c.Body, spokenCommentChars)
+	if body == "" {
+		body = "(no text)"
+	}
+	switch c.Type {
+	case "inline":
+		where := "the code"
+		if c.Path != "" {
+			where = path.Base(c.Path)
+			if c.Line > 0 {
+				where = fmt.Sprintf("line %d of %s", c.Line, where)
+			}
+		}
+		return fmt.Sprintf("%s commented on %s: %s", who, where, body)
+	case "review":
+		return fmt.Sprintf("%s reviewed: %s", who, body)
+	}
+	return fmt.Sprintf("%s wrote: %s", who, body)
+}
+
+// speakableText flattens markdown-ish text for reading aloud: code blocks become
+// "(code)", whitespace collapses, and the result is cut at a word boundary near max.
+func speakableText(text string, max int) string {
+	var kept []string
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if !inCode {
+				kept = append(kept, "(code)")
+			}
+			inCode = !inCode
+			continue
+		}
+		if !inCode {
+			kept = append(kept, line)
+		}
+	}
+	out := strings.Join(strings.Fields(strings.Join(kept, " ")), " ")
+	out = strings.TrimRight(out, ".")
+	if r := []rune(out); len(r) > max {
+		cut := string(r[:max])
+		if i := strings.LastIndex(cut, " "); i > 0 {
+			cut = cut[:i]
+		}
+		out = strings.TrimRight(cut, " ,;:") + "..."
+	}
+	return out
+}
+
+// argString reads a string from classifier args, trimmed. Missing or non-string
+// values yield "".
+func argString(args map[string]any, key string) string {
+	v, _ := args[key].(string)
+	return strings.TrimSpace(v)
+}
+
+// argInt reads an integer from classifier args. JSON numbers arrive as float64, the
+// store may hand back int or int64, and the model sometimes quotes numbers ("42",
+// "#42"); all are accepted. Fractional and unparseable values report false.
+func argInt(args map[string]any, key string) (int, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		return n, err == nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(v), "#"))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// describePRRefs names PRs for a spoken choice: "#5 'Fix auth bug' in a/x or #5 in b/y".
+func describePRRefs(refs []store.PRRef) string {
+	names := make([]string, 0, len(refs))
+	for _, r := range refs {
+		name := fmt.Sprintf("#%d", r.Number)
+		if r.Title != "" {
+			name += fmt.Sprintf(" '%s'", r.Title)
+		}
+		names = append(names, name+" in "+r.Repository)
+	}
+	return joinOr(names)
+}
+
+// ordinalWords maps spoken positions to 1-based indexes; negative counts from the end.
+var ordinalWords = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+	"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	"last": -1, "second to last": -2, "penultimate": -2,
+}
+
+// ordinalArg reads the "index" arg: a position in the last listed PRs, given as a
+// number ("2", 2), an ordinal ("2nd", "second") or "last". Positions are 1-based;
+// negative values count from the end of the list.
+func ordinalArg(args map[string]any) (int, bool) {
+	if n, ok := argInt(args, "index"); ok {
+		return n, n != 0
+	}
+	v := strings.ToLower(argString(args, "index"))
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "the "), " one")
+	if n, ok := ordinalWords[v]; ok {
+		return n, true
+	}
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		if strings.HasSuffix(v, suffix) {
+			if n, err := strconv.Atoi(strings.TrimSuffix(v, suffix)); err == nil && n > 0 {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// stringListArg reads a list of strings from classifier args, accepting either a JSON
+// array or a comma-separated string. GitHub usernames lose any leading "@".
+func stringListArg(args map[string]any, key string) []string {
+	var raw []string
+	switch v := args[key].(type) {
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	case []string:
+		raw = v
+	case string:
+		raw = strings.Split(v, ",")
+	}
+	out := make([]string, 0, len(raw))
+	for _, s := range raw {
+		s = strings.TrimPrefix(strings.TrimSpace(s), "@")
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// joinNames renders a list for speech: "alice", "alice and bob", "alice, bob and carol".
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// joinOr renders choices for speech: "a", "a or b", "a, b or c".
+func joinOr(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// resolvePRTarget extracts repo and pr_number for a PR-targeting intent, expanding
+// bare repo names and consulting the focused PR and the last listed PRs. When a
+// slot is still missing or ambiguous it stores the pending intent and returns a
+// clarification with ok=false. A repo outside REPO_ALLOWLIST is refused the same way,
+// with an error response instead of a clarify. A resolved PR becomes the session's focus.
+func (s *Server) resolvePRTarget(ctx context.Context, sessionID, intentType string, args map[string]any, askBoth string) (string, int, string, *types.IntentResponse, bool) {
+	clarify := &types.IntentResponse{Type: "clarify"}
+	repo := argString(args, "repo")
+	prNumber, _ := argInt(args, "pr_number")
+	// "the second one" picks from the last listed PRs
+	if pos, ok := ordinalArg(args); ok && repo == "" && prNumber <= 0 {
+		delete(args, "index")
+		refs, _ := s.store.GetLastPRs(sessionID)
+		if len(refs) == 0 {
+			s.store.SetPendingIntent(sessionID, intentType, args)
+			return "", 0, "I don't have a recent list to pick from. " + askBoth, clarify, false
+		}
+		i := pos - 1
+		if pos < 0 {
+			i = len(refs) + pos
+		}
+		if i < 0 || i >= len(refs) {
+			s.store.SetPendingIntent(sessionID, intentType, args)
+			return "", 0, fmt.Sprintf("I only listed %d pull request(s). Which one did you mean?", len(refs)), clarify, false
+		}
+		repo, prNumber = refs[i].Repository, refs[i].Number
+	}
+	// "the one by alice" picks that author's PR from the last listing
+	if author := strings.TrimPrefix(argString(args, "author"), "@"); author != "" && repo == "" && prNumber <= 0 {
+		delete(args, "author")
+		refs, _ := s.store.GetLastPRs(sessionID)
+		var matches []store.PRRef
+		for _, r := range refs {
+			if strings.EqualFold(r.Author, author) {
+				matches = append(matches, r)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			s.store.SetPendingIntent(sessionID, intentType, args)
+			return "", 0, fmt.Sprintf("I don't see a PR by %s in the last list. %s", author, askBoth), clarify, false
+		case 1:
+			repo, prNumber = matches[0].Repository, matches[0].Number
+		default:
+			s.store.SetPendingIntent(sessionID, intentType, args)
+			return "", 0, fmt.Sprintf("%s has %d PRs in that list. Did you mean %s?", author, len(matches), describePRRefs(matches)), clarify, false
+		}
+	}
+	repo, ambiguous, msg := s.resolveRepo(ctx, sessionID, repo, prNumber)
+	if ambiguous {
+		args["pr_number"] = prNumber
+		s.store.SetPendingIntent(sessionID, intentType, args)
+		return "", 0, msg, clarify, false
+	}
+	// Follow-ups like "merge it" fall back to the focused PR
+	if focus, ok := s.store.GetFocusedPR(sessionID); ok {
+		if repo == "" && prNumber <= 0 {
+			repo, prNumber = focus.Repository, focus.Number
+		} else if prNumber <= 0 && strings.EqualFold(repo, focus.Repository) {
+			prNumber = focus.Number
+		}
+	}
+	// Missing fields clarifications
+	if repo == "" && prNumber <= 0 {
+		s.store.SetPendingIntent(sessionID, intentType, args)
+		return "", 0, askBoth, clarify, false
+	}
+	if repo == "" {
+		s.store.SetPendingIntent(sessionID, intentType, args)
+		return "", 0, fmt.Sprintf("Which repo is PR %d in?", prNumber), clarify, false
+	}
+	if prNumber <= 0 {
+		s.store.SetPendingIntent(sessionID, intentType, args)
+		return "", 0, fmt.Sprintf("Which PR number in %s?", repo), clarify, false
+	}
+	if !s.repoAllowed(repo) {
+		s.store.ClearPendingIntent(sessionID)
+		return "", 0, "I'm not allowed to touch that repo.", &types.IntentResponse{Type: "error", Payload: map[string]any{"repo": repo, "reason": "repo_not_allowed"}}, false
+	}
+	s.store.SetFocusedPR(sessionID, repo, prNumber)
+	return repo, prNumber, "", nil, true
+}
+
+// resolveRepo qualifies the repo a PR-targeting intent names. A bare name gets the
+// signed-in user (or DEFAULT_REPO_OWNER) as owner when that repo exists; otherwise
+// it is looked up among the repos the user can access, where a unique match wins and
+// the same name under several owners sets needsClarify with clarifyMsg asking which
+// one. Names not found either way keep the guessed owner. With
+// no repo, a PR number is looked up in the focused PR and then the last listed PRs;
+// when the number is in several listed repos, needsClarify is set and clarifyMsg
+// asks which one. An unresolvable repo comes back empty.
+func (s *Server) resolveRepo(ctx context.Context, sessionID, repo string, prNumber int) (string, bool, string) {
+	if repo = strings.TrimSpace(repo); repo != "" {
+		// A bare name answering "#5 in a/app or b/api?" means the listed one
+		if prNumber > 0 && !strings.Contains(repo, "/") {
+			if listed, ok := listedRepo(s.listedRefs(sessionID, prNumber), repo); ok {
+				return listed, false, ""
+			}
+		}
+		if !strings.Contains(repo, "/") {
+			owner := strings.TrimSpace(s.store.GetUsername(sessionID))
+			if owner == "" {
+				owner = strings.TrimSpace(s.cfg.DefaultRepoOwner)
+			}
+			// One lookup usually settles it; listing every accessible repo takes pages
+			if owner != "" && s.repoExists(ctx, sessionID, owner+"/"+repo) {
+				return owner + "/" + repo, false, ""
+			}
+			switch owners := s.accessibleRepoOwners(ctx, sessionID, repo); len(owners) {
+			case 0:
+			case 1:
+				return owners[0] + "/" + repo, false, ""
+			default:
+				full := make([]string, len(owners))
+				for i, o := range owners {
+					full[i] = o + "/" + repo
+				}
+				return "", true, fmt.Sprintf("You have access to more than one %s. Did you mean %s?", repo, joinOr(full))
+			}
+			if owner != "" {
+				repo = owner + "/" + repo
+			}
+		}
+		return repo, false, ""
+	}
+	if prNumber <= 0 {
+		return "", false, ""
+	}
+	if focus, ok := s.store.GetFocusedPR(sessionID); ok && focus.Number == prNumber {
+		return focus.Repository, false, ""
+	}
+	matches := s.listedRefs(sessionID, prNumber)
+	switch len(matches) {
+	case 0:
+		return "", false, ""
+	case 1:
+		return matches[0].Repository, false, ""
+	}
+	return "", true, fmt.Sprintf("Did you mean %s?", describePRRefs(matches))
+}
+
+// repoExists reports whether the session's GitHub account can see repo. Only a 404
+// counts as missing; without a token, or when the lookup fails otherwise, it answers
+// true and leaves GitHub to say so when the repo is actually used.
+func (s *Server) repoExists(ctx context.Context, sessionID, repo string) bool {
+	token := s.getGitHubTokenForRepo(ctx, sessionID, repo)
+	if strings.TrimSpace(token) == "" {
+		return true
+	}
+	_, err := s.mcp.GetRepo(ctx, token, repo)
+	var notFound *gh.NotFoundError
+	if errors.As(err, &notFound) {
+		return false
+	}
+	if err != nil {
+		logger(ctx).Warn("look up repo failed", "repo", repo, "error", err)
+	}
+	return true
+}
+
+// accessibleRepoOwners lists the owners of the repos named exactly name that the
+// session's GitHub account can access. Lookup failures are logged and yield none,
+// leaving the caller to guess the owner.
+func (s *Server) accessibleRepoOwners(ctx context.Context, sessionID, name string) []string {
+	token := s.getGitHubToken(sessionID)
+	if strings.TrimSpace(token) == "" {
+		return nil
+	}
+	repos, err := s.mcp.SearchUserRepos(ctx, token, name)
+	if err != nil {
+		logger(ctx).Warn("search user repos failed", "repo", name, "error", err)
+		return nil
+	}
+	var owners []string
+	for _, r := range repos {
+		if strings.EqualFold(r.Name, name) {
+			owners = append(owners, r.Owner)
+		}
+	}
+	return owners
+}
+
+// isRepoAnswer reports whether args answer a pending intent's which-repo question:
+// the pending args have a PR number but no repo, and args name a repo (possibly
+// without its owner) that one of the last listed PRs with that number is in.
+func (s *Server) isRepoAnswer(sessionID string, pending, args map[string]any) bool {
+	prNumber, ok := argInt(pending, "pr_number")
+	if !ok || prNumber <= 0 || argString(pending, "repo") != "" {
+		return false
+	}
+	if n, ok := argInt(args, "pr_number"); ok && n != prNumber {
+		return false
+	}
+	repo := argString(args, "repo")
+	if repo == "" {
+		return false
+	}
+	_, ok = listedRepo(s.listedRefs(sessionID, prNumber), repo)
+	return ok
+}
+
+// listedRefs returns the last listed PRs numbered prNumber.
+func (s *Server) listedRefs(sessionID string, prNumber int) []store.PRRef {
+	refs, _ := s.store.GetLastPRs(sessionID)
+	matches := make([]store.PRRef, 0, 2)
+	for _, r := range refs {
+		if r.Number == prNumber {
+			matches = append(matches, r)
+		}
+	}
+	return matches
+}
+
+// listedRepo picks the repo among refs that repo names, either in full or, when
+// exactly one ref matches, by its name alone ("app" for "me/app").
+func listedRepo(refs []store.PRRef, repo string) (string, bool) {
+	var byName []string
+	for _, r := range refs {
+		if strings.EqualFold(r.Repository, repo) {
+			return r.Repository, true
+		}
+		if _, name, ok := strings.Cut(r.Repository, "/"); ok && !strings.Contains(repo, "/") && strings.EqualFold(name, repo) {
+			byName = append(byName, r.Repository)
+		}
+	}
+	if len(byName) == 1 {
+		return byName[0], true
+	}
+	return "", false
+}
+
+// isAffirmative reports whether a reply to a yes/no question means yes.
+func isAffirmative(message string) bool {
+	switch normalizeReply(message) {
+	case "yes", "yeah", "yep", "yup", "sure", "ok", "okay", "confirm", "confirmed", "do it", "go ahead", "yes please", "yes merge it", "merge it",
+		"yes force", "yes force it", "force it", "force merge", "force merge it", "merge it anyway", "do it anyway", "yes anyway":
+		return true
+	}
+	return false
+}
+
+// isNegative reports whether a reply to a yes/no question means no.
+func isNegative(message string) bool {
+	switch normalizeReply(message) {
+	case "no", "nope", "nah", "cancel", "stop", "don't", "dont", "never mind", "nevermind", "no thanks", "forget it":
+		return true
+	}
+	return false
+}
+
+func normalizeReply(message string) string {
+	m := strings.ReplaceAll(strings.TrimSpace(message), ",", "")
+	return strings.ToLower(strings.Join(strings.Fields(strings.Trim(m, ".!? ")), " "))
+}
+
+// actionKey identifies a destructive action on one PR for duplicate suppression.
+func actionKey(intentType, repo string, prNumber int) string {
+	return fmt.Sprintf("%s:%s#%d", intentType, strings.ToLower(repo), prNumber)
+}
+
+// githubFailureReply phrases a failed GitHub call for speech: a rejected token asks
+// the user to reconnect, and rate limits and a missing or forbidden PR get their own
+// replies. prNumber is 0 for calls that aren't about one PR. Any other error gets
+// fallback; with an empty fallback it is left to the caller and ok is false.
+func (s *Server) githubFailureReply(ctx context.Context, sessionID, token string, err error, repo string, prNumber int, fallback string) (string, *types.IntentResponse, bool) {
+	if reply, resp, ok := s.reauthReply(ctx, sessionID, token, err); ok {
+		return reply, resp, true
+	}
+	if reply, ok := rateLimitReply(err); ok {
+		return reply, &types.IntentResponse{Type: "error"}, true
+	}
+	if prNumber > 0 {
+		if reply, ok := githubErrorReply(err, repo, prNumber); ok {
+			return reply, &types.IntentResponse{Type: "error"}, true
+		}
+	}
+	if fallback == "" {
+		return "", nil, false
+	}
+	return fallback, &types.IntentResponse{Type: "error"}, true
+}
+
+// reauthReply handles a GitHub call that failed because token was revoked or
+// expired: the stored login that token belongs to is forgotten, since every later
+// call with it would fail the same way, and the user is asked to connect GitHub
+// again. The configured token and GitHub App tokens aren't ours to delete.
+func (s *Server) reauthReply(ctx context.Context, sessionID, token string, err error) (string, *types.IntentResponse, bool) {
+	if !gh.IsBadCredentials(err) {
+		return "", nil, false
+	}
+	s.forgetGitHubToken(ctx, sessionID, token)
+	s.store.ClearUsername(sessionID)
+	s.store.ClearCachedPRs(sessionID)
+	s.store.ClearPendingIntent(sessionID)
+	reply := "GitHub isn't accepting my access to your account anymore; it may have been revoked. Let's connect GitHub again."
+	return reply, &types.IntentResponse{Type: "require_github_auth", Payload: map[string]any{"reason": "bad_credentials"}}, true
+}
+
+// forgetGitHubToken deletes the stored login whose access token is token: one of
+// the session's database accounts, or the token file.
+func (s *Server) forgetGitHubToken(ctx context.Context, sessionID, token string) {
+	if strings.TrimSpace(token) == "" {
+		return
+	}
+	for _, a := range s.githubAccounts(ctx, sessionID) {
+		if a.GitHubToken == token {
+			if err := s.databaseStore.DeleteGitHubAccount(sessionID, a.GitHubOwner); err != nil {
+				logger(ctx).Warn("delete revoked github auth failed", "owner", a.GitHubOwner, "error", err)
+			}
+			return
+		}
+	}
+	if tok, err := s.tokenStore.Read(); err == nil && tok != nil && tok.AccessToken == token {
+		if err := s.tokenStore.Clear(); err != nil {
+			logger(ctx).Warn("clear revoked github token failed", "error", err)
+		}
+	}
+}
+
+// rateLimitReply returns a spoken reply when err is a GitHub rate-limit error,
+// so users aren't told to retry immediately.
+func rateLimitReply(err error) (string, bool) {
+	var rl *gh.RateLimitError
+	if !errors.As(err, &rl) {
+		return "", false
+	}
+	mins := 1
+	if !rl.ResetAt.IsZero() {
+		if m := int(math.Ceil(time.Until(rl.ResetAt).Minutes())); m > 1 {
+			mins = m
+		}
+	}
+	if mins == 1 {
+		return "GitHub rate-limited me; I can try again in about a minute.", true
+	}
+	return fmt.Sprintf("GitHub rate-limited me; I can try again in about %d minutes.", mins), true
+}
+
+// githubErrorReply phrases the GitHub failures that read the same for every PR
+// action: the PR can't be found, or the token isn't allowed to touch it.
+func githubErrorReply(err error, repo string, prNumber int) (string, bool) {
+	var notFound *gh.NotFoundError
+	if errors.As(err, &notFound) {
+		return fmt.Sprintf("I couldn't find PR #%d in %s. Double-check the repo and PR number?", prNumber, repo), true
+	}
+	var forbidden *gh.ForbiddenError
+	if errors.As(err, &forbidden) {
+		return fmt.Sprintf("GitHub says you don't have permission to do that on %s. Your token may be missing a scope, or a branch rule may be blocking it.", repo), true
+	}
+	return "", false
+}
+
+func (s *Server) formatPRListReply(kind gh.IntentKind, filter gh.PRFilter, prs []gh.PR) string {
+	filtered := filter != (gh.PRFilter{})
+	// e.g. "merged pull requests in me/app"; "all" has no adjective
+	described := "pull request"
+	if filter.State != "" && filter.State != "all" {
+		described = filter.State + " " + described
+	}
+	where := ""
+	if filter.Repo != "" {
+		where = " in " + filter.Repo
+	}
+	if len(prs) == 0 {
+		switch {
+		case filtered && kind == gh.IntentListReview:
+			return fmt.Sprintf("You have no %ss to review%s.", described, where)
+		case filtered:
+			return fmt.Sprintf("You have no %ss%s.", described, where)
+		case kind == gh.IntentListReview:
+			return "You have no GitHub pull requests to review at the moment."
+		}
+		return "You have no open pull requests on GitHub."
+	}
+	max := 5
 	if len(prs) < max {
 		max = len(prs)
 	}
 	var b strings.Builder
-	if kind == gh.IntentListReview {
+	switch {
+	case filtered && kind == gh.IntentListReview:
+		fmt.Fprintf(&b, "You have %d %s(s) to review%s. ", len(prs), described, where)
+	case filtered:
+		fmt.Fprintf(&b, "You have %d %s(s)%s. ", len(prs), described, where)
+	case kind == gh.IntentListReview:
 		fmt.Fprintf(&b, "You have %d GitHub pull request(s) to review. ", len(prs))
-	} else {
+	default:
 		fmt.Fprintf(&b, "You have %d GitHub pull request(s). ", len(prs))
 	}
 	for i := 0; i < max; i++ {
@@ -713,97 +2442,44 @@ func (s *Server) formatPRListReply(kind gh.IntentKind, prs []gh.PR) string {
 	return b.String()
 }
 
-// ElevenLabs TTS proxy: JSON { text, voiceId? } -> audio/mpeg
+// ElevenLabs TTS proxy: JSON { text, voiceId?, stability?, similarityBoost?, style?,
+// useSpeakerBoost? } -> audio/mpeg
 func (s *Server) handleTTS(w http.ResponseWriter, r *http.Request) {
 	type reqBody struct {
 		Text    string `json:"text"`
 		VoiceID string `json:"voiceId,omitempty"`
+		// Provider forces "elevenlabs" or "openai"; empty prefers ElevenLabs with OpenAI fallback
+		Provider string `json:"provider,omitempty"`
+		voiceSettings
 	}
 	var body reqBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Text) == "" {
 		s.writeError(w, http.StatusBadRequest, "invalid text body")
 		return
 	}
-	if s.cfg.ElevenAPIKey == "" {
-		s.writeError(w, http.StatusBadRequest, "elevenlabs not configured")
-		return
-	}
-
-	// Build ElevenLabs request
-	voiceID := s.cfg.ElevenVoiceID
-	if strings.TrimSpace(body.VoiceID) != "" {
-		voiceID = body.VoiceID
-	}
-	if strings.TrimSpace(voiceID) == "" {
-		s.writeError(w, http.StatusBadRequest, "no elevenlabs voice configured or provided")
+	if err := body.voiceSettings.validate(); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	url := fmt.Sprintf("https://api.elevenlabs.io/v1/text-to-speech/%s/stream", voiceID)
-	payload := map[string]any{
-		"text":     body.Text,
-		"model_id": s.cfg.ElevenModel,
-		"voice_settings": map[string]any{
-			"stability":         0.5,
-			"similarity_boost":  0.7,
-			"style":             0.2,
-			"use_speaker_boost": true,
-		},
-		"optimize_streaming_latency": 4,
-		"output_format":              "mp3_44100_128",
-	}
-	b, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "tts request build failed")
+	provider := strings.ToLower(strings.TrimSpace(body.Provider))
+	if provider != "" && provider != ttsProviderEleven && provider != ttsProviderOpenAI {
+		s.writeError(w, http.StatusBadRequest, "provider must be elevenlabs or openai")
 		return
 	}
-	req.Header.Set("xi-api-key", s.cfg.ElevenAPIKey)
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	audio, used, err := s.synthesize(r.Context(), body.Text, body.VoiceID, provider, body.voiceSettings)
 	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "tts request failed")
-		return
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bb, _ := io.ReadAll(resp.Body)
-		log.Println("elevenlabs error:", string(bb))
+		logger(r.Context()).Error("tts failed", "provider", used, "error", err)
+		if errors.Is(err, errElevenNotConfigured) {
+			s.writeError(w, http.StatusBadRequest, "elevenlabs not configured")
+			return
+		}
 		s.writeError(w, http.StatusBadGateway, "tts error")
 		return
 	}
+	defer audio.Close()
 	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("X-TTS-Provider", used)
 	w.WriteHeader(http.StatusOK)
-	_, _ = io.Copy(w, resp.Body)
-}
-
-// ElevenLabs Voices proxy: GET -> JSON { voices: [...] }
-func (s *Server) handleTTSVoices(w http.ResponseWriter, r *http.Request) {
-	if s.cfg.ElevenAPIKey == "" {
-		s.writeError(w, http.StatusBadRequest, "elevenlabs not configured")
-		return
-	}
-
-	req, err := http.NewRequest("GET", "https://api.elevenlabs.io/v1/voices", nil)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "voices request build failed")
-		return
-	}
-	req.Header.Set("xi-api-key", s.cfg.ElevenAPIKey)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		s.writeError(w, http.StatusBadGateway, "voices request failed")
-		return
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bb, _ := io.ReadAll(resp.Body)
-		log.Println("elevenlabs voices error:", string(bb))
-		s.writeError(w, http.StatusBadGateway, "voices error")
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = io.Copy(w, resp.Body)
+	_, _ = io.Copy(w, audio)
 }
@@ -0,0 +1,1566 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"zana-speech-backend/internal/config"
+	"zana-speech-backend/internal/db"
+	"zana-speech-backend/internal/db/dbtest"
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/github/githubtest"
+	"zana-speech-backend/internal/store"
+	"zana-speech-backend/internal/types"
+)
+
+const testSession = "s_test"
+
+// newTestServer builds a Server around a MemoryStore and the githubtest fakes,
+// skipping NewServer's OpenAI, database and prompt loading. cfg.GitHubToken is
+// what every session authenticates with; leave it empty to exercise the auth gate.
+func newTestServer(t *testing.T, cfg config.Config) (*Server, *githubtest.FakeMCPClient) {
+	t.Helper()
+	if cfg.IntentConfidenceThreshold == 0 {
+		cfg.IntentConfidenceThreshold = 0.5
+	}
+	fake := &githubtest.FakeMCPClient{}
+	s := &Server{
+		store:      store.NewMemoryStore(40),
+		cfg:        cfg,
+		tokenStore: store.NewFileTokenStore(filepath.Join(t.TempDir(), "token.json")),
+		mcp:        fake,
+		intent:     &githubtest.FakeClassifier{},
+		shutdown:   make(chan struct{}),
+	}
+	return s, fake
+}
+
+// turn is one classified user turn and what handleWithArgs should make of it.
+type turn struct {
+	intent string
+	args   map[string]any
+	// confidence defaults to 0.9, comfortably above the threshold
+	confidence float32
+	wantType   string
+	wantReply  string
+}
+
+func TestHandleWithArgs(t *testing.T) {
+	authed := config.Config{GitHubToken: "tok"}
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		setup func(s *Server, f *githubtest.FakeMCPClient)
+		turns []turn
+		// wantCalls lists the fake's PR calls in order, as "Method repo#n"
+		wantCalls []string
+	}{
+		{
+			name: "missing pr number is asked for, then filled in",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "merge_pr", args: map[string]any{"repo": "acme/app"}, wantType: "clarify", wantReply: "Which PR number in acme/app?"},
+				{intent: "clarify", args: map[string]any{"pr_number": float64(5)}, wantType: "merged", wantReply: "acme/app#5"},
+			},
+			wantCalls: []string{"MergePR acme/app#5"},
+		},
+		{
+			name: "missing repo is asked for and merged with the pending pr number",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "get_pr_comments", args: map[string]any{"pr_number": float64(7)}, wantType: "clarify", wantReply: "Which repo is PR 7 in?"},
+				{intent: "get_pr_comments", args: map[string]any{"repo": "acme/app"}, wantType: "show_comments"},
+			},
+			wantCalls: []string{"GetPRComments acme/app#7"},
+		},
+		{
+			name: "a new intent doesn't inherit the pending one's args",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "merge_pr", args: map[string]any{"repo": "acme/app"}, wantType: "clarify"},
+				{intent: "close_pr", args: map[string]any{"pr_number": float64(3)}, wantType: "clarify", wantReply: "Which repo is PR 3 in?"},
+			},
+		},
+		{
+			name: "bare repo name owned twice asks which one",
+			cfg:  authed,
+			setup: func(s *Server, f *githubtest.FakeMCPClient) {
+				f.Repos = []gh.Repo{{Name: "app", Owner: "acme", FullName: "acme/app"}, {Name: "app", Owner: "other", FullName: "other/app"}}
+			},
+			turns: []turn{
+				{intent: "get_pr_comments", args: map[string]any{"repo": "app", "pr_number": float64(2)}, wantType: "clarify", wantReply: "Did you mean acme/app or other/app?"},
+				{intent: "clarify", args: map[string]any{"repo": "other/app"}, wantType: "show_comments"},
+			},
+			wantCalls: []string{"GetPRComments other/app#2"},
+		},
+		{
+			name: "bare repo name owned once is qualified",
+			cfg:  authed,
+			setup: func(s *Server, f *githubtest.FakeMCPClient) {
+				f.Repos = []gh.Repo{{Name: "app", Owner: "acme", FullName: "acme/app"}, {Name: "app-web", Owner: "other", FullName: "other/app-web"}}
+			},
+			turns: []turn{
+				{intent: "get_pr_comments", args: map[string]any{"repo": "app", "pr_number": float64(2)}, wantType: "show_comments"},
+			},
+			wantCalls: []string{"GetPRComments acme/app#2"},
+		},
+		{
+			name: "no github connection asks to connect",
+			turns: []turn{
+				{intent: "merge_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, wantType: "require_github_auth"},
+				{intent: "list_prs_mine", wantType: "require_github_auth"},
+			},
+		},
+		{
+			name: "repo outside the allowlist is refused",
+			cfg:  config.Config{GitHubToken: "tok", RepoAllowlist: []string{"acme/*"}},
+			turns: []turn{
+				{intent: "close_pr", args: map[string]any{"repo": "other/app", "pr_number": float64(1)}, wantType: "error", wantReply: "not allowed"},
+			},
+		},
+		{
+			name: "low confidence is confirmed first",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "close_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(4)}, confidence: 0.2, wantType: "clarify", wantReply: "wasn't totally sure"},
+			},
+		},
+		{
+			name: "follow-ups use the focused pr",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "focus_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(42)}, wantType: "pr_focused", wantReply: "PR #42 in acme/app"},
+				{intent: "get_pr_comments", wantType: "show_comments", wantReply: "PR #42 in acme/app"},
+				{intent: "close_pr", args: map[string]any{"repo": "acme/app"}, wantType: "pr_closed", wantReply: "Closed PR #42 in acme/app"},
+			},
+			wantCalls: []string{"GetPRComments acme/app#42", "ClosePR acme/app#42"},
+		},
+		{
+			name: "focus doesn't carry to another repo",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "focus_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(42)}, wantType: "pr_focused"},
+				{intent: "close_pr", args: map[string]any{"repo": "acme/other"}, wantType: "clarify", wantReply: "Which PR number in acme/other?"},
+			},
+		},
+		{
+			name: "acting on a pr focuses it",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "focus_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(42)}, wantType: "pr_focused"},
+				{intent: "close_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(7)}, wantType: "pr_closed"},
+				{intent: "reopen_pr", wantType: "pr_reopened", wantReply: "#7"},
+			},
+			wantCalls: []string{"ClosePR acme/app#7", "ReopenPR acme/app#7"},
+		},
+		{
+			name: "listing changes the topic",
+			cfg:  authed,
+			turns: []turn{
+				{intent: "focus_pr", args: map[string]any{"repo": "acme/app", "pr_number": float64(42)}, wantType: "pr_focused"},
+				{intent: "list_prs_mine", wantType: "show_prs"},
+				{intent: "close_pr", wantType: "clarify", wantReply: "Which repo and PR should I close?"},
+			},
+		},
+		{
+			name:  "naming the repo completes an ambiguous merge",
+			cfg:   authed,
+			setup: twoListedPR5s,
+			turns: []turn{
+				{intent: "list_prs_mine", wantType: "show_prs"},
+				{intent: "merge_pr", args: map[string]any{"pr_number": float64(5)}, wantType: "clarify", wantReply: "Did you mean"},
+				// "the one in me/app" reads like a focus request to the classifier
+				{intent: "focus_pr", args: map[string]any{"repo": "me/app"}, wantType: "merged", wantReply: "me/app#5"},
+			},
+			wantCalls: []string{"MergePR me/app#5"},
+		},
+		{
+			name:  "repo name without owner completes an ambiguous merge",
+			cfg:   authed,
+			setup: twoListedPR5s,
+			turns: []turn{
+				{intent: "list_prs_mine", wantType: "show_prs"},
+				{intent: "merge_pr", args: map[string]any{"pr_number": float64(5)}, wantType: "clarify", wantReply: "Did you mean"},
+				{intent: "clarify", args: map[string]any{"repo": "api"}, wantType: "merged", wantReply: "me/api#5"},
+			},
+			wantCalls: []string{"MergePR me/api#5"},
+		},
+		{
+			name:  "naming the repo completes ambiguous comments",
+			cfg:   authed,
+			setup: twoListedPR5s,
+			turns: []turn{
+				{intent: "list_prs_mine", wantType: "show_prs"},
+				{intent: "get_pr_comments", args: map[string]any{"pr_number": float64(5)}, wantType: "clarify", wantReply: "Did you mean"},
+				{intent: "unknown", args: map[string]any{"repo": "me/api"}, wantType: "show_comments"},
+			},
+			wantCalls: []string{"GetPRComments me/api#5"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, tc.cfg)
+			if tc.setup != nil {
+				tc.setup(s, fake)
+			}
+			for i, tt := range tc.turns {
+				ci := &gh.ClassifiedIntent{Type: tt.intent, Args: map[string]interface{}{}, Confidence: 0.9}
+				for k, v := range tt.args {
+					ci.Args[k] = v
+				}
+				if tt.confidence > 0 {
+					ci.Confidence = tt.confidence
+				}
+				reply, resp, ok := s.handleWithArgs(context.Background(), testSession, ci)
+				if !ok || resp == nil {
+					t.Fatalf("turn %d: not handled", i)
+				}
+				if resp.Type != tt.wantType {
+					t.Fatalf("turn %d: type = %q, want %q (reply %q)", i, resp.Type, tt.wantType, reply)
+				}
+				if !strings.Contains(reply, tt.wantReply) {
+					t.Errorf("turn %d: reply = %q, want it to contain %q", i, reply, tt.wantReply)
+				}
+			}
+			if got := prCalls(fake); strings.Join(got, ",") != strings.Join(tc.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// twoListedPR5s makes "my PRs" list a #5 in two repos, so "merge 5" is ambiguous.
+func twoListedPR5s(s *Server, f *githubtest.FakeMCPClient) {
+	f.MinePRs = []gh.PR{{Repository: "me/app", Number: 5}, {Repository: "me/api", Number: 5}}
+}
+
+// prCalls renders the fake's PR-targeting calls, ignoring lookups like
+// SearchUserRepos that don't name a PR.
+func prCalls(f *githubtest.FakeMCPClient) []string {
+	var out []string
+	for _, c := range f.Calls() {
+		if c.PRNumber > 0 {
+			out = append(out, c.Method+" "+c.Repo+"#"+strconv.Itoa(c.PRNumber))
+		}
+	}
+	return out
+}
+
+func TestMergeConfirmation(t *testing.T) {
+	ready := gh.Status{Approvals: []string{"bob"}, Mergeable: true, ChecksPassing: 1, ChecksTotal: 1}
+	tests := []struct {
+		name       string
+		intent     *gh.ClassifiedIntent
+		answer     string
+		wantAsk    string
+		wantType   string
+		wantMerges []string
+	}{
+		{
+			name:       "merge_pr confirmed",
+			intent:     &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"repo": "acme/app", "pr_number": float64(5), "merge_method": "squash"}, Confidence: 0.9},
+			answer:     "yes",
+			wantAsk:    "Merge PR #5 in acme/app using squash? Say yes to confirm.",
+			wantType:   "merged",
+			wantMerges: []string{"MergePR acme/app#5"},
+		},
+		{
+			name:     "merge_pr cancelled",
+			intent:   &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]interface{}{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9},
+			answer:   "no",
+			wantAsk:  "Merge PR #5 in acme/app using merge? Say yes to confirm.",
+			wantType: "merge_cancelled",
+		},
+		{
+			name:       "merge_approved confirmed merges only the listed prs",
+			intent:     &gh.ClassifiedIntent{Type: "merge_approved", Args: map[string]interface{}{}, Confidence: 0.9},
+			answer:     "go ahead",
+			wantAsk:    "Merge 2 PRs using merge: acme/app#1 and acme/api#2? Say yes to confirm.",
+			wantType:   "batch_merged",
+			wantMerges: []string{"MergePR acme/app#1", "MergePR acme/api#2"},
+		},
+		{
+			name:     "merge_approved cancelled",
+			intent:   &gh.ClassifiedIntent{Type: "merge_approved", Args: map[string]interface{}{}, Confidence: 0.9},
+			answer:   "cancel",
+			wantAsk:  "Merge 2 PRs using merge: acme/app#1 and acme/api#2? Say yes to confirm.",
+			wantType: "merge_cancelled",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok", RequireMergeConfirmation: true})
+			fake.Status = ready
+			fake.MinePRs = []gh.PR{
+				{Repository: "acme/app", Number: 1},
+				{Repository: "acme/api", Number: 2},
+				{Repository: "acme/web", Number: 3, IsDraft: true},
+			}
+			ctx := context.Background()
+			reply, resp, _ := s.handleWithArgs(ctx, testSession, tc.intent)
+			if resp == nil || resp.Type != "confirm_merge" || reply != tc.wantAsk {
+				t.Fatalf("first turn = %q (%v), want confirm_merge %q", reply, resp, tc.wantAsk)
+			}
+			if n := len(fake.CallsTo("MergePR")); n != 0 {
+				t.Fatalf("merged %d PRs before confirmation", n)
+			}
+			// A PR opened after the question isn't part of what was confirmed
+			fake.MinePRs = append(fake.MinePRs, gh.PR{Repository: "acme/new", Number: 9})
+
+			reply, resp, ok := s.classifyAndHandle(ctx, testSession, tc.answer)
+			if !ok || resp == nil || resp.Type != tc.wantType {
+				t.Fatalf("answer %q = %q (%v), want %s", tc.answer, reply, resp, tc.wantType)
+			}
+			var merges []string
+			for _, c := range fake.CallsTo("MergePR") {
+				merges = append(merges, c.Method+" "+c.Repo+"#"+strconv.Itoa(c.PRNumber))
+			}
+			// Batches merge concurrently
+			sort.Strings(merges)
+			sort.Strings(tc.wantMerges)
+			if strings.Join(merges, ",") != strings.Join(tc.wantMerges, ",") {
+				t.Errorf("merges = %v, want %v", merges, tc.wantMerges)
+			}
+			if _, _, pending := s.store.GetPendingIntent(testSession); pending {
+				t.Error("confirmation still pending after the answer")
+			}
+		})
+	}
+}
+
+func TestMergeApprovedReportsMergeFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantReason string
+	}{
+		{name: "github's message is passed on", err: &gh.ValidationError{APIError: &gh.APIError{Op: "merge", StatusCode: http.StatusUnprocessableEntity, Message: "Required status check \"ci\" is expected."}}, wantReason: `GitHub refused the merge: Required status check "ci" is expected`},
+		{name: "refusal without a message", err: &gh.ConflictError{APIError: &gh.APIError{Op: "merge", StatusCode: http.StatusMethodNotAllowed}}, wantReason: "GitHub refused the merge"},
+		{name: "github unreachable", err: errors.New("dial tcp: connection refused"), wantReason: "couldn't reach GitHub"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Status = gh.Status{Approvals: []string{"carol"}, Mergeable: true}
+			fake.Errors = map[string]error{"MergePR": tc.err}
+
+			results := s.mergeApproved(context.Background(), testSession, []gh.PR{{Repository: "acme/app", Number: 5}}, "merge")
+			if len(results) != 1 || results[0].Merged || results[0].Reason != tc.wantReason {
+				t.Fatalf("results = %+v, want reason %q", results, tc.wantReason)
+			}
+			if summary := summarizeBatchMerge(results); !strings.Contains(summary, "acme/app#5 ("+tc.wantReason+")") {
+				t.Errorf("summary = %q, want the reason", summary)
+			}
+		})
+	}
+}
+
+func TestMergeApprovedUsesEachRepoOwnersToken(t *testing.T) {
+	s, fake := newTestServer(t, config.Config{})
+	s.databaseStore = store.NewDatabaseStore(dbtest.New(t), 40)
+	// The last one saved, alice, is the default
+	for _, a := range []struct{ owner, token string }{{"bob", "gho_bob"}, {"alice", "gho_alice"}} {
+		if err := s.databaseStore.SaveGitHubAuth(testSession, a.token, a.owner, "", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.Status = gh.Status{Approvals: []string{"carol"}, Mergeable: true}
+	fake.MinePRs = []gh.PR{
+		{Repository: "alice/app", Number: 1},
+		{Repository: "bob/lib", Number: 2},
+		{Repository: "acme/web", Number: 3},
+	}
+
+	if _, resp := handle(t, s, "merge_approved", nil); resp.Type != "batch_merged" {
+		t.Fatalf("type = %s, want batch_merged", resp.Type)
+	}
+	want := map[string]string{"alice/app": "gho_alice", "bob/lib": "gho_bob", "acme/web": "gho_alice"}
+	for _, method := range []string{"GetPRStatus", "MergePR"} {
+		calls := fake.CallsTo(method)
+		if len(calls) != len(want) {
+			t.Fatalf("%d %s calls, want %d", len(calls), method, len(want))
+		}
+		for _, c := range calls {
+			if c.Token != want[c.Repo] {
+				t.Errorf("%s %s used %q, want %q", method, c.Repo, c.Token, want[c.Repo])
+			}
+		}
+	}
+}
+
+func TestResolveRepo(t *testing.T) {
+	repos := func(full ...string) []gh.Repo {
+		out := make([]gh.Repo, len(full))
+		for i, f := range full {
+			owner, name, _ := strings.Cut(f, "/")
+			out[i] = gh.Repo{FullName: f, Owner: owner, Name: name}
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		username    string
+		repos       []gh.Repo
+		repo        string
+		want        string
+		wantClarify string
+		wantSearch  bool
+	}{
+		{name: "own repo is used without searching", username: "acme", repos: repos("acme/app", "other/app"), repo: "app", want: "acme/app"},
+		{name: "qualified name is kept", username: "acme", repos: repos("other/app"), repo: "other/app", want: "other/app"},
+		{name: "unique match elsewhere", username: "acme", repos: repos("other/app", "other/app-web"), repo: "app", want: "other/app", wantSearch: true},
+		{name: "ambiguous match elsewhere", username: "acme", repos: repos("one/app", "two/app"), repo: "app", wantClarify: "Did you mean one/app or two/app?", wantSearch: true},
+		{name: "ambiguous without a known owner", repos: repos("one/app", "two/app"), repo: "app", wantClarify: "Did you mean one/app or two/app?", wantSearch: true},
+		{name: "no match keeps the guessed owner", username: "acme", repo: "app", want: "acme/app", wantSearch: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Repos = tc.repos
+			if tc.username != "" {
+				s.store.SetUsername(testSession, tc.username)
+			}
+			got, ambiguous, msg := s.resolveRepo(context.Background(), testSession, tc.repo, 0)
+			if tc.wantClarify != "" {
+				if !ambiguous || !strings.Contains(msg, tc.wantClarify) {
+					t.Fatalf("got (%q, %v, %q), want clarification %q", got, ambiguous, msg, tc.wantClarify)
+				}
+			} else if ambiguous || got != tc.want {
+				t.Fatalf("got (%q, %v, %q), want %q", got, ambiguous, msg, tc.want)
+			}
+			if searched := len(fake.CallsTo("SearchUserRepos")) > 0; searched != tc.wantSearch {
+				t.Errorf("searched = %v, want %v", searched, tc.wantSearch)
+			}
+		})
+	}
+}
+
+func TestRepeatedActions(t *testing.T) {
+	tests := []struct {
+		intent    string
+		method    string
+		wantCalls int
+		// wantSecond is a prefix of the reply to the repeat
+		wantSecond string
+	}{
+		// A double-sent merge or close is suppressed
+		{intent: "merge_pr", method: "MergePR", wantCalls: 1, wantSecond: "I just merged that one."},
+		{intent: "close_pr", method: "ClosePR", wantCalls: 1, wantSecond: "I just closed that one."},
+		// Re-running checks is harmless to repeat and often wanted
+		{intent: "rerun_checks", method: "RerunFailedChecks", wantCalls: 2, wantSecond: "Re-running the failed checks on PR #5."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.intent, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			ctx := context.Background()
+			var reply string
+			for i := 0; i < 2; i++ {
+				reply, _, _ = s.handleWithArgs(ctx, testSession, &gh.ClassifiedIntent{
+					Type:       tc.intent,
+					Args:       map[string]any{"repo": "acme/app", "pr_number": float64(5)},
+					Confidence: 0.9,
+				})
+			}
+			if n := len(fake.CallsTo(tc.method)); n != tc.wantCalls {
+				t.Errorf("%s called %d times, want %d", tc.method, n, tc.wantCalls)
+			}
+			if !strings.HasPrefix(reply, tc.wantSecond) {
+				t.Errorf("second reply = %q, want %q", reply, tc.wantSecond)
+			}
+		})
+	}
+}
+
+// handle runs one confidently classified intent for testSession.
+func handle(t *testing.T, s *Server, intent string, args map[string]any) (string, *types.IntentResponse) {
+	t.Helper()
+	reply, resp, ok := s.handleWithArgs(context.Background(), testSession, &gh.ClassifiedIntent{Type: intent, Args: args, Confidence: 0.9})
+	if !ok {
+		t.Fatalf("%s was not handled", intent)
+	}
+	return reply, resp
+}
+
+func TestClosePR(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      map[string]any
+		err       error
+		wantType  string
+		wantReply string
+		wantClose []string
+	}{
+		{
+			name:      "closes without merging",
+			args:      map[string]any{"repo": "me/proj", "pr_number": float64(88)},
+			wantType:  "pr_closed",
+			wantReply: "Closed PR #88 in me/proj without merging.",
+			wantClose: []string{"ClosePR me/proj#88"},
+		},
+		{
+			name:      "asks for the pr",
+			args:      map[string]any{"repo": "me/proj"},
+			wantType:  "clarify",
+			wantReply: "Which PR number in me/proj?",
+		},
+		{
+			name:      "github refuses",
+			args:      map[string]any{"repo": "me/proj", "pr_number": float64(88)},
+			err:       &gh.ForbiddenError{APIError: &gh.APIError{Op: "close pr", StatusCode: 403, Message: "Must have admin rights"}},
+			wantType:  "error",
+			wantReply: "GitHub says you don't have permission to do that on me/proj.",
+			wantClose: []string{"ClosePR me/proj#88"},
+		},
+		{
+			name:      "github fails",
+			args:      map[string]any{"repo": "me/proj", "pr_number": float64(88)},
+			err:       &gh.APIError{Op: "close pr", StatusCode: 502, Message: "Server Error"},
+			wantType:  "error",
+			wantReply: "I couldn't close the pull request on GitHub.",
+			wantClose: []string{"ClosePR me/proj#88"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Errors = map[string]error{"ClosePR": tc.err}
+			s.store.SetCachedPRs(testSession, "mine", []gh.PR{{Number: 88, Repository: "me/proj"}})
+
+			reply, resp := handle(t, s, "close_pr", tc.args)
+			if resp.Type != tc.wantType || !strings.HasPrefix(reply, tc.wantReply) {
+				t.Errorf("got %s %q, want %s %q", resp.Type, reply, tc.wantType, tc.wantReply)
+			}
+			var closes []string
+			for _, c := range prCalls(fake) {
+				if strings.HasPrefix(c, "ClosePR ") {
+					closes = append(closes, c)
+				}
+			}
+			if strings.Join(closes, ",") != strings.Join(tc.wantClose, ",") {
+				t.Errorf("close calls = %v, want %v", closes, tc.wantClose)
+			}
+			// A closed PR drops out of the cached listings
+			_, cached := s.store.GetCachedPRs(testSession, "mine")
+			if cached != (tc.wantType != "pr_closed") {
+				t.Errorf("cached listing kept = %v after %s", cached, tc.wantType)
+			}
+		})
+	}
+}
+
+func TestGitHubFailureReplies(t *testing.T) {
+	pr := map[string]any{"repo": "me/proj", "pr_number": float64(88)}
+	with := func(k string, v any) map[string]any {
+		args := map[string]any{k: v}
+		for k, v := range pr {
+			args[k] = v
+		}
+		return args
+	}
+	intents := []struct {
+		intent   string
+		method   string
+		args     map[string]any
+		fallback string
+	}{
+		{"close_pr", "ClosePR", pr, "I couldn't close the pull request on GitHub."},
+		{"reopen_pr", "ReopenPR", pr, "I couldn't reopen the pull request on GitHub."},
+		{"describe_pr", "GetPR", pr, "I couldn't fetch that pull request from GitHub."},
+		{"mark_ready", "MarkReady", pr, "I couldn't mark that pull request as ready on GitHub."},
+		{"get_pr_diff", "GetPRDiff", pr, "I couldn't fetch the changes for that pull request from GitHub."},
+		{"add_labels", "AddLabels", with("labels", []any{"bug"}), "I couldn't add those labels on GitHub."},
+		{"remove_label", "RemoveLabel", with("label", "bug"), "I couldn't remove that label on GitHub."},
+		{"assign_reviewers", "RequestReviewers", with("reviewers", []any{"bob"}), "I couldn't request those reviews on GitHub."},
+		{"reply_to_review", "ReplyToReview", with("review_id", float64(7)), "I couldn't post that reply on GitHub."},
+	}
+	failures := []struct {
+		name      string
+		err       error
+		wantType  string
+		wantReply string
+	}{
+		{name: "revoked token", err: &gh.UnauthorizedError{APIError: &gh.APIError{StatusCode: 401, Message: "Bad credentials"}}, wantType: "require_github_auth", wantReply: "GitHub isn't accepting my access"},
+		{name: "rate limited", err: &gh.RateLimitError{}, wantType: "error", wantReply: "GitHub rate-limited me"},
+		{name: "forbidden", err: &gh.ForbiddenError{APIError: &gh.APIError{StatusCode: 403, Message: "Resource not accessible by integration"}}, wantType: "error", wantReply: "GitHub says you don't have permission to do that on me/proj."},
+		{name: "not found", err: &gh.NotFoundError{APIError: &gh.APIError{StatusCode: 404, Message: "Not Found"}}, wantType: "error", wantReply: "I couldn't find PR #88 in me/proj."},
+		{name: "server error", err: &gh.APIError{StatusCode: 502, Message: "Server Error"}, wantType: "error"},
+	}
+	for _, in := range intents {
+		for _, f := range failures {
+			t.Run(in.intent+"/"+f.name, func(t *testing.T) {
+				s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+				fake.Errors = map[string]error{in.method: f.err}
+				args := make(map[string]any, len(in.args))
+				for k, v := range in.args {
+					args[k] = v
+				}
+				args["body"] = "done"
+
+				want := f.wantReply
+				switch {
+				case want == "":
+					want = in.fallback
+				case f.name == "not found" && in.intent == "reply_to_review":
+					// The review comment is what's missing, not the PR
+					want = "I couldn't find that review comment on PR #88"
+				}
+				reply, resp := handle(t, s, in.intent, args)
+				if resp.Type != f.wantType || !strings.HasPrefix(reply, want) {
+					t.Errorf("got %s %q, want %s %q", resp.Type, reply, f.wantType, want)
+				}
+				if len(fake.CallsTo(in.method)) != 1 {
+					t.Errorf("%s called %d times, want once", in.method, len(fake.CallsTo(in.method)))
+				}
+			})
+		}
+	}
+}
+
+func TestSuggestReviewersIntent(t *testing.T) {
+	tests := []struct {
+		name          string
+		codeOwners    string
+		err           error
+		wantReply     string
+		wantReviewers []string
+	}{
+		{name: "owners of changed files", codeOwners: "* @core\n*.go @gopher\n/docs/ @writer\n", wantReply: "Based on CODEOWNERS, I'd ask @gopher, @writer to review PR #5.", wantReviewers: []string{"@gopher", "@writer"}},
+		{name: "no rule covers the files", codeOwners: "/web/ @frontend\n", wantReply: "CODEOWNERS doesn't cover the files changed in PR #5.", wantReviewers: []string{}},
+		{name: "no CODEOWNERS file", err: gh.ErrNoCodeOwners, wantReply: "acme/app doesn't have a CODEOWNERS file, so I can't suggest reviewers for PR #5.", wantReviewers: []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.CodeOwners = tc.codeOwners
+			fake.Errors = map[string]error{"GetCodeOwners": tc.err}
+			fake.Diff = gh.Diff{Files: []gh.DiffFile{{Filename: "server/main.go"}, {Filename: "docs/setup.md"}}}
+
+			reply, resp := handle(t, s, "suggest_reviewers", map[string]any{"repo": "acme/app", "pr_number": float64(5)})
+			if resp.Type != "suggested_reviewers" || reply != tc.wantReply {
+				t.Errorf("got %s %q, want suggested_reviewers %q", resp.Type, reply, tc.wantReply)
+			}
+			if got := resp.Payload["reviewers"]; !reflect.DeepEqual(got, tc.wantReviewers) {
+				t.Errorf("reviewers = %#v, want %#v", got, tc.wantReviewers)
+			}
+			if n := len(fake.CallsTo("RequestReviewers")); n != 0 {
+				t.Errorf("suggesting requested %d reviews", n)
+			}
+		})
+	}
+}
+
+func TestResetClearsFocus(t *testing.T) {
+	s, _ := newTestServer(t, config.Config{GitHubToken: "tok"})
+	handle(t, s, "focus_pr", map[string]any{"repo": "acme/app", "pr_number": float64(42)})
+	if f, ok := s.store.GetFocusedPR(testSession); !ok || f.Number != 42 {
+		t.Fatalf("focus = %+v, %v", f, ok)
+	}
+	if err := s.resetConversation(testSession, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.store.GetFocusedPR(testSession); ok {
+		t.Error("focus survived a reset")
+	}
+	if reply, resp := handle(t, s, "merge_pr", nil); resp.Type != "clarify" {
+		t.Errorf("merge after reset = %s %q, want a clarify", resp.Type, reply)
+	}
+}
+
+func TestConfirmLowConfidence(t *testing.T) {
+	merge := map[string]any{"repo": "acme/app", "pr_number": float64(5)}
+	tests := []struct {
+		name       string
+		intent     string
+		args       map[string]any
+		confidence float32
+		threshold  float64
+		// wantReply is the confirmation asked for; "" means the intent is acted on
+		wantReply string
+	}{
+		{name: "low confidence merge", intent: "merge_pr", args: merge, confidence: 0.3, wantReply: "Did you want me to merge PR 5 in acme/app? I wasn't totally sure."},
+		{name: "just under a custom threshold", intent: "merge_pr", args: merge, confidence: 0.79, threshold: 0.8, wantReply: "Did you want me to merge PR 5 in acme/app? I wasn't totally sure."},
+		{name: "without a pr number", intent: "close_pr", args: map[string]any{"repo": "acme/app"}, confidence: 0.1, wantReply: "Did you want me to close that PR in acme/app? I wasn't totally sure."},
+		{name: "at the threshold", intent: "merge_pr", args: merge, confidence: 0.5},
+		{name: "no confidence reported", intent: "merge_pr", args: merge},
+		{name: "clarify is never second-guessed", intent: "clarify", confidence: 0.1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t, config.Config{GitHubToken: "tok", IntentConfidenceThreshold: tc.threshold})
+			ci := &gh.ClassifiedIntent{Type: tc.intent, Args: tc.args, Confidence: tc.confidence}
+			reply, resp, ok := s.confirmLowConfidence(testSession, ci)
+			if ok != (tc.wantReply != "") {
+				t.Fatalf("confirmLowConfidence = %q, %v", reply, ok)
+			}
+			if !ok {
+				if _, _, pending := s.store.GetPendingIntent(testSession); pending {
+					t.Error("acted-on intent left a pending intent")
+				}
+				return
+			}
+			if reply != tc.wantReply || resp.Type != "clarify" || resp.Payload["intent"] != tc.intent {
+				t.Errorf("got %s %q %v, want clarify %q", resp.Type, reply, resp.Payload, tc.wantReply)
+			}
+			typ, args, pending := s.store.GetPendingIntent(testSession)
+			if !pending || typ != tc.intent || !reflect.DeepEqual(args, tc.args) {
+				t.Errorf("pending = %q %v %v, want %q %v", typ, args, pending, tc.intent, tc.args)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	// A closed pool fails every ping without needing a Postgres to talk to
+	closed, err := sql.Open("postgres", "postgres://health.invalid/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		database *db.DB
+		key      string
+		wantCode int
+		want     map[string]string
+	}{
+		{name: "no database", key: "sk-test", wantCode: http.StatusOK, want: map[string]string{"status": "ok", "database": "not_configured", "openai": "configured"}},
+		{name: "no openai key", wantCode: http.StatusOK, want: map[string]string{"status": "degraded", "database": "not_configured", "openai": "missing_key"}},
+		{name: "database down", database: &db.DB{DB: closed}, key: "sk-test", wantCode: http.StatusServiceUnavailable, want: map[string]string{"status": "down", "database": "down", "openai": "configured"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t, config.Config{OpenAIAPIKey: tc.key})
+			s.database = tc.database
+
+			rec := httptest.NewRecorder()
+			s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("body = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// recordingClassifier is a gh.Classifier stub that remembers the chat it was given.
+type recordingClassifier struct {
+	ci   *gh.ClassifiedIntent
+	err  error
+	chat []openai.ChatCompletionMessage
+}
+
+func (c *recordingClassifier) ClassifyChat(ctx context.Context, chat []openai.ChatCompletionMessage) (*gh.ClassifiedIntent, error) {
+	c.chat = chat
+	return c.ci, c.err
+}
+
+func TestClassifierIsPluggable(t *testing.T) {
+	stub := &recordingClassifier{ci: &gh.ClassifiedIntent{Type: "list_prs_review", Args: map[string]any{}, Confidence: 0.9}}
+	tests := []struct {
+		name       string
+		classifier gh.Classifier
+		message    string
+		wantType   string
+		wantCalls  []string
+	}{
+		{name: "stub decides the intent", classifier: stub, message: "anything at all", wantType: "show_prs", wantCalls: []string{"ListPRs list_prs_review"}},
+		{name: "rules classifier lists my prs", classifier: gh.RulesClassifier{}, message: "show my PRs", wantType: "show_prs", wantCalls: []string{"ListPRs list_prs_mine"}},
+		{name: "rules classifier leaves chat to the model", classifier: gh.RulesClassifier{}, message: "how are you?"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			s.intent = tc.classifier
+			s.appendMessage(testSession, store.Message{Role: "assistant", Content: "Hi, what can I do?"})
+			s.appendMessage(testSession, store.Message{Role: "user", Content: tc.message})
+
+			_, resp, ok := s.classifyAndHandle(context.Background(), testSession, tc.message)
+			if ok != (tc.wantType != "") {
+				t.Fatalf("handled = %v, want %v", ok, tc.wantType != "")
+			}
+			if ok && resp.Type != tc.wantType {
+				t.Errorf("type = %q, want %q", resp.Type, tc.wantType)
+			}
+			var calls []string
+			for _, c := range fake.Calls() {
+				calls = append(calls, fmt.Sprintf("%s %s", c.Method, c.Args[0]))
+			}
+			if !reflect.DeepEqual(calls, tc.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tc.wantCalls)
+			}
+		})
+	}
+	// The classifier sees the conversation, not just the latest message
+	if n := len(stub.chat); n < 2 || stub.chat[n-1].Content != "anything at all" || stub.chat[n-2].Content != "Hi, what can I do?" {
+		t.Errorf("stub classified %+v, want the session history", stub.chat)
+	}
+}
+
+func TestGetGitHubTokenUsesAppInstallation(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	tests := []struct {
+		name      string
+		fileToken string
+		status    int
+		want      string
+		wantMints int32
+	}{
+		{name: "installation token beats the configured one", want: "ghs_app", wantMints: 1},
+		{name: "oauth login beats the installation", fileToken: "gho_user", want: "gho_user"},
+		{name: "failed mint falls back to config", status: http.StatusUnauthorized, want: "ghp_config", wantMints: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mints atomic.Int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/app/installations/42/access_tokens" {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				mints.Add(1)
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"token": "ghs_app", "expires_at": time.Now().Add(time.Hour)})
+			}))
+			defer ts.Close()
+
+			s, _ := newTestServer(t, config.Config{GitHubToken: "ghp_config", GitHubTimeout: 5 * time.Second})
+			src, err := gh.NewAppTokenSource("123", 42, keyPEM, gh.WithBaseURL(ts.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.appTokens = src
+			if tc.fileToken != "" {
+				if err := s.tokenStore.Write(&store.GitHubToken{AccessToken: tc.fileToken}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Twice: a minted token is reused, a failed mint is retried
+			for i := 0; i < 2; i++ {
+				if got := s.getGitHubToken(testSession); got != tc.want {
+					t.Fatalf("call %d: token = %q, want %q", i, got, tc.want)
+				}
+			}
+			if got := mints.Load(); got != tc.wantMints {
+				t.Errorf("minted %d times, want %d", got, tc.wantMints)
+			}
+		})
+	}
+}
+
+func TestBadCredentialsForgetsOnlyTheRejectedLogin(t *testing.T) {
+	revoked := &gh.UnauthorizedError{APIError: &gh.APIError{Op: "list prs", StatusCode: 401, Message: "Bad credentials"}}
+	tests := []struct {
+		name      string
+		fileToken string
+		// rejected is the token GitHub refused; empty means whichever the listing used
+		rejected      string
+		wantFileToken string
+		wantToken     string
+	}{
+		{name: "stored login is forgotten", fileToken: "gho_user", wantToken: "ghp_config"},
+		{name: "configured token is left alone", wantToken: "ghp_config"},
+		{name: "another login's token is kept", fileToken: "gho_user", rejected: "gho_stale", wantFileToken: "gho_user", wantToken: "gho_user"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "ghp_config"})
+			if tc.fileToken != "" {
+				if err := s.tokenStore.Write(&store.GitHubToken{AccessToken: tc.fileToken}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.store.SetUsername(testSession, "alice")
+
+			var reply string
+			var resp *types.IntentResponse
+			if tc.rejected == "" {
+				fake.Errors = map[string]error{"ListPRs": revoked}
+				reply, resp = handle(t, s, "list_prs_mine", nil)
+			} else {
+				var ok bool
+				reply, resp, ok = s.reauthReply(context.Background(), testSession, tc.rejected, revoked)
+				if !ok {
+					t.Fatal("bad credentials not handled")
+				}
+			}
+			if resp.Type != "require_github_auth" || !strings.Contains(reply, "connect GitHub again") {
+				t.Errorf("got %s %q, want require_github_auth", resp.Type, reply)
+			}
+			if s.store.GetUsername(testSession) != "" {
+				t.Error("username kept after the token was rejected")
+			}
+			var fileToken string
+			if tok, err := s.tokenStore.Read(); err == nil && tok != nil {
+				fileToken = tok.AccessToken
+			}
+			if fileToken != tc.wantFileToken {
+				t.Errorf("token file holds %q, want %q", fileToken, tc.wantFileToken)
+			}
+			if got := s.getGitHubToken(testSession); got != tc.wantToken {
+				t.Errorf("token afterwards = %q, want %q", got, tc.wantToken)
+			}
+		})
+	}
+}
+
+func TestListPRCommitsIntent(t *testing.T) {
+	commits := []gh.Commit{
+		{SHA: "a1", Message: "Add login\n\nWith tests", Author: "alice"},
+		{SHA: "b2", Message: "Fix typo", Author: "Bob B"},
+		{SHA: "c3", Message: "", Author: ""},
+		{SHA: "d4", Message: "Bump deps", Author: "carol"},
+	}
+	tests := []struct {
+		name      string
+		commits   []gh.Commit
+		wantReply string
+	}{
+		{name: "first few read out", commits: commits, wantReply: "PR #12 has 4 commits: Add login by alice; Fix typo by Bob B; (no message); and 1 more."},
+		{name: "one commit", commits: commits[:1], wantReply: "PR #12 has 1 commit: Add login by alice."},
+		{name: "none", wantReply: "PR #12 has no commits."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Commits = tc.commits
+			reply, resp := handle(t, s, "list_pr_commits", map[string]any{"repo": "acme/app", "pr_number": float64(12)})
+			if resp.Type != "pr_commits" || reply != tc.wantReply {
+				t.Errorf("got %s %q, want pr_commits %q", resp.Type, reply, tc.wantReply)
+			}
+			if got := resp.Payload["commits"].([]gh.Commit); len(got) != len(tc.commits) {
+				t.Errorf("payload commits = %v, want all %d", got, len(tc.commits))
+			}
+			if got := prCalls(fake); strings.Join(got, ",") != "ListPRCommits acme/app#12" {
+				t.Errorf("calls = %v", got)
+			}
+		})
+	}
+}
+
+func TestGetPRReviewsIntent(t *testing.T) {
+	tests := []struct {
+		name      string
+		reviews   []gh.Review
+		wantReply string
+	}{
+		{
+			name:      "one state per reviewer",
+			reviews:   []gh.Review{{Reviewer: "alice", State: "APPROVED"}, {Reviewer: "bob", State: "CHANGES_REQUESTED"}, {Reviewer: "dave", State: "COMMENTED"}},
+			wantReply: "On PR #5, alice approved, bob requested changes and dave commented.",
+		},
+		{
+			name:      "a later comment keeps the approval",
+			reviews:   []gh.Review{{Reviewer: "alice", State: "APPROVED"}, {Reviewer: "alice", State: "COMMENTED"}},
+			wantReply: "On PR #5, alice approved.",
+		},
+		{
+			name:      "a later verdict replaces the earlier one",
+			reviews:   []gh.Review{{Reviewer: "bob", State: "CHANGES_REQUESTED"}, {Reviewer: "alice", State: "COMMENTED"}, {Reviewer: "bob", State: "APPROVED"}},
+			wantReply: "On PR #5, bob approved and alice commented.",
+		},
+		{
+			name:      "dismissed",
+			reviews:   []gh.Review{{Reviewer: "erin", State: "DISMISSED"}},
+			wantReply: "On PR #5, erin had their review dismissed.",
+		},
+		{name: "none", wantReply: "Nobody has reviewed PR #5 yet."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Reviews = tc.reviews
+			reply, resp := handle(t, s, "get_pr_reviews", map[string]any{"repo": "acme/app", "pr_number": float64(5)})
+			if resp.Type != "pr_reviews" || reply != tc.wantReply {
+				t.Errorf("got %s %q, want pr_reviews %q", resp.Type, reply, tc.wantReply)
+			}
+			if got := resp.Payload["reviews"].([]gh.Review); len(got) != len(tc.reviews) {
+				t.Errorf("payload reviews = %v, want all %d", got, len(tc.reviews))
+			}
+		})
+	}
+}
+
+func TestGetPRStatusIntent(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    gh.Status
+		wantReply string
+	}{
+		{
+			name:      "ready",
+			status:    gh.Status{ChecksPassing: 3, ChecksTotal: 3, Approvals: []string{"alice"}, Mergeable: true},
+			wantReply: "PR #5 has 1 approval, 3 of 3 checks passing, and is mergeable.",
+		},
+		{
+			name:      "no checks",
+			status:    gh.Status{Approvals: []string{"alice", "bob"}, Mergeable: true},
+			wantReply: "PR #5 has 2 approvals, no checks reported, and is mergeable.",
+		},
+		{
+			name:      "conflicts and failing checks",
+			status:    gh.Status{ChecksPassing: 1, ChecksTotal: 3, HasConflicts: true, FailingCheckIDs: []string{"lint", "test"}},
+			wantReply: "PR #5 has 0 approvals, 1 of 3 checks passing, and isn't mergeable yet — it has merge conflicts; failing checks: lint and test.",
+		},
+		{
+			name:      "mergeability not known yet",
+			status:    gh.Status{ChecksPassing: 2, ChecksTotal: 2},
+			wantReply: "PR #5 has 0 approvals, 2 of 2 checks passing, and isn't mergeable yet.",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Status = tc.status
+			reply, resp := handle(t, s, "get_pr_status", map[string]any{"repo": "acme/app", "pr_number": float64(5)})
+			if resp.Type != "pr_status" || reply != tc.wantReply {
+				t.Errorf("got %s %q, want pr_status %q", resp.Type, reply, tc.wantReply)
+			}
+			if got := prCalls(fake); strings.Join(got, ",") != "GetPRStatus acme/app#5" {
+				t.Errorf("calls = %v", got)
+			}
+		})
+	}
+}
+
+func TestGetFailingChecksIntent(t *testing.T) {
+	lint := gh.Check{Name: "lint", URL: "https://ci.example/lint"}
+	test := gh.Check{Name: "test", URL: "https://ci.example/test"}
+	tests := []struct {
+		name      string
+		status    gh.Status
+		wantReply string
+	}{
+		{name: "one failing", status: gh.Status{ChecksPassing: 2, ChecksTotal: 3, FailingChecks: []gh.Check{lint}}, wantReply: "1 check is failing on PR #5: lint."},
+		{name: "several failing", status: gh.Status{ChecksPassing: 1, ChecksTotal: 3, FailingChecks: []gh.Check{lint, test}}, wantReply: "2 checks are failing on PR #5: lint and test."},
+		{name: "all passing", status: gh.Status{ChecksPassing: 4, ChecksTotal: 4}, wantReply: "All 4 checks on PR #5 are passing."},
+		{name: "the only check passing", status: gh.Status{ChecksPassing: 1, ChecksTotal: 1}, wantReply: "The one check on PR #5 is passing."},
+		{name: "some still running", status: gh.Status{ChecksPassing: 1, ChecksTotal: 3}, wantReply: "Nothing is failing on PR #5; 1 of 3 checks have passed so far."},
+		{name: "no checks", wantReply: "PR #5 has no checks reported."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.Status = tc.status
+			reply, resp := handle(t, s, "get_failing_checks", map[string]any{"repo": "acme/app", "pr_number": float64(5)})
+			if resp.Type != "failing_checks" || reply != tc.wantReply {
+				t.Errorf("got %s %q, want failing_checks %q", resp.Type, reply, tc.wantReply)
+			}
+			if got := resp.Payload["failing"].([]gh.Check); len(got) != len(tc.status.FailingChecks) {
+				t.Errorf("payload failing = %v, want all %d", got, len(tc.status.FailingChecks))
+			}
+		})
+	}
+}
+
+func TestUndoComment(t *testing.T) {
+	tests := []struct {
+		name string
+		// commented adds a comment first, as comment 42 on acme/app#5
+		commented   bool
+		deleteErr   error
+		wantReply   string
+		wantDeleted bool
+		wantDeletes int
+		// wantKept is whether a retry would still find the comment to undo
+		wantKept bool
+	}{
+		{name: "deletes the last comment", commented: true, wantReply: "Deleted that comment.", wantDeleted: true, wantDeletes: 1},
+		{name: "nothing to undo", wantReply: "There's no recent comment of yours to undo."},
+		{name: "already deleted on GitHub", commented: true, deleteErr: gh.ErrCommentNotFound, wantReply: "That comment is already gone.", wantDeletes: 1},
+		{name: "GitHub down", commented: true, deleteErr: &gh.APIError{StatusCode: http.StatusBadGateway}, wantReply: "I couldn't delete that comment on GitHub. Want me to try again?", wantDeletes: 1, wantKept: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.CommentID = 42
+			if tc.commented {
+				handle(t, s, "add_comment", map[string]any{"repo": "acme/app", "pr_number": float64(5), "body": "nit: typo"})
+			}
+			fake.Errors = map[string]error{"DeleteComment": tc.deleteErr}
+
+			reply, resp := handle(t, s, "undo_comment", map[string]any{})
+			if reply != tc.wantReply {
+				t.Errorf("reply = %q, want %q", reply, tc.wantReply)
+			}
+			if tc.deleteErr == nil || errors.Is(tc.deleteErr, gh.ErrCommentNotFound) {
+				if resp.Type != "comment_deleted" || resp.Payload["deleted"] != tc.wantDeleted {
+					t.Errorf("intent = %s %v, want comment_deleted with deleted %v", resp.Type, resp.Payload, tc.wantDeleted)
+				}
+			}
+			deletes := fake.CallsTo("DeleteComment")
+			if len(deletes) != tc.wantDeletes {
+				t.Fatalf("deletes = %d, want %d", len(deletes), tc.wantDeletes)
+			}
+			if tc.wantDeletes > 0 && (deletes[0].Repo != "acme/app" || deletes[0].Args[0] != int64(42)) {
+				t.Errorf("deleted %s comment %v, want acme/app comment 42", deletes[0].Repo, deletes[0].Args[0])
+			}
+			if _, kept := s.store.GetLastComment(testSession); kept != tc.wantKept {
+				t.Errorf("last comment kept = %v, want %v", kept, tc.wantKept)
+			}
+		})
+	}
+
+	t.Run("a second undo has nothing left", func(t *testing.T) {
+		s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+		fake.CommentID = 42
+		handle(t, s, "add_comment", map[string]any{"repo": "acme/app", "pr_number": float64(5), "body": "nit: typo"})
+		handle(t, s, "undo_comment", map[string]any{})
+		if reply, _ := handle(t, s, "undo_comment", map[string]any{}); reply != "There's no recent comment of yours to undo." {
+			t.Errorf("second undo = %q", reply)
+		}
+		if got := len(fake.CallsTo("DeleteComment")); got != 1 {
+			t.Errorf("deletes = %d, want 1", got)
+		}
+	})
+}
+
+func TestMergeDeletesBranch(t *testing.T) {
+	sameRepo := gh.PR{Repository: "acme/app", Number: 5, HeadRef: "fix/auth", HeadRepo: "acme/app"}
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		args        map[string]any
+		pr          gh.PR
+		errs        map[string]error
+		wantNote    string
+		wantDeleted bool
+		wantDeletes []string
+	}{
+		{name: "same repo branch is deleted", args: map[string]any{"delete_branch": true}, pr: sameRepo,
+			wantNote: "Deleted the fix/auth branch.", wantDeleted: true, wantDeletes: []string{"acme/app fix/auth"}},
+		{name: "config default", cfg: config.Config{DeleteBranchOnMerge: true}, pr: sameRepo,
+			wantNote: "Deleted the fix/auth branch.", wantDeleted: true, wantDeletes: []string{"acme/app fix/auth"}},
+		{name: "arg overrides the config default", cfg: config.Config{DeleteBranchOnMerge: true}, args: map[string]any{"delete_branch": false}, pr: sameRepo},
+		{name: "fork branch is left alone", args: map[string]any{"delete_branch": true}, pr: gh.PR{HeadRef: "fix/auth", HeadRepo: "someone/app"},
+			wantNote: "I left its branch alone since it's in a fork."},
+		// A deleted fork leaves no head repo at all
+		{name: "deleted fork", args: map[string]any{"delete_branch": true}, pr: gh.PR{HeadRef: "fix/auth"},
+			wantNote: "I left its branch alone since it's in a fork."},
+		{name: "already deleted", args: map[string]any{"delete_branch": true}, pr: sameRepo, errs: map[string]error{"DeleteBranch": gh.ErrBranchNotFound},
+			wantNote: "The fix/auth branch was already deleted.", wantDeletes: []string{"acme/app fix/auth"}},
+		{name: "delete fails", args: map[string]any{"delete_branch": true}, pr: sameRepo, errs: map[string]error{"DeleteBranch": errors.New("boom")},
+			wantNote: "I couldn't delete the fix/auth branch.", wantDeletes: []string{"acme/app fix/auth"}},
+		{name: "pr lookup fails", args: map[string]any{"delete_branch": true}, errs: map[string]error{"GetPR": errors.New("boom")},
+			wantNote: "I couldn't look up its branch to delete it."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.GitHubToken = "tok"
+			s, fake := newTestServer(t, tc.cfg)
+			fake.PR = tc.pr
+			fake.Errors = tc.errs
+			args := map[string]any{"repo": "acme/app", "pr_number": float64(5)}
+			for k, v := range tc.args {
+				args[k] = v
+			}
+			reply, resp := handle(t, s, "merge_pr", args)
+			if resp.Type != "merged" {
+				t.Fatalf("type = %q (%q), want merged", resp.Type, reply)
+			}
+			if want := strings.TrimSpace("using merge method. " + tc.wantNote); !strings.HasSuffix(reply, want) {
+				t.Errorf("reply = %q, want it to end with %q", reply, want)
+			}
+			if got, _ := resp.Payload["branchDeleted"].(bool); got != tc.wantDeleted {
+				t.Errorf("branchDeleted = %v, want %v", got, tc.wantDeleted)
+			}
+			var deletes []string
+			for _, c := range fake.CallsTo("DeleteBranch") {
+				deletes = append(deletes, c.Repo+" "+c.Args[0].(string))
+			}
+			if strings.Join(deletes, ",") != strings.Join(tc.wantDeletes, ",") {
+				t.Errorf("deletes = %v, want %v", deletes, tc.wantDeletes)
+			}
+		})
+	}
+}
+
+func TestMergePrecheck(t *testing.T) {
+	ready := gh.Status{Mergeable: true, ChecksPassing: 2, ChecksTotal: 2}
+	tests := []struct {
+		name      string
+		precheck  bool
+		status    gh.Status
+		errs      map[string]error
+		wantType  string
+		wantReply string
+		wantCalls []string
+	}{
+		{
+			name:      "mergeable pr is merged",
+			precheck:  true,
+			status:    ready,
+			wantType:  "merged",
+			wantCalls: []string{"GetPRStatus acme/app#5", "MergePR acme/app#5"},
+		},
+		{
+			name:      "failing checks and conflicts block",
+			precheck:  true,
+			status:    gh.Status{FailingCheckIDs: []string{"lint", "test"}, HasConflicts: true},
+			wantType:  "merge_blocked",
+			wantReply: "I didn't merge PR #5 because 2 checks are failing and it has merge conflicts. Want me to force the merge anyway?",
+			wantCalls: []string{"GetPRStatus acme/app#5"},
+		},
+		{
+			name:      "unmergeable pr blocks",
+			precheck:  true,
+			status:    gh.Status{FailingCheckIDs: []string{"lint"}},
+			wantType:  "merge_blocked",
+			wantReply: "I didn't merge PR #5 because 1 check is failing and GitHub hasn't marked it mergeable yet. Want me to force the merge anyway?",
+			wantCalls: []string{"GetPRStatus acme/app#5"},
+		},
+		{
+			// The check is advisory; GitHub still gets the final say
+			name:      "failed lookup lets the merge through",
+			precheck:  true,
+			errs:      map[string]error{"GetPRStatus": errors.New("boom")},
+			wantType:  "merged",
+			wantCalls: []string{"GetPRStatus acme/app#5", "MergePR acme/app#5"},
+		},
+		{
+			name:      "pre-check off",
+			status:    gh.Status{HasConflicts: true},
+			wantType:  "merged",
+			wantCalls: []string{"MergePR acme/app#5"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok", MergePrecheck: tc.precheck})
+			fake.Status = tc.status
+			fake.Errors = tc.errs
+			reply, resp := handle(t, s, "merge_pr", map[string]any{"repo": "acme/app", "pr_number": float64(5)})
+			if resp.Type != tc.wantType {
+				t.Fatalf("type = %q (%q), want %s", resp.Type, reply, tc.wantType)
+			}
+			if tc.wantReply != "" && reply != tc.wantReply {
+				t.Errorf("reply = %q, want %q", reply, tc.wantReply)
+			}
+			if got := prCalls(fake); !reflect.DeepEqual(got, tc.wantCalls) {
+				t.Errorf("calls = %v, want %v", got, tc.wantCalls)
+			}
+			_, pending, ok := s.store.GetPendingIntent(testSession)
+			if blocked := tc.wantType == "merge_blocked"; ok != blocked {
+				t.Fatalf("merge pending = %v, want %v", ok, blocked)
+			}
+			if ok && pending["force"] != true {
+				t.Errorf("pending merge = %v, want it forced", pending)
+			}
+		})
+	}
+}
+
+func TestForceMerge(t *testing.T) {
+	blocked := gh.Status{FailingCheckIDs: []string{"lint"}, HasConflicts: true}
+	protected := &gh.ConflictError{APIError: &gh.APIError{Op: "merge", StatusCode: http.StatusMethodNotAllowed, Message: "Required status check \"lint\" is failing."}}
+	tests := []struct {
+		name      string
+		errs      map[string]error
+		wantType  string
+		wantReply string
+		wantCalls []string
+	}{
+		{
+			name:      "force skips the pre-check",
+			wantType:  "merged",
+			wantReply: "Successfully merged GitHub pull request acme/app#5 using merge method.",
+			wantCalls: []string{"MergePR acme/app#5"},
+		},
+		{
+			name:      "github's refusal is still reported",
+			errs:      map[string]error{"MergePR": protected},
+			wantType:  "error",
+			wantReply: "GitHub refused to merge PR #5: Required status check \"lint\" is failing.",
+			wantCalls: []string{"MergePR acme/app#5"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok", MergePrecheck: true})
+			fake.Status = blocked
+			fake.Errors = tc.errs
+			reply, resp := handle(t, s, "merge_pr", map[string]any{"repo": "acme/app", "pr_number": float64(5), "force": true})
+			if resp.Type != tc.wantType || reply != tc.wantReply {
+				t.Errorf("reply = %q (%s), want %q (%s)", reply, resp.Type, tc.wantReply, tc.wantType)
+			}
+			if got := prCalls(fake); !reflect.DeepEqual(got, tc.wantCalls) {
+				t.Errorf("calls = %v, want %v", got, tc.wantCalls)
+			}
+			if tc.wantType == "error" && resp.Payload["forced"] != true {
+				t.Errorf("payload = %v, want forced", resp.Payload)
+			}
+		})
+	}
+
+	t.Run("yes, force after a blocked merge", func(t *testing.T) {
+		s, fake := newTestServer(t, config.Config{GitHubToken: "tok", MergePrecheck: true, RequireMergeConfirmation: true})
+		fake.Status = blocked
+		ctx := context.Background()
+		reply, resp := handle(t, s, "merge_pr", map[string]any{"repo": "acme/app", "pr_number": float64(5), "merge_method": "squash"})
+		if resp.Type != "merge_blocked" {
+			t.Fatalf("first turn = %q (%s), want merge_blocked", reply, resp.Type)
+		}
+
+		// Forced and confirmed: neither checked again nor asked about again
+		reply, resp, ok := s.classifyAndHandle(ctx, testSession, "yes, force it")
+		if !ok || resp == nil || resp.Type != "merged" {
+			t.Fatalf("answer = %q (%v), want merged", reply, resp)
+		}
+		if want := []string{"GetPRStatus acme/app#5", "MergePR acme/app#5"}; !reflect.DeepEqual(prCalls(fake), want) {
+			t.Errorf("calls = %v, want %v", prCalls(fake), want)
+		}
+		if merges := fake.CallsTo("MergePR"); len(merges) == 1 && merges[0].Args[0] != "squash" {
+			t.Errorf("merge method = %v, want squash kept from the first turn", merges[0].Args[0])
+		}
+	})
+}
+
+func TestFormatCommentsReply(t *testing.T) {
+	inline := gh.Comment{Author: "bob", Body: "Rename this.", Type: "inline", Path: "internal/server/server.go", Line: 42}
+	general := gh.Comment{Author: "alice", Body: "Looks good\n\nthanks!", Type: "general"}
+	code := gh.Comment{Author: "carol", Body: "Try:\n```go\nx := 1\n```\nthen rerun", Type: "review"}
+	long := gh.Comment{Body: strings.Repeat("word ", 40), Type: "general"}
+	tests := []struct {
+		name      string
+		comments  []gh.Comment
+		truncated bool
+		limit     int
+		want      string
+	}{
+		{name: "none", want: "There are no comments on PR #5 in acme/app yet."},
+		{name: "inline and general", comments: []gh.Comment{inline, general}, limit: 3,
+			want: "PR #5 in acme/app has 2 comments. bob commented on line 42 of server.go: Rename this; alice wrote: Looks good thanks!."},
+		{name: "inline without a line", comments: []gh.Comment{{Author: "bob", Body: "hm", Type: "inline", Path: "a/b.go"}}, limit: 3,
+			want: "PR #5 in acme/app has 1 comment. bob commented on b.go: hm."},
+		{name: "code blocks are not read out", comments: []gh.Comment{code}, limit: 3,
+			want: "PR #5 in acme/app has 1 comment. carol reviewed: Try: (code) then rerun."},
+		{name: "long bodies are cut at a word", comments: []gh.Comment{long, general}, limit: 2,
+			want: "PR #5 in acme/app has 2 comments. someone wrote: " + strings.TrimSpace(strings.Repeat("word ", 24)) + "...; alice wrote: Looks good thanks!."},
+		{name: "over the limit", comments: []gh.Comment{inline, general, code}, limit: 1,
+			want: "PR #5 in acme/app has 3 comments. bob commented on line 42 of server.go: Rename this; and 2 more."},
+		{name: "truncated listing", comments: []gh.Comment{inline, general}, truncated: true, limit: 2,
+			want: "PR #5 in acme/app has more than 2 comments. bob commented on line 42 of server.go: Rename this; alice wrote: Looks good thanks!; and more."},
+		{name: "no limit only counts", comments: []gh.Comment{inline, general}, want: "PR #5 in acme/app has 2 comments."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatCommentsReply("acme/app", 5, tc.comments, tc.truncated, tc.limit); got != tc.want {
+				t.Errorf("reply = %q\nwant    %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatDiffReply(t *testing.T) {
+	file := func(name string, add, del int) gh.DiffFile {
+		return gh.DiffFile{Filename: name, Additions: add, Deletions: del}
+	}
+	tests := []struct {
+		name string
+		diff gh.Diff
+		want string
+	}{
+		{name: "empty", want: "PR #7 doesn't change any files."},
+		{name: "one file", diff: gh.Diff{FilesChanged: 1, Additions: 1, Deletions: 0, Files: []gh.DiffFile{file("a.go", 1, 0)}},
+			want: "PR #7 changes 1 file, with 1 addition and 0 deletions. The file is a.go (1 line)."},
+		{name: "top three by lines changed", diff: gh.Diff{FilesChanged: 4, Additions: 30, Deletions: 12, Files: []gh.DiffFile{
+			file("small.go", 1, 1), file("big.go", 20, 5), file("mid.go", 4, 4), file("tie.go", 5, 2),
+		}}, want: "PR #7 changes 4 files, with 30 additions and 12 deletions. Most changed: big.go (25 lines), mid.go (8 lines) and tie.go (7 lines)."},
+		{name: "ties keep listing order", diff: gh.Diff{FilesChanged: 2, Additions: 2, Deletions: 0, Files: []gh.DiffFile{file("b.go", 1, 0), file("a.go", 1, 0)}},
+			want: "PR #7 changes 2 files, with 2 additions and 0 deletions. Most changed: b.go (1 line) and a.go (1 line)."},
+		{name: "truncated", diff: gh.Diff{FilesChanged: 2, Additions: 6, Deletions: 5, Truncated: true, Files: []gh.DiffFile{file("a.go", 5, 5), file("b.go", 1, 0)}},
+			want: "PR #7 changes more than 2 files, with 6 additions and 5 deletions. Most changed: a.go (10 lines) and b.go (1 line)."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatDiffReply(7, tc.diff); got != tc.want {
+				t.Errorf("reply = %q\nwant    %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestArgInt(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      any
+		want   int
+		wantOK bool
+	}{
+		{name: "float64 from JSON", v: float64(42), want: 42, wantOK: true},
+		{name: "fractional float64", v: 4.5},
+		{name: "int", v: 42, want: 42, wantOK: true},
+		{name: "int64", v: int64(42), want: 42, wantOK: true},
+		{name: "json.Number", v: json.Number("42"), want: 42, wantOK: true},
+		{name: "fractional json.Number", v: json.Number("4.5")},
+		{name: "numeric string", v: "42", want: 42, wantOK: true},
+		{name: "hash and spaces", v: " #42 ", want: 42, wantOK: true},
+		{name: "word", v: "forty-two"},
+		{name: "empty string", v: ""},
+		{name: "bool", v: true},
+		{name: "missing", v: nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := map[string]any{}
+			if tc.v != nil {
+				args["pr_number"] = tc.v
+			}
+			got, ok := argInt(args, "pr_number")
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("argInt(%#v) = %d, %v, want %d, %v", tc.v, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestArgString(t *testing.T) {
+	args := map[string]any{"repo": "  acme/app ", "pr_number": float64(5)}
+	if got := argString(args, "repo"); got != "acme/app" {
+		t.Errorf("argString(repo) = %q, want acme/app", got)
+	}
+	// Non-strings and missing keys read as empty
+	if got := argString(args, "pr_number"); got != "" {
+		t.Errorf("argString(pr_number) = %q, want empty", got)
+	}
+	if got := argString(args, "missing"); got != "" {
+		t.Errorf("argString(missing) = %q, want empty", got)
+	}
+}
+
+func TestOrdinalArg(t *testing.T) {
+	tests := []struct {
+		v      any
+		want   int
+		wantOK bool
+	}{
+		{v: float64(2), want: 2, wantOK: true},
+		{v: "3", want: 3, wantOK: true},
+		{v: "first", want: 1, wantOK: true},
+		{v: "The Second One", want: 2, wantOK: true},
+		{v: "2nd", want: 2, wantOK: true},
+		{v: "21st", want: 21, wantOK: true},
+		{v: "last", want: -1, wantOK: true},
+		{v: "second to last", want: -2, wantOK: true},
+		{v: "penultimate", want: -2, wantOK: true},
+		{v: float64(0)},
+		{v: "0th"},
+		{v: "next"},
+		{v: nil},
+	}
+	for _, tc := range tests {
+		args := map[string]any{}
+		if tc.v != nil {
+			args["index"] = tc.v
+		}
+		got, ok := ordinalArg(args)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("ordinalArg(%#v) = %d, %v, want %d, %v", tc.v, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestOrdinalsResolveAgainstLastListing(t *testing.T) {
+	listed := []store.PRRef{{Number: 5, Repository: "acme/app"}, {Number: 9, Repository: "acme/api"}, {Number: 2, Repository: "acme/web"}}
+	tests := []struct {
+		name      string
+		listed    []store.PRRef
+		args      map[string]any
+		wantType  string
+		wantReply string
+		wantCalls []string
+	}{
+		{name: "first", listed: listed, args: map[string]any{"index": "first"}, wantType: "show_comments", wantCalls: []string{"GetPRComments acme/app#5"}},
+		{name: "numeric position", listed: listed, args: map[string]any{"index": float64(2)}, wantType: "show_comments", wantCalls: []string{"GetPRComments acme/api#9"}},
+		{name: "last", listed: listed, args: map[string]any{"index": "last"}, wantType: "show_comments", wantCalls: []string{"GetPRComments acme/web#2"}},
+		{name: "second to last", listed: listed, args: map[string]any{"index": "the second to last one"}, wantType: "show_comments", wantCalls: []string{"GetPRComments acme/api#9"}},
+		{name: "past the end", listed: listed, args: map[string]any{"index": "fourth"}, wantType: "clarify", wantReply: "I only listed 3 pull request(s)."},
+		{name: "before the start", listed: listed, args: map[string]any{"index": float64(-4)}, wantType: "clarify", wantReply: "I only listed 3 pull request(s)."},
+		{name: "nothing listed", args: map[string]any{"index": "first"}, wantType: "clarify", wantReply: "I don't have a recent list to pick from."},
+		// A named PR beats a position
+		{name: "explicit pr wins", listed: listed, args: map[string]any{"index": "first", "repo": "acme/web", "pr_number": float64(7)}, wantType: "show_comments", wantCalls: []string{"GetPRComments acme/web#7"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			s.store.SetLastPRs(testSession, tc.listed)
+			reply, resp := handle(t, s, "get_pr_comments", tc.args)
+			if resp.Type != tc.wantType || !strings.HasPrefix(reply, tc.wantReply) {
+				t.Errorf("got %s %q, want %s %q", resp.Type, reply, tc.wantType, tc.wantReply)
+			}
+			if got := prCalls(fake); strings.Join(got, ",") != strings.Join(tc.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLastListingKeepsTitlesAndAuthors(t *testing.T) {
+	listing := []gh.PR{
+		{Number: 5, Repository: "acme/app", Title: "Fix auth bug", Author: "alice", URL: "https://github.com/acme/app/pull/5"},
+		{Number: 9, Repository: "acme/api", Title: "Add cache", Author: "bob"},
+		{Number: 2, Repository: "acme/web", Title: "Bump deps", Author: "bob"},
+	}
+	tests := []struct {
+		name      string
+		author    string
+		wantType  string
+		wantReply string
+		wantCalls []string
+	}{
+		{name: "one pr by the author", author: "@Alice", wantType: "show_comments", wantCalls: []string{"GetPRComments acme/app#5"}},
+		{name: "several prs are offered by title", author: "bob", wantType: "clarify",
+			wantReply: "bob has 2 PRs in that list. Did you mean #9 'Add cache' in acme/api or #2 'Bump deps' in acme/web?"},
+		{name: "author not in the listing", author: "carol", wantType: "clarify", wantReply: "I don't see a PR by carol in the last list."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fake := newTestServer(t, config.Config{GitHubToken: "tok"})
+			fake.MinePRs = listing
+			handle(t, s, "list_prs_mine", nil)
+			refs, _ := s.store.GetLastPRs(testSession)
+			if len(refs) != 3 || refs[0].Title != "Fix auth bug" || refs[0].Author != "alice" || refs[0].URL != listing[0].URL {
+				t.Fatalf("last prs = %+v, want titles, authors and URLs kept", refs)
+			}
+
+			reply, resp := handle(t, s, "get_pr_comments", map[string]any{"author": tc.author})
+			if resp.Type != tc.wantType || !strings.HasPrefix(reply, tc.wantReply) {
+				t.Errorf("got %s %q, want %s %q", resp.Type, reply, tc.wantType, tc.wantReply)
+			}
+			if got := prCalls(fake); strings.Join(got, ",") != strings.Join(tc.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", got, tc.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"zana-speech-backend/internal/store"
+)
+
+// GET /api/session/history
+// Returns { messages: [{ role, content }], systemPrompt } for the session, oldest
+// message first. The pinned system prompt is reported apart from the messages.
+func (s *Server) handleSessionHistory(w http.ResponseWriter, r *http.Request) {
+	sid := s.getSessionID(r)
+	msgs := []store.Message{}
+	system := ""
+	if sid != "" {
+		if h := s.history(sid); h != nil {
+			msgs = h
+		}
+		system = s.store.GetSystemPrompt(sid)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"messages": msgs, "systemPrompt": system})
+}
+
+// DELETE /api/session/history[?system=true]
+// Forgets the session's conversation (see resetConversation) so it starts over. The pinned system prompt survives unless
+// system=true is passed.
+func (s *Server) handleResetSessionHistory(w http.ResponseWriter, r *http.Request) {
+	sid := s.getSessionID(r)
+	if sid == "" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
+		return
+	}
+	clearSystem, _ := strconv.ParseBool(r.URL.Query().Get("system"))
+	if err := s.resetConversation(sid, clearSystem); err != nil {
+		logger(r.Context()).Error("database delete messages failed", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to clear history")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+// resetConversation forgets what the session has said and looked at: messages,
+// pending intent, the last PR listing, cached listings and the focused PR. GitHub
+// auth is untouched. clearSystem also drops the pinned system prompt.
+func (s *Server) resetConversation(sessionID string, clearSystem bool) error {
+	if s.databaseStore != nil {
+		if err := s.databaseStore.DeleteMessages(sessionID); err != nil {
+			return err
+		}
+	}
+	s.store.Set(sessionID, nil)
+	s.store.ClearPendingIntent(sessionID)
+	s.store.SetLastPRs(sessionID, nil)
+	s.store.ClearCachedPRs(sessionID)
+	s.store.ClearFocusedPR(sessionID)
+	if clearSystem {
+		s.store.SetSystemPrompt(sessionID, "")
+	}
+	return nil
+}
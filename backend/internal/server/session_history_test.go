@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"zana-speech-backend/internal/config"
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/store"
+)
+
+func TestSessionHistoryRoutes(t *testing.T) {
+	type historyBody struct {
+		Messages     []store.Message `json:"messages"`
+		SystemPrompt string          `json:"systemPrompt"`
+	}
+	conversation := []store.Message{{Role: "user", Content: "list my prs"}, {Role: "assistant", Content: "You have 1 PR."}}
+
+	// seeded is a server whose test session has talked, listed PRs and left state behind
+	seeded := func(t *testing.T) *Server {
+		s, _ := newTestServer(t, config.Config{})
+		s.router = chi.NewRouter()
+		s.routes()
+		for _, m := range conversation {
+			s.appendMessage(testSession, m)
+		}
+		s.store.SetSystemPrompt(testSession, "be brief")
+		s.store.SetPendingIntent(testSession, "merge_pr", map[string]any{"pr_number": 5})
+		s.store.SetLastPRs(testSession, []store.PRRef{{Number: 5, Repository: "acme/app"}})
+		s.store.SetCachedPRs(testSession, "mine", []gh.PR{{Number: 5}})
+		s.store.SetFocusedPR(testSession, "acme/app", 5)
+		s.store.SetUsername(testSession, "alice")
+		return s
+	}
+	do := func(t *testing.T, s *Server, method, path string, sid string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if sid != "" {
+			req.Header.Set("X-Session-Id", sid)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d (%s)", method, path, rec.Code, rec.Body)
+		}
+		return rec
+	}
+	getHistory := func(t *testing.T, s *Server, sid string) historyBody {
+		t.Helper()
+		var body historyBody
+		if err := json.Unmarshal(do(t, s, http.MethodGet, "/api/session/history", sid).Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	t.Run("get returns messages and the system prompt apart", func(t *testing.T) {
+		s := seeded(t)
+		got := getHistory(t, s, testSession)
+		want := historyBody{Messages: conversation, SystemPrompt: "be brief"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("history = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("get without a session is empty", func(t *testing.T) {
+		s := seeded(t)
+		rec := do(t, s, http.MethodGet, "/api/session/history", "")
+		if got := rec.Body.String(); got != `{"messages":[],"systemPrompt":""}`+"\n" {
+			t.Errorf("body = %s, want an empty list rather than null", got)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantSystem string
+	}{
+		{name: "delete keeps the system prompt", wantSystem: "be brief"},
+		{name: "delete with system=true clears it too", query: "?system=true"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := seeded(t)
+			do(t, s, http.MethodDelete, "/api/session/history"+tc.query, testSession)
+
+			got := getHistory(t, s, testSession)
+			if len(got.Messages) != 0 || got.SystemPrompt != tc.wantSystem {
+				t.Errorf("history after reset = %+v, want no messages and system prompt %q", got, tc.wantSystem)
+			}
+			if _, _, ok := s.store.GetPendingIntent(testSession); ok {
+				t.Error("pending intent survived the reset")
+			}
+			if prs, _ := s.store.GetLastPRs(testSession); len(prs) != 0 {
+				t.Errorf("last PRs survived the reset: %v", prs)
+			}
+			if _, ok := s.store.GetCachedPRs(testSession, "mine"); ok {
+				t.Error("cached PRs survived the reset")
+			}
+			if _, ok := s.store.GetFocusedPR(testSession); ok {
+				t.Error("focused PR survived the reset")
+			}
+			// Starting over isn't signing out
+			if got := s.store.GetUsername(testSession); got != "alice" {
+				t.Errorf("username = %q, want it kept", got)
+			}
+		})
+	}
+}
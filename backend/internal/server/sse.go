@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"zana-speech-backend/internal/store"
+	"zana-speech-backend/internal/types"
+)
+
+// sseWriter writes named Server-Sent Events, flushing after each one.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// event sends one event whose data is v encoded as a single line of JSON.
+func (e sseWriter) event(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", name, b); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// POST /api/chat/stream/sse
+// Streams a chat turn as Server-Sent Events so the UI can tell content apart:
+//
+//	token  {"text": "..."}                 one per completion delta
+//	intent IntentResponse                  the handled GitHub intent (PR lists etc.)
+//	done   {"sessionId": "...", "reply": "..."} the full reply; always last on success
+//	error  {"error": "..."}                the turn failed; no done follows
+//
+// Actionable intents produce intent then done; anything else is streamed as tokens.
+func (s *Server) handleChatStreamSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	req, ok := s.decodeChatRequest(w, r)
+	if !ok {
+		return
+	}
+	sid := s.getOrCreateSessionID(r, w)
+	if strings.TrimSpace(req.Message) == "" {
+		s.writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	if req.System != "" {
+		s.store.SetSystemPrompt(sid, req.System)
+	}
+	s.appendMessage(sid, store.Message{Role: "user", Content: req.Message})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Session-Id", sid)
+	w.WriteHeader(http.StatusOK)
+	sse := sseWriter{w: w, flusher: flusher}
+
+	done := func(reply string) {
+		_ = sse.event("done", map[string]string{"sessionId": sid, "reply": reply})
+	}
+
+	if strings.TrimSpace(s.getGitHubToken(sid)) == "" {
+		reply := "Please connect your GitHub account to use this application. This service helps you manage GitHub pull requests - fetching, listing, merging, and viewing PR comments."
+		_ = sse.event("intent", types.IntentResponse{Type: "require_github_auth"})
+		done(reply)
+		return
+	}
+
+	cctx, cancel := context.WithTimeout(r.Context(), s.cfg.ChatTimeout)
+	reply, intent, ok := s.classifyAndHandle(cctx, sid, req.Message)
+	cancel()
+	if ok {
+		s.appendMessage(sid, store.Message{Role: "assistant", Content: reply})
+		if intent != nil {
+			_ = sse.event("intent", intent)
+		}
+		done(reply)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.StreamTimeout)
+	defer cancel()
+	final, err := s.streamCompletion(ctx, sid, func(chunk string) error {
+		return sse.event("token", map[string]string{"text": chunk})
+	})
+	if strings.TrimSpace(final) != "" {
+		s.appendMessage(sid, store.Message{Role: "assistant", Content: final})
+	}
+	if err != nil && r.Context().Err() == nil {
+		logger(ctx).Error("sse stream failed", "error", err)
+		_ = sse.event("error", types.ErrorResponse{Error: "chat stream failed"})
+		return
+	}
+	done(final)
+}
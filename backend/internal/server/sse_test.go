@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gh "zana-speech-backend/internal/github"
+)
+
+// sseFrame is one parsed Server-Sent Event.
+type sseFrame struct {
+	event string
+	data  map[string]any
+}
+
+// parseSSE splits a text/event-stream body into frames, failing on anything but the
+// "event: name\ndata: json\n\n" shape the server writes.
+func parseSSE(t *testing.T, body string) []sseFrame {
+	t.Helper()
+	if !strings.HasSuffix(body, "\n\n") {
+		t.Fatalf("stream does not end with a blank line: %q", body)
+	}
+	var frames []sseFrame
+	for _, raw := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		lines := strings.Split(raw, "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "event: ") || !strings.HasPrefix(lines[1], "data: ") {
+			t.Fatalf("malformed frame %q", raw)
+		}
+		f := sseFrame{event: strings.TrimPrefix(lines[0], "event: ")}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &f.data); err != nil {
+			t.Fatalf("frame %q: data is not JSON: %v", raw, err)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func TestChatStreamSSEEvents(t *testing.T) {
+	merge := &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9}
+	tests := []struct {
+		name       string
+		intent     *gh.ClassifiedIntent
+		err        error
+		status     int
+		noGitHub   bool
+		wantEvents []string
+		wantIntent string
+	}{
+		{name: "small talk streams tokens", err: gh.ErrNoIntent, wantEvents: []string{"token", "token", "token", "token", "token", "token", "done"}},
+		{name: "intent then done", intent: merge, wantEvents: []string{"intent", "done"}, wantIntent: "merged"},
+		{name: "no github account", noGitHub: true, wantEvents: []string{"intent", "done"}, wantIntent: "require_github_auth"},
+		{name: "completion fails", err: gh.ErrNoIntent, status: http.StatusInternalServerError, wantEvents: []string{"error"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &stubOpenAI{reply: "Hello there, how can I help?", status: tc.status}
+			s, _ := newChatTestServer(t, o, tc.intent, tc.err)
+			if tc.noGitHub {
+				s.cfg.GitHubToken = ""
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleChatStreamSSE(rec, chatRequest("hello"))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Content-Type = %q, want text/event-stream", got)
+			}
+			frames := parseSSE(t, rec.Body.String())
+			var events []string
+			var tokens strings.Builder
+			for _, f := range frames {
+				events = append(events, f.event)
+				switch f.event {
+				case "token":
+					tokens.WriteString(f.data["text"].(string))
+				case "intent":
+					if got := f.data["type"]; got != tc.wantIntent {
+						t.Errorf("intent type = %v, want %q", got, tc.wantIntent)
+					}
+				case "error":
+					if f.data["error"] == "" {
+						t.Error("error event has no message")
+					}
+				}
+			}
+			if strings.Join(events, ",") != strings.Join(tc.wantEvents, ",") {
+				t.Fatalf("events = %v, want %v", events, tc.wantEvents)
+			}
+			last := frames[len(frames)-1]
+			if last.event != "done" {
+				return
+			}
+			if last.data["sessionId"] != testSession {
+				t.Errorf("done sessionId = %v, want %q", last.data["sessionId"], testSession)
+			}
+			if tokens.Len() > 0 && last.data["reply"] != tokens.String() {
+				t.Errorf("done reply = %v, want the streamed tokens %q", last.data["reply"], tokens.String())
+			}
+			if tc.intent != nil && !strings.Contains(last.data["reply"].(string), "acme/app#5") {
+				t.Errorf("done reply = %v, want it to name acme/app#5", last.data["reply"])
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"zana-speech-backend/internal/store"
+)
+
+// tokenRefresher is the subset of *oauth2.Config used to renew expiring GitHub
+// tokens, so the refresh grant can be stubbed in tests.
+type tokenRefresher interface {
+	TokenSource(ctx context.Context, t *oauth2.Token) oauth2.TokenSource
+}
+
+// githubTokenRefreshMargin is how long before expiry a stored token is renewed.
+const githubTokenRefreshMargin = 5 * time.Minute
+
+// needsRefresh reports whether a stored token expires soon and can be renewed.
+func needsRefresh(refreshToken string, expiry time.Time) bool {
+	return refreshToken != "" && !expiry.IsZero() && time.Until(expiry) < githubTokenRefreshMargin
+}
+
+// refreshGitHubToken trades a refresh token for a new access token.
+func (s *Server) refreshGitHubToken(refreshToken string) (*oauth2.Token, error) {
+	if s.oauthRefresher == nil {
+		return nil, errors.New("github oauth not configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.GitHubTimeout)
+	defer cancel()
+	// Without an access token the source goes straight to the refresh grant
+	return s.oauthRefresher.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+}
+
+// accountToken returns a stored account's access token, first refreshing it and
+// writing the new one back when it is about to expire. If the refresh fails the
+// old token is returned and GitHub's 401 says the rest.
+func (s *Server) accountToken(auth store.GitHubAuth) string {
+	if !needsRefresh(auth.RefreshToken, auth.TokenExpiry) {
+		return auth.GitHubToken
+	}
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	// Refresh tokens are single use; another request may have spent this one while we waited
+	if auths, err := s.databaseStore.ListGitHubAuth(auth.SessionID); err == nil {
+		for _, a := range auths {
+			if a.GitHubOwner == auth.GitHubOwner {
+				auth = a
+			}
+		}
+	}
+	if !needsRefresh(auth.RefreshToken, auth.TokenExpiry) {
+		return auth.GitHubToken
+	}
+	tok, err := s.refreshGitHubToken(auth.RefreshToken)
+	if err != nil {
+		slog.Warn("refresh github token failed", "login", auth.GitHubOwner, "error", err)
+		return auth.GitHubToken
+	}
+	if err := s.databaseStore.UpdateGitHubToken(auth.SessionID, auth.GitHubOwner, tok.AccessToken, tok.RefreshToken, tok.Expiry); err != nil {
+		slog.Error("save refreshed github token failed", "error", err)
+	}
+	return tok.AccessToken
+}
+
+// fileToken is accountToken for the single-user token file.
+func (s *Server) fileToken(tok *store.GitHubToken) string {
+	if !needsRefresh(tok.RefreshToken, tok.Expiry) {
+		return tok.AccessToken
+	}
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	if cur, err := s.tokenStore.Read(); err == nil && cur != nil {
+		tok = cur
+	}
+	if !needsRefresh(tok.RefreshToken, tok.Expiry) {
+		return tok.AccessToken
+	}
+	fresh, err := s.refreshGitHubToken(tok.RefreshToken)
+	if err != nil {
+		slog.Warn("refresh github token failed", "error", err)
+		return tok.AccessToken
+	}
+	if err := s.tokenStore.Write(&store.GitHubToken{
+		AccessToken:  fresh.AccessToken,
+		TokenType:    fresh.TokenType,
+		Scope:        tok.Scope,
+		RefreshToken: fresh.RefreshToken,
+		Expiry:       fresh.Expiry,
+		SessionID:    tok.SessionID,
+	}); err != nil {
+		slog.Error("save refreshed github token failed", "error", err)
+	}
+	return fresh.AccessToken
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"zana-speech-backend/internal/config"
+	"zana-speech-backend/internal/store"
+)
+
+func TestNeedsRefresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		refresh string
+		expiry  time.Time
+		want    bool
+	}{
+		{name: "non-expiring token", refresh: "ghr_1"},
+		{name: "no refresh token", expiry: time.Now().Add(time.Minute)},
+		{name: "plenty of time left", refresh: "ghr_1", expiry: time.Now().Add(time.Hour)},
+		{name: "inside the margin", refresh: "ghr_1", expiry: time.Now().Add(time.Minute), want: true},
+		{name: "already expired", refresh: "ghr_1", expiry: time.Now().Add(-time.Hour), want: true},
+	}
+	for _, tc := range tests {
+		if got := needsRefresh(tc.refresh, tc.expiry); got != tc.want {
+			t.Errorf("%s: needsRefresh = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// tokenEndpoint fakes GitHub's OAuth token endpoint for the refresh grant: it
+// trades ghr_old for gho_new and ghr_new, or fails with status when it is set.
+type tokenEndpoint struct {
+	t      *testing.T
+	status int
+	hits   atomic.Int32
+}
+
+func (e *tokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.hits.Add(1)
+	if err := r.ParseForm(); err != nil {
+		e.t.Error(err)
+	}
+	if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("client_id") != "client-id" {
+		e.t.Errorf("token request = %v", r.PostForm)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if e.status != 0 {
+		w.WriteHeader(e.status)
+		_, _ = w.Write([]byte(`{"error":"bad_refresh_token"}`))
+		return
+	}
+	if got := r.PostForm.Get("refresh_token"); got != "ghr_old" {
+		// Refresh tokens are single use; a second trade means a lost race
+		e.t.Errorf("refreshed with %q", got)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  "gho_new",
+		"token_type":    "bearer",
+		"refresh_token": "ghr_new",
+		"expires_in":    8 * 60 * 60,
+	})
+}
+
+func newRefreshTestServer(t *testing.T, e *tokenEndpoint, stored *store.GitHubToken) *Server {
+	t.Helper()
+	ts := httptest.NewServer(e)
+	t.Cleanup(ts.Close)
+	s, _ := newTestServer(t, config.Config{GitHubToken: "ghp_config", GitHubTimeout: 5 * time.Second})
+	s.oauthRefresher = &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: ts.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+	if err := s.tokenStore.Write(stored); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFileTokenRefreshesNearExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored store.GitHubToken
+		status int
+		// unconfigured leaves the server without an OAuth app to refresh through
+		unconfigured bool
+		want         string
+		wantHits     int32
+		wantRefresh  string
+	}{
+		{name: "expiring token is renewed", stored: store.GitHubToken{AccessToken: "gho_old", RefreshToken: "ghr_old", Expiry: time.Now().Add(time.Minute), Scope: "repo"}, want: "gho_new", wantHits: 1, wantRefresh: "ghr_new"},
+		{name: "expired token is renewed", stored: store.GitHubToken{AccessToken: "gho_old", RefreshToken: "ghr_old", Expiry: time.Now().Add(-time.Hour), Scope: "repo"}, want: "gho_new", wantHits: 1, wantRefresh: "ghr_new"},
+		{name: "fresh token is used as is", stored: store.GitHubToken{AccessToken: "gho_old", RefreshToken: "ghr_old", Expiry: time.Now().Add(time.Hour)}, want: "gho_old", wantRefresh: "ghr_old"},
+		{name: "non-expiring token is used as is", stored: store.GitHubToken{AccessToken: "gho_old"}, want: "gho_old"},
+		{name: "failed refresh keeps the old token", stored: store.GitHubToken{AccessToken: "gho_old", RefreshToken: "ghr_old", Expiry: time.Now().Add(time.Minute)}, status: http.StatusBadRequest, want: "gho_old", wantHits: 2, wantRefresh: "ghr_old"},
+		{name: "no oauth app keeps the old token", stored: store.GitHubToken{AccessToken: "gho_old", RefreshToken: "ghr_old", Expiry: time.Now().Add(time.Minute)}, unconfigured: true, want: "gho_old", wantRefresh: "ghr_old"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &tokenEndpoint{t: t, status: tc.status}
+			stored := tc.stored
+			s := newRefreshTestServer(t, e, &stored)
+			if tc.unconfigured {
+				s.oauthRefresher = nil
+			}
+
+			// The second call finds the renewed token on disk rather than refreshing again
+			for i := 0; i < 2; i++ {
+				if got := s.getGitHubToken(testSession); got != tc.want {
+					t.Fatalf("call %d: token = %q, want %q", i, got, tc.want)
+				}
+			}
+			if got := e.hits.Load(); got != tc.wantHits {
+				t.Errorf("token endpoint hit %d times, want %d", got, tc.wantHits)
+			}
+			saved, err := s.tokenStore.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.AccessToken != tc.want || saved.RefreshToken != tc.wantRefresh {
+				t.Errorf("saved token = %+v, want %s / %s", saved, tc.want, tc.wantRefresh)
+			}
+			if tc.wantRefresh == "ghr_new" {
+				if time.Until(saved.Expiry) < 7*time.Hour || saved.Scope != "repo" {
+					t.Errorf("saved expiry %v, scope %q; want the new expiry and the old scope", saved.Expiry, saved.Scope)
+				}
+			}
+		})
+	}
+}
+
+func TestFileTokenRefreshesOnce(t *testing.T) {
+	e := &tokenEndpoint{t: t}
+	s := newRefreshTestServer(t, e, &store.GitHubToken{AccessToken: "gho_old", RefreshToken: "ghr_old", Expiry: time.Now().Add(time.Minute)})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 8)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i] = s.getGitHubToken(testSession)
+		}(i)
+	}
+	wg.Wait()
+	for i, tok := range tokens {
+		if tok != "gho_new" {
+			t.Errorf("request %d got %q", i, tok)
+		}
+	}
+	if got := e.hits.Load(); got != 1 {
+		t.Errorf("refreshed %d times concurrently, want 1", got)
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TTS providers a caller can force via the request's provider field.
+const (
+	ttsProviderEleven = "elevenlabs"
+	ttsProviderOpenAI = "openai"
+)
+
+// elevenLabsBaseURL is the ElevenLabs API root.
+const elevenLabsBaseURL = "https://api.elevenlabs.io"
+
+var errElevenNotConfigured = errors.New("elevenlabs not configured")
+
+// voiceSettings tunes an ElevenLabs voice per request; unset fields keep the
+// defaults (stability 0.5, similarity boost 0.7, style 0.2, speaker boost on).
+// Embedded in the TTS request bodies, so the fields sit next to text and voiceId.
+type voiceSettings struct {
+	Stability       *float64 `json:"stability,omitempty"`
+	SimilarityBoost *float64 `json:"similarityBoost,omitempty"`
+	Style           *float64 `json:"style,omitempty"`
+	UseSpeakerBoost *bool    `json:"useSpeakerBoost,omitempty"`
+}
+
+// validate rejects values outside ElevenLabs' 0..1 range.
+func (v voiceSettings) validate() error {
+	for _, f := range []struct {
+		name string
+		val  *float64
+	}{{"stability", v.Stability}, {"similarityBoost", v.SimilarityBoost}, {"style", v.Style}} {
+		if f.val != nil && (*f.val < 0 || *f.val > 1) {
+			return fmt.Errorf("%s must be between 0 and 1", f.name)
+		}
+	}
+	return nil
+}
+
+// payload renders the ElevenLabs voice_settings object with defaults filled in.
+func (v voiceSettings) payload() map[string]any {
+	out := map[string]any{
+		"stability":         0.5,
+		"similarity_boost":  0.7,
+		"style":             0.2,
+		"use_speaker_boost": true,
+	}
+	if v.Stability != nil {
+		out["stability"] = *v.Stability
+	}
+	if v.SimilarityBoost != nil {
+		out["similarity_boost"] = *v.SimilarityBoost
+	}
+	if v.Style != nil {
+		out["style"] = *v.Style
+	}
+	if v.UseSpeakerBoost != nil {
+		out["use_speaker_boost"] = *v.UseSpeakerBoost
+	}
+	return out
+}
+
+// elevenStatusError is a non-2xx answer from ElevenLabs.
+type elevenStatusError struct {
+	code int
+	body string
+}
+
+func (e *elevenStatusError) Error() string {
+	return fmt.Sprintf("elevenlabs error %d: %s", e.code, e.body)
+}
+
+// synthesize turns text into mp3 audio. With no provider it prefers ElevenLabs and
+// falls back to OpenAI when ElevenLabs isn't configured, can't be reached or answers
+// with a 5xx; a forced provider never falls back. settings only apply to ElevenLabs.
+// The caller must close the reader.
+func (s *Server) synthesize(ctx context.Context, text, voiceID, provider string, settings voiceSettings) (io.ReadCloser, string, error) {
+	switch provider {
+	case ttsProviderOpenAI:
+		rc, err := s.openAISpeech(ctx, text)
+		return rc, ttsProviderOpenAI, err
+	case ttsProviderEleven:
+		rc, err := s.elevenSpeech(ctx, text, voiceID, settings)
+		return rc, ttsProviderEleven, err
+	}
+	rc, err := s.elevenSpeech(ctx, text, voiceID, settings)
+	if err == nil {
+		return rc, ttsProviderEleven, nil
+	}
+	var statusErr *elevenStatusError
+	if errors.As(err, &statusErr) && statusErr.code < 500 {
+		return nil, ttsProviderEleven, err
+	}
+	if !errors.Is(err, errElevenNotConfigured) {
+		logger(ctx).Warn("elevenlabs unavailable, falling back to openai tts", "error", err)
+	}
+	rc, err = s.openAISpeech(ctx, text)
+	return rc, ttsProviderOpenAI, err
+}
+
+// openAISpeech synthesizes text with the OpenAI speech API using cfg.TTSModel.
+func (s *Server) openAISpeech(ctx context.Context, text string) (io.ReadCloser, error) {
+	resp, err := s.client.CreateSpeech(ctx, openai.CreateSpeechRequest{
+		Model:          openai.SpeechModel(s.cfg.TTSModel),
+		Input:          text,
+		Voice:          openai.SpeechVoice(s.cfg.OpenAITTSVoice),
+		ResponseFormat: openai.SpeechResponseFormatMp3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// elevenSpeech requests streamed mp3 audio from ElevenLabs. The request is tied to
+// ctx, so cancelling it (e.g. the client disconnecting) aborts the upstream call.
+func (s *Server) elevenSpeech(ctx context.Context, text, voiceID string, settings voiceSettings) (io.ReadCloser, error) {
+	if s.cfg.ElevenAPIKey == "" {
+		return nil, errElevenNotConfigured
+	}
+	if strings.TrimSpace(voiceID) == "" {
+		voiceID = s.cfg.ElevenVoiceID
+	}
+	if strings.TrimSpace(voiceID) == "" {
+		return nil, &elevenStatusError{code: http.StatusBadRequest, body: "no elevenlabs voice configured or provided"}
+	}
+	url := fmt.Sprintf("%s/v1/text-to-speech/%s/stream", s.elevenBaseURL, voiceID)
+	payload := map[string]any{
+		"text":                       text,
+		"model_id":                   s.cfg.ElevenModel,
+		"voice_settings":             settings.payload(),
+		"optimize_streaming_latency": 4,
+		"output_format":              "mp3_44100_128",
+	}
+	b, _ := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("xi-api-key", s.cfg.ElevenAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bb, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &elevenStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(bb))}
+	}
+	return resp.Body, nil
+}
+
+// POST /api/tts/stream
+// Like /api/tts but flushes audio to the client chunk by chunk as it arrives from the
+// provider, so playback can start before synthesis finishes. The upstream request
+// is bound to the client's context and is cancelled if the client goes away.
+func (s *Server) handleTTSStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	var body struct {
+		Text     string `json:"text"`
+		VoiceID  string `json:"voiceId,omitempty"`
+		Provider string `json:"provider,omitempty"`
+		voiceSettings
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Text) == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid text body")
+		return
+	}
+	if err := body.voiceSettings.validate(); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(body.Provider))
+	if provider != "" && provider != ttsProviderEleven && provider != ttsProviderOpenAI {
+		s.writeError(w, http.StatusBadRequest, "provider must be elevenlabs or openai")
+		return
+	}
+
+	audio, used, err := s.synthesize(r.Context(), body.Text, body.VoiceID, provider, body.voiceSettings)
+	if err != nil {
+		logger(r.Context()).Error("tts stream failed", "provider", used, "error", err)
+		s.writeError(w, http.StatusBadGateway, "tts error")
+		return
+	}
+	defer audio.Close()
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-TTS-Provider", used)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := audio.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			if err != io.EOF && r.Context().Err() == nil {
+				logger(r.Context()).Error("tts stream read failed", "error", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"zana-speech-backend/internal/config"
+)
+
+// fakeEleven stands in for the ElevenLabs API. Speech requests answer status when it
+// is set and audio otherwise; the last speech request body is kept in body.
+type fakeEleven struct {
+	status int
+	audio  string
+	body   map[string]any
+	speech atomic.Int32
+}
+
+func (f *fakeEleven) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/text-to-speech/") {
+		http.NotFound(w, r)
+		return
+	}
+	f.speech.Add(1)
+	_ = json.NewDecoder(r.Body).Decode(&f.body)
+	if f.status != 0 {
+		http.Error(w, `{"detail":"stub failure"}`, f.status)
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	io.WriteString(w, f.audio)
+}
+
+// newTTSTestServer is newTestServer with ElevenLabs served by eleven (nil leaves it
+// unconfigured) and OpenAI speech answering "openai-audio".
+func newTTSTestServer(t *testing.T, eleven http.Handler) (*Server, *atomic.Int32) {
+	t.Helper()
+	cfg := config.Config{TTSModel: "tts-1", OpenAITTSVoice: "alloy", ElevenModel: "eleven_multilingual_v2"}
+	if eleven != nil {
+		cfg.ElevenAPIKey = "xi-test"
+		cfg.ElevenVoiceID = "voice-default"
+	}
+	s, _ := newTestServer(t, cfg)
+	if eleven != nil {
+		ts := httptest.NewServer(eleven)
+		t.Cleanup(ts.Close)
+		s.elevenBaseURL = ts.URL
+	}
+	var openAICalls atomic.Int32
+	oai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/speech" {
+			http.NotFound(w, r)
+			return
+		}
+		openAICalls.Add(1)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		io.WriteString(w, "openai-audio")
+	}))
+	t.Cleanup(oai.Close)
+	oc := openai.DefaultConfig("test")
+	oc.BaseURL = oai.URL + "/v1"
+	s.client = openai.NewClientWithConfig(oc)
+	return s, &openAICalls
+}
+
+func ttsRequest(path, body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+}
+
+func TestTTSFallsBackToOpenAI(t *testing.T) {
+	tests := []struct {
+		name         string
+		eleven       *fakeEleven
+		body         string
+		wantCode     int
+		wantProvider string
+		wantAudio    string
+		wantOpenAI   int32
+	}{
+		{name: "elevenlabs answers", eleven: &fakeEleven{audio: "eleven-audio"}, body: `{"text":"hi"}`, wantCode: http.StatusOK, wantProvider: "elevenlabs", wantAudio: "eleven-audio"},
+		{name: "elevenlabs not configured", body: `{"text":"hi"}`, wantCode: http.StatusOK, wantProvider: "openai", wantAudio: "openai-audio", wantOpenAI: 1},
+		{name: "elevenlabs 5xx", eleven: &fakeEleven{status: http.StatusServiceUnavailable}, body: `{"text":"hi"}`, wantCode: http.StatusOK, wantProvider: "openai", wantAudio: "openai-audio", wantOpenAI: 1},
+		// A 4xx is our request's fault; OpenAI wouldn't do better
+		{name: "elevenlabs 4xx", eleven: &fakeEleven{status: http.StatusUnauthorized}, body: `{"text":"hi"}`, wantCode: http.StatusBadGateway},
+		{name: "forced elevenlabs never falls back", eleven: &fakeEleven{status: http.StatusServiceUnavailable}, body: `{"text":"hi","provider":"elevenlabs"}`, wantCode: http.StatusBadGateway},
+		{name: "forced elevenlabs not configured", body: `{"text":"hi","provider":"elevenlabs"}`, wantCode: http.StatusBadRequest},
+		{name: "forced openai", eleven: &fakeEleven{audio: "eleven-audio"}, body: `{"text":"hi","provider":"OpenAI"}`, wantCode: http.StatusOK, wantProvider: "openai", wantAudio: "openai-audio", wantOpenAI: 1},
+		{name: "unknown provider", body: `{"text":"hi","provider":"polly"}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var eleven http.Handler
+			if tc.eleven != nil {
+				eleven = tc.eleven
+			}
+			s, openAICalls := newTTSTestServer(t, eleven)
+			rec := httptest.NewRecorder()
+			s.handleTTS(rec, ttsRequest("/api/tts", tc.body))
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+			}
+			if got := openAICalls.Load(); got != tc.wantOpenAI {
+				t.Errorf("openai speech calls = %d, want %d", got, tc.wantOpenAI)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("X-TTS-Provider"); got != tc.wantProvider {
+				t.Errorf("X-TTS-Provider = %q, want %q", got, tc.wantProvider)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "audio/mpeg" {
+				t.Errorf("Content-Type = %q, want audio/mpeg", got)
+			}
+			if got := rec.Body.String(); got != tc.wantAudio {
+				t.Errorf("audio = %q, want %q", got, tc.wantAudio)
+			}
+		})
+	}
+}
+
+func TestTTSStreamFlushesChunksAsTheyArrive(t *testing.T) {
+	// start serves /api/tts/stream in front of an ElevenLabs that sends chunk-1, then
+	// holds the stream open until release is closed or the request is cancelled
+	start := func(t *testing.T) (url string, release chan struct{}, upstreamDone chan error) {
+		release = make(chan struct{})
+		upstreamDone = make(chan error, 1)
+		eleven := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "audio/mpeg")
+			io.WriteString(w, "chunk-1")
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+				io.WriteString(w, "chunk-2")
+				upstreamDone <- nil
+			case <-r.Context().Done():
+				upstreamDone <- r.Context().Err()
+			}
+		})
+		s, _ := newTTSTestServer(t, eleven)
+		ts := httptest.NewServer(http.HandlerFunc(s.handleTTSStream))
+		t.Cleanup(ts.Close)
+		return ts.URL, release, upstreamDone
+	}
+
+	t.Run("chunks reach the client before synthesis finishes", func(t *testing.T) {
+		url, release, upstreamDone := start(t)
+		resp, err := http.Post(url, "application/json", strings.NewReader(`{"text":"hello"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got := resp.Header.Get("X-TTS-Provider"); got != "elevenlabs" {
+			t.Errorf("X-TTS-Provider = %q, want elevenlabs", got)
+		}
+		first := make([]byte, len("chunk-1"))
+		if _, err := io.ReadFull(resp.Body, first); err != nil {
+			t.Fatalf("reading the first chunk while upstream is still open: %v", err)
+		}
+		if string(first) != "chunk-1" {
+			t.Errorf("first chunk = %q, want chunk-1", first)
+		}
+		close(release)
+		rest, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rest) != "chunk-2" {
+			t.Errorf("rest = %q, want chunk-2", rest)
+		}
+		if err := <-upstreamDone; err != nil {
+			t.Errorf("upstream ended with %v", err)
+		}
+	})
+
+	t.Run("client disconnect cancels the upstream request", func(t *testing.T) {
+		url, _, upstreamDone := start(t)
+		resp, err := http.Post(url, "application/json", strings.NewReader(`{"text":"hello"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := make([]byte, len("chunk-1"))
+		if _, err := io.ReadFull(resp.Body, first); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if err := <-upstreamDone; err == nil {
+			t.Error("upstream finished normally, want it cancelled")
+		}
+	})
+}
+
+func TestTTSVoiceSettings(t *testing.T) {
+	defaults := map[string]any{"stability": 0.5, "similarity_boost": 0.7, "style": 0.2, "use_speaker_boost": true}
+	tests := []struct {
+		name      string
+		body      string
+		want      map[string]any
+		wantError string
+	}{
+		{name: "defaults", body: `{"text":"hi"}`, want: defaults},
+		{name: "all provided", body: `{"text":"hi","stability":0.1,"similarityBoost":0.9,"style":0,"useSpeakerBoost":false}`,
+			want: map[string]any{"stability": 0.1, "similarity_boost": 0.9, "style": 0.0, "use_speaker_boost": false}},
+		{name: "some provided", body: `{"text":"hi","stability":1}`,
+			want: map[string]any{"stability": 1.0, "similarity_boost": 0.7, "style": 0.2, "use_speaker_boost": true}},
+		{name: "stability below range", body: `{"text":"hi","stability":-0.1}`, wantError: "stability must be between 0 and 1"},
+		{name: "similarity above range", body: `{"text":"hi","similarityBoost":1.5}`, wantError: "similarityBoost must be between 0 and 1"},
+		{name: "style above range", body: `{"text":"hi","style":2}`, wantError: "style must be between 0 and 1"},
+	}
+	for _, tc := range tests {
+		for _, path := range []string{"/api/tts", "/api/tts/stream"} {
+			t.Run(tc.name+" "+path, func(t *testing.T) {
+				eleven := &fakeEleven{audio: "eleven-audio"}
+				s, _ := newTTSTestServer(t, eleven)
+				rec := httptest.NewRecorder()
+				if path == "/api/tts" {
+					s.handleTTS(rec, ttsRequest(path, tc.body))
+				} else {
+					s.handleTTSStream(rec, ttsRequest(path, tc.body))
+				}
+				if tc.wantError != "" {
+					if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.wantError) {
+						t.Errorf("got %d %s, want 400 %q", rec.Code, rec.Body, tc.wantError)
+					}
+					if got := eleven.speech.Load(); got != 0 {
+						t.Errorf("elevenlabs called %d times for an invalid request", got)
+					}
+					return
+				}
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+				}
+				if got := eleven.body["voice_settings"]; !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("voice_settings = %v, want %v", got, tc.want)
+				}
+			})
+		}
+	}
+}
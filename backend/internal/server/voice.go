@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"zana-speech-backend/internal/store"
+)
+
+// POST /api/voice/speak
+// Transcribes the uploaded audio, handles the intent like /api/voice and answers with
+// the spoken reply as audio/mpeg, saving the client a second /api/tts round trip.
+// The transcript, reply text and intent type travel in the X-Transcript, X-Reply and
+// X-Intent-Type headers, percent-encoded since they may hold non-ASCII text. An empty
+// reply yields 204 with the headers only.
+func (s *Server) handleVoiceSpeak(w http.ResponseWriter, r *http.Request) {
+	if !s.parseAudioForm(w, r) {
+		return
+	}
+	sid := s.getOrCreateSessionID(r, w)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "audio file is required (field 'file')")
+		return
+	}
+	defer file.Close()
+	if !s.checkAudioUpload(w, file, header.Filename) {
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(r.FormValue("provider")))
+	if provider != "" && provider != ttsProviderEleven && provider != ttsProviderOpenAI {
+		s.writeError(w, http.StatusBadRequest, "provider must be elevenlabs or openai")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.VoiceTimeout)
+	defer cancel()
+
+	transcribed, ok := s.transcribe(ctx, w, r, file, header.Filename)
+	if !ok {
+		return
+	}
+	s.appendMessage(sid, store.Message{Role: "user", Content: transcribed})
+
+	var reply, intentType string
+	if strings.TrimSpace(s.getGitHubToken(sid)) == "" {
+		reply = "Please connect your GitHub account to use this application. This service helps you manage GitHub pull requests - fetching, listing, merging, and viewing PR comments."
+		intentType = "require_github_auth"
+	} else {
+		rep, intent, ok := s.answer(ctx, sid, transcribed)
+		if !ok {
+			logger(ctx).Warn("voice intent not handled")
+			s.writeError(w, http.StatusInternalServerError, "I'm having trouble understanding your request right now. Please try again.")
+			return
+		}
+		reply = rep
+		if intent != nil {
+			intentType = intent.Type
+		}
+		s.appendMessage(sid, store.Message{Role: "assistant", Content: reply})
+	}
+
+	w.Header().Set("X-Session-Id", sid)
+	w.Header().Set("X-Transcript", url.PathEscape(transcribed))
+	w.Header().Set("X-Reply", url.PathEscape(reply))
+	w.Header().Set("X-Intent-Type", intentType)
+	if strings.TrimSpace(reply) == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	audio, used, err := s.synthesize(ctx, reply, r.FormValue("voiceId"), provider, voiceSettings{})
+	if err != nil {
+		logger(ctx).Error("voice speak tts failed", "provider", used, "error", err)
+		s.writeError(w, http.StatusBadGateway, "tts error")
+		return
+	}
+	defer audio.Close()
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("X-TTS-Provider", used)
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, audio)
+}
+
+// whisperLanguages are the ISO-639-1 codes Whisper accepts as a language hint.
+var whisperLanguages = map[string]bool{
+	"af": true, "ar": true, "az": true, "be": true, "bg": true, "bs": true, "ca": true, "cs": true,
+	"cy": true, "da": true, "de": true, "el": true, "en": true, "es": true, "et": true, "fa": true,
+	"fi": true, "fr": true, "gl": true, "he": true, "hi": true, "hr": true, "hu": true, "hy": true,
+	"id": true, "is": true, "it": true, "ja": true, "kk": true, "kn": true, "ko": true, "lt": true,
+	"lv": true, "mi": true, "mk": true, "mr": true, "ms": true, "ne": true, "nl": true, "no": true,
+	"pl": true, "pt": true, "ro": true, "ru": true, "sk": true, "sl": true, "sr": true, "sv": true,
+	"sw": true, "ta": true, "th": true, "tl": true, "tr": true, "uk": true, "ur": true, "vi": true,
+	"yo": true, "zh": true,
+}
+
+// transcriptionLanguage normalizes a requested language to an ISO-639-1 code Whisper
+// knows. Anything else (including "en-US" style tags) is reduced or dropped so Whisper
+// falls back to auto-detection instead of rejecting the upload.
+func transcriptionLanguage(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if i := strings.IndexAny(v, "-_"); i > 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return ""
+	}
+	if !whisperLanguages[v] {
+		slog.Warn("ignoring unsupported transcription language", "language", v)
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	gh "zana-speech-backend/internal/github"
+)
+
+// voiceTranscript is what Whisper hears in every newVoiceSpeakTestServer upload; it
+// isn't ASCII, so the X-Transcript header has to be percent-encoded.
+const voiceTranscript = "¿fusionas acme/app 5?"
+
+// newVoiceSpeakTestServer is newChatTestServer with Whisper answering voiceTranscript,
+// OpenAI speech answering "openai-audio" and ElevenLabs served by eleven (nil leaves it
+// unconfigured). It returns the OpenAI speech calls made.
+func newVoiceSpeakTestServer(t *testing.T, o *stubOpenAI, ci *gh.ClassifiedIntent, err error, eleven http.Handler) (*Server, *atomic.Int32) {
+	t.Helper()
+	s, _ := newChatTestServer(t, o, ci, err)
+	s.cfg.MaxAudioBytes = 1 << 20
+	s.cfg.VoiceTimeout = 5 * time.Second
+	s.cfg.TTSModel = "tts-1"
+	s.cfg.OpenAITTSVoice = "alloy"
+	if eleven != nil {
+		s.cfg.ElevenAPIKey = "xi-test"
+		s.cfg.ElevenVoiceID = "voice-default"
+		s.cfg.ElevenModel = "eleven_multilingual_v2"
+		ts := httptest.NewServer(eleven)
+		t.Cleanup(ts.Close)
+		s.elevenBaseURL = ts.URL
+	}
+	var speechCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/audio/transcriptions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"text":"`+voiceTranscript+`"}`)
+	})
+	mux.HandleFunc("/v1/audio/speech", func(w http.ResponseWriter, r *http.Request) {
+		speechCalls.Add(1)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		io.WriteString(w, "openai-audio")
+	})
+	mux.Handle("/v1/chat/completions", o)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	oc := openai.DefaultConfig("test")
+	oc.BaseURL = ts.URL + "/v1"
+	s.client = openai.NewClientWithConfig(oc)
+	return s, &speechCalls
+}
+
+func TestVoiceSpeak(t *testing.T) {
+	merge := &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9}
+	tests := []struct {
+		name       string
+		intent     *gh.ClassifiedIntent
+		err        error
+		completion string
+		eleven     *fakeEleven
+		noGitHub   bool
+		wantCode   int
+		// wantReply is looked for in the decoded X-Reply header
+		wantReply    string
+		wantIntent   string
+		wantProvider string
+		wantAudio    string
+		wantOpenAI   int32
+	}{
+		{name: "intent reply spoken by elevenlabs", intent: merge, eleven: &fakeEleven{audio: "eleven-audio"},
+			wantCode: http.StatusOK, wantReply: "acme/app#5", wantIntent: "merged", wantProvider: "elevenlabs", wantAudio: "eleven-audio"},
+		{name: "model reply spoken by openai", err: gh.ErrNoIntent, completion: "Hola, ¿en qué te ayudo?",
+			wantCode: http.StatusOK, wantReply: "Hola, ¿en qué te ayudo?", wantProvider: "openai", wantAudio: "openai-audio", wantOpenAI: 1},
+		{name: "no github account", noGitHub: true, eleven: &fakeEleven{audio: "eleven-audio"},
+			wantCode: http.StatusOK, wantReply: "connect your GitHub account", wantIntent: "require_github_auth", wantProvider: "elevenlabs", wantAudio: "eleven-audio"},
+		{name: "empty reply has nothing to say", err: gh.ErrNoIntent, completion: "", eleven: &fakeEleven{audio: "eleven-audio"},
+			wantCode: http.StatusNoContent},
+		// A 4xx from ElevenLabs doesn't fall back to OpenAI, so there is no audio to send
+		{name: "tts failure", intent: merge, eleven: &fakeEleven{status: http.StatusUnauthorized},
+			wantCode: http.StatusBadGateway, wantReply: "acme/app#5", wantIntent: "merged"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var eleven http.Handler
+			if tc.eleven != nil {
+				eleven = tc.eleven
+			}
+			s, openAICalls := newVoiceSpeakTestServer(t, &stubOpenAI{reply: tc.completion}, tc.intent, tc.err, eleven)
+			if tc.noGitHub {
+				s.cfg.GitHubToken = ""
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleVoiceSpeak(rec, voiceUpload(t, "clip.wav", wavHeader))
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("X-Transcript"); got != url.PathEscape(voiceTranscript) {
+				t.Errorf("X-Transcript = %q, want %q", got, url.PathEscape(voiceTranscript))
+			}
+			reply, err := url.PathUnescape(rec.Header().Get("X-Reply"))
+			if err != nil {
+				t.Fatalf("X-Reply isn't percent-encoded: %v", err)
+			}
+			if !strings.Contains(reply, tc.wantReply) {
+				t.Errorf("X-Reply = %q, want it to contain %q", reply, tc.wantReply)
+			}
+			if got := rec.Header().Get("X-Intent-Type"); got != tc.wantIntent {
+				t.Errorf("X-Intent-Type = %q, want %q", got, tc.wantIntent)
+			}
+			if got := openAICalls.Load(); got != tc.wantOpenAI {
+				t.Errorf("openai speech calls = %d, want %d", got, tc.wantOpenAI)
+			}
+			switch tc.wantCode {
+			case http.StatusNoContent:
+				if reply != "" || rec.Body.Len() != 0 {
+					t.Errorf("204 carried reply %q and body %q", reply, rec.Body)
+				}
+				if got := tc.eleven.speech.Load(); got != 0 {
+					t.Errorf("elevenlabs called %d times for an empty reply", got)
+				}
+			case http.StatusOK:
+				if got := rec.Header().Get("X-TTS-Provider"); got != tc.wantProvider {
+					t.Errorf("X-TTS-Provider = %q, want %q", got, tc.wantProvider)
+				}
+				if got := rec.Header().Get("Content-Type"); got != "audio/mpeg" {
+					t.Errorf("Content-Type = %q, want audio/mpeg", got)
+				}
+				if got := rec.Body.String(); got != tc.wantAudio {
+					t.Errorf("audio = %q, want %q", got, tc.wantAudio)
+				}
+			default:
+				if !strings.Contains(rec.Body.String(), "tts error") {
+					t.Errorf("body = %q, want the tts error", rec.Body)
+				}
+			}
+			history := s.history(rec.Header().Get("X-Session-Id"))
+			if len(history) == 0 || history[0].Role != "user" || history[0].Content != voiceTranscript {
+				t.Errorf("history = %+v, want the transcript first", history)
+			}
+		})
+	}
+}
+
+func TestTranscriptionLanguage(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"en", "en"},
+		{"fr", "fr"},
+		{" DE ", "de"},
+		{"en-US", "en"},
+		{"pt_BR", "pt"},
+		{"zh-Hant-TW", "zh"},
+		{"xx", ""},
+		{"klingon", ""},
+		{"-US", ""},
+	}
+	for _, tc := range tests {
+		if got := transcriptionLanguage(tc.in); got != tc.want {
+			t.Errorf("transcriptionLanguage(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
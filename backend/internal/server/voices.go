@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// voicesCacheTTL is how long the ElevenLabs voice list is served from memory; it
+// changes rarely and the upstream response is large.
+const voicesCacheTTL = time.Hour
+
+// ttsVoice is one ElevenLabs voice as reported to the frontend.
+type ttsVoice struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+// voicesCache holds the last voice list fetched from ElevenLabs. The zero value is
+// an empty cache.
+type voicesCache struct {
+	mu        sync.Mutex
+	voices    []ttsVoice
+	fetchedAt time.Time
+}
+
+// GET /api/tts/voices[?refresh=true]
+// Returns { voices: [{ id, name, labels }] } from ElevenLabs, cached for an hour.
+// refresh=true skips the cache and fetches a fresh list.
+func (s *Server) handleTTSVoices(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.ElevenAPIKey == "" {
+		s.writeError(w, http.StatusBadRequest, "elevenlabs not configured")
+		return
+	}
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	voices, err := s.ttsVoices(r.Context(), refresh)
+	if err != nil {
+		logger(r.Context()).Error("elevenlabs voices failed", "error", err)
+		s.writeError(w, http.StatusBadGateway, "voices request failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"voices": voices})
+}
+
+// ttsVoices returns the cached voice list, fetching it when the cache is empty,
+// older than voicesCacheTTL or refresh is set. The lock is held across the fetch so
+// concurrent misses share one upstream call.
+func (s *Server) ttsVoices(ctx context.Context, refresh bool) ([]ttsVoice, error) {
+	c := &s.voices
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !refresh && c.voices != nil && time.Since(c.fetchedAt) < voicesCacheTTL {
+		return c.voices, nil
+	}
+	voices, err := s.fetchElevenVoices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.voices, c.fetchedAt = voices, time.Now()
+	return voices, nil
+}
+
+// fetchElevenVoices lists the account's voices from ElevenLabs using the configured key.
+func (s *Server) fetchElevenVoices(ctx context.Context) ([]ttsVoice, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.elevenBaseURL+"/v1/voices", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("xi-api-key", s.cfg.ElevenAPIKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bb, _ := io.ReadAll(resp.Body)
+		return nil, &elevenStatusError{code: resp.StatusCode, body: string(bb)}
+	}
+	var body struct {
+		Voices []struct {
+			VoiceID string            `json:"voice_id"`
+			Name    string            `json:"name"`
+			Labels  map[string]string `json:"labels"`
+		} `json:"voices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode voices: %w", err)
+	}
+	voices := make([]ttsVoice, 0, len(body.Voices))
+	for _, v := range body.Voices {
+		labels := v.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		voices = append(voices, ttsVoice{ID: v.VoiceID, Name: v.Name, Labels: labels})
+	}
+	return voices, nil
+}
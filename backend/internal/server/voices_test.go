@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTTSVoicesAreCached(t *testing.T) {
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	eleven := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/voices" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches.Add(1)
+		if got := r.Header.Get("xi-api-key"); got != "xi-test" {
+			t.Errorf("xi-api-key = %q, want the configured key", got)
+		}
+		if failing.Load() {
+			http.Error(w, "upstream down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"voices":[
+			{"voice_id":"v1","name":"Rachel","labels":{"accent":"american"},"samples":[],"settings":{"stability":0.5}},
+			{"voice_id":"v2","name":"Domi","labels":null,"fine_tuning":{"is_allowed_to_fine_tune":true}}
+		]}`)
+	})
+	s, _ := newTTSTestServer(t, eleven)
+
+	get := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleTTSVoices(rec, httptest.NewRequest(http.MethodGet, "/api/tts/voices"+query, nil))
+		return rec
+	}
+	wantVoices := []ttsVoice{
+		{ID: "v1", Name: "Rachel", Labels: map[string]string{"accent": "american"}},
+		{ID: "v2", Name: "Domi", Labels: map[string]string{}},
+	}
+
+	steps := []struct {
+		name        string
+		query       string
+		expire      bool
+		failing     bool
+		wantCode    int
+		wantFetches int32
+	}{
+		{name: "first call fetches", wantCode: http.StatusOK, wantFetches: 1},
+		{name: "second call within the TTL is cached", wantCode: http.StatusOK, wantFetches: 1},
+		{name: "refresh skips the cache", query: "?refresh=true", wantCode: http.StatusOK, wantFetches: 2},
+		{name: "expired cache fetches again", expire: true, wantCode: http.StatusOK, wantFetches: 3},
+		{name: "cached list survives an upstream outage", failing: true, wantCode: http.StatusOK, wantFetches: 3},
+		{name: "refresh during an outage fails", query: "?refresh=1", failing: true, wantCode: http.StatusBadGateway, wantFetches: 4},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.expire {
+				s.voices.fetchedAt = time.Now().Add(-voicesCacheTTL - time.Minute)
+			}
+			failing.Store(step.failing)
+			rec := get(t, step.query)
+			if rec.Code != step.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, step.wantCode, rec.Body)
+			}
+			if got := fetches.Load(); got != step.wantFetches {
+				t.Errorf("upstream fetches = %d, want %d", got, step.wantFetches)
+			}
+			if step.wantCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Voices []ttsVoice `json:"voices"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(body.Voices, wantVoices) {
+				t.Errorf("voices = %+v, want %+v", body.Voices, wantVoices)
+			}
+		})
+	}
+}
+
+func TestTTSVoicesNeedElevenLabs(t *testing.T) {
+	s, _ := newTTSTestServer(t, nil)
+	rec := httptest.NewRecorder()
+	s.handleTTSVoices(rec, httptest.NewRequest(http.MethodGet, "/api/tts/voices", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 (%s)", rec.Code, rec.Body)
+	}
+}
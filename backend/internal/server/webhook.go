@@ -0,0 +1,265 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"zana-speech-backend/internal/types"
+)
+
+// GitHub caps webhook payloads at 25 MB
+const webhookMaxBytes = 25 << 20
+
+// POST /api/github/webhook
+// Receives GitHub webhook deliveries signed with GITHUB_WEBHOOK_SECRET. pull_request
+// and pull_request_review events drop the PR lists cached for the users involved and
+// push a "notification" frame to their open WebSockets ("PR #5 just got approved");
+// other events are acknowledged and ignored.
+func (s *Server) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.GitHubWebhookSecret == "" {
+		s.writeError(w, http.StatusNotFound, "webhooks are not configured")
+		return
+	}
+	// An unsigned delivery is turned away before its body is buffered
+	sig, ok := parseWebhookSignature(r.Header.Get("X-Hub-Signature-256"))
+	if !ok {
+		s.writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBytes))
+	if err != nil {
+		s.writeError(w, http.StatusRequestEntityTooLarge, "payload too large")
+		return
+	}
+	if !webhookMACMatches(s.cfg.GitHubWebhookSecret, sig, body) {
+		s.writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	ev, err := parseWebhookEvent(r.Header.Get("X-GitHub-Event"), body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	handled := ev != nil
+	if handled {
+		s.dispatchPREvent(*ev)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "handled": handled})
+}
+
+// parseWebhookSignature decodes an X-Hub-Signature-256 header, reporting false
+// unless it is "sha256=" followed by a hex SHA-256 digest.
+func parseWebhookSignature(header string) ([]byte, bool) {
+	hexSig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return nil, false
+	}
+	sig, err := hex.DecodeString(hexSig)
+	if err != nil || len(sig) != sha256.Size {
+		return nil, false
+	}
+	return sig, true
+}
+
+// webhookMACMatches reports whether sig is the HMAC-SHA256 of body keyed with secret.
+func webhookMACMatches(secret string, sig, body []byte) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// prEvent is a webhook delivery reduced to what the users involved need to hear.
+type prEvent struct {
+	Event    string
+	Action   string
+	Repo     string
+	PRNumber int
+	Title    string
+	Sender   string
+	// State is the review verdict (APPROVED, CHANGES_REQUESTED, COMMENTED) for
+	// reviews, or merged/closed for closed PRs
+	State string
+	// Involved are the logins whose cached PR lists may now be stale
+	Involved []string
+	// Notify are the logins told about the event; Message is what they're told
+	Notify  []string
+	Message string
+}
+
+type webhookUser struct {
+	Login string `json:"login"`
+}
+
+type webhookPayload struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Number             int           `json:"number"`
+		Title              string        `json:"title"`
+		Merged             bool          `json:"merged"`
+		User               webhookUser   `json:"user"`
+		RequestedReviewers []webhookUser `json:"requested_reviewers"`
+	} `json:"pull_request"`
+	Review struct {
+		State string      `json:"state"`
+		User  webhookUser `json:"user"`
+	} `json:"review"`
+	RequestedReviewer *webhookUser `json:"requested_reviewer"`
+	Repository        struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender webhookUser `json:"sender"`
+}
+
+// parseWebhookEvent decodes a pull_request or pull_request_review delivery. It
+// returns nil without an error for event types and actions nobody is told about.
+func parseWebhookEvent(event string, body []byte) (*prEvent, error) {
+	if event != "pull_request" && event != "pull_request_review" {
+		return nil, nil
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("invalid %s payload", event)
+	}
+	if p.Repository.FullName == "" || p.PullRequest.Number <= 0 {
+		return nil, errors.New("payload is missing the repository or pull request")
+	}
+	ev := &prEvent{
+		Event:    event,
+		Action:   p.Action,
+		Repo:     p.Repository.FullName,
+		PRNumber: p.PullRequest.Number,
+		Title:    p.PullRequest.Title,
+		Sender:   p.Sender.Login,
+	}
+	author := p.PullRequest.User.Login
+	ev.Involved = append(ev.Involved, author)
+	for _, u := range p.PullRequest.RequestedReviewers {
+		ev.Involved = append(ev.Involved, u.Login)
+	}
+	pr := fmt.Sprintf("PR #%d in %s", ev.PRNumber, ev.Repo)
+
+	if event == "pull_request_review" {
+		if p.Action != "submitted" {
+			return nil, nil
+		}
+		reviewer := p.Review.User.Login
+		ev.State = strings.ToUpper(p.Review.State)
+		ev.Involved = append(ev.Involved, reviewer)
+		ev.Notify = []string{author}
+		switch ev.State {
+		case "APPROVED":
+			ev.Message = fmt.Sprintf("%s just got approved by %s.", pr, reviewer)
+		case "CHANGES_REQUESTED":
+			ev.Message = fmt.Sprintf("%s requested changes on %s.", reviewer, pr)
+		default:
+			ev.Message = fmt.Sprintf("%s left a review on %s.", reviewer, pr)
+		}
+		return ev, nil
+	}
+
+	switch p.Action {
+	case "closed":
+		ev.Notify = []string{author}
+		if p.PullRequest.Merged {
+			ev.State = "merged"
+			ev.Message = fmt.Sprintf("%s was merged by %s.", pr, ev.Sender)
+		} else {
+			ev.State = "closed"
+			ev.Message = fmt.Sprintf("%s was closed by %s.", pr, ev.Sender)
+		}
+	case "review_requested":
+		if p.RequestedReviewer == nil {
+			// A team was requested; its members aren't in the payload
+			return ev, nil
+		}
+		ev.Involved = append(ev.Involved, p.RequestedReviewer.Login)
+		ev.Notify = []string{p.RequestedReviewer.Login}
+		ev.Message = fmt.Sprintf("%s asked you to review %s.", ev.Sender, pr)
+	case "opened", "reopened", "synchronize", "ready_for_review", "converted_to_draft", "edited", "review_request_removed":
+		// Lists change but nothing is worth interrupting anyone for
+	default:
+		return nil, nil
+	}
+	return ev, nil
+}
+
+// dispatchPREvent clears the cached PR lists of connected sessions whose user is
+// involved in ev and notifies those it concerns. Nobody is told about their own
+// action.
+func (s *Server) dispatchPREvent(ev prEvent) {
+	for _, sess := range s.clients.all() {
+		login := s.store.GetUsername(sess.sid)
+		if login == "" || !containsLogin(ev.Involved, login) {
+			continue
+		}
+		s.store.ClearCachedPRs(sess.sid)
+		if ev.Message == "" || !containsLogin(ev.Notify, login) || strings.EqualFold(login, ev.Sender) {
+			continue
+		}
+		intent := &types.IntentResponse{Type: "pr_event", Payload: map[string]any{
+			"event":    ev.Event,
+			"action":   ev.Action,
+			"repo":     ev.Repo,
+			"prNumber": ev.PRNumber,
+			"title":    ev.Title,
+			"state":    ev.State,
+			"sender":   ev.Sender,
+		}}
+		if err := sess.send(types.WSServerMessage{Type: "notification", Reply: ev.Message, Intent: intent}); err != nil {
+			slog.Warn("websocket notification failed", "error", err)
+		}
+	}
+}
+
+func containsLogin(logins []string, login string) bool {
+	for _, l := range logins {
+		if l != "" && strings.EqualFold(l, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsClients tracks the open /api/ws connections so server-initiated events can
+// reach them. The zero value is ready to use.
+type wsClients struct {
+	mu    sync.Mutex
+	conns map[*wsSession]struct{}
+}
+
+func (c *wsClients) add(ws *wsSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		c.conns = make(map[*wsSession]struct{})
+	}
+	c.conns[ws] = struct{}{}
+}
+
+func (c *wsClients) remove(ws *wsSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, ws)
+}
+
+// all returns a snapshot so sends happen without holding the lock.
+func (c *wsClients) all() []*wsSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]*wsSession, 0, len(c.conns))
+	for ws := range c.conns {
+		out = append(out, ws)
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"zana-speech-backend/internal/config"
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/websocket/wstest"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	tests := []struct {
+		name      string
+		header    string
+		wantParse bool
+		wantMatch bool
+	}{
+		{name: "good", header: sign("s3cret", body), wantParse: true, wantMatch: true},
+		{name: "wrong secret", header: sign("other", body), wantParse: true},
+		{name: "tampered body", header: sign("s3cret", []byte(`{"action":"closed"}`)), wantParse: true},
+		{name: "missing", header: ""},
+		{name: "sha1 only", header: "sha1=" + strings.TrimPrefix(sign("s3cret", body), "sha256=")},
+		{name: "not hex", header: "sha256=zz"},
+		{name: "truncated digest", header: sign("s3cret", body)[:20]},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sig, ok := parseWebhookSignature(tc.header)
+			if ok != tc.wantParse {
+				t.Fatalf("parseWebhookSignature ok = %v, want %v", ok, tc.wantParse)
+			}
+			if !ok {
+				return
+			}
+			if got := webhookMACMatches("s3cret", sig, body); got != tc.wantMatch {
+				t.Errorf("webhookMACMatches = %v, want %v", got, tc.wantMatch)
+			}
+		})
+	}
+}
+
+func TestHandleGitHubWebhook(t *testing.T) {
+	body := []byte(`{"action":"opened","pull_request":{"number":5,"user":{"login":"alice"}},"repository":{"full_name":"acme/app"},"sender":{"login":"alice"}}`)
+	tests := []struct {
+		name     string
+		secret   string
+		event    string
+		sig      string
+		wantCode int
+	}{
+		{name: "not configured", event: "pull_request", sig: sign("s3cret", body), wantCode: http.StatusNotFound},
+		{name: "bad signature", secret: "s3cret", event: "pull_request", sig: sign("other", body), wantCode: http.StatusUnauthorized},
+		{name: "missing signature", secret: "s3cret", event: "pull_request", wantCode: http.StatusUnauthorized},
+		{name: "handled", secret: "s3cret", event: "pull_request", sig: sign("s3cret", body), wantCode: http.StatusAccepted},
+		{name: "ignored event", secret: "s3cret", event: "push", sig: sign("s3cret", body), wantCode: http.StatusAccepted},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t, config.Config{GitHubWebhookSecret: tc.secret})
+			req := httptest.NewRequest(http.MethodPost, "/api/github/webhook", bytes.NewReader(body))
+			req.Header.Set("X-GitHub-Event", tc.event)
+			if tc.sig != "" {
+				req.Header.Set("X-Hub-Signature-256", tc.sig)
+			}
+			rec := httptest.NewRecorder()
+			s.handleGitHubWebhook(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+// readTracker is a request body that records whether anything read it.
+type readTracker struct {
+	r    io.Reader
+	read bool
+}
+
+func (t *readTracker) Read(p []byte) (int, error) {
+	t.read = true
+	return t.r.Read(p)
+}
+
+func TestWebhookRejectsBadSignatureHeaderBeforeReadingBody(t *testing.T) {
+	for _, sig := range []string{"", "sha1=abc", "sha256=zz", "sha256=abcd"} {
+		t.Run(sig, func(t *testing.T) {
+			s, _ := newTestServer(t, config.Config{GitHubWebhookSecret: "s3cret"})
+			body := &readTracker{r: strings.NewReader(`{"action":"opened"}`)}
+			req := httptest.NewRequest(http.MethodPost, "/api/github/webhook", body)
+			req.Header.Set("X-GitHub-Event", "pull_request")
+			if sig != "" {
+				req.Header.Set("X-Hub-Signature-256", sig)
+			}
+			rec := httptest.NewRecorder()
+			s.handleGitHubWebhook(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", rec.Code)
+			}
+			if body.read {
+				t.Error("body was read before the signature header was checked")
+			}
+		})
+	}
+}
+
+func TestWebhookIsNotRateLimited(t *testing.T) {
+	const burst = 10
+	s, _ := newTestServer(t, config.Config{GitHubWebhookSecret: "s3cret"})
+	s.router = chi.NewRouter()
+	s.router.Use(s.rateLimit(newRateLimiter(2, burst)))
+	s.routes()
+
+	body := []byte(`{"action":"opened","pull_request":{"number":5,"user":{"login":"alice"}},"repository":{"full_name":"acme/app"},"sender":{"login":"alice"}}`)
+	for i := 0; i < 3*burst; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/github/webhook", bytes.NewReader(body))
+		req.RemoteAddr = "140.82.112.1:4242"
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		req.Header.Set("X-Hub-Signature-256", sign("s3cret", body))
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("delivery %d: status = %d, want 202 (%s)", i+1, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestDispatchPREventFanOut(t *testing.T) {
+	s, _ := newTestServer(t, config.Config{SessionCookieName: "session_id", MaxAudioBytes: 1 << 20, AllowedOrigin: "*"})
+	t.Cleanup(func() { s.Close() })
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWS))
+	t.Cleanup(ts.Close)
+
+	logins := map[string]string{"s_alice": "alice", "s_bob": "bob", "s_carol": "carol"}
+	clients := make(map[string]*wstest.Conn, len(logins))
+	for sid, login := range logins {
+		s.store.SetUsername(sid, login)
+		s.store.SetCachedPRs(sid, "mine", []gh.PR{{Number: 1}})
+		clients[sid] = dialWS(t, ts.URL, sid)
+		if msg := readWS(t, clients[sid]); msg.Type != "ready" {
+			t.Fatalf("%s: first frame %q, want ready", login, msg.Type)
+		}
+	}
+
+	// bob approves alice's PR: both are involved, only alice is told, carol is neither
+	ev, err := parseWebhookEvent("pull_request_review", []byte(`{
+		"action": "submitted",
+		"review": {"state": "approved", "user": {"login": "bob"}},
+		"pull_request": {"number": 5, "title": "Fix auth", "user": {"login": "Alice"}},
+		"repository": {"full_name": "acme/app"},
+		"sender": {"login": "bob"}
+	}`))
+	if err != nil || ev == nil {
+		t.Fatalf("parseWebhookEvent = %v, %v", ev, err)
+	}
+	s.dispatchPREvent(*ev)
+
+	msg := readWS(t, clients["s_alice"])
+	if msg.Type != "notification" || msg.Intent == nil || msg.Intent.Type != "pr_event" {
+		t.Fatalf("alice got %+v, want a pr_event notification", msg)
+	}
+	if msg.Reply != "PR #5 in acme/app just got approved by bob." {
+		t.Errorf("alice was told %q", msg.Reply)
+	}
+	clients["s_bob"].ExpectNothing(100 * time.Millisecond)
+	clients["s_carol"].ExpectNothing(100 * time.Millisecond)
+
+	for sid, wantCleared := range map[string]bool{"s_alice": true, "s_bob": true, "s_carol": false} {
+		if _, cached := s.store.GetCachedPRs(sid, "mine"); cached == wantCleared {
+			t.Errorf("%s: cached PRs kept = %v, want %v", logins[sid], cached, !wantCleared)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"zana-speech-backend/internal/store"
+	"zana-speech-backend/internal/types"
+	"zana-speech-backend/internal/websocket"
+)
+
+const (
+	// How often the server pings an idle client
+	wsPingInterval = 30 * time.Second
+	// A client that sends nothing (not even a pong) for this long is dropped
+	wsPongWait = 75 * time.Second
+)
+
+// GET /api/ws
+// Upgrades to a WebSocket for full-duplex voice sessions. The client sends JSON text
+// frames (see types.WSClientMessage) and raw audio as binary frames between
+// audio_start and audio_end; the server answers with JSON frames tagged by type:
+// transcript, intent (actionable GitHub requests), token (streamed assistant text for
+// everything else), done and error. notification frames (PR activity from GitHub
+// webhooks) can arrive at any time. The session cookie identifies the user, as on the
+// HTTP endpoints.
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	// Browsers don't apply CORS to WebSockets, so check the origin ourselves
+	if origin := r.Header.Get("Origin"); origin != "" && s.cfg.AllowedOrigin != "*" && origin != s.cfg.AllowedOrigin {
+		s.writeError(w, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	sid := s.getOrCreateSessionID(r, w)
+	w.Header().Set("X-Session-Id", sid)
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		logger(r.Context()).Warn("websocket upgrade failed", "error", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	defer conn.Close(websocket.CloseNormal, "")
+
+	conn.SetReadLimit(s.cfg.MaxAudioBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func() {
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go s.wsKeepalive(ctx, conn)
+
+	sess := &wsSession{s: s, conn: conn, sid: sid}
+	s.clients.add(sess)
+	defer s.clients.remove(sess)
+	sess.send(types.WSServerMessage{Type: "ready", SessionID: sid})
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) && ctx.Err() == nil {
+				logger(r.Context()).Warn("websocket read failed", "error", err)
+			}
+			return
+		}
+		sess.handleFrame(ctx, op, data)
+		// Handling can outlast the pong window; the client is clearly still there
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	}
+}
+
+// wsKeepalive pings the client until ctx ends, and closes the connection with
+// "going away" when the server shuts down.
+func (s *Server) wsKeepalive(ctx context.Context, conn *websocket.Conn) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			conn.Close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-ticker.C:
+			if err := conn.Ping(); err != nil {
+				conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// wsSession is the per-connection state of a /api/ws client.
+type wsSession struct {
+	s     *Server
+	conn  *websocket.Conn
+	sid   string
+	audio bytes.Buffer
+}
+
+func (ws *wsSession) send(msg types.WSServerMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ws.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+func (ws *wsSession) sendError(msg string) {
+	_ = ws.send(types.WSServerMessage{Type: "error", Error: msg})
+}
+
+func (ws *wsSession) handleFrame(ctx context.Context, op int, data []byte) {
+	if op == websocket.BinaryMessage {
+		if int64(ws.audio.Len()+len(data)) > ws.s.cfg.MaxAudioBytes {
+			ws.audio.Reset()
+			ws.sendError("audio too large; start a new recording")
+			return
+		}
+		ws.audio.Write(data)
+		return
+	}
+	var msg types.WSClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		ws.sendError("invalid JSON message")
+		return
+	}
+	switch msg.Type {
+	case "text":
+		text := strings.TrimSpace(msg.Message)
+		if text == "" {
+			ws.sendError("message is required")
+			return
+		}
+		if msg := ws.s.messageTooLong(text); msg != "" {
+			ws.sendError(msg)
+			return
+		}
+		ws.respond(ctx, text)
+	case "audio_start":
+		ws.audio.Reset()
+	case "audio_end":
+		if ws.audio.Len() == 0 {
+			ws.sendError("no audio received")
+			return
+		}
+		filename := msg.Filename
+		if filename == "" {
+			filename = "audio.webm"
+		}
+		if problem := audioProblem(filename, ws.audio.Bytes()); problem != "" {
+			ws.audio.Reset()
+			ws.sendError(problem)
+			return
+		}
+		tctx, cancel := context.WithTimeout(ctx, ws.s.cfg.VoiceTimeout)
+		transcribed, err := ws.s.speechToText(tctx, bytes.NewReader(ws.audio.Bytes()), filename, msg.Language, msg.Prompt)
+		cancel()
+		ws.audio.Reset()
+		if err != nil {
+			if !errors.Is(err, errEmptyTranscription) {
+				logger(ctx).Error("websocket transcription failed", "error", err)
+			}
+			ws.sendError("transcription failed")
+			return
+		}
+		if err := ws.send(types.WSServerMessage{Type: "transcript", Text: transcribed}); err != nil {
+			return
+		}
+		ws.respond(ctx, transcribed)
+	default:
+		ws.sendError("unknown message type")
+	}
+}
+
+// respond handles one user utterance: GitHub intents are executed and returned as an
+// intent frame; anything the classifier can't act on is answered by a streamed
+// completion. Either way the turn ends with a done frame carrying the full reply.
+func (ws *wsSession) respond(ctx context.Context, text string) {
+	s := ws.s
+	s.appendMessage(ws.sid, store.Message{Role: "user", Content: text})
+
+	if strings.TrimSpace(s.getGitHubToken(ws.sid)) == "" {
+		reply := "Please connect your GitHub account to use this application. This service helps you manage GitHub pull requests - fetching, listing, merging, and viewing PR comments."
+		_ = ws.send(types.WSServerMessage{Type: "intent", Reply: reply, Intent: &types.IntentResponse{Type: "require_github_auth"}})
+		_ = ws.send(types.WSServerMessage{Type: "done", Reply: reply})
+		return
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, s.cfg.ChatTimeout)
+	reply, intent, ok := s.classifyAndHandle(cctx, ws.sid, text)
+	cancel()
+	if ok {
+		s.appendMessage(ws.sid, store.Message{Role: "assistant", Content: reply})
+		_ = ws.send(types.WSServerMessage{Type: "intent", Reply: reply, Intent: intent})
+		_ = ws.send(types.WSServerMessage{Type: "done", Reply: reply})
+		return
+	}
+
+	sctx, cancel := context.WithTimeout(ctx, s.cfg.StreamTimeout)
+	defer cancel()
+	final, err := s.streamCompletion(sctx, ws.sid, func(chunk string) error {
+		return ws.send(types.WSServerMessage{Type: "token", Text: chunk})
+	})
+	if strings.TrimSpace(final) != "" {
+		s.appendMessage(ws.sid, store.Message{Role: "assistant", Content: final})
+	}
+	if err != nil && final == "" {
+		logger(ctx).Error("websocket stream failed", "error", err)
+		ws.sendError("I'm having trouble understanding your request right now. Please try again.")
+		return
+	}
+	_ = ws.send(types.WSServerMessage{Type: "done", Reply: final})
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gh "zana-speech-backend/internal/github"
+	"zana-speech-backend/internal/types"
+	"zana-speech-backend/internal/websocket"
+	"zana-speech-backend/internal/websocket/wstest"
+)
+
+// dialWS opens a WebSocket to serverURL's /api/ws, with sid as the session cookie
+// unless it is empty.
+func dialWS(t *testing.T, serverURL, sid string) *wstest.Conn {
+	t.Helper()
+	header := http.Header{}
+	if sid != "" {
+		header.Set("Cookie", (&http.Cookie{Name: "session_id", Value: sid}).String())
+	}
+	return wstest.Dial(t, serverURL+"/api/ws", header)
+}
+
+// startWS serves s.handleWS, connects to it and reads the ready frame.
+func startWS(t *testing.T, s *Server) *wstest.Conn {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWS))
+	t.Cleanup(ts.Close)
+	c := dialWS(t, ts.URL, "")
+	if ready := readWS(t, c); ready.Type != "ready" || ready.SessionID == "" {
+		t.Fatalf("first frame = %+v, want ready with a session", ready)
+	}
+	return c
+}
+
+func readWS(t *testing.T, c *wstest.Conn) types.WSServerMessage {
+	t.Helper()
+	var msg types.WSServerMessage
+	c.ReadJSON(&msg)
+	return msg
+}
+
+func TestWSTurns(t *testing.T) {
+	merge := &gh.ClassifiedIntent{Type: "merge_pr", Args: map[string]any{"repo": "acme/app", "pr_number": float64(5)}, Confidence: 0.9}
+
+	t.Run("text intent", func(t *testing.T) {
+		s, _ := newVoiceSpeakTestServer(t, &stubOpenAI{}, merge, nil, nil)
+		c := startWS(t, s)
+		c.WriteJSON(types.WSClientMessage{Type: "text", Message: "merge acme/app 5"})
+		intent := readWS(t, c)
+		if intent.Type != "intent" || intent.Intent == nil || intent.Intent.Type != "merged" || !strings.Contains(intent.Reply, "acme/app#5") {
+			t.Errorf("got %+v, want the merged intent", intent)
+		}
+		if done := readWS(t, c); done.Type != "done" || done.Reply != intent.Reply {
+			t.Errorf("got %+v, want done with the intent's reply", done)
+		}
+	})
+
+	t.Run("text answered by the model", func(t *testing.T) {
+		s, _ := newVoiceSpeakTestServer(t, &stubOpenAI{reply: "Hello there"}, nil, gh.ErrNoIntent, nil)
+		c := startWS(t, s)
+		c.WriteJSON(types.WSClientMessage{Type: "text", Message: "hi"})
+		var streamed string
+		for {
+			msg := readWS(t, c)
+			if msg.Type != "token" {
+				if msg.Type != "done" || msg.Reply != "Hello there" {
+					t.Errorf("got %+v, want done with the full reply", msg)
+				}
+				break
+			}
+			streamed += msg.Text
+		}
+		if streamed != "Hello there" {
+			t.Errorf("streamed %q, want the model's reply", streamed)
+		}
+	})
+
+	t.Run("audio", func(t *testing.T) {
+		s, _ := newVoiceSpeakTestServer(t, &stubOpenAI{}, merge, nil, nil)
+		c := startWS(t, s)
+		c.WriteJSON(types.WSClientMessage{Type: "audio_start"})
+		c.WriteFrame(true, wstest.OpBinary, wavHeader[:6])
+		c.WriteFrame(true, wstest.OpBinary, wavHeader[6:])
+		c.WriteJSON(types.WSClientMessage{Type: "audio_end", Filename: "clip.wav"})
+		if tr := readWS(t, c); tr.Type != "transcript" || tr.Text != voiceTranscript {
+			t.Errorf("got %+v, want the transcript", tr)
+		}
+		if intent := readWS(t, c); intent.Type != "intent" || intent.Intent == nil || intent.Intent.Type != "merged" {
+			t.Errorf("got %+v, want the merged intent", intent)
+		}
+		if done := readWS(t, c); done.Type != "done" {
+			t.Errorf("got %+v, want done", done)
+		}
+	})
+}
+
+func TestWSErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		send      func(c *wstest.Conn)
+		wantError string
+	}{
+		{name: "invalid JSON", send: func(c *wstest.Conn) {
+			c.WriteFrame(true, wstest.OpText, []byte("{"))
+		}, wantError: "invalid JSON message"},
+		{name: "unknown type", send: func(c *wstest.Conn) {
+			c.WriteJSON(types.WSClientMessage{Type: "dance"})
+		}, wantError: "unknown message type"},
+		{name: "empty text", send: func(c *wstest.Conn) {
+			c.WriteJSON(types.WSClientMessage{Type: "text", Message: "  "})
+		}, wantError: "message is required"},
+		{name: "text too long", send: func(c *wstest.Conn) {
+			c.WriteJSON(types.WSClientMessage{Type: "text", Message: strings.Repeat("a", 1001)})
+		}, wantError: "message is too long"},
+		{name: "audio end without audio", send: func(c *wstest.Conn) {
+			c.WriteJSON(types.WSClientMessage{Type: "audio_end"})
+		}, wantError: "no audio received"},
+		{name: "audio that isn't audio", send: func(c *wstest.Conn) {
+			c.WriteFrame(true, wstest.OpBinary, []byte("%PDF-1.7"))
+			c.WriteJSON(types.WSClientMessage{Type: "audio_end", Filename: "clip.wav"})
+		}, wantError: "clip.wav doesn't look like audio"},
+		{name: "recording over the audio cap", send: func(c *wstest.Conn) {
+			chunk := bytes.Repeat([]byte("x"), 600<<10)
+			c.WriteFrame(true, wstest.OpBinary, chunk)
+			c.WriteFrame(true, wstest.OpBinary, chunk)
+		}, wantError: "audio too large"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newVoiceSpeakTestServer(t, &stubOpenAI{}, nil, gh.ErrNoIntent, nil)
+			c := startWS(t, s)
+			tc.send(c)
+			if msg := readWS(t, c); msg.Type != "error" || !strings.Contains(msg.Error, tc.wantError) {
+				t.Errorf("got %+v, want error %q", msg, tc.wantError)
+			}
+			// The connection stays usable after an error
+			c.WriteFrame(true, wstest.OpPing, []byte("still there?"))
+			if _, op, payload := c.ReadFrame(); op != wstest.OpPong || string(payload) != "still there?" {
+				t.Errorf("got opcode %d %q, want a pong", op, payload)
+			}
+		})
+	}
+}
+
+func TestWSClosesOnOversizedFrame(t *testing.T) {
+	s, _ := newVoiceSpeakTestServer(t, &stubOpenAI{}, nil, gh.ErrNoIntent, nil)
+	c := startWS(t, s)
+	c.WriteFrame(true, wstest.OpBinary, bytes.Repeat([]byte("x"), int(s.cfg.MaxAudioBytes)+1))
+	if code, _ := c.ReadClose(); code != websocket.CloseMessageTooBig {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+}
@@ -8,14 +8,16 @@ import (
 	"zana-speech-backend/internal/db"
 )
 
-// DatabaseStore stores GitHub authentication data in PostgreSQL
+// DatabaseStore stores GitHub authentication data and chat history in PostgreSQL
 type DatabaseStore struct {
 	db *db.DB
+	// maxMessages caps stored history per session; <= 0 keeps everything
+	maxMessages int
 }
 
 // NewDatabaseStore creates a new database store
-func NewDatabaseStore(database *db.DB) *DatabaseStore {
-	return &DatabaseStore{db: database}
+func NewDatabaseStore(database *db.DB, maxMessages int) *DatabaseStore {
+	return &DatabaseStore{db: database, maxMessages: maxMessages}
 }
 
 // GitHubAuth represents GitHub authentication data
@@ -23,54 +25,70 @@ type GitHubAuth struct {
 	SessionID   string
 	GitHubToken string
 	GitHubOwner string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// IsDefault marks the account used when a request doesn't pick one
+	IsDefault bool
+	// RefreshToken renews GitHubToken once TokenExpiry passes; both are empty for
+	// tokens that don't expire
+	RefreshToken string
+	TokenExpiry  time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
-// SaveGitHubAuth saves or updates GitHub authentication data for a session
-func (ds *DatabaseStore) SaveGitHubAuth(sessionID, githubToken, githubOwner string) error {
+// SaveGitHubAuth saves or updates GitHub authentication data for one account of a
+// session and makes it the session's default account. refreshToken and expiry are
+// empty for tokens that don't expire
+func (ds *DatabaseStore) SaveGitHubAuth(sessionID, githubToken, githubOwner, refreshToken string, expiry time.Time) error {
 	if sessionID == "" || githubToken == "" || githubOwner == "" {
 		return fmt.Errorf("session_id, github_token, and github_owner are required")
 	}
 
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save GitHub auth: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Clear the old default first so the one-default-per-session index holds
+	if _, err := tx.Exec(`UPDATE github_auth SET is_default = FALSE WHERE session_id = $1 AND is_default`, sessionID); err != nil {
+		return fmt.Errorf("failed to save GitHub auth: %w", err)
+	}
 	query := `
-		INSERT INTO github_auth (session_id, github_token, github_owner, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
-		ON CONFLICT (session_id) 
+		INSERT INTO github_auth (session_id, github_token, github_owner, is_default, refresh_token, token_expiry, created_at, updated_at)
+		VALUES ($1, $2, $3, TRUE, $4, $5, NOW(), NOW())
+		ON CONFLICT (session_id, github_owner) 
 		DO UPDATE SET 
 			github_token = EXCLUDED.github_token,
-			github_owner = EXCLUDED.github_owner,
+			is_default = TRUE,
+			refresh_token = EXCLUDED.refresh_token,
+			token_expiry = EXCLUDED.token_expiry,
 			updated_at = NOW()
 	`
-
-	_, err := ds.db.Exec(query, sessionID, githubToken, githubOwner)
-	if err != nil {
+	if _, err := tx.Exec(query, sessionID, githubToken, githubOwner, refreshToken, nullTime(expiry)); err != nil {
 		return fmt.Errorf("failed to save GitHub auth: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save GitHub auth: %w", err)
+	}
 	return nil
 }
 
-// GetGitHubAuth retrieves GitHub authentication data for a session
+// GetGitHubAuth retrieves the default GitHub account for a session
 func (ds *DatabaseStore) GetGitHubAuth(sessionID string) (*GitHubAuth, error) {
 	if sessionID == "" {
 		return nil, fmt.Errorf("session_id is required")
 	}
 
-	var auth GitHubAuth
 	query := `
-		SELECT session_id, github_token, github_owner, created_at, updated_at
+		SELECT session_id, github_token, github_owner, is_default, refresh_token, token_expiry, created_at, updated_at
 		FROM github_auth
 		WHERE session_id = $1
+		ORDER BY is_default DESC, updated_at DESC
+		LIMIT 1
 	`
 
-	err := ds.db.QueryRow(query, sessionID).Scan(
-		&auth.SessionID,
-		&auth.GitHubToken,
-		&auth.GitHubOwner,
-		&auth.CreatedAt,
-		&auth.UpdatedAt,
-	)
+	auth, err := scanGitHubAuth(ds.db.QueryRow(query, sessionID))
 
 	if err == sql.ErrNoRows {
 		return nil, nil // Not found, return nil
@@ -83,7 +101,94 @@ func (ds *DatabaseStore) GetGitHubAuth(sessionID string) (*GitHubAuth, error) {
 	return &auth, nil
 }
 
-// DeleteGitHubAuth removes GitHub authentication data for a session
+// ListGitHubAuth retrieves every GitHub account connected to a session, default first
+func (ds *DatabaseStore) ListGitHubAuth(sessionID string) ([]GitHubAuth, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session_id is required")
+	}
+
+	query := `
+		SELECT session_id, github_token, github_owner, is_default, refresh_token, token_expiry, created_at, updated_at
+		FROM github_auth
+		WHERE session_id = $1
+		ORDER BY is_default DESC, github_owner
+	`
+
+	rows, err := ds.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GitHub auth: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []GitHubAuth
+	for rows.Next() {
+		auth, err := scanGitHubAuth(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan GitHub auth: %w", err)
+		}
+		accounts = append(accounts, auth)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list GitHub auth: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// SetDefaultGitHubAuth makes the session's account with the given login (matched
+// case-insensitively) its default. Returns false when no such account is connected.
+func (ds *DatabaseStore) SetDefaultGitHubAuth(sessionID, githubOwner string) (bool, error) {
+	if sessionID == "" || githubOwner == "" {
+		return false, fmt.Errorf("session_id and github_owner are required")
+	}
+
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to set default GitHub auth: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM github_auth WHERE session_id = $1 AND LOWER(github_owner) = LOWER($2))`
+	if err := tx.QueryRow(query, sessionID, githubOwner).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to set default GitHub auth: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	if _, err := tx.Exec(`UPDATE github_auth SET is_default = FALSE WHERE session_id = $1 AND is_default`, sessionID); err != nil {
+		return false, fmt.Errorf("failed to set default GitHub auth: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE github_auth SET is_default = TRUE WHERE session_id = $1 AND LOWER(github_owner) = LOWER($2)`, sessionID, githubOwner); err != nil {
+		return false, fmt.Errorf("failed to set default GitHub auth: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to set default GitHub auth: %w", err)
+	}
+	return true, nil
+}
+
+// UpdateGitHubToken replaces one account's token after a refresh, leaving which
+// account is the session's default untouched
+func (ds *DatabaseStore) UpdateGitHubToken(sessionID, githubOwner, githubToken, refreshToken string, expiry time.Time) error {
+	if sessionID == "" || githubOwner == "" || githubToken == "" {
+		return fmt.Errorf("session_id, github_owner, and github_token are required")
+	}
+
+	query := `
+		UPDATE github_auth
+		SET github_token = $3, refresh_token = $4, token_expiry = $5, updated_at = NOW()
+		WHERE session_id = $1 AND github_owner = $2
+	`
+	if _, err := ds.db.Exec(query, sessionID, githubOwner, githubToken, refreshToken, nullTime(expiry)); err != nil {
+		return fmt.Errorf("failed to update GitHub token: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteGitHubAuth removes every GitHub account connected to a session
 func (ds *DatabaseStore) DeleteGitHubAuth(sessionID string) error {
 	if sessionID == "" {
 		return fmt.Errorf("session_id is required")
@@ -98,36 +203,175 @@ func (ds *DatabaseStore) DeleteGitHubAuth(sessionID string) error {
 	return nil
 }
 
+// DeleteGitHubAccount removes the session's account with the given login (matched
+// case-insensitively), leaving the others
+func (ds *DatabaseStore) DeleteGitHubAccount(sessionID, githubOwner string) error {
+	if sessionID == "" || githubOwner == "" {
+		return fmt.Errorf("session_id and github_owner are required")
+	}
+
+	query := `DELETE FROM github_auth WHERE session_id = $1 AND LOWER(github_owner) = LOWER($2)`
+	if _, err := ds.db.Exec(query, sessionID, githubOwner); err != nil {
+		return fmt.Errorf("failed to delete GitHub account: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAuthOlderThan removes GitHub authentication rows not updated within d
+// and returns how many were deleted
+func (ds *DatabaseStore) DeleteAuthOlderThan(d time.Duration) (int, error) {
+	if d <= 0 {
+		return 0, fmt.Errorf("max age must be positive")
+	}
+
+	query := `DELETE FROM github_auth WHERE updated_at < $1`
+	res, err := ds.db.Exec(query, time.Now().Add(-d))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale GitHub auth: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted GitHub auth: %w", err)
+	}
+
+	return int(n), nil
+}
+
 // GetGitHubAuthByOwner retrieves GitHub authentication data by owner username
 func (ds *DatabaseStore) GetGitHubAuthByOwner(owner string) (*GitHubAuth, error) {
 	if owner == "" {
 		return nil, fmt.Errorf("owner is required")
 	}
 
-	var auth GitHubAuth
 	query := `
-		SELECT session_id, github_token, github_owner, created_at, updated_at
+		SELECT session_id, github_token, github_owner, is_default, refresh_token, token_expiry, created_at, updated_at
 		FROM github_auth
 		WHERE github_owner = $1
 		ORDER BY updated_at DESC
 		LIMIT 1
 	`
 
-	err := ds.db.QueryRow(query, owner).Scan(
+	auth, err := scanGitHubAuth(ds.db.QueryRow(query, owner))
+
+	if err == sql.ErrNoRows {
+		return nil, nil // Not found
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GitHub auth by owner: %w", err)
+	}
+
+	return &auth, nil
+}
+
+// scanGitHubAuth reads one github_auth row selected in the column order the queries above use
+func scanGitHubAuth(row interface{ Scan(...any) error }) (GitHubAuth, error) {
+	var auth GitHubAuth
+	var expiry sql.NullTime
+	err := row.Scan(
 		&auth.SessionID,
 		&auth.GitHubToken,
 		&auth.GitHubOwner,
+		&auth.IsDefault,
+		&auth.RefreshToken,
+		&expiry,
 		&auth.CreatedAt,
 		&auth.UpdatedAt,
 	)
+	if expiry.Valid {
+		auth.TokenExpiry = expiry.Time
+	}
+	return auth, err
+}
 
-	if err == sql.ErrNoRows {
-		return nil, nil // Not found
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// AppendMessage stores a chat message for a session and trims the oldest rows
+// beyond maxMessages, mirroring MemoryStore's trimming
+func (ds *DatabaseStore) AppendMessage(sessionID string, msg Message) error {
+	if sessionID == "" {
+		return fmt.Errorf("session_id is required")
 	}
 
+	tx, err := ds.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get GitHub auth by owner: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-	return &auth, nil
+	insert := `INSERT INTO messages (session_id, role, content, created_at) VALUES ($1, $2, $3, NOW())`
+	if _, err := tx.Exec(insert, sessionID, msg.Role, msg.Content); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to append message: %w", err)
+	}
+
+	if ds.maxMessages > 0 {
+		trim := `
+			DELETE FROM messages
+			WHERE session_id = $1 AND id NOT IN (
+				SELECT id FROM messages WHERE session_id = $1 ORDER BY id DESC LIMIT $2
+			)
+		`
+		if _, err := tx.Exec(trim, sessionID, ds.maxMessages); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to trim messages: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit message: %w", err)
+	}
+
+	return nil
+}
+
+// GetMessages returns a session's chat history, oldest first
+func (ds *DatabaseStore) GetMessages(sessionID string) ([]Message, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session_id is required")
+	}
+
+	query := `
+		SELECT role, content
+		FROM messages
+		WHERE session_id = $1
+		ORDER BY id ASC
+	`
+
+	rows, err := ds.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := make([]Message, 0)
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.Role, &m.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	return msgs, nil
+}
+
+// DeleteMessages removes a session's chat history
+func (ds *DatabaseStore) DeleteMessages(sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session_id is required")
+	}
+
+	query := `DELETE FROM messages WHERE session_id = $1`
+	if _, err := ds.db.Exec(query, sessionID); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"zana-speech-backend/internal/db/dbtest"
+)
+
+// seedAuth saves a login for each session and backdates its updated_at by age.
+func seedAuth(t *testing.T, ds *DatabaseStore, ages map[string]time.Duration) {
+	t.Helper()
+	for sid, age := range ages {
+		if err := ds.SaveGitHubAuth(sid, "tok-"+sid, "owner-"+sid, "", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ds.db.Exec(`UPDATE github_auth SET updated_at = $1 WHERE session_id = $2`, time.Now().Add(-age), sid); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteAuthOlderThan(t *testing.T) {
+	ds := NewDatabaseStore(dbtest.New(t), 40)
+	seedAuth(t, ds, map[string]time.Duration{
+		"old":     48 * time.Hour,
+		"older":   30 * 24 * time.Hour,
+		"fresh":   time.Minute,
+		"borders": 23 * time.Hour,
+	})
+
+	n, err := ds.DeleteAuthOlderThan(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d rows, want 2", n)
+	}
+	for sid, wantKept := range map[string]bool{"old": false, "older": false, "fresh": true, "borders": true} {
+		auth, err := ds.GetGitHubAuth(sid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := auth != nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", sid, kept, wantKept)
+		}
+	}
+
+	if n, err := ds.DeleteAuthOlderThan(24 * time.Hour); err != nil || n != 0 {
+		t.Errorf("second pass deleted %d (err %v), want 0", n, err)
+	}
+}
+
+func TestDeleteAuthOlderThanRejectsNonPositive(t *testing.T) {
+	// Rejected before the database is touched
+	ds := NewDatabaseStore(nil, 40)
+	for _, d := range []time.Duration{0, -time.Hour} {
+		if _, err := ds.DeleteAuthOlderThan(d); err == nil {
+			t.Errorf("DeleteAuthOlderThan(%v) succeeded, want an error", d)
+		}
+	}
+}
+
+func TestStartAuthJanitorDeletesStaleLogins(t *testing.T) {
+	ds := NewDatabaseStore(dbtest.New(t), 40)
+	seedAuth(t, ds, map[string]time.Duration{"old": 48 * time.Hour, "fresh": time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The first sweep runs immediately; a long interval means no second one
+	ds.StartAuthJanitor(ctx, time.Hour, 24*time.Hour)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		auth, err := ds.GetGitHubAuth("old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor never deleted the stale login")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if auth, err := ds.GetGitHubAuth("fresh"); err != nil || auth == nil {
+		t.Errorf("fresh login = %v (err %v), want it kept", auth, err)
+	}
+}
+
+func TestDeleteGitHubAccountMatchesLoginCaseInsensitively(t *testing.T) {
+	ds := NewDatabaseStore(dbtest.New(t), 40)
+	for _, login := range []string{"Alice", "bob"} {
+		if err := ds.SaveGitHubAuth("s1", "tok-"+login, login, "", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ds.DeleteGitHubAccount("s1", "ALICE"); err != nil {
+		t.Fatal(err)
+	}
+	auths, err := ds.ListGitHubAuth("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auths) != 1 || auths[0].GitHubOwner != "bob" {
+		t.Errorf("accounts left = %v, want only bob", auths)
+	}
+}
@@ -7,12 +7,18 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type GitHubToken struct {
 	AccessToken string `json:"access_token"`
 	TokenType   string `json:"token_type,omitempty"`
 	Scope       string `json:"scope,omitempty"`
+	// Set when GitHub issued an expiring token; RefreshToken renews it after Expiry
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+	// SessionID is the session that connected the token; only it may log it out
+	SessionID string `json:"session_id,omitempty"`
 }
 
 // FileTokenStore persists a single-user GitHub token on disk.
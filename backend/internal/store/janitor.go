@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SetSessionTTL sets how long a session may stay idle before the janitor
+// evicts it. Non-positive values are ignored.
+func (m *MemoryStore) SetSessionTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessionTTL = ttl
+}
+
+// StartJanitor sweeps expired entries every interval until ctx is cancelled.
+func (m *MemoryStore) StartJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n := m.Sweep(); n > 0 {
+					slog.Info("janitor evicted idle sessions", "count", n)
+				}
+			}
+		}
+	}()
+}
+
+// StartAuthJanitor deletes GitHub logins not updated within maxAge every interval
+// until ctx is cancelled. It runs once immediately so a restart doesn't wait a full
+// interval.
+func (ds *DatabaseStore) StartAuthJanitor(ctx context.Context, interval, maxAge time.Duration) {
+	if interval <= 0 || maxAge <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := ds.DeleteAuthOlderThan(maxAge); err != nil {
+				slog.Error("auth janitor failed", "error", err)
+			} else if n > 0 {
+				slog.Info("auth janitor deleted stale GitHub logins", "count", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sweep removes sessions idle longer than the session TTL along with all of
+// their per-session state, and drops expired PR caches, pending intents, focus
+// entries and OAuth states from live sessions. Returns the number of sessions evicted.
+func (m *MemoryStore) Sweep() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+
+	evicted := 0
+	for sid, touched := range m.touchedBySession {
+		if now.Sub(touched) > m.sessionTTL {
+			m.deleteSessionLocked(sid)
+			evicted++
+		}
+	}
+	for sid, c := range m.lastPRsBySession {
+		if now.Sub(c.UpdatedAt) > lastPRsTTL {
+			delete(m.lastPRsBySession, sid)
+		}
+	}
+	for sid, p := range m.pendingBySession {
+		if now.Sub(p.UpdatedAt) > pendingTTL {
+			delete(m.pendingBySession, sid)
+		}
+	}
+	for sid, byKind := range m.cachedPRsBySession {
+		for kind, c := range byKind {
+			if now.Sub(c.UpdatedAt) > prListCacheTTL {
+				delete(byKind, kind)
+			}
+		}
+		if len(byKind) == 0 {
+			delete(m.cachedPRsBySession, sid)
+		}
+	}
+	for sid, c := range m.lastCommentBySession {
+		if now.Sub(c.CreatedAt) > lastCommentTTL {
+			delete(m.lastCommentBySession, sid)
+		}
+	}
+	for sid, byAction := range m.recentActionsBySession {
+		for action, at := range byAction {
+			if now.Sub(at) > actionDedupeTTL {
+				delete(byAction, action)
+			}
+		}
+		if len(byAction) == 0 {
+			delete(m.recentActionsBySession, sid)
+		}
+	}
+	for sid, f := range m.focusBySession {
+		if now.Sub(f.UpdatedAt) > focusTTL {
+			delete(m.focusBySession, sid)
+		}
+	}
+	for state, e := range m.sessionByOAuthState {
+		if now.Sub(e.CreatedAt) > oauthStateTTL {
+			delete(m.sessionByOAuthState, state)
+			if m.oauthStateBySession[e.SessionID] == state {
+				delete(m.oauthStateBySession, e.SessionID)
+			}
+		}
+	}
+	return evicted
+}
+
+// deleteSessionLocked drops every map entry for a session; callers must hold m.mu.
+func (m *MemoryStore) deleteSessionLocked(sessionID string) {
+	if st, ok := m.oauthStateBySession[sessionID]; ok {
+		delete(m.sessionByOAuthState, st)
+		delete(m.oauthStateBySession, sessionID)
+	}
+	delete(m.sessions, sessionID)
+	delete(m.systemPromptBySession, sessionID)
+	delete(m.usernameBySession, sessionID)
+	delete(m.lastPRsBySession, sessionID)
+	delete(m.pendingBySession, sessionID)
+	delete(m.reviewedSHABySession, sessionID)
+	delete(m.focusBySession, sessionID)
+	delete(m.cachedPRsBySession, sessionID)
+	delete(m.lastCommentBySession, sessionID)
+	delete(m.recentActionsBySession, sessionID)
+	delete(m.touchedBySession, sessionID)
+}
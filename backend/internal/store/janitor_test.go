@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newClockedMemoryStore returns a MemoryStore on a clock moved by the returned func.
+func newClockedMemoryStore(t *testing.T) (*MemoryStore, func(time.Duration)) {
+	t.Helper()
+	m := NewMemoryStore(testMaxMessages)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestSweepEvictsIdleSessions(t *testing.T) {
+	m, advance := newClockedMemoryStore(t)
+	m.SetSessionTTL(time.Hour)
+
+	for _, sid := range []string{"idle", "active"} {
+		m.Append(sid, Message{Role: "user", Content: "hi"})
+		m.SetUsername(sid, "alice")
+		m.SetOAuthState(sid, "state-"+sid, "verifier")
+	}
+	advance(30 * time.Minute)
+	m.Append("active", Message{Role: "user", Content: "still here"})
+	advance(31 * time.Minute)
+
+	if n := m.Sweep(); n != 1 {
+		t.Fatalf("Sweep evicted %d sessions, want 1", n)
+	}
+	if m.HasSession("idle") || len(m.Get("idle")) != 0 || m.GetUsername("idle") != "" {
+		t.Error("idle session survived the sweep")
+	}
+	if m.GetSessionByOAuthState("state-idle") != "" {
+		t.Error("idle session's OAuth state still resolves")
+	}
+	if !m.HasSession("active") || len(m.Get("active")) != 2 || m.GetUsername("active") != "alice" {
+		t.Error("active session was evicted")
+	}
+
+	// Nothing left to evict until the active one idles out too
+	if n := m.Sweep(); n != 0 {
+		t.Errorf("second Sweep evicted %d", n)
+	}
+	advance(time.Hour + time.Second)
+	if n := m.Sweep(); n != 1 || len(m.touchedBySession) != 0 {
+		t.Errorf("Sweep evicted %d, %d sessions left", n, len(m.touchedBySession))
+	}
+}
+
+func TestSweepDropsExpiredStateFromLiveSessions(t *testing.T) {
+	m, advance := newClockedMemoryStore(t)
+	m.Append("s1", Message{Role: "user", Content: "merge 5"})
+	m.SetPendingIntent("s1", "merge_pr", map[string]any{"pr_number": 5})
+	m.SetFocusedPR("s1", "acme/app", 5)
+	m.SetOAuthState("s1", "state-1", "verifier")
+
+	// Past the pending and OAuth state TTLs but inside focus and the session TTL
+	advance(11 * time.Minute)
+	if n := m.Sweep(); n != 0 {
+		t.Fatalf("Sweep evicted %d live sessions", n)
+	}
+	if len(m.pendingBySession) != 0 || len(m.sessionByOAuthState) != 0 || len(m.oauthStateBySession) != 0 {
+		t.Errorf("expired state kept: %d pending, %d oauth states", len(m.pendingBySession), len(m.sessionByOAuthState))
+	}
+	if _, ok := m.focusBySession["s1"]; !ok {
+		t.Error("focus dropped before its TTL")
+	}
+	if len(m.Get("s1")) != 1 {
+		t.Error("history dropped from a live session")
+	}
+
+	advance(5 * time.Minute)
+	m.Sweep()
+	if _, ok := m.focusBySession["s1"]; ok {
+		t.Error("focus kept past its TTL")
+	}
+}
+
+func TestSetSessionTTLIgnoresNonPositive(t *testing.T) {
+	m := NewMemoryStore(testMaxMessages)
+	m.SetSessionTTL(0)
+	m.SetSessionTTL(-time.Hour)
+	if m.sessionTTL != defaultSessionTTL {
+		t.Errorf("sessionTTL = %v, want the default", m.sessionTTL)
+	}
+}
+
+func TestStartJanitorSweepsUntilCancelled(t *testing.T) {
+	m, advance := newClockedMemoryStore(t)
+	m.SetSessionTTL(time.Minute)
+	m.Append("s1", Message{Role: "user", Content: "hi"})
+	advance(2 * time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.StartJanitor(ctx, time.Millisecond)
+
+	sessions := func() int {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return len(m.touchedBySession)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sessions() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor never evicted the idle session")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	// Give a still-running janitor a chance to prove it wasn't stopped
+	time.Sleep(20 * time.Millisecond)
+	m.mu.Lock()
+	m.touchedBySession["s2"] = time.Time{}
+	m.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	if sessions() != 1 {
+		t.Error("janitor kept sweeping after its context was cancelled")
+	}
+}
@@ -1,46 +1,91 @@
 package store
 
 import (
+	"fmt"
 	"sync"
 	"time"
+
+	"zana-speech-backend/internal/github"
 )
 
 type Message struct {
-	Role    string
-	Content string
+	Role    string `json:"role"`
+	Content string `json:"content"`
 }
 
 type MemoryStore struct {
 	mu          sync.RWMutex
 	sessions    map[string][]Message
 	maxMessages int
+	// tokenBudget, when positive, trims history by estimated tokens instead of maxMessages
+	tokenBudget int
+	// Pinned system prompt per session, outside the trimmed history
+	systemPromptBySession map[string]string
 	// OAuth state mapping per session (for CSRF protection)
 	oauthStateBySession map[string]string
 	// Optional: username associated with session after auth
 	usernameBySession map[string]string
-	// Reverse mapping: state -> sessionID to resolve callbacks
-	sessionByOAuthState map[string]string
+	// Reverse mapping: state -> session and issue time, to resolve callbacks
+	sessionByOAuthState map[string]oauthStateEntry
 	// Last PRs cache for quick repo resolution by PR number
 	lastPRsBySession map[string]LastPRsCache
 	// Pending intent with partially filled slots
 	pendingBySession map[string]PendingIntent
+	// Last reviewed head SHA per session, keyed by "owner/repo#number"
+	reviewedSHABySession map[string]map[string]string
+	// PR the conversation is currently about, used when follow-ups omit it
+	focusBySession map[string]FocusedPR
+	// Full PR listings keyed by list kind ("mine", "review"), to spare GitHub's search API
+	cachedPRsBySession map[string]map[string]CachedPRs
+	// Last issue comment the session created, for undo
+	lastCommentBySession map[string]LastComment
+	// Destructive actions just performed, keyed by action, to suppress duplicates
+	recentActionsBySession map[string]map[string]time.Time
+	// Last write per session; the janitor evicts sessions idle beyond sessionTTL
+	touchedBySession map[string]time.Time
+	sessionTTL       time.Duration
+	// now is the clock used for TTLs; replaceable in tests
+	now func() time.Time
 }
 
 func NewMemoryStore(maxMessages int) *MemoryStore {
 	return &MemoryStore{
-		sessions:            make(map[string][]Message),
-		maxMessages:         maxMessages,
-		oauthStateBySession: make(map[string]string),
-		usernameBySession:   make(map[string]string),
-		sessionByOAuthState: make(map[string]string),
-		lastPRsBySession:    make(map[string]LastPRsCache),
-		pendingBySession:    make(map[string]PendingIntent),
+		sessions:             make(map[string][]Message),
+		maxMessages:          maxMessages,
+		oauthStateBySession:  make(map[string]string),
+		usernameBySession:    make(map[string]string),
+		sessionByOAuthState:  make(map[string]oauthStateEntry),
+		lastPRsBySession:     make(map[string]LastPRsCache),
+		pendingBySession:     make(map[string]PendingIntent),
+		reviewedSHABySession: make(map[string]map[string]string),
+		focusBySession:       make(map[string]FocusedPR),
+		cachedPRsBySession:   make(map[string]map[string]CachedPRs),
+		lastCommentBySession: make(map[string]LastComment),
+		touchedBySession:     make(map[string]time.Time),
+		sessionTTL:           defaultSessionTTL,
+		now:                  time.Now,
+
+		recentActionsBySession: make(map[string]map[string]time.Time),
+		systemPromptBySession:  make(map[string]string),
 	}
 }
 
+// touchLocked records activity for a session; callers must hold m.mu for writing.
+func (m *MemoryStore) touchLocked(sessionID string) {
+	m.touchedBySession[sessionID] = m.now()
+}
+
+func (m *MemoryStore) HasSession(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	touched, ok := m.touchedBySession[sessionID]
+	return ok && m.now().Sub(touched) <= m.sessionTTL
+}
+
 func (m *MemoryStore) Append(sessionID string, msg Message) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
 	m.sessions[sessionID] = append(m.sessions[sessionID], msg)
 	m.trimLocked(sessionID)
 }
@@ -57,15 +102,49 @@ func (m *MemoryStore) Get(sessionID string) []Message {
 func (m *MemoryStore) Set(sessionID string, msgs []Message) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
 	m.sessions[sessionID] = append([]Message(nil), msgs...)
 	m.trimLocked(sessionID)
 }
 
+// SetSystemPrompt pins prompt as the session's system message; "" clears it.
+func (m *MemoryStore) SetSystemPrompt(sessionID, prompt string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	if prompt == "" {
+		delete(m.systemPromptBySession, sessionID)
+		return
+	}
+	m.systemPromptBySession[sessionID] = prompt
+	m.trimLocked(sessionID)
+}
+
+// GetSystemPrompt returns the session's pinned system prompt, or "".
+func (m *MemoryStore) GetSystemPrompt(sessionID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.systemPromptBySession[sessionID]
+}
+
+// SetTokenBudget switches history trimming from a message count to an estimated
+// token budget that includes the pinned system prompt. Non-positive values restore
+// count-based trimming.
+func (m *MemoryStore) SetTokenBudget(budget int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokenBudget = budget
+}
+
 func (m *MemoryStore) trimLocked(sessionID string) {
+	msgs := m.sessions[sessionID]
+	if m.tokenBudget > 0 {
+		m.sessions[sessionID] = TrimToTokenBudget(msgs, m.tokenBudget, EstimateTokens(m.systemPromptBySession[sessionID]))
+		return
+	}
 	if m.maxMessages <= 0 {
 		return
 	}
-	msgs := m.sessions[sessionID]
 	if len(msgs) > m.maxMessages {
 		m.sessions[sessionID] = msgs[len(msgs)-m.maxMessages:]
 	}
@@ -73,17 +152,57 @@ func (m *MemoryStore) trimLocked(sessionID string) {
 
 // OAuth helpers
 
-func (m *MemoryStore) SetOAuthState(sessionID, state string) {
+// oauthStateEntry records which session an OAuth state was issued to, when, and
+// the PKCE code verifier the callback must present
+type oauthStateEntry struct {
+	SessionID string
+	Verifier  string
+	CreatedAt time.Time
+}
+
+// SetOAuthState issues state for a session, replacing any earlier one. verifier is
+// the flow's PKCE code verifier, handed back by ConsumeOAuthState.
+func (m *MemoryStore) SetOAuthState(sessionID, state, verifier string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	if old, ok := m.oauthStateBySession[sessionID]; ok {
+		delete(m.sessionByOAuthState, old)
+	}
 	m.oauthStateBySession[sessionID] = state
-	m.sessionByOAuthState[state] = sessionID
+	m.sessionByOAuthState[state] = oauthStateEntry{SessionID: sessionID, Verifier: verifier, CreatedAt: m.now()}
 }
 
+// GetOAuthState returns the session's outstanding state, or "" once it has expired.
 func (m *MemoryStore) GetOAuthState(sessionID string) string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.oauthStateBySession[sessionID]
+	st := m.oauthStateBySession[sessionID]
+	if e, ok := m.sessionByOAuthState[st]; !ok || m.now().Sub(e.CreatedAt) > oauthStateTTL {
+		return ""
+	}
+	return st
+}
+
+// ConsumeOAuthState redeems a callback's state: it returns the session the state
+// was issued to and its PKCE verifier, and deletes it so a state works at most once.
+// Unknown, expired or superseded states yield empty strings.
+func (m *MemoryStore) ConsumeOAuthState(state string) (string, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.sessionByOAuthState[state]
+	if !ok {
+		return "", ""
+	}
+	delete(m.sessionByOAuthState, state)
+	if m.oauthStateBySession[e.SessionID] != state {
+		return "", ""
+	}
+	delete(m.oauthStateBySession, e.SessionID)
+	if m.now().Sub(e.CreatedAt) > oauthStateTTL {
+		return "", ""
+	}
+	return e.SessionID, e.Verifier
 }
 
 func (m *MemoryStore) ClearOAuthState(sessionID string) {
@@ -98,6 +217,7 @@ func (m *MemoryStore) ClearOAuthState(sessionID string) {
 func (m *MemoryStore) SetUsername(sessionID, username string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
 	m.usernameBySession[sessionID] = username
 }
 
@@ -116,19 +236,38 @@ func (m *MemoryStore) ClearUsername(sessionID string) {
 func (m *MemoryStore) GetSessionByOAuthState(state string) string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.sessionByOAuthState[state]
+	e, ok := m.sessionByOAuthState[state]
+	if !ok || m.now().Sub(e.CreatedAt) > oauthStateTTL {
+		return ""
+	}
+	return e.SessionID
 }
 
 // Slot/PR cache TTLs
 var (
 	lastPRsTTL = 7 * time.Minute
 	pendingTTL = 7 * time.Minute
+	focusTTL   = 15 * time.Minute
+	// prListCacheTTL bounds how stale a cached PR listing may be
+	prListCacheTTL = 60 * time.Second
+	// lastCommentTTL is how long a created comment can still be undone by voice
+	lastCommentTTL = 15 * time.Minute
+	// actionDedupeTTL is how long a repeated destructive action is treated as a duplicate
+	actionDedupeTTL = 10 * time.Second
+	// oauthStateTTL is how long a user has to finish the GitHub OAuth flow
+	oauthStateTTL = 10 * time.Minute
+	// defaultSessionTTL is how long an idle session is kept before the janitor evicts it
+	defaultSessionTTL = 24 * time.Hour
 )
 
-// PRRef holds just enough to resolve a repo from a PR number
+// PRRef is one entry of the last PR listing: enough to resolve a PR from its number,
+// position or author, and to name it by title in clarifications
 type PRRef struct {
 	Number     int
 	Repository string
+	Title      string
+	Author     string
+	URL        string
 }
 
 type LastPRsCache struct {
@@ -136,6 +275,27 @@ type LastPRsCache struct {
 	UpdatedAt time.Time
 }
 
+// FocusedPR is the PR a session is currently talking about
+type FocusedPR struct {
+	Repository string
+	Number     int
+	UpdatedAt  time.Time
+}
+
+// LastComment identifies the most recent issue comment a session created
+type LastComment struct {
+	Repository string
+	PRNumber   int
+	ID         int64
+	CreatedAt  time.Time
+}
+
+// CachedPRs is a full PR listing with the time it was fetched
+type CachedPRs struct {
+	PRs       []github.PR
+	UpdatedAt time.Time
+}
+
 type PendingIntent struct {
 	Type      string
 	Args      map[string]any
@@ -146,7 +306,8 @@ type PendingIntent struct {
 func (m *MemoryStore) SetLastPRs(sessionID string, prs []PRRef) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.lastPRsBySession[sessionID] = LastPRsCache{PRs: append([]PRRef(nil), prs...), UpdatedAt: time.Now()}
+	m.touchLocked(sessionID)
+	m.lastPRsBySession[sessionID] = LastPRsCache{PRs: append([]PRRef(nil), prs...), UpdatedAt: m.now()}
 }
 
 // GetLastPRs returns cached PRs if within TTL.
@@ -157,7 +318,7 @@ func (m *MemoryStore) GetLastPRs(sessionID string) ([]PRRef, bool) {
 	if !ok {
 		return nil, false
 	}
-	if time.Since(cache.UpdatedAt) > lastPRsTTL {
+	if m.now().Sub(cache.UpdatedAt) > lastPRsTTL {
 		delete(m.lastPRsBySession, sessionID)
 		return nil, false
 	}
@@ -169,12 +330,13 @@ func (m *MemoryStore) GetLastPRs(sessionID string) ([]PRRef, bool) {
 func (m *MemoryStore) SetPendingIntent(sessionID, typ string, args map[string]any) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
 	// Copy args to avoid external mutation
 	copyArgs := make(map[string]any, len(args))
 	for k, v := range args {
 		copyArgs[k] = v
 	}
-	m.pendingBySession[sessionID] = PendingIntent{Type: typ, Args: copyArgs, UpdatedAt: time.Now()}
+	m.pendingBySession[sessionID] = PendingIntent{Type: typ, Args: copyArgs, UpdatedAt: m.now()}
 }
 
 // GetPendingIntent returns the pending intent if within TTL.
@@ -185,7 +347,7 @@ func (m *MemoryStore) GetPendingIntent(sessionID string) (string, map[string]any
 	if !ok {
 		return "", nil, false
 	}
-	if time.Since(p.UpdatedAt) > pendingTTL {
+	if m.now().Sub(p.UpdatedAt) > pendingTTL {
 		delete(m.pendingBySession, sessionID)
 		return "", nil, false
 	}
@@ -203,3 +365,151 @@ func (m *MemoryStore) ClearPendingIntent(sessionID string) {
 	defer m.mu.Unlock()
 	delete(m.pendingBySession, sessionID)
 }
+
+func reviewKey(repo string, prNumber int) string {
+	return fmt.Sprintf("%s#%d", repo, prNumber)
+}
+
+// SetReviewedSHA records the head SHA a session last reviewed for a PR.
+func (m *MemoryStore) SetReviewedSHA(sessionID, repo string, prNumber int, sha string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	byPR, ok := m.reviewedSHABySession[sessionID]
+	if !ok {
+		byPR = make(map[string]string)
+		m.reviewedSHABySession[sessionID] = byPR
+	}
+	byPR[reviewKey(repo, prNumber)] = sha
+}
+
+// GetReviewedSHA returns the head SHA last reviewed for a PR, or "" if none.
+func (m *MemoryStore) GetReviewedSHA(sessionID, repo string, prNumber int) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.reviewedSHABySession[sessionID][reviewKey(repo, prNumber)]
+}
+
+// SetFocusedPR makes repo#prNumber the session's current PR and refreshes its TTL.
+func (m *MemoryStore) SetFocusedPR(sessionID, repo string, prNumber int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	m.focusBySession[sessionID] = FocusedPR{Repository: repo, Number: prNumber, UpdatedAt: m.now()}
+}
+
+// GetFocusedPR returns the session's focused PR if within TTL.
+func (m *MemoryStore) GetFocusedPR(sessionID string) (FocusedPR, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.focusBySession[sessionID]
+	if !ok {
+		return FocusedPR{}, false
+	}
+	if m.now().Sub(f.UpdatedAt) > focusTTL {
+		delete(m.focusBySession, sessionID)
+		return FocusedPR{}, false
+	}
+	return f, true
+}
+
+// ClearFocusedPR drops the session's focused PR.
+func (m *MemoryStore) ClearFocusedPR(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.focusBySession, sessionID)
+}
+
+// SetCachedPRs stores a full PR listing of the given kind for a short window.
+func (m *MemoryStore) SetCachedPRs(sessionID, kind string, prs []github.PR) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	byKind, ok := m.cachedPRsBySession[sessionID]
+	if !ok {
+		byKind = make(map[string]CachedPRs)
+		m.cachedPRsBySession[sessionID] = byKind
+	}
+	byKind[kind] = CachedPRs{PRs: append([]github.PR(nil), prs...), UpdatedAt: m.now()}
+}
+
+// GetCachedPRs returns a cached PR listing if within TTL.
+func (m *MemoryStore) GetCachedPRs(sessionID, kind string) ([]github.PR, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.cachedPRsBySession[sessionID][kind]
+	if !ok {
+		return nil, false
+	}
+	if m.now().Sub(c.UpdatedAt) > prListCacheTTL {
+		delete(m.cachedPRsBySession[sessionID], kind)
+		return nil, false
+	}
+	return append([]github.PR(nil), c.PRs...), true
+}
+
+// ClearCachedPRs drops all cached listings for a session, e.g. after a merge changes them.
+func (m *MemoryStore) ClearCachedPRs(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cachedPRsBySession, sessionID)
+}
+
+// MarkActionDone records that a destructive action (e.g. "merge_pr:owner/repo#5") just
+// succeeded, so a retried or double-sent request can be recognized.
+func (m *MemoryStore) MarkActionDone(sessionID, action string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	byAction, ok := m.recentActionsBySession[sessionID]
+	if !ok {
+		byAction = make(map[string]time.Time)
+		m.recentActionsBySession[sessionID] = byAction
+	}
+	byAction[action] = m.now()
+}
+
+// RecentlyDone reports whether MarkActionDone was called for action within actionDedupeTTL.
+func (m *MemoryStore) RecentlyDone(sessionID, action string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	at, ok := m.recentActionsBySession[sessionID][action]
+	if !ok {
+		return false
+	}
+	if m.now().Sub(at) > actionDedupeTTL {
+		delete(m.recentActionsBySession[sessionID], action)
+		return false
+	}
+	return true
+}
+
+// SetLastComment remembers the comment the session just created so it can be undone.
+func (m *MemoryStore) SetLastComment(sessionID, repo string, prNumber int, commentID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touchLocked(sessionID)
+	m.lastCommentBySession[sessionID] = LastComment{Repository: repo, PRNumber: prNumber, ID: commentID, CreatedAt: m.now()}
+}
+
+// GetLastComment returns the session's last created comment if within TTL.
+func (m *MemoryStore) GetLastComment(sessionID string) (LastComment, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.lastCommentBySession[sessionID]
+	if !ok {
+		return LastComment{}, false
+	}
+	if m.now().Sub(c.CreatedAt) > lastCommentTTL {
+		delete(m.lastCommentBySession, sessionID)
+		return LastComment{}, false
+	}
+	return c, true
+}
+
+// ClearLastComment forgets the session's last created comment.
+func (m *MemoryStore) ClearLastComment(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.lastCommentBySession, sessionID)
+}
@@ -0,0 +1,59 @@
+package store
+
+import "zana-speech-backend/internal/github"
+
+// Store is the per-session state the server keeps between requests: chat
+// history, OAuth state, and conversational slots. MemoryStore serves a single
+// instance; RedisStore shares state across horizontally scaled replicas.
+type Store interface {
+	// HasSession reports whether state is kept for sessionID, i.e. the server has
+	// seen it and it hasn't expired. Client-supplied IDs can be checked with it.
+	HasSession(sessionID string) bool
+
+	// Chat history
+	Append(sessionID string, msg Message)
+	Get(sessionID string) []Message
+	Set(sessionID string, msgs []Message)
+	// The system prompt is kept apart from the history so trimming never evicts it
+	SetSystemPrompt(sessionID, prompt string)
+	GetSystemPrompt(sessionID string) string
+
+	// OAuth
+	SetOAuthState(sessionID, state, verifier string)
+	GetOAuthState(sessionID string) string
+	ClearOAuthState(sessionID string)
+	GetSessionByOAuthState(state string) string
+	// ConsumeOAuthState returns the session a still-valid state belongs to and its
+	// PKCE verifier, and invalidates it; empty for unknown, expired or used states
+	ConsumeOAuthState(state string) (sessionID, verifier string)
+	SetUsername(sessionID, username string)
+	GetUsername(sessionID string) string
+	ClearUsername(sessionID string)
+
+	// Conversational slots
+	SetLastPRs(sessionID string, prs []PRRef)
+	GetLastPRs(sessionID string) ([]PRRef, bool)
+	SetPendingIntent(sessionID, typ string, args map[string]any)
+	GetPendingIntent(sessionID string) (string, map[string]any, bool)
+	ClearPendingIntent(sessionID string)
+	SetReviewedSHA(sessionID, repo string, prNumber int, sha string)
+	GetReviewedSHA(sessionID, repo string, prNumber int) string
+	SetFocusedPR(sessionID, repo string, prNumber int)
+	GetFocusedPR(sessionID string) (FocusedPR, bool)
+	ClearFocusedPR(sessionID string)
+	SetCachedPRs(sessionID, kind string, prs []github.PR)
+	GetCachedPRs(sessionID, kind string) ([]github.PR, bool)
+	ClearCachedPRs(sessionID string)
+	SetLastComment(sessionID, repo string, prNumber int, commentID int64)
+	GetLastComment(sessionID string) (LastComment, bool)
+	ClearLastComment(sessionID string)
+
+	// Duplicate suppression for destructive actions
+	MarkActionDone(sessionID, action string)
+	RecentlyDone(sessionID, action string) bool
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*RedisStore)(nil)
+)
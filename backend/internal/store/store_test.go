@@ -0,0 +1,317 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"zana-speech-backend/internal/github"
+)
+
+const testMaxMessages = 3
+
+// storeImpl builds a fresh Store and a way to move its clock forward.
+type storeImpl struct {
+	name string
+	new  func(t *testing.T) (Store, func(time.Duration))
+}
+
+var storeImpls = []storeImpl{
+	{name: "memory", new: func(t *testing.T) (Store, func(time.Duration)) {
+		m := NewMemoryStore(testMaxMessages)
+		now := time.Now()
+		m.now = func() time.Time { return now }
+		return m, func(d time.Duration) { now = now.Add(d) }
+	}},
+	{name: "redis", new: func(t *testing.T) (Store, func(time.Duration)) {
+		mr := miniredis.RunT(t)
+		r, err := NewRedisStore("redis://"+mr.Addr(), testMaxMessages, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		// Redis enforces TTLs by expiring keys, which FastForward triggers
+		return r, mr.FastForward
+	}},
+}
+
+// TestStoreConformance runs the same behavioural checks against every Store
+// implementation so MemoryStore and RedisStore stay interchangeable.
+func TestStoreConformance(t *testing.T) {
+	for _, impl := range storeImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			for _, tc := range conformanceTests {
+				t.Run(tc.name, func(t *testing.T) {
+					s, advance := impl.new(t)
+					tc.run(t, s, advance)
+				})
+			}
+		})
+	}
+}
+
+var conformanceTests = []struct {
+	name string
+	run  func(t *testing.T, s Store, advance func(time.Duration))
+}{
+	{"history is trimmed to the newest messages", func(t *testing.T, s Store, _ func(time.Duration)) {
+		for _, c := range []string{"a", "b", "c", "d"} {
+			s.Append("s1", Message{Role: "user", Content: c})
+		}
+		got := s.Get("s1")
+		if len(got) != testMaxMessages || got[0].Content != "b" || got[2].Content != "d" {
+			t.Fatalf("history = %v, want b..d", got)
+		}
+		s.Set("s1", []Message{{Role: "assistant", Content: "x"}})
+		if got := s.Get("s1"); len(got) != 1 || got[0].Content != "x" {
+			t.Fatalf("after Set history = %v", got)
+		}
+		if got := s.Get("other"); len(got) != 0 {
+			t.Fatalf("unknown session history = %v", got)
+		}
+	}},
+	{"system prompt is kept apart and cleared by empty", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetSystemPrompt("s1", "be brief")
+		if got := s.GetSystemPrompt("s1"); got != "be brief" {
+			t.Fatalf("system prompt = %q", got)
+		}
+		s.SetSystemPrompt("s1", "")
+		if got := s.GetSystemPrompt("s1"); got != "" {
+			t.Fatalf("cleared system prompt = %q", got)
+		}
+	}},
+	{"system prompt survives trimming", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetSystemPrompt("s1", "be brief")
+		for _, c := range []string{"a", "b", "c", "d", "e"} {
+			s.Append("s1", Message{Role: "user", Content: c})
+		}
+		got := s.Get("s1")
+		if len(got) != testMaxMessages || got[0].Content != "c" {
+			t.Fatalf("history = %v, want c..e", got)
+		}
+		for _, m := range got {
+			if m.Role == "system" {
+				t.Fatalf("system prompt stored inline: %v", got)
+			}
+		}
+		if got := s.GetSystemPrompt("s1"); got != "be brief" {
+			t.Fatalf("system prompt after trimming = %q, want it pinned", got)
+		}
+	}},
+	{"has session once written to", func(t *testing.T, s Store, _ func(time.Duration)) {
+		if s.HasSession("s1") {
+			t.Fatal("unknown session reported as known")
+		}
+		s.Append("s1", Message{Role: "user", Content: "hi"})
+		s.SetUsername("s2", "alice")
+		if !s.HasSession("s1") || !s.HasSession("s2") {
+			t.Fatal("written sessions reported as unknown")
+		}
+	}},
+	{"oauth state is consumed once", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetOAuthState("s1", "state-1", "verifier-1")
+		if got := s.GetOAuthState("s1"); got != "state-1" {
+			t.Fatalf("GetOAuthState = %q", got)
+		}
+		if got := s.GetSessionByOAuthState("state-1"); got != "s1" {
+			t.Fatalf("GetSessionByOAuthState = %q", got)
+		}
+		sid, verifier := s.ConsumeOAuthState("state-1")
+		if sid != "s1" || verifier != "verifier-1" {
+			t.Fatalf("ConsumeOAuthState = %q, %q", sid, verifier)
+		}
+		if sid, verifier := s.ConsumeOAuthState("state-1"); sid != "" || verifier != "" {
+			t.Fatalf("second ConsumeOAuthState = %q, %q, want nothing", sid, verifier)
+		}
+		if sid, _ := s.ConsumeOAuthState("never-issued"); sid != "" {
+			t.Fatalf("unknown state consumed for %q", sid)
+		}
+	}},
+	{"superseded oauth state is refused", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetOAuthState("s1", "old", "v-old")
+		s.SetOAuthState("s1", "new", "v-new")
+		if sid, _ := s.ConsumeOAuthState("old"); sid != "" {
+			t.Fatalf("superseded state consumed for %q", sid)
+		}
+		if sid, verifier := s.ConsumeOAuthState("new"); sid != "s1" || verifier != "v-new" {
+			t.Fatalf("current state = %q, %q", sid, verifier)
+		}
+	}},
+	{"oauth state expires", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.SetOAuthState("s1", "state-1", "verifier-1")
+		advance(oauthStateTTL + time.Second)
+		if got := s.GetOAuthState("s1"); got != "" {
+			t.Fatalf("expired GetOAuthState = %q", got)
+		}
+		if sid, _ := s.ConsumeOAuthState("state-1"); sid != "" {
+			t.Fatalf("expired state consumed for %q", sid)
+		}
+	}},
+	{"cleared oauth state can't be consumed", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetOAuthState("s1", "state-1", "verifier-1")
+		s.ClearOAuthState("s1")
+		if sid, _ := s.ConsumeOAuthState("state-1"); sid != "" {
+			t.Fatalf("cleared state consumed for %q", sid)
+		}
+	}},
+	{"username", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetUsername("s1", "alice")
+		if got := s.GetUsername("s1"); got != "alice" {
+			t.Fatalf("username = %q", got)
+		}
+		s.ClearUsername("s1")
+		if got := s.GetUsername("s1"); got != "" {
+			t.Fatalf("cleared username = %q", got)
+		}
+	}},
+	{"pending intent round-trips and expires", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.SetPendingIntent("s1", "merge_pr", map[string]any{"repo": "acme/app", "pr_number": float64(5)})
+		typ, args, ok := s.GetPendingIntent("s1")
+		if !ok || typ != "merge_pr" || args["repo"] != "acme/app" || args["pr_number"] != float64(5) {
+			t.Fatalf("pending = %q %v %v", typ, args, ok)
+		}
+		advance(pendingTTL - time.Second)
+		if _, _, ok := s.GetPendingIntent("s1"); !ok {
+			t.Fatal("pending intent expired early")
+		}
+		advance(2 * time.Second)
+		if _, _, ok := s.GetPendingIntent("s1"); ok {
+			t.Fatal("pending intent outlived its TTL")
+		}
+	}},
+	{"pending intent is cleared", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetPendingIntent("s1", "close_pr", nil)
+		if _, args, ok := s.GetPendingIntent("s1"); !ok || args == nil {
+			t.Fatalf("pending with no args = %v, %v; want an empty map", args, ok)
+		}
+		s.ClearPendingIntent("s1")
+		if _, _, ok := s.GetPendingIntent("s1"); ok {
+			t.Fatal("cleared pending intent still there")
+		}
+	}},
+	{"last prs expire", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.SetLastPRs("s1", []PRRef{{Number: 5, Repository: "acme/app", Title: "Fix"}})
+		if got, ok := s.GetLastPRs("s1"); !ok || len(got) != 1 || got[0].Repository != "acme/app" {
+			t.Fatalf("last prs = %v, %v", got, ok)
+		}
+		advance(lastPRsTTL + time.Second)
+		if _, ok := s.GetLastPRs("s1"); ok {
+			t.Fatal("last prs outlived their TTL")
+		}
+	}},
+	{"last prs keep titles and authors", func(t *testing.T, s Store, _ func(time.Duration)) {
+		refs := []PRRef{
+			{Number: 5, Repository: "acme/app", Title: "Fix auth bug", Author: "alice", URL: "https://github.com/acme/app/pull/5"},
+			{Number: 9, Repository: "acme/api", Title: "Add cache", Author: "bob"},
+		}
+		s.SetLastPRs("s1", refs)
+		if got, ok := s.GetLastPRs("s1"); !ok || !reflect.DeepEqual(got, refs) {
+			t.Fatalf("last prs = %+v, %v, want %+v", got, ok, refs)
+		}
+	}},
+	{"focused pr expires and is cleared", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.SetFocusedPR("s1", "acme/app", 5)
+		if f, ok := s.GetFocusedPR("s1"); !ok || f.Repository != "acme/app" || f.Number != 5 {
+			t.Fatalf("focus = %v, %v", f, ok)
+		}
+		s.ClearFocusedPR("s1")
+		if _, ok := s.GetFocusedPR("s1"); ok {
+			t.Fatal("cleared focus still there")
+		}
+		s.SetFocusedPR("s1", "acme/app", 6)
+		advance(focusTTL + time.Second)
+		if _, ok := s.GetFocusedPR("s1"); ok {
+			t.Fatal("focus outlived its TTL")
+		}
+	}},
+	{"cached prs are kept per kind, cleared together and expire", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.SetCachedPRs("s1", "mine", []github.PR{{Number: 1, Repository: "acme/app"}})
+		s.SetCachedPRs("s1", "review", []github.PR{{Number: 2, Repository: "acme/app"}})
+		if got, ok := s.GetCachedPRs("s1", "review"); !ok || len(got) != 1 || got[0].Number != 2 {
+			t.Fatalf("cached review prs = %v, %v", got, ok)
+		}
+		s.ClearCachedPRs("s1")
+		if _, ok := s.GetCachedPRs("s1", "mine"); ok {
+			t.Fatal("cleared cache still there")
+		}
+		s.SetCachedPRs("s1", "mine", nil)
+		advance(prListCacheTTL + time.Second)
+		if _, ok := s.GetCachedPRs("s1", "mine"); ok {
+			t.Fatal("cached prs outlived their TTL")
+		}
+	}},
+	{"last comment expires", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.SetLastComment("s1", "acme/app", 5, 42)
+		if c, ok := s.GetLastComment("s1"); !ok || c.ID != 42 || c.PRNumber != 5 {
+			t.Fatalf("last comment = %v, %v", c, ok)
+		}
+		advance(lastCommentTTL + time.Second)
+		if _, ok := s.GetLastComment("s1"); ok {
+			t.Fatal("last comment outlived its TTL")
+		}
+	}},
+	{"reviewed sha is per pr", func(t *testing.T, s Store, _ func(time.Duration)) {
+		s.SetReviewedSHA("s1", "acme/app", 5, "abc")
+		if got := s.GetReviewedSHA("s1", "acme/app", 5); got != "abc" {
+			t.Fatalf("reviewed sha = %q", got)
+		}
+		if got := s.GetReviewedSHA("s1", "acme/app", 6); got != "" {
+			t.Fatalf("other pr's reviewed sha = %q", got)
+		}
+		if got := s.GetReviewedSHA("s2", "acme/app", 5); got != "" {
+			t.Fatalf("other session's reviewed sha = %q", got)
+		}
+		s.SetReviewedSHA("s1", "acme/app", 5, "def")
+		if got := s.GetReviewedSHA("s1", "acme/app", 5); got != "def" {
+			t.Fatalf("reviewed sha after a newer review = %q", got)
+		}
+	}},
+	{"actions are deduplicated briefly", func(t *testing.T, s Store, advance func(time.Duration)) {
+		s.MarkActionDone("s1", "merge_pr:acme/app#5")
+		if !s.RecentlyDone("s1", "merge_pr:acme/app#5") {
+			t.Fatal("action not recorded")
+		}
+		if s.RecentlyDone("s1", "merge_pr:acme/app#6") || s.RecentlyDone("s2", "merge_pr:acme/app#5") {
+			t.Fatal("dedupe leaked to another action or session")
+		}
+		advance(actionDedupeTTL + time.Second)
+		if s.RecentlyDone("s1", "merge_pr:acme/app#5") {
+			t.Fatal("action outlived the dedupe window")
+		}
+	}},
+}
+
+func TestRedisStoreActivityRenewsSessionKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r, err := NewRedisStore("redis://"+mr.Addr(), testMaxMessages, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	r.SetUsername("s1", "alice")
+	r.SetSystemPrompt("s1", "be brief")
+	r.SetReviewedSHA("s1", "acme/app", 5, "abc")
+	// Chatting every 40 minutes keeps everything past the first hour
+	for i := 0; i < 3; i++ {
+		mr.FastForward(40 * time.Minute)
+		r.Append("s1", Message{Role: "user", Content: "hi"})
+	}
+	if got := r.GetUsername("s1"); got != "alice" {
+		t.Errorf("username = %q after an active session outlived its first ttl", got)
+	}
+	if got := r.GetSystemPrompt("s1"); got != "be brief" {
+		t.Errorf("system prompt = %q after an active session outlived its first ttl", got)
+	}
+	if got := r.GetReviewedSHA("s1", "acme/app", 5); got != "abc" {
+		t.Errorf("reviewed sha = %q after an active session outlived its first ttl", got)
+	}
+
+	// An idle hour expires the whole session
+	mr.FastForward(time.Hour)
+	if r.HasSession("s1") || r.GetUsername("s1") != "" || r.GetSystemPrompt("s1") != "" {
+		t.Error("idle session outlived its ttl")
+	}
+}
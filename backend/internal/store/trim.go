@@ -0,0 +1,49 @@
+package store
+
+import "unicode/utf8"
+
+// messageOverheadTokens approximates the per-message framing (role, separators)
+// the model counts on top of the content.
+const messageOverheadTokens = 4
+
+// EstimateTokens approximates how many model tokens text takes, at roughly four
+// characters per token. It errs high for short strings so budgets stay safe.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// messageTokens is EstimateTokens for one history entry, framing included.
+func messageTokens(m Message) int {
+	return EstimateTokens(m.Content) + messageOverheadTokens
+}
+
+// TrimToTokenBudget drops the oldest messages until msgs, plus reserved tokens
+// spent elsewhere (the pinned system prompt), fit within budget. The most recent
+// user turn and everything after it are always kept, even over budget. A
+// non-positive budget returns msgs unchanged.
+func TrimToTokenBudget(msgs []Message, budget, reserved int) []Message {
+	if budget <= 0 || len(msgs) == 0 {
+		return msgs
+	}
+	keepFrom := len(msgs) - 1
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			keepFrom = i
+			break
+		}
+	}
+	used := reserved
+	for _, m := range msgs[keepFrom:] {
+		used += messageTokens(m)
+	}
+	start := keepFrom
+	for start > 0 {
+		cost := messageTokens(msgs[start-1])
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	return msgs[start:]
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		// Runes, not bytes
+		{"éééé", 1},
+	}
+	for _, tc := range tests {
+		if got := EstimateTokens(tc.text); got != tc.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tc.text, got, tc.want)
+		}
+	}
+}
+
+func contents(msgs []Message) []string {
+	out := []string{}
+	for _, m := range msgs {
+		out = append(out, m.Content)
+	}
+	return out
+}
+
+func TestTrimToTokenBudget(t *testing.T) {
+	// Each short message costs 1 token of content plus 4 of framing
+	short := func(role, c string) Message { return Message{Role: role, Content: c} }
+	long := Message{Role: "user", Content: strings.Repeat("x", 400)}
+	tests := []struct {
+		name     string
+		msgs     []Message
+		budget   int
+		reserved int
+		want     []string
+	}{
+		{name: "fits", msgs: []Message{short("user", "a"), short("assistant", "b")}, budget: 10, want: []string{"a", "b"}},
+		{name: "oldest dropped first", msgs: []Message{short("user", "a"), short("assistant", "b"), short("user", "c")}, budget: 10, want: []string{"b", "c"}},
+		{name: "reserved tokens count", msgs: []Message{short("user", "a"), short("assistant", "b"), short("user", "c")}, budget: 10, reserved: 1, want: []string{"c"}},
+		{name: "latest user turn kept over budget", msgs: []Message{short("user", "a"), long}, budget: 10, want: []string{strings.Repeat("x", 400)}},
+		{name: "replies after the latest user turn kept", msgs: []Message{short("user", "a"), long, short("assistant", "b")}, budget: 10, want: []string{strings.Repeat("x", 400), "b"}},
+		{name: "no budget", msgs: []Message{long, short("user", "a")}, budget: 0, want: []string{strings.Repeat("x", 400), "a"}},
+		{name: "empty", budget: 10, want: []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := contents(TrimToTokenBudget(tc.msgs, tc.budget, tc.reserved))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("kept %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestCountVsTokenTrimming feeds the same conversation to each store trimmed by
+// message count and by token budget: the count keeps a huge message and drops
+// useful short ones, the budget does the opposite.
+func TestCountVsTokenTrimming(t *testing.T) {
+	conversation := []Message{
+		{Role: "user", Content: strings.Repeat("x", 400)},
+		{Role: "assistant", Content: "ok"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "yo"},
+		{Role: "user", Content: "go"},
+	}
+	for _, impl := range storeImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			tests := []struct {
+				name   string
+				budget int
+				want   []string
+			}{
+				{name: "count", want: []string{"hi", "yo", "go"}},
+				// 30 tokens, 2 of them spent on the system prompt, fit the four short messages
+				{name: "tokens", budget: 30, want: []string{"ok", "hi", "yo", "go"}},
+			}
+			for _, tc := range tests {
+				t.Run(tc.name, func(t *testing.T) {
+					s, _ := impl.new(t)
+					if tc.budget > 0 {
+						s.(interface{ SetTokenBudget(int) }).SetTokenBudget(tc.budget)
+					}
+					s.SetSystemPrompt("s1", "be brief")
+					for _, m := range conversation {
+						s.Append("s1", m)
+					}
+					if got := contents(s.Get("s1")); !reflect.DeepEqual(got, tc.want) {
+						t.Errorf("kept %q, want %q", got, tc.want)
+					}
+				})
+			}
+		})
+	}
+}
@@ -23,3 +23,26 @@ type IntentResponse struct {
 	Type    string         `json:"type"`
 	Payload map[string]any `json:"payload,omitempty"`
 }
+
+// WSClientMessage is a JSON text frame sent by the client over /api/ws.
+// Type is "text" (Message holds the utterance), "audio_start" (discard any buffered
+// audio) or "audio_end" (transcribe the binary frames received since audio_start).
+type WSClientMessage struct {
+	Type     string `json:"type"`
+	Message  string `json:"message,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Language string `json:"language,omitempty"`
+	Prompt   string `json:"prompt,omitempty"`
+}
+
+// WSServerMessage is a JSON text frame pushed to the client over /api/ws.
+// Type is one of "ready", "transcript", "token", "intent", "done", "error" or
+// "notification".
+type WSServerMessage struct {
+	Type      string          `json:"type"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Text      string          `json:"text,omitempty"`
+	Reply     string          `json:"reply,omitempty"`
+	Intent    *IntentResponse `json:"intent,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
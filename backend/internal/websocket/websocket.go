@@ -0,0 +1,302 @@
+// Package websocket is a small server-side RFC 6455 implementation: the opening
+// handshake, masked client frames, fragmentation and the ping/pong/close control
+// frames. Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message opcodes.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	closeMessage  = 8
+	pingMessage   = 9
+	pongMessage   = 10
+	continuation  = 0
+)
+
+// Close status codes used by this package and its callers.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// handshakeGUID is appended to the client key to derive Sec-WebSocket-Accept.
+const handshakeGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// writeTimeout bounds every frame write so a stalled peer can't block a writer forever.
+const writeTimeout = 10 * time.Second
+
+var (
+	// ErrMessageTooBig is returned by ReadMessage when a message exceeds the read limit.
+	ErrMessageTooBig = errors.New("websocket: message too big")
+	errProtocol      = errors.New("websocket: protocol error")
+)
+
+// CloseError is returned by ReadMessage when the peer sends a close frame.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed by peer (%d %s)", e.Code, e.Reason)
+}
+
+// Conn is an upgraded WebSocket connection. One goroutine may read while others
+// write; writes are serialized internally.
+type Conn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	wmu       sync.Mutex
+	readLimit int64
+	onPong    func()
+	closeOnce sync.Once
+}
+
+// Upgrade completes the opening handshake and takes over the connection. Headers
+// already set on w (cookies, request IDs) are sent with the 101 response. On failure
+// an HTTP error has been written and the connection is left to net/http.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	netConn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	for name, values := range w.Header() {
+		for _, v := range values {
+			b.WriteString(name + ": " + v + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	_ = netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := netConn.Write([]byte(b.String())); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: write handshake: %w", err)
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	return &Conn{conn: netConn, br: brw.Reader, readLimit: 1 << 20}, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + handshakeGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetReadLimit caps the size of a single (possibly fragmented) message.
+func (c *Conn) SetReadLimit(n int64) { c.readLimit = n }
+
+// SetReadDeadline sets the deadline for the next ReadMessage call.
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+// SetPongHandler registers a callback run (on the reading goroutine) for each pong.
+func (c *Conn) SetPongHandler(f func()) { c.onPong = f }
+
+// ReadMessage returns the next text or binary message. Pings are answered and pongs
+// reported to the pong handler along the way. A close frame from the peer is echoed
+// and surfaced as *CloseError.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		msgType int
+		msg     []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.Close(CloseProtocolError, "")
+			}
+			return 0, nil, err
+		}
+		switch op {
+		case pingMessage:
+			if err := c.writeFrame(pongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongMessage:
+			if c.onPong != nil {
+				c.onPong()
+			}
+			continue
+		case closeMessage:
+			ce := &CloseError{Code: 1005}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			c.Close(CloseNormal, "")
+			return 0, nil, ce
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				c.Close(CloseProtocolError, "")
+				return 0, nil, errProtocol
+			}
+			msgType = op
+		case continuation:
+			if msgType == 0 {
+				c.Close(CloseProtocolError, "")
+				return 0, nil, errProtocol
+			}
+		default:
+			c.Close(CloseProtocolError, "")
+			return 0, nil, errProtocol
+		}
+		if int64(len(msg)+len(payload)) > c.readLimit {
+			c.Close(CloseMessageTooBig, "")
+			return 0, nil, ErrMessageTooBig
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msgType, msg, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame.
+func (c *Conn) readFrame() (fin bool, op int, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(c.br, hdr[:]); err != nil {
+		return
+	}
+	fin = hdr[0]&0x80 != 0
+	op = int(hdr[0] & 0x0f)
+	if hdr[0]&0x70 != 0 || hdr[1]&0x80 == 0 {
+		// Reserved bits without an extension, or an unmasked client frame
+		return false, 0, nil, errProtocol
+	}
+	n := int64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if op >= closeMessage && (n > 125 || !fin) {
+		return false, 0, nil, errProtocol
+	}
+	if n < 0 || n > c.readLimit {
+		c.Close(CloseMessageTooBig, "")
+		return false, 0, nil, ErrMessageTooBig
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends data as a single unfragmented text or binary message.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	return c.writeFrame(messageType, data)
+}
+
+// Ping sends a ping control frame; the peer's pong reaches the pong handler.
+func (c *Conn) Ping() error {
+	return c.writeFrame(pingMessage, nil)
+}
+
+func (c *Conn) writeFrame(op int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | byte(op)
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(hdr, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close sends a close frame with code and reason, then closes the connection. Only
+// the first call has any effect.
+func (c *Conn) Close(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+		_ = c.writeFrame(closeMessage, payload)
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,230 @@
+package websocket_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"zana-speech-backend/internal/websocket"
+	"zana-speech-backend/internal/websocket/wstest"
+)
+
+// echoServer upgrades every request and echoes each message back with its type,
+// answering pongs with a "pong" text message. The error that ends the read loop is
+// sent on the returned channel.
+func echoServer(t *testing.T, readLimit int64) (string, <-chan error) {
+	t.Helper()
+	done := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Session-Id", "sess-1")
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close(websocket.CloseNormal, "")
+		if readLimit > 0 {
+			conn.SetReadLimit(readLimit)
+		}
+		conn.SetPongHandler(func() {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+		})
+		for {
+			op, msg, err := conn.ReadMessage()
+			if err != nil {
+				done <- err
+				return
+			}
+			if err := conn.WriteMessage(op, msg); err != nil {
+				done <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, done
+}
+
+// readErr waits for the server's read loop to end.
+func readErr(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("server read loop didn't end")
+		return nil
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	url, _ := echoServer(t, 0)
+
+	// The sample handshake from RFC 6455 section 1.3
+	c := wstest.Dial(t, url, http.Header{"Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}})
+	if got := c.Response.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+	if got := c.Response.Header.Get("X-Session-Id"); got != "sess-1" {
+		t.Errorf("X-Session-Id = %q, want headers set before the upgrade sent along", got)
+	}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		wantCode int
+	}{
+		{name: "not an upgrade", header: http.Header{}, wantCode: http.StatusBadRequest},
+		{name: "old version", header: http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}, "Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}}, wantCode: http.StatusUpgradeRequired},
+		{name: "no key", header: http.Header{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}}, wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			req.Header = tc.header
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantCode)
+			}
+			if tc.wantCode == http.StatusUpgradeRequired && resp.Header.Get("Sec-WebSocket-Version") != "13" {
+				t.Errorf("426 without Sec-WebSocket-Version: 13")
+			}
+		})
+	}
+}
+
+func TestMessageLengths(t *testing.T) {
+	url, _ := echoServer(t, 0)
+	c := wstest.Dial(t, url, nil)
+	// One length per header encoding: 7-bit, 16-bit and 64-bit extended
+	for _, n := range []int{0, 125, 126, 0xffff, 0x10000 + 3} {
+		msg := bytes.Repeat([]byte("abcdefg"), n/7+1)[:n]
+		c.WriteFrame(true, wstest.OpBinary, msg)
+		fin, op, got := c.ReadFrame()
+		if !fin || op != wstest.OpBinary || !bytes.Equal(got, msg) {
+			t.Errorf("%d bytes: echoed fin %v, opcode %d, %d bytes", n, fin, op, len(got))
+		}
+	}
+}
+
+func TestFragmentedMessageWithInterleavedControlFrames(t *testing.T) {
+	url, _ := echoServer(t, 0)
+	c := wstest.Dial(t, url, nil)
+
+	c.WriteFrame(false, wstest.OpText, []byte("hel"))
+	c.WriteFrame(true, wstest.OpPing, []byte("are you there"))
+	if _, op, payload := c.ReadFrame(); op != wstest.OpPong || string(payload) != "are you there" {
+		t.Fatalf("got opcode %d %q, want the ping's payload in a pong", op, payload)
+	}
+	c.WriteFrame(false, wstest.OpContinuation, []byte("lo "))
+	c.WriteFrame(true, wstest.OpPong, nil)
+	if _, op, payload := c.ReadFrame(); op != wstest.OpText || string(payload) != "pong" {
+		t.Fatalf("got opcode %d %q, want the pong handler's message", op, payload)
+	}
+	c.WriteFrame(true, wstest.OpContinuation, []byte("world"))
+	if fin, op, payload := c.ReadFrame(); !fin || op != wstest.OpText || string(payload) != "hello world" {
+		t.Errorf("got fin %v, opcode %d %q, want the reassembled text message", fin, op, payload)
+	}
+}
+
+func TestServerPing(t *testing.T) {
+	pinged := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close(websocket.CloseNormal, "")
+		pinged <- conn.Ping()
+		_, _, _ = conn.ReadMessage()
+	}))
+	t.Cleanup(ts.Close)
+
+	c := wstest.Dial(t, ts.URL, nil)
+	if fin, op, payload := c.ReadFrame(); !fin || op != wstest.OpPing || len(payload) != 0 {
+		t.Errorf("got fin %v, opcode %d %q, want an empty ping", fin, op, payload)
+	}
+	if err := <-pinged; err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
+
+func TestPeerClose(t *testing.T) {
+	url, done := echoServer(t, 0)
+	c := wstest.Dial(t, url, nil)
+	c.WriteFrame(true, wstest.OpClose, append([]byte{0x03, 0xe9}, "bye"...))
+
+	if code, _ := c.ReadClose(); code != websocket.CloseNormal {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseNormal)
+	}
+	var ce *websocket.CloseError
+	if err := readErr(t, done); !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway || ce.Reason != "bye" {
+		t.Errorf("ReadMessage error = %v, want a CloseError with 1001 bye", err)
+	}
+}
+
+func TestProtocolViolationsClose(t *testing.T) {
+	tests := []struct {
+		name      string
+		readLimit int64
+		send      func(c *wstest.Conn)
+		wantCode  int
+	}{
+		{name: "unmasked client frame", send: func(c *wstest.Conn) {
+			c.WriteRawFrame(true, wstest.OpText, []byte("hi"), false)
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "reserved bits", send: func(c *wstest.Conn) {
+			c.WriteFrame(true, wstest.OpText|0x40, []byte("hi"))
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "unknown opcode", send: func(c *wstest.Conn) {
+			c.WriteFrame(true, 3, []byte("hi"))
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "continuation with nothing to continue", send: func(c *wstest.Conn) {
+			c.WriteFrame(true, wstest.OpContinuation, []byte("hi"))
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "new message inside a fragmented one", send: func(c *wstest.Conn) {
+			c.WriteFrame(false, wstest.OpText, []byte("hi"))
+			c.WriteFrame(true, wstest.OpText, []byte("there"))
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "fragmented control frame", send: func(c *wstest.Conn) {
+			c.WriteFrame(false, wstest.OpPing, []byte("hi"))
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "control frame over 125 bytes", send: func(c *wstest.Conn) {
+			c.WriteFrame(true, wstest.OpPing, bytes.Repeat([]byte("x"), 126))
+		}, wantCode: websocket.CloseProtocolError},
+		{name: "frame over the read limit", readLimit: 10, send: func(c *wstest.Conn) {
+			c.WriteFrame(true, wstest.OpBinary, bytes.Repeat([]byte("x"), 11))
+		}, wantCode: websocket.CloseMessageTooBig},
+		{name: "fragments over the read limit", readLimit: 10, send: func(c *wstest.Conn) {
+			c.WriteFrame(false, wstest.OpBinary, bytes.Repeat([]byte("x"), 6))
+			c.WriteFrame(true, wstest.OpContinuation, bytes.Repeat([]byte("x"), 6))
+		}, wantCode: websocket.CloseMessageTooBig},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			url, done := echoServer(t, tc.readLimit)
+			c := wstest.Dial(t, url, nil)
+			tc.send(c)
+			if code, _ := c.ReadClose(); code != tc.wantCode {
+				t.Errorf("close code = %d, want %d", code, tc.wantCode)
+			}
+			err := readErr(t, done)
+			if err == nil {
+				t.Fatal("ReadMessage returned no error")
+			}
+			if tooBig := errors.Is(err, websocket.ErrMessageTooBig); tooBig != (tc.wantCode == websocket.CloseMessageTooBig) {
+				t.Errorf("ReadMessage error = %v", err)
+			}
+			if tc.wantCode == websocket.CloseProtocolError && !strings.Contains(err.Error(), "protocol error") {
+				t.Errorf("ReadMessage error = %v, want a protocol error", err)
+			}
+		})
+	}
+}
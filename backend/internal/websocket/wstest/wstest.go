@@ -0,0 +1,227 @@
+// Package wstest provides a raw WebSocket client for tests of the websocket package
+// and the handlers built on it. It works frame by frame, so tests can also send what
+// a well-behaved client never would: unmasked frames, stray continuations, oversized
+// control frames.
+package wstest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Frame opcodes.
+const (
+	OpContinuation = 0
+	OpText         = 1
+	OpBinary       = 2
+	OpClose        = 8
+	OpPing         = 9
+	OpPong         = 10
+)
+
+// readTimeout bounds each ReadFrame so a server that never answers fails the test
+// instead of hanging it.
+const readTimeout = 5 * time.Second
+
+// Conn is the client end of a test WebSocket. Its methods fail the test on I/O errors.
+type Conn struct {
+	// Response is the server's 101 Switching Protocols response.
+	Response *http.Response
+
+	t    testing.TB
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// Dial opens a WebSocket to rawURL (http:// or ws://), sending header with the opening
+// handshake; a Sec-WebSocket-Key in header is used instead of a random one. The test
+// fails unless the server switches protocols with the matching Sec-WebSocket-Accept.
+// The connection is closed when the test ends.
+func Dial(t testing.TB, rawURL string, header http.Header) *Conn {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Scheme = "http"
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		var nonce [16]byte
+		_, _ = rand.Read(nonce[:])
+		key = base64.StdEncoding.EncodeToString(nonce[:])
+		req.Header.Set("Sec-WebSocket-Key", key)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if req.Header.Get("Sec-WebSocket-Version") == "" {
+		req.Header.Set("Sec-WebSocket-Version", "13")
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("handshake status = %d, want 101 (%s)", resp.StatusCode, b)
+	}
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	if got, want := resp.Header.Get("Sec-WebSocket-Accept"), base64.StdEncoding.EncodeToString(sum[:]); got != want {
+		t.Fatalf("Sec-WebSocket-Accept = %q, want %q", got, want)
+	}
+	return &Conn{Response: resp, t: t, conn: conn, br: br}
+}
+
+// WriteFrame sends one masked frame, as a client must.
+func (c *Conn) WriteFrame(fin bool, op int, payload []byte) {
+	c.t.Helper()
+	c.WriteRawFrame(fin, op, payload, true)
+}
+
+// WriteRawFrame sends one frame, masked with a random key when masked is set.
+func (c *Conn) WriteRawFrame(fin bool, op int, payload []byte, masked bool) {
+	c.t.Helper()
+	hdr := []byte{byte(op), 0}
+	if fin {
+		hdr[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	body := append([]byte(nil), payload...)
+	if masked {
+		hdr[1] |= 0x80
+		var mask [4]byte
+		_, _ = rand.Read(mask[:])
+		hdr = append(hdr, mask[:]...)
+		for i := range body {
+			body[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(hdr, body...)); err != nil {
+		c.t.Fatalf("write frame: %v", err)
+	}
+}
+
+// ReadFrame reads one frame from the server, failing the test if it is masked.
+func (c *Conn) ReadFrame() (fin bool, op int, payload []byte) {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		c.t.Fatalf("read frame: %v", err)
+	}
+	if hdr[1]&0x80 != 0 {
+		c.t.Fatal("server sent a masked frame")
+	}
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			c.t.Fatalf("read frame length: %v", err)
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			c.t.Fatalf("read frame length: %v", err)
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatalf("read frame payload: %v", err)
+	}
+	return hdr[0]&0x80 != 0, int(hdr[0] & 0x0f), payload
+}
+
+// ReadClose reads the next frame, failing the test unless it is a close frame, and
+// returns its status code and reason.
+func (c *Conn) ReadClose() (code int, reason string) {
+	c.t.Helper()
+	_, op, payload := c.ReadFrame()
+	if op != OpClose {
+		c.t.Fatalf("got opcode %d (%q), want a close frame", op, payload)
+	}
+	if len(payload) < 2 {
+		return 1005, ""
+	}
+	return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+}
+
+// WriteJSON sends v as a single text frame.
+func (c *Conn) WriteJSON(v any) {
+	c.t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.WriteFrame(true, OpText, b)
+}
+
+// ReadJSON reads the next frame, failing the test unless it is a complete text
+// frame, and decodes it into v.
+func (c *Conn) ReadJSON(v any) {
+	c.t.Helper()
+	fin, op, payload := c.ReadFrame()
+	if !fin || op != OpText {
+		c.t.Fatalf("got opcode %d (fin %v, %q), want a text frame", op, fin, payload)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		c.t.Fatalf("decode %q: %v", payload, err)
+	}
+}
+
+// Close closes the connection without a closing handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ExpectNothing fails the test if the server sends anything within d.
+func (c *Conn) ExpectNothing(d time.Duration) {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(d))
+	b, err := c.br.Peek(1)
+	if err == nil {
+		c.t.Fatalf("unexpected frame starting %#x", b[0])
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		c.t.Fatalf("read: %v, want a timeout", err)
+	}
+}